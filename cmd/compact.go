@@ -42,6 +42,8 @@ func NewCompactCommand(ctx context.Context) *cobra.Command {
 			if err != nil {
 				return
 			}
+			stopEvents := startEventsEmitter(ctx, opts.eventsConfig)
+			defer stopEvents()
 
 			var clientSet client.Client
 			if opts.compactorConfig.EnabledLeaseRenewal {
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/gardener/etcd-backup-restore/pkg/compressor"
+	"github.com/gardener/etcd-backup-restore/pkg/snapshot/snapshotter"
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// NewGarbageCollectCommand creates a cobra command for garbage collecting the backups once.
+func NewGarbageCollectCommand(ctx context.Context) *cobra.Command {
+	opts := newGCOptions()
+	var command = &cobra.Command{
+		Use:   "gc",
+		Short: "garbage collects old backups once",
+		Long: `Garbage collects the backups in the snapstore once, according to the configured garbage collection policies.
+The decision about each snapshot is printed along with its reason. With --dry-run, no snapshot is deleted.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			printVersionInfo()
+			if err := opts.validate(); err != nil {
+				logger.Fatalf("failed to validate the options: %v", err)
+			}
+			opts.complete()
+			stopEvents := startEventsEmitter(ctx, opts.eventsConfig)
+			defer stopEvents()
+
+			store, err := snapstore.GetSnapstore(opts.snapstoreConfig)
+			if err != nil {
+				logger.Fatalf("failed to create snapstore from configured storage provider: %v", err)
+			}
+			ssr, err := snapshotter.NewSnapshotter(logrus.NewEntry(logger), opts.snapshotterConfig, store, brtypes.NewEtcdConnectionConfig(), compressor.NewCompressorConfig(), brtypes.NewHealthConfig(), opts.snapstoreConfig)
+			if err != nil {
+				logger.Fatalf("failed to create snapshotter: %v", err)
+			}
+
+			plan, err := ssr.PlanGarbageCollection(store)
+			if err != nil {
+				logger.Fatalf("failed to plan garbage collection: %v", err)
+			}
+			if err := printGarbageCollectionPlan(os.Stdout, plan, opts.output); err != nil {
+				logger.Fatalf("failed to print garbage collection plan: %v", err)
+			}
+			if opts.dryRun {
+				logger.Infof("Dry run: %d snapshots would be garbage collected.", len(plan.Deleted()))
+				return
+			}
+
+			chunksDeleted, snapshotsDeleted := ssr.ApplyGarbageCollectionPlan(plan)
+			if planned := len(plan.Deleted()); chunksDeleted+snapshotsDeleted < planned {
+				logger.Fatalf("failed to garbage collect %d of %d snapshots", planned-chunksDeleted-snapshotsDeleted, planned)
+			}
+		},
+	}
+	opts.addFlags(command.Flags())
+	return command
+}
+
+// printGarbageCollectionPlan writes the given plan to w in the given output format.
+func printGarbageCollectionPlan(w io.Writer, plan *snapshotter.GarbageCollectionPlan, output string) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tKIND\tSNAPSHOT\tCREATED\tSIZE\tREASON")
+	for _, decision := range plan.Decisions {
+		snap := decision.Snapshot
+		kind := snap.Kind
+		if snap.IsChunk {
+			kind = brtypes.SnapshotKindChunk
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", decision.Action, kind, path.Join(snap.SnapDir, snap.SnapName), snap.CreatedOn.UTC().Format("2006-01-02T15:04:05Z"), snap.Size, decision.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(w, "WARNING: %s\n", warning)
+	}
+	return nil
+}
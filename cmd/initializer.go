@@ -63,7 +63,7 @@ func NewInitializeCommand(ctx context.Context) *cobra.Command {
 			if err != nil {
 				logger.Fatalf("failed to create initializer object: %v", err)
 			}
-			if err := etcdInitializer.Initialize(mode, opts.validatorOptions.FailBelowRevision); err != nil {
+			if err := etcdInitializer.Initialize(mode, opts.validatorOptions.FailBelowRevision, nil); err != nil {
 				logger.Fatalf("initializer failed. %v", err)
 			}
 		},
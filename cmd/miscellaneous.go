@@ -5,13 +5,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"runtime"
+	"sync"
 
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 	ver "github.com/gardener/etcd-backup-restore/pkg/version"
+	"github.com/sirupsen/logrus"
 	"go.etcd.io/etcd/pkg/types"
 )
 
@@ -22,6 +26,28 @@ func printVersionInfo() {
 	logger.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
 }
 
+// startEventsEmitter starts the delivery of the backup lifecycle events of a command to the sinks of the given
+// config, if any. The returned function waits till the emitted events are delivered, until the given context is
+// cancelled. It is also run when the command exits on a fatal error, so that failure events are not lost.
+func startEventsEmitter(ctx context.Context, config *brtypes.EventsConfig) func() {
+	emitter := events.NewEmitter(config, logrus.NewEntry(logger))
+	if emitter == nil {
+		return func() {}
+	}
+	events.SetDefault(emitter)
+	go emitter.Run(ctx)
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			events.SetDefault(nil)
+			emitter.Close(ctx)
+		})
+	}
+	logrus.RegisterExitHandler(stop)
+	return stop
+}
+
 // BuildRestoreOptionsAndStore forms the RestoreOptions and Store object
 func BuildRestoreOptionsAndStore(opts *restorerOptions) (*brtypes.RestoreOptions, brtypes.SnapStore, error) {
 	if err := opts.validate(); err != nil {
@@ -41,15 +67,24 @@ func BuildRestoreOptionsAndStore(opts *restorerOptions) (*brtypes.RestoreOptions
 		logger.Fatalf("failed parsing peers urls for restore cluster: %v", err)
 	}
 
-	store, err := snapstore.GetSnapstore(opts.snapstoreConfig)
-	if err != nil {
-		logger.Fatalf("failed to create restore snapstore from configured storage provider: %v", err)
+	var store brtypes.SnapStore
+	if len(opts.snapshotFiles) > 0 {
+		store, err = snapstore.NewFilesSnapStore(opts.snapshotFiles)
+		if err != nil {
+			logger.Fatalf("failed to create restore snapstore from snapshot files: %v", err)
+		}
+	} else {
+		store, err = snapstore.GetSnapstore(opts.snapstoreConfig)
+		if err != nil {
+			logger.Fatalf("failed to create restore snapstore from configured storage provider: %v", err)
+		}
 	}
 
-	logger.Info("Finding latest set of snapshot to recover from...")
-	baseSnap, deltaSnapList, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+	target := opts.restorationConfig.RestoreTarget()
+	logger.Infof("Finding set of snapshot to recover from the %s up to the %s...", opts.restorationConfig.SnapshotSelector, target)
+	baseSnap, deltaSnapList, err := miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, opts.restorationConfig.SnapshotSelector, target)
 	if err != nil {
-		logger.Fatalf("failed to get latest snapshot: %v", err)
+		logger.Fatalf("failed to get snapshots to recover from: %v", err)
 	}
 
 	if baseSnap == nil {
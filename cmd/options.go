@@ -7,7 +7,9 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/gardener/etcd-backup-restore/pkg/compressor"
 
@@ -134,6 +136,7 @@ func newCompactOptions() *compactOptions {
 		restorerOptions: &restorerOptions{
 			restorationConfig: brtypes.NewRestorationConfig(),
 			snapstoreConfig:   snapstore.NewSnapstoreConfig(),
+			eventsConfig:      brtypes.NewEventsConfig(),
 		},
 		compactorConfig: brtypes.NewCompactorConfig(),
 	}
@@ -144,6 +147,7 @@ func (c *compactOptions) addFlags(fs *flag.FlagSet) {
 	c.restorationConfig.AddFlags(fs)
 	c.snapstoreConfig.AddFlags(fs)
 	c.compactorConfig.AddFlags(fs)
+	c.eventsConfig.AddFlags(fs)
 }
 
 // Validate validates the config.
@@ -154,6 +158,9 @@ func (c *compactOptions) validate() error {
 type restorerOptions struct {
 	restorationConfig *brtypes.RestorationConfig
 	snapstoreConfig   *brtypes.SnapstoreConfig
+	eventsConfig      *brtypes.EventsConfig
+	// snapshotFiles are the snapshot files and directories of snapshot files to restore from instead of the snapstore.
+	snapshotFiles []string
 }
 
 // newRestorerOptions returns the validation config.
@@ -161,6 +168,7 @@ func newRestorerOptions() *restorerOptions {
 	return &restorerOptions{
 		restorationConfig: brtypes.NewRestorationConfig(),
 		snapstoreConfig:   snapstore.NewSnapstoreConfig(),
+		eventsConfig:      brtypes.NewEventsConfig(),
 	}
 }
 
@@ -168,6 +176,7 @@ func newRestorerOptions() *restorerOptions {
 func (c *restorerOptions) addFlags(fs *flag.FlagSet) {
 	c.restorationConfig.AddFlags(fs)
 	c.snapstoreConfig.AddFlags(fs)
+	c.eventsConfig.AddFlags(fs)
 }
 
 // Validate validates the config.
@@ -175,6 +184,9 @@ func (c *restorerOptions) validate() error {
 	if err := c.snapstoreConfig.Validate(); err != nil {
 		return err
 	}
+	if err := c.eventsConfig.Validate(); err != nil {
+		return err
+	}
 
 	return c.restorationConfig.Validate()
 }
@@ -317,3 +329,165 @@ func (c *copierOptions) complete() {
 	c.snapstoreConfig.Complete()
 	c.sourceSnapStoreConfig.MergeWith(c.snapstoreConfig)
 }
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type gcOptions struct {
+	snapstoreConfig   *brtypes.SnapstoreConfig
+	snapshotterConfig *brtypes.SnapshotterConfig
+	eventsConfig      *brtypes.EventsConfig
+	dryRun            bool
+	output            string
+}
+
+// newGCOptions returns the garbage collection options.
+func newGCOptions() *gcOptions {
+	return &gcOptions{
+		snapstoreConfig:   snapstore.NewSnapstoreConfig(),
+		snapshotterConfig: snapshotter.NewSnapshotterConfig(),
+		eventsConfig:      brtypes.NewEventsConfig(),
+		output:            outputText,
+	}
+}
+
+// AddFlags adds the flags to flagset.
+func (c *gcOptions) addFlags(fs *flag.FlagSet) {
+	c.snapstoreConfig.AddFlags(fs)
+	c.snapshotterConfig.AddGarbageCollectionFlags(fs)
+	c.eventsConfig.AddFlags(fs)
+	fs.BoolVar(&c.dryRun, "dry-run", c.dryRun, "only print the decisions of the garbage collector without deleting any snapshot")
+	fs.StringVarP(&c.output, "output", "o", c.output, "output format of the garbage collection plan: text or json")
+}
+
+// Validate validates the config.
+func (c *gcOptions) validate() error {
+	if c.output != outputText && c.output != outputJSON {
+		return fmt.Errorf("invalid output format: %s", c.output)
+	}
+	if err := c.snapstoreConfig.Validate(); err != nil {
+		return err
+	}
+	if err := c.eventsConfig.Validate(); err != nil {
+		return err
+	}
+	return c.snapshotterConfig.Validate()
+}
+
+// complete completes the config.
+func (c *gcOptions) complete() {
+	c.snapstoreConfig.Complete()
+}
+
+type pinOptions struct {
+	snapstoreConfig *brtypes.SnapstoreConfig
+	reason          string
+	ttl             wrappers.Duration
+}
+
+// newPinOptions returns the snapshot pin options.
+func newPinOptions() *pinOptions {
+	return &pinOptions{
+		snapstoreConfig: snapstore.NewSnapstoreConfig(),
+	}
+}
+
+// addFlags adds the flags of the snapstore to flagset.
+func (c *pinOptions) addFlags(fs *flag.FlagSet) {
+	c.snapstoreConfig.AddFlags(fs)
+}
+
+// addPinFlags adds the flags of a new pin to flagset.
+func (c *pinOptions) addPinFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.reason, "reason", c.reason, "reason for pinning the snapshot")
+	fs.DurationVar(&c.ttl.Duration, "ttl", c.ttl.Duration, "duration after which the pin expires. If set to 0, the pin never expires.")
+}
+
+// validate validates the config.
+func (c *pinOptions) validate() error {
+	if c.ttl.Duration < 0 {
+		return errors.New("parameter ttl must not be less than 0")
+	}
+	return c.snapstoreConfig.Validate()
+}
+
+// complete completes the config.
+func (c *pinOptions) complete() {
+	c.snapstoreConfig.Complete()
+}
+
+type restoreKeysOptions struct {
+	*restorerOptions
+	etcdConnectionConfig *brtypes.EtcdConnectionConfig
+	keyRestorerConfig    *brtypes.KeyRestorerConfig
+	output               string
+}
+
+// newRestoreKeysOptions returns the key restoration options.
+func newRestoreKeysOptions() *restoreKeysOptions {
+	restorerOptions := newRestorerOptions()
+	// The data directory only holds the temporary embedded etcd the backup is restored into.
+	restorerOptions.restorationConfig.DataDir = filepath.Join(os.TempDir(), "etcd-key-restore.etcd")
+	return &restoreKeysOptions{
+		restorerOptions:      restorerOptions,
+		etcdConnectionConfig: brtypes.NewEtcdConnectionConfig(),
+		keyRestorerConfig:    brtypes.NewKeyRestorerConfig(),
+		output:               outputText,
+	}
+}
+
+// AddFlags adds the flags to flagset.
+func (c *restoreKeysOptions) addFlags(fs *flag.FlagSet) {
+	c.restorerOptions.addFlags(fs)
+	c.etcdConnectionConfig.AddFlags(fs)
+	c.keyRestorerConfig.AddFlags(fs)
+	fs.StringVarP(&c.output, "output", "o", c.output, "output format of the differences between the backup and the etcd cluster: text or json")
+}
+
+// Validate validates the config.
+func (c *restoreKeysOptions) validate() error {
+	if c.output != outputText && c.output != outputJSON {
+		return fmt.Errorf("invalid output format: %s", c.output)
+	}
+	if err := c.etcdConnectionConfig.Validate(); err != nil {
+		return err
+	}
+	return c.keyRestorerConfig.Validate()
+}
+
+type restoreOptions struct {
+	*restorerOptions
+	plan       bool
+	output     string
+	allMembers bool
+}
+
+// newRestoreOptions returns the restoration options.
+func newRestoreOptions() *restoreOptions {
+	return &restoreOptions{
+		restorerOptions: newRestorerOptions(),
+		output:          outputText,
+	}
+}
+
+// AddFlags adds the flags to flagset.
+func (c *restoreOptions) addFlags(fs *flag.FlagSet) {
+	c.restorerOptions.addFlags(fs)
+	fs.BoolVar(&c.plan, "plan", c.plan, "only print the plan of the restoration, without touching the data directory")
+	fs.StringVarP(&c.output, "output", "o", c.output, "output format of the restoration plan: text or json")
+	fs.BoolVar(&c.allMembers, "all-members", c.allMembers, "restore the data directories of all members of the initial cluster, each into the sub directory of the data directory named after the member")
+	fs.StringSliceVar(&c.snapshotFiles, "snapshot-files", c.snapshotFiles, "comma separated list of snapshot files and directories of snapshot files on local disk to restore from, instead of the snapstore")
+}
+
+// Validate validates the config.
+func (c *restoreOptions) validate() error {
+	if c.output != outputText && c.output != outputJSON {
+		return fmt.Errorf("invalid output format: %s", c.output)
+	}
+	if len(c.snapshotFiles) > 0 && c.snapstoreConfig.Provider != "" {
+		return fmt.Errorf("snapshot files cannot be restored from along with a storage provider")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/spf13/cobra"
+)
+
+// NewPinCommand creates a cobra command for managing the pins which protect snapshots from garbage collection.
+func NewPinCommand(ctx context.Context) *cobra.Command {
+	opts := newPinOptions()
+	var command = &cobra.Command{
+		Use:   "pin",
+		Short: "manages the pins of snapshots",
+		Long: `Pins protect snapshots from garbage collection, until they expire or are removed.
+A pin is stored in the snapstore alongside the snapshot.`,
+	}
+	opts.addFlags(command.PersistentFlags())
+
+	var addCommand = &cobra.Command{
+		Use:   "add SNAPSHOT",
+		Short: "pins a snapshot",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			store := opts.getSnapstore()
+			snap := getSnapshot(store, args[0])
+			pin := brtypes.NewSnapshotPin(opts.reason, opts.ttl.Duration, time.Now())
+			if err := snapstore.PinSnapshot(store, *snap, pin); err != nil {
+				logger.Fatalf("failed to pin snapshot: %v", err)
+			}
+			logger.Infof("Snapshot %s %s", snap.SnapName, pin)
+		},
+	}
+	opts.addPinFlags(addCommand.Flags())
+
+	var removeCommand = &cobra.Command{
+		Use:   "remove SNAPSHOT",
+		Short: "unpins a snapshot",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			store := opts.getSnapstore()
+			snap := getSnapshot(store, args[0])
+			if err := snapstore.UnpinSnapshot(store, *snap); err != nil {
+				logger.Fatalf("failed to unpin snapshot: %v", err)
+			}
+			logger.Infof("Snapshot %s unpinned", snap.SnapName)
+		},
+	}
+
+	var listCommand = &cobra.Command{
+		Use:   "list",
+		Short: "lists the pinned snapshots",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pinned, err := snapstore.ListSnapshotPins(opts.getSnapstore())
+			if err != nil {
+				logger.Fatalf("failed to list snapshot pins: %v", err)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "SNAPSHOT\tPINNED\tEXPIRES\tREASON")
+			for _, p := range pinned {
+				expiresOn := "never"
+				if p.Pin.ExpiresOn != nil {
+					expiresOn = p.Pin.ExpiresOn.UTC().Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", path.Join(p.Snapshot.SnapDir, p.Snapshot.SnapName), p.Pin.CreatedOn.UTC().Format(time.RFC3339), expiresOn, p.Pin.Reason)
+			}
+			if err := tw.Flush(); err != nil {
+				logger.Fatalf("failed to print snapshot pins: %v", err)
+			}
+		},
+	}
+
+	command.AddCommand(addCommand, removeCommand, listCommand)
+	return command
+}
+
+// getSnapstore validates the options and returns the configured snapstore.
+func (c *pinOptions) getSnapstore() brtypes.SnapStore {
+	if err := c.validate(); err != nil {
+		logger.Fatalf("failed to validate the options: %v", err)
+	}
+	c.complete()
+	store, err := snapstore.GetSnapstore(c.snapstoreConfig)
+	if err != nil {
+		logger.Fatalf("failed to create snapstore from configured storage provider: %v", err)
+	}
+	return store
+}
+
+// getSnapshot returns the snapshot with the given name in the given store.
+func getSnapshot(store brtypes.SnapStore, snapName string) *brtypes.Snapshot {
+	snapList, err := store.List()
+	if err != nil {
+		logger.Fatalf("failed to list snapshots: %v", err)
+	}
+	snap := snapstore.FindSnapshot(snapList, snapName)
+	if snap == nil {
+		logger.Fatalf("snapshot %s not found in snapstore", snapName)
+	}
+	return snap
+}
@@ -6,20 +6,31 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
 
 	"github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 // NewRestoreCommand returns the command to restore
 func NewRestoreCommand(ctx context.Context) *cobra.Command {
-	opts := newRestorerOptions()
+	opts := newRestoreOptions()
 	// restoreCmd represents the restore command
 	restoreCmd := &cobra.Command{
 		Use:   "restore",
 		Short: "restores an etcd member data directory from snapshots",
-		Long:  "Restores an etcd member data directory from existing backup stored in snapshot store.",
+		Long: `Restores an etcd member data directory from existing backup stored in snapshot store.
+With --plan, the snapshots the restoration would apply are printed and checked for gaps in their revisions, without touching the data directory.
+With --all-members, the data directories of all members of the initial cluster are restored from a single download of the snapshots.
+With --snapshot-files, the snapshot files and directories of snapshot files on local disk are restored from, instead of the snapstore.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			/* Restore operation
 			- Find the latest snapshot.
@@ -27,15 +38,44 @@ func NewRestoreCommand(ctx context.Context) *cobra.Command {
 			*/
 			logger := logrus.New()
 
-			options, store, err := BuildRestoreOptionsAndStore(opts)
+			if err := opts.validate(); err != nil {
+				logger.Fatalf("failed to validate the options: %v", err)
+			}
+
+			options, store, err := BuildRestoreOptionsAndStore(opts.restorerOptions)
 			if err != nil {
 				return
 			}
+			stopEvents := startEventsEmitter(ctx, opts.eventsConfig)
+			defer stopEvents()
+
+			if opts.plan {
+				plan := restorer.NewRestorePlan(*options)
+				if err := printRestorePlan(os.Stdout, plan, opts.output); err != nil {
+					logger.Fatalf("failed to print restoration plan: %v", err)
+				}
+				if !plan.IsContinuous() {
+					logger.Fatalf("found %d gaps in the revisions of the snapshots to restore", len(plan.Gaps))
+				}
+				return
+			}
 
 			rs, err := restorer.NewRestorer(store, logrus.NewEntry(logger))
 			if err != nil {
 				logger.Fatalf("failed to create restorer object: %v", err)
 			}
+			if opts.allMembers {
+				// A fresh cluster token gives the restored cluster a new cluster ID, unless the token is set explicitly.
+				if !cmd.Flags().Changed("initial-cluster-token") {
+					options.Config.InitialClusterToken = uuid.New().String()
+				}
+				dataDirs, err := rs.RestoreMembers(*options)
+				if err != nil {
+					logger.Fatalf("Failed to restore the data directories of the members: %v", err)
+				}
+				logger.Infof("Successfully restored the data directories of %d members with the initial cluster token %s.", len(dataDirs), options.Config.InitialClusterToken)
+				return
+			}
 			if err := rs.RestoreAndStopEtcd(*options, nil); err != nil {
 				logger.Fatalf("Failed to restore snapshot: %v", err)
 				return
@@ -47,3 +87,27 @@ func NewRestoreCommand(ctx context.Context) *cobra.Command {
 	opts.addFlags(restoreCmd.Flags())
 	return restoreCmd
 }
+
+// printRestorePlan writes the given plan to w in the given output format.
+func printRestorePlan(w io.Writer, plan *restorer.RestorePlan, output string) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tSNAPSHOT\tSTART REVISION\tLAST REVISION\tCREATED\tSIZE")
+	for _, snap := range append(brtypes.SnapList{plan.BaseSnapshot}, plan.DeltaSnapshots...) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%d\n", snap.Kind, path.Join(snap.SnapDir, snap.SnapName), snap.StartRevision, snap.LastRevision, snap.CreatedOn.UTC().Format("2006-01-02T15:04:05Z"), snap.Size)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Restoring from the %s up to the %s: %d delta snapshots, %d bytes to download, up to revision %d.\n",
+		plan.SnapshotSelector, plan.Target, len(plan.DeltaSnapshots), plan.TotalBytes, plan.Revision)
+	for _, gap := range plan.Gaps {
+		fmt.Fprintf(w, "GAP: delta snapshot %s starts at revision %d, but %s ends at revision %d.\n", gap.Snapshot, gap.StartRevision, gap.Previous, gap.ExpectedStartRevision-1)
+	}
+	return nil
+}
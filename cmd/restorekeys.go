@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/keyrestorer"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// NewRestoreKeysCommand returns the command to restore the keys under some prefixes into a live etcd cluster.
+func NewRestoreKeysCommand(ctx context.Context) *cobra.Command {
+	opts := newRestoreKeysOptions()
+	// restoreKeysCmd represents the restore-keys command
+	restoreKeysCmd := &cobra.Command{
+		Use:   "restore-keys",
+		Short: "restores the keys under some prefixes from snapshots into a live etcd cluster",
+		Long: `Restores the backup stored in snapshot store into a temporary embedded etcd, and copies the keys under the given prefixes from it into the live etcd cluster.
+The differences between the backup and the etcd cluster are printed along with the action on each key. With --dry-run, the etcd cluster is not changed.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			/* Restore keys operation
+			- Restore the backup into a temporary embedded etcd.
+			- Compare the keys under the prefixes with the etcd cluster.
+			- Put the keys selected by the conflict policy into the etcd cluster.
+			*/
+			if err := opts.validate(); err != nil {
+				logger.Fatalf("failed to validate the options: %v", err)
+			}
+
+			options, store, err := BuildRestoreOptionsAndStore(opts.restorerOptions)
+			if err != nil {
+				return
+			}
+			stopEvents := startEventsEmitter(ctx, opts.eventsConfig)
+			defer stopEvents()
+
+			clientKV, err := etcdutil.NewFactory(*opts.etcdConnectionConfig).NewKV()
+			if err != nil {
+				logger.Fatalf("failed to create etcd KV client: %v", err)
+			}
+			defer clientKV.Close()
+
+			kr := keyrestorer.NewKeyRestorer(store, logrus.NewEntry(logger))
+			result, err := kr.RestoreKeys(ctx, &brtypes.KeyRestoreOptions{
+				RestoreOptions:    options,
+				KeyRestorerConfig: opts.keyRestorerConfig,
+			}, clientKV)
+			if result != nil {
+				if err := printKeyRestoreResult(os.Stdout, result, opts.output); err != nil {
+					logger.Errorf("failed to print the restored keys: %v", err)
+				}
+			}
+			if err != nil {
+				logger.Fatalf("Failed to restore keys: %v", err)
+			}
+		},
+	}
+
+	opts.addFlags(restoreKeysCmd.Flags())
+	return restoreKeysCmd
+}
+
+// printKeyRestoreResult writes the differing keys of the given result to w in the given output format.
+func printKeyRestoreResult(w io.Writer, result *brtypes.KeyRestoreResult, output string) error {
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "ACTION\tKEY\tBACKUP REVISION\tCLUSTER REVISION")
+	if !result.DryRun {
+		fmt.Fprint(tw, "\tAPPLIED")
+	}
+	fmt.Fprintln(tw)
+	for _, diff := range result.Diffs {
+		clusterRevision := "-"
+		if diff.ModRevision != 0 {
+			clusterRevision = fmt.Sprint(diff.ModRevision)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s", diff.Action, diff.Key, diff.BackupModRevision, clusterRevision)
+		if !result.DryRun {
+			fmt.Fprintf(tw, "\t%t", diff.Applied)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d keys to create, %d to update, %d skipped and %d unchanged from the backup at revision %d.\n",
+		result.Count(brtypes.KeyRestoreActionCreate), result.Count(brtypes.KeyRestoreActionUpdate), result.Count(brtypes.KeyRestoreActionSkip), result.Unchanged, result.Revision)
+	if !result.DryRun {
+		fmt.Fprintf(w, "%d keys were restored.\n", result.CountApplied())
+	}
+	return nil
+}
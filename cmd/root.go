@@ -28,9 +28,12 @@ from previously taken snapshot.`,
 	RootCmd.Flags().BoolVarP(&version, "version", "v", false, "print version info")
 	RootCmd.AddCommand(NewSnapshotCommand(ctx),
 		NewRestoreCommand(ctx),
+		NewRestoreKeysCommand(ctx),
 		NewCompactCommand(ctx),
 		NewInitializeCommand(ctx),
 		NewServerCommand(ctx),
-		NewCopyCommand(ctx))
+		NewCopyCommand(ctx),
+		NewGarbageCollectCommand(ctx),
+		NewPinCommand(ctx))
 	return RootCmd
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/health/heartbeat"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
 	"github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 	"go.etcd.io/etcd/clientv3"
 
@@ -60,6 +61,8 @@ func (cp *Compactor) Compact(ctx context.Context, opts *brtypes.CompactOptions)
 
 	// Deepcopy restoration options ro to avoid any mutation of the passing object
 	compactorRestoreOptions := opts.RestoreOptions.DeepCopy()
+	// The restoration for compaction is internal, so the restore hooks are not run.
+	compactorRestoreOptions.Config.Hooks = nil
 
 	// If no base snapshot is found, abort compaction as there would be nothing to compact
 	if compactorRestoreOptions.BaseSnapshot == nil {
@@ -126,6 +129,14 @@ func (cp *Compactor) Compact(ctx context.Context, opts *brtypes.CompactOptions)
 	}
 	defer clientMaintenance.Close()
 
+	// A backup recorded with a key filter is partial, and so is its compacted snapshot.
+	keyFilter := r.KeyFilter()
+	if keyFilter != nil && opts.StripFilteredKeys {
+		if err := cp.stripFilteredKeys(ctx, clientKV, keyFilter, int(compactorRestoreOptions.Config.MaxTxnOps)); err != nil {
+			return nil, fmt.Errorf("failed to strip filtered keys: %v", err)
+		}
+	}
+
 	revCheckCtx, cancel := context.WithTimeout(ctx, etcdDialTimeout)
 	getResponse, err := clientKV.Get(revCheckCtx, "foo")
 	cancel()
@@ -173,11 +184,33 @@ func (cp *Compactor) Compact(ctx context.Context, opts *brtypes.CompactOptions)
 	isFinal := compactorRestoreOptions.BaseSnapshot.IsFinal
 
 	cc := &compressor.CompressionConfig{Enabled: isCompressed, CompressionPolicy: compressionPolicy}
-	snapshot, err := etcdutil.TakeAndSaveFullSnapshot(snapshotReqCtx, clientMaintenance, cp.store, etcdRevision, cc, suffix, isFinal, cp.logger)
+	// the snapshot is spooled in the temporary etcd directory, which is removed after compaction.
+	var snapshot *brtypes.Snapshot
+	if keyFilter == nil {
+		snapshot, err = etcdutil.TakeAndSaveFullSnapshot(snapshotReqCtx, clientMaintenance, cp.store, compactorRestoreOptions.Config.DataDir, etcdRevision, cc, suffix, isFinal, cp.logger)
+	} else {
+		// The revisions of the filtered out keys are missing in the embedded etcd, so the compacted snapshot
+		// is named with the last revision of the backup, which the following delta snapshots continue from.
+		lastRevision := compactorRestoreOptions.BaseSnapshot.LastRevision
+		if len(compactorRestoreOptions.DeltaSnapList) > 0 {
+			lastRevision = compactorRestoreOptions.DeltaSnapList[compactorRestoreOptions.DeltaSnapList.Len()-1].LastRevision
+		}
+		snapshot, err = etcdutil.TakeAndSaveFullSnapshotAtRevision(snapshotReqCtx, clientMaintenance, cp.store, compactorRestoreOptions.Config.DataDir, lastRevision, cc, suffix, isFinal, cp.logger)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if keyFilter != nil {
+		if err := snapstore.SaveSnapshotMetadata(cp.store, *snapshot, &brtypes.SnapshotMetadata{KeyFilter: keyFilter}); err != nil {
+			if err := cp.store.Delete(*snapshot); err != nil {
+				cp.logger.Warnf("Failed to delete compacted snapshot %s without metadata: %v", snapshot.SnapName, err)
+			}
+			return nil, err
+		}
+		snapshot.HasMetadata = true
+	}
+
 	// Update snapshot lease only if lease update flag is enabled
 	if opts.EnabledLeaseRenewal {
 		// Update revisions in holder identity of full snapshot lease.
@@ -207,3 +240,43 @@ func sleepWithContext(ctx context.Context, sleepFor time.Duration) error {
 		}
 	}
 }
+
+// stripFilteredKeys deletes the keys which are not selected by the key filter from the embedded etcd.
+func (cp *Compactor) stripFilteredKeys(ctx context.Context, clientKV clientv3.KV, keyFilter *brtypes.KeyPrefixFilter, maxTxnOps int) error {
+	resp, err := clientKV.Get(ctx, "", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+
+	var (
+		ops     []clientv3.Op
+		deleted int
+	)
+	commit := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		if _, err := clientKV.Txn(ctx).Then(ops...).Commit(); err != nil {
+			return err
+		}
+		deleted += len(ops)
+		ops = ops[:0]
+		return nil
+	}
+	for _, kv := range resp.Kvs {
+		if keyFilter.Matches(kv.Key) {
+			continue
+		}
+		ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+		if maxTxnOps > 0 && len(ops) >= maxTxnOps {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+	cp.logger.Infof("Stripped %d keys not selected by the key filter (%s).", deleted, keyFilter)
+	return nil
+}
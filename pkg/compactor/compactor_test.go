@@ -5,7 +5,11 @@
 package compactor_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"time"
@@ -19,6 +23,8 @@ import (
 	"github.com/gardener/etcd-backup-restore/test/utils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
 	"go.etcd.io/etcd/pkg/types"
 )
 
@@ -263,6 +269,97 @@ var _ = Describe("Running Compactor", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 		})
+		Context("with a partial backup recorded with a key filter", func() {
+			var partialStore brtypes.SnapStore
+
+			BeforeEach(func() {
+				partialStore, err = snapstore.GetSnapstore(&brtypes.SnapstoreConfig{Container: path.Join(testSuiteDir, "partial.bkp"), Provider: "Local"})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				// the base full snapshot contains all the keys
+				baseSnapshot, _, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+				Expect(err).ShouldNot(HaveOccurred())
+				rc, err := store.Fetch(*baseSnapshot)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(partialStore.Save(*baseSnapshot, rc)).To(Succeed())
+
+				// the delta snapshot lacks the revisions of the filtered out keys
+				var events []brtypes.Event
+				for i, key := range []string{"/registry/pods/a", "/registry/pods/b"} {
+					events = append(events, brtypes.Event{
+						EtcdEvent: &clientv3.Event{
+							Type: mvccpb.PUT,
+							Kv:   &mvccpb.KeyValue{Key: []byte(key), Value: []byte("value"), ModRevision: baseSnapshot.LastRevision + int64(2*(i+1))},
+						},
+						Time: time.Now(),
+					})
+				}
+				data, err := json.Marshal(events)
+				Expect(err).ShouldNot(HaveOccurred())
+				hash := sha256.Sum256(data)
+				deltaSnapshot := snapstore.NewSnapshot(brtypes.SnapshotKindDelta, baseSnapshot.LastRevision+1, baseSnapshot.LastRevision+4, "", false)
+				// the compacted snapshot is ordered after the delta snapshot at the same revision by its creation time
+				deltaSnapshot.CreatedOn = deltaSnapshot.CreatedOn.Add(-time.Minute)
+				deltaSnapshot.GenerateSnapshotName()
+				metadata := &brtypes.SnapshotMetadata{KeyFilter: &brtypes.KeyPrefixFilter{Include: []string{"/registry/pods/"}}}
+				Expect(snapstore.SaveSnapshotMetadata(partialStore, *deltaSnapshot, metadata)).To(Succeed())
+				Expect(partialStore.Save(*deltaSnapshot, io.NopCloser(bytes.NewReader(append(data, hash[:]...))))).To(Succeed())
+
+				cptr = compactor.NewCompactor(partialStore, logger, nil)
+			})
+
+			It("should create a partial snapshot at the last revision of the backup without the filtered out keys", func() {
+				baseSnapshot, deltaSnapList, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(partialStore)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).To(HaveLen(1))
+				Expect(deltaSnapList[0].HasMetadata).To(BeTrue())
+
+				restoreOpts.BaseSnapshot = baseSnapshot
+				restoreOpts.DeltaSnapList = deltaSnapList
+				compactOptions.StripFilteredKeys = true
+				compactedSnapshot, err = cptr.Compact(testCtx, compactOptions)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(compactedSnapshot.LastRevision).To(Equal(deltaSnapList[0].LastRevision))
+
+				latestSnapshot, latestDeltaSnapList, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(partialStore)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(latestDeltaSnapList).To(BeEmpty())
+				Expect(latestSnapshot.SnapName).To(Equal(compactedSnapshot.SnapName))
+				Expect(latestSnapshot.HasMetadata).To(BeTrue())
+				metadata, err := snapstore.GetSnapshotMetadata(partialStore, *latestSnapshot)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(metadata.KeyFilter.Include).To(Equal([]string{"/registry/pods/"}))
+
+				// Restore from the compacted snapshot
+				tempRestoreDir, err = os.MkdirTemp(testSuiteDir, "restore-test-")
+				Expect(err).ShouldNot(HaveOccurred())
+				defer os.RemoveAll(tempRestoreDir)
+				restoreOpts.Config.DataDir = tempRestoreDir
+				restoreOpts.BaseSnapshot = latestSnapshot
+				restoreOpts.DeltaSnapList = latestDeltaSnapList
+				rstr, err := restorer.NewRestorer(partialStore, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(rstr.RestoreAndStopEtcd(*restoreOpts, nil)).To(Succeed())
+				Expect(rstr.KeyFilter()).NotTo(BeNil())
+
+				e, err := miscellaneous.StartEmbeddedEtcd(logger, restoreOpts)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer func() {
+					e.Server.Stop()
+					e.Close()
+				}()
+				cli, err := clientv3.New(clientv3.Config{Endpoints: []string{e.Clients[0].Addr().String()}})
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				resp, err := cli.Get(testCtx, "", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+				Expect(err).ShouldNot(HaveOccurred())
+				var keys []string
+				for _, kv := range resp.Kvs {
+					keys = append(keys, string(kv.Key))
+				}
+				Expect(keys).To(Equal([]string{"/registry/pods/a", "/registry/pods/b"}))
+			})
+		})
 		Context("with no base snapshot in backup store", func() {
 			It("should not run compaction", func() {
 				restoreOpts.Config.MaxFetchers = 4
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 
@@ -80,6 +81,7 @@ waitLoop:
 				if err != nil {
 					d.logger.Warnf("failed to defrag data with error: %v", err)
 				} else {
+					events.Emit(events.TypeDefragmentationDone, "", events.DefragmentationData{Endpoints: etcdEndpoints})
 					if d.callback != nil {
 						if _, err = d.callback(d.ctx, false); err != nil {
 							d.logger.Warnf("defragmentation callback failed with error: %v", err)
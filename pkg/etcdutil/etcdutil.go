@@ -7,7 +7,10 @@ package etcdutil
 import (
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/compressor"
@@ -19,6 +22,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/pkg/transport"
 )
@@ -253,8 +257,21 @@ func GetEtcdEndPointsSorted(ctx context.Context, clientMaintenance client.Mainte
 	return leaderEtcdEndpoints, followerEtcdEndpoints, nil
 }
 
-// TakeAndSaveFullSnapshot takes full snapshot and save it to store
-func TakeAndSaveFullSnapshot(ctx context.Context, client client.MaintenanceCloser, store brtypes.SnapStore, lastRevision int64, cc *compressor.CompressionConfig, suffix string, isFinal bool, logger *logrus.Entry) (*brtypes.Snapshot, error) {
+// TakeAndSaveFullSnapshot takes full snapshot and save it to store.
+// The snapshot is spooled to a temporary file in tempDir first, so that it is named with the exact
+// revision of its content rather than lastRevision, which is fetched separately from the snapshot.
+func TakeAndSaveFullSnapshot(ctx context.Context, client client.MaintenanceCloser, store brtypes.SnapStore, tempDir string, lastRevision int64, cc *compressor.CompressionConfig, suffix string, isFinal bool, logger *logrus.Entry) (*brtypes.Snapshot, error) {
+	return takeAndSaveFullSnapshot(ctx, client, store, tempDir, lastRevision, true, cc, suffix, isFinal, logger)
+}
+
+// TakeAndSaveFullSnapshotAtRevision takes full snapshot and save it to store, named with the given revision
+// regardless of the revision of its content. It is meant for snapshots of a backup recorded with a key filter,
+// whose content lacks the revisions of the filtered out keys.
+func TakeAndSaveFullSnapshotAtRevision(ctx context.Context, client client.MaintenanceCloser, store brtypes.SnapStore, tempDir string, revision int64, cc *compressor.CompressionConfig, suffix string, isFinal bool, logger *logrus.Entry) (*brtypes.Snapshot, error) {
+	return takeAndSaveFullSnapshot(ctx, client, store, tempDir, revision, false, cc, suffix, isFinal, logger)
+}
+
+func takeAndSaveFullSnapshot(ctx context.Context, client client.MaintenanceCloser, store brtypes.SnapStore, tempDir string, lastRevision int64, useDBRevision bool, cc *compressor.CompressionConfig, suffix string, isFinal bool, logger *logrus.Entry) (*brtypes.Snapshot, error) {
 	startTime := time.Now()
 	rc, err := client.Snapshot(ctx)
 	if err != nil {
@@ -262,25 +279,60 @@ func TakeAndSaveFullSnapshot(ctx context.Context, client client.MaintenanceClose
 			Message: fmt.Sprintf("failed to create etcd snapshot: %v", err),
 		}
 	}
+	defer rc.Close()
+
+	dbFile, err := os.CreateTemp(tempDir, "etcd-snapshot-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for etcd snapshot: %v", err)
+	}
+	defer func() {
+		dbFile.Close()
+		if err := os.Remove(dbFile.Name()); err != nil {
+			logger.Warnf("Failed to remove temporary etcd snapshot file %s: %v", dbFile.Name(), err)
+		}
+	}()
+	if _, err := io.Copy(dbFile, rc); err != nil {
+		return nil, &errors.EtcdError{
+			Message: fmt.Sprintf("failed to read etcd snapshot: %v", err),
+		}
+	}
 	timeTaken := time.Since(startTime)
 	logger.Infof("Total time taken by Snapshot API: %f seconds.", timeTaken.Seconds())
 
+	// Note: The revision fetched before calling the Snapshot API can be behind the content of the snapshot.
+	// Refer: https://github.com/coreos/etcd/issues/9037
+	if useDBRevision {
+		dbRevision, err := GetDBRevision(dbFile.Name())
+		if err != nil {
+			logger.Warnf("Unable to read revision from etcd snapshot, using revision %d instead: %v", lastRevision, err)
+		} else {
+			if dbRevision != lastRevision {
+				logger.Infof("Etcd snapshot is at revision %d, whereas the revision fetched before taking it was %d.", dbRevision, lastRevision)
+			}
+			lastRevision = dbRevision
+		}
+	}
+
+	if _, err := dbFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek temporary etcd snapshot file: %v", err)
+	}
+	var snapReader io.ReadCloser = io.NopCloser(dbFile)
 	if cc.Enabled {
 		startTimeCompression := time.Now()
-		rc, err = compressor.CompressSnapshot(rc, cc.CompressionPolicy)
+		snapReader, err = compressor.CompressSnapshot(snapReader, cc.CompressionPolicy)
 		if err != nil {
 			return nil, fmt.Errorf("unable to obtain reader for compressed file: %v", err)
 		}
 		timeTakenCompression := time.Since(startTimeCompression)
 		logger.Infof("Total time taken in full snapshot compression: %f seconds.", timeTakenCompression.Seconds())
 	}
-	defer rc.Close()
+	defer snapReader.Close()
 
 	logger.Infof("Successfully opened snapshot reader on etcd")
 
 	// Then save the snapshot to the store.
 	snapshot := snapstore.NewSnapshot(brtypes.SnapshotKindFull, 0, lastRevision, suffix, isFinal)
-	if err := store.Save(*snapshot, rc); err != nil {
+	if err := store.Save(*snapshot, snapReader); err != nil {
 		timeTaken := time.Since(startTime)
 		metrics.SnapshotDurationSeconds.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Observe(timeTaken.Seconds())
 		return nil, &errors.SnapstoreError{
@@ -294,3 +346,40 @@ func TakeAndSaveFullSnapshot(ctx context.Context, client client.MaintenanceClose
 
 	return snapshot, nil
 }
+
+// GetDBRevision returns the revision of the etcd bolt db file at the given path, which is the
+// highest revision of the keys in the db, or the compacted revision if that is higher.
+// Note: The returned revision is 1 for a db without any keys.
+func GetDBRevision(dbPath string) (int64, error) {
+	db, err := bolt.Open(dbPath, 0400, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open db file %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	var rev int64
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("key"))
+		if b == nil {
+			return fmt.Errorf("cannot find bucket \"key\"")
+		}
+		// keys are encoded as the big endian main revision, followed by the sub revision.
+		// etcd starts with revision 1, even if there are no keys.
+		rev = 1
+		if k, _ := b.Cursor().Last(); len(k) >= 8 {
+			rev = int64(binary.BigEndian.Uint64(k[0:8]))
+		}
+		if meta := tx.Bucket([]byte("meta")); meta != nil {
+			if v := meta.Get([]byte("finishedCompactRev")); len(v) >= 8 {
+				if compactRev := int64(binary.BigEndian.Uint64(v[0:8])); compactRev > rev {
+					rev = compactRev
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rev, nil
+}
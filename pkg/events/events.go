@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// cloudEventsSpecVersion is the version of the CloudEvents specification the events conform to.
+	cloudEventsSpecVersion = "1.0"
+	// typePrefix is the prefix of the types of the events.
+	typePrefix = "com.gardener.etcd-backup-restore."
+
+	// TypeFullSnapshotSucceeded is the type of the event emitted after a full snapshot is uploaded.
+	TypeFullSnapshotSucceeded = typePrefix + "snapshot.full.succeeded"
+	// TypeFullSnapshotFailed is the type of the event emitted after a full snapshot failed.
+	TypeFullSnapshotFailed = typePrefix + "snapshot.full.failed"
+	// TypeDeltaSnapshotSucceeded is the type of the event emitted after a delta snapshot is uploaded.
+	TypeDeltaSnapshotSucceeded = typePrefix + "snapshot.delta.succeeded"
+	// TypeDeltaSnapshotFailed is the type of the event emitted after a delta snapshot failed.
+	TypeDeltaSnapshotFailed = typePrefix + "snapshot.delta.failed"
+	// TypeSnapshotDeleted is the type of the event emitted after the garbage collector deleted a snapshot.
+	TypeSnapshotDeleted = typePrefix + "snapshot.deleted"
+	// TypeRestoreStarted is the type of the event emitted when a restore starts.
+	TypeRestoreStarted = typePrefix + "restore.started"
+	// TypeRestoreFinished is the type of the event emitted when a restore finished, successfully or not.
+	TypeRestoreFinished = typePrefix + "restore.finished"
+	// TypeLeadershipChanged is the type of the event emitted when the backup-restore leadership state changed.
+	TypeLeadershipChanged = typePrefix + "leadership.changed"
+	// TypeDefragmentationDone is the type of the event emitted after the etcd members were defragmented.
+	TypeDefragmentationDone = typePrefix + "defragmentation.done"
+	// TypeMemberAdded is the type of the event emitted after the etcd member was added to the cluster as a learner.
+	TypeMemberAdded = typePrefix + "member.added"
+	// TypeMemberRemoved is the type of the event emitted after the etcd member was removed from the cluster.
+	TypeMemberRemoved = typePrefix + "member.removed"
+)
+
+// CloudEvent is an event in the structured JSON format of the CloudEvents specification.
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// SnapshotData is the data of the snapshot events.
+type SnapshotData struct {
+	// Snapshot is the snapshot taken or deleted. It is not set if a snapshot failed.
+	Snapshot *brtypes.Snapshot `json:"snapshot,omitempty"`
+	// Error is the error of a failed snapshot.
+	Error string `json:"error,omitempty"`
+}
+
+// RestoreData is the data of the restore events.
+type RestoreData struct {
+	// BaseSnapshot is the full snapshot restored from.
+	BaseSnapshot *brtypes.Snapshot `json:"baseSnapshot,omitempty"`
+	// DeltaSnapshots is the number of delta snapshots applied on top of the base snapshot.
+	DeltaSnapshots int `json:"deltaSnapshots"`
+	// Succeeded is set if a finished restore succeeded.
+	Succeeded bool `json:"succeeded,omitempty"`
+	// Error is the error of a failed restore.
+	Error string `json:"error,omitempty"`
+}
+
+// LeadershipData is the data of the leadership events.
+type LeadershipData struct {
+	// State is the new leadership state of the backup-restore, e.g. Leader or Follower.
+	State string `json:"state"`
+}
+
+// DefragmentationData is the data of the defragmentation events.
+type DefragmentationData struct {
+	// Endpoints are the endpoints of the defragmented etcd members.
+	Endpoints []string `json:"endpoints"`
+}
+
+// MemberData is the data of the member events.
+type MemberData struct {
+	// Name is the name of the etcd member.
+	Name string `json:"name"`
+	// ID is the hexadecimal ID of the etcd member.
+	ID string `json:"id,omitempty"`
+	// PeerURL is the peer URL of the etcd member.
+	PeerURL string `json:"peerURL,omitempty"`
+}
+
+var (
+	defaultEmitterMutex sync.RWMutex
+	defaultEmitter      *Emitter
+)
+
+// SetDefault sets the emitter to which Emit passes the events. A nil emitter disables the events.
+func SetDefault(e *Emitter) {
+	defaultEmitterMutex.Lock()
+	defer defaultEmitterMutex.Unlock()
+	defaultEmitter = e
+}
+
+// Emit emits an event of the given type about the given subject with the default emitter, if any.
+// It does not block: the event is dropped if the buffer of the emitter is full.
+func Emit(eventType, subject string, data interface{}) {
+	defaultEmitterMutex.RLock()
+	e := defaultEmitter
+	defaultEmitterMutex.RUnlock()
+	e.Emit(eventType, subject, data)
+}
+
+// Emitter delivers events to the configured sinks. The events are buffered, up to the configured buffer size,
+// and delivered one after the other. A failed delivery to a sink is retried with an exponential backoff.
+// A nil Emitter drops all events.
+type Emitter struct {
+	config *brtypes.EventsConfig
+	sinks  []sink
+	buffer chan *CloudEvent
+	closed chan struct{}
+	logger *logrus.Entry
+}
+
+// NewEmitter returns an emitter to the sinks of the given config, or nil if no sink is configured.
+func NewEmitter(config *brtypes.EventsConfig, logger *logrus.Entry) *Emitter {
+	if config == nil || !config.IsEnabled() {
+		return nil
+	}
+	var sinks []sink
+	if len(config.HTTPSinkURL) != 0 {
+		sinks = append(sinks, newHTTPSink(config.HTTPSinkURL, config.HTTPSinkHeaders, config.Timeout.Duration))
+	}
+	if len(config.FileSinkPath) != 0 {
+		sinks = append(sinks, newFileSink(config.FileSinkPath))
+	}
+	return &Emitter{
+		config: config,
+		sinks:  sinks,
+		buffer: make(chan *CloudEvent, config.BufferSize),
+		closed: make(chan struct{}),
+		logger: logger.WithField("actor", "events"),
+	}
+}
+
+// Emit buffers an event of the given type about the given subject for delivery.
+// It does not block: the event is dropped if the buffer is full.
+func (e *Emitter) Emit(eventType, subject string, data interface{}) {
+	if e == nil {
+		return
+	}
+	event := &CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.New().String(),
+		Source:          e.config.Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	select {
+	case e.buffer <- event:
+	default:
+		e.logger.Warnf("Dropping event %s of type %s as the event buffer is full.", event.ID, event.Type)
+		metrics.EventsTotal.With(prometheus.Labels{metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
+	}
+}
+
+// Run delivers the buffered events until the given context is cancelled or the emitter is closed.
+// The events still buffered when the context is cancelled are delivered once more without retries.
+func (e *Emitter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			e.flush()
+			return
+		case event := <-e.buffer:
+			if event == nil {
+				close(e.closed)
+				return
+			}
+			e.deliver(ctx, event, e.config.MaxRetries)
+		}
+	}
+}
+
+// Close stops Run once the events emitted before are delivered, with retries. It waits for that
+// until the given context is cancelled. Events emitted after Close are not delivered anymore.
+func (e *Emitter) Close(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.buffer <- nil:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-e.closed:
+	case <-ctx.Done():
+	}
+}
+
+func (e *Emitter) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout.Duration)
+	defer cancel()
+	for {
+		select {
+		case event := <-e.buffer:
+			if event == nil {
+				close(e.closed)
+				return
+			}
+			e.deliver(ctx, event, 0)
+		default:
+			return
+		}
+	}
+}
+
+// deliver delivers the event to each sink, retrying a failed delivery up to the given number of times.
+func (e *Emitter) deliver(ctx context.Context, event *CloudEvent, maxRetries uint) {
+	for _, s := range e.sinks {
+		backoff := e.config.RetryPeriod.Duration
+		for attempt := uint(0); ; attempt++ {
+			err := s.send(ctx, event)
+			if err == nil {
+				metrics.EventsTotal.With(prometheus.Labels{metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
+				break
+			}
+			if attempt >= maxRetries || ctx.Err() != nil {
+				e.logger.Warnf("Failed to deliver event %s of type %s to %s: %v", event.ID, event.Type, s, err)
+				metrics.EventsTotal.With(prometheus.Labels{metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
+				break
+			}
+			e.logger.Debugf("Failed to deliver event %s to %s, retrying after %s: %v", event.ID, s, backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package events_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/events"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		logger   = logrus.New().WithField("actor", "events-test")
+		snapshot = &brtypes.Snapshot{
+			Kind:         brtypes.SnapshotKindFull,
+			LastRevision: 42,
+			CreatedOn:    time.Now().UTC(),
+			SnapDir:      "Backup-1",
+			SnapName:     "Full-00000000-00000042-1",
+		}
+		server      *httptest.Server
+		mutex       sync.Mutex
+		received    []map[string]interface{}
+		contentType string
+		failures    int
+		config      *brtypes.EventsConfig
+		ctx         context.Context
+		cancel      context.CancelFunc
+	)
+
+	receivedEvents := func() []map[string]interface{} {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]map[string]interface{}{}, received...)
+	}
+
+	BeforeEach(func() {
+		received, failures = nil, 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var event map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&event)).To(Succeed())
+			contentType = r.Header.Get("Content-Type")
+			received = append(received, event)
+		}))
+		config = brtypes.NewEventsConfig()
+		config.Source = "test-cluster"
+		config.HTTPSinkURL = server.URL
+		config.RetryPeriod = wrappers.Duration{Duration: 10 * time.Millisecond}
+		ctx, cancel = context.WithCancel(context.TODO())
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+	})
+
+	Describe("#NewEmitter", func() {
+		It("should return a nil emitter which drops all events if no sink is configured", func() {
+			emitter := events.NewEmitter(brtypes.NewEventsConfig(), logger)
+			Expect(emitter).To(BeNil())
+			emitter.Emit(events.TypeFullSnapshotSucceeded, "", nil)
+		})
+	})
+
+	Describe("#Emit", func() {
+		It("should post the events as CloudEvents", func() {
+			emitter := events.NewEmitter(config, logger)
+			go emitter.Run(ctx)
+
+			emitter.Emit(events.TypeFullSnapshotSucceeded, "Backup-1/Full-00000000-00000042-1", events.SnapshotData{Snapshot: snapshot})
+			emitter.Emit(events.TypeLeadershipChanged, "", events.LeadershipData{State: "Leader"})
+
+			Eventually(receivedEvents).Should(HaveLen(2))
+			delivered := receivedEvents()
+			Expect(contentType).To(Equal("application/cloudevents+json"))
+			Expect(delivered[0]).To(HaveKeyWithValue("specversion", "1.0"))
+			Expect(delivered[0]).To(HaveKeyWithValue("source", "test-cluster"))
+			Expect(delivered[0]).To(HaveKeyWithValue("type", "com.gardener.etcd-backup-restore.snapshot.full.succeeded"))
+			Expect(delivered[0]).To(HaveKeyWithValue("subject", "Backup-1/Full-00000000-00000042-1"))
+			Expect(delivered[0]).To(HaveKey("id"))
+			Expect(delivered[0]).To(HaveKey("time"))
+			Expect(delivered[0]["data"]).To(HaveKeyWithValue("snapshot", HaveKeyWithValue("snapName", snapshot.SnapName)))
+			Expect(delivered[1]).To(HaveKeyWithValue("type", "com.gardener.etcd-backup-restore.leadership.changed"))
+			Expect(delivered[1]["data"]).To(HaveKeyWithValue("state", "Leader"))
+			Expect(delivered[0]["id"]).NotTo(Equal(delivered[1]["id"]))
+		})
+
+		It("should retry a failed delivery", func() {
+			failures = 3
+			emitter := events.NewEmitter(config, logger)
+			go emitter.Run(ctx)
+
+			emitter.Emit(events.TypeDefragmentationDone, "", events.DefragmentationData{Endpoints: []string{"http://localhost:2379"}})
+
+			Eventually(receivedEvents).Should(HaveLen(1))
+		})
+
+		It("should give up on an event after the maximum number of retries", func() {
+			failures = 2
+			config.MaxRetries = 1
+			emitter := events.NewEmitter(config, logger)
+			go emitter.Run(ctx)
+
+			emitter.Emit(events.TypeMemberAdded, "etcd-0", events.MemberData{Name: "etcd-0"})
+			emitter.Emit(events.TypeMemberRemoved, "etcd-0", events.MemberData{Name: "etcd-0"})
+
+			Eventually(receivedEvents).Should(HaveLen(1))
+			Expect(receivedEvents()[0]).To(HaveKeyWithValue("type", "com.gardener.etcd-backup-restore.member.removed"))
+		})
+
+		It("should drop the events beyond the buffer size", func() {
+			config.BufferSize = 2
+			emitter := events.NewEmitter(config, logger)
+
+			for i := 0; i < 5; i++ {
+				emitter.Emit(events.TypeSnapshotDeleted, "", events.SnapshotData{Snapshot: snapshot})
+			}
+			go emitter.Run(ctx)
+
+			Eventually(receivedEvents).Should(HaveLen(2))
+			Consistently(receivedEvents, 200*time.Millisecond).Should(HaveLen(2))
+		})
+
+		It("should append the events to the file sink", func() {
+			config.HTTPSinkURL = ""
+			config.FileSinkPath = filepath.Join(GinkgoT().TempDir(), "events.json")
+			emitter := events.NewEmitter(config, logger)
+
+			emitter.Emit(events.TypeRestoreStarted, "default.etcd", events.RestoreData{BaseSnapshot: snapshot})
+			emitter.Emit(events.TypeRestoreFinished, "default.etcd", events.RestoreData{BaseSnapshot: snapshot, Succeeded: true})
+			// the buffered events are delivered when the emitter stops.
+			cancel()
+			emitter.Run(ctx)
+
+			f, err := os.Open(config.FileSinkPath)
+			Expect(err).ShouldNot(HaveOccurred())
+			defer f.Close()
+			var types []string
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var event events.CloudEvent
+				Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+				types = append(types, event.Type)
+			}
+			Expect(types).To(Equal([]string{events.TypeRestoreStarted, events.TypeRestoreFinished}))
+		})
+	})
+
+	Describe("#Close", func() {
+		It("should stop the emitter once the events emitted before are delivered", func() {
+			failures = 2
+			emitter := events.NewEmitter(config, logger)
+			stopped := make(chan struct{})
+			go func() {
+				emitter.Run(ctx)
+				close(stopped)
+			}()
+
+			emitter.Emit(events.TypeRestoreStarted, "default.etcd", events.RestoreData{BaseSnapshot: snapshot})
+			emitter.Emit(events.TypeRestoreFinished, "default.etcd", events.RestoreData{BaseSnapshot: snapshot, Succeeded: true})
+			emitter.Close(ctx)
+
+			Expect(receivedEvents()).To(HaveLen(2))
+			Eventually(stopped).Should(BeClosed())
+		})
+	})
+
+	Describe("#SetDefault", func() {
+		AfterEach(func() {
+			events.SetDefault(nil)
+		})
+
+		It("should emit the events with the default emitter", func() {
+			emitter := events.NewEmitter(config, logger)
+			go emitter.Run(ctx)
+			events.SetDefault(emitter)
+
+			events.Emit(events.TypeDeltaSnapshotFailed, "", events.SnapshotData{Error: "upload failed"})
+
+			Eventually(receivedEvents).Should(HaveLen(1))
+			Expect(receivedEvents()[0]["data"]).To(HaveKeyWithValue("error", "upload failed"))
+		})
+	})
+})
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// cloudEventsContentType is the content type of an event in the structured JSON format of the CloudEvents specification.
+const cloudEventsContentType = "application/cloudevents+json"
+
+// sink is a destination of the events.
+type sink interface {
+	fmt.Stringer
+	send(ctx context.Context, event *CloudEvent) error
+}
+
+// httpSink posts the events in the structured JSON format to a URL.
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSink(url string, headers map[string]string, timeout time.Duration) *httpSink {
+	return &httpSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *httpSink) String() string {
+	return s.url
+}
+
+func (s *httpSink) send(ctx context.Context, event *CloudEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// fileSink appends the events in the structured JSON format to a local file, one event per line.
+// Events are only sent by the single delivery loop of the emitter, so the file isn't written concurrently.
+type fileSink struct {
+	path string
+}
+
+func newFileSink(path string) *fileSink {
+	return &fileSink{path: path}
+}
+
+func (s *fileSink) String() string {
+	return s.path
+}
+
+func (s *fileSink) send(_ context.Context, event *CloudEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
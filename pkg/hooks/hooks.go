@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// envHookName is the environment variable holding the name of the hook run by an exec hook.
+	envHookName = "ETCDBR_HOOK_NAME"
+	// envHookStage is the environment variable holding the stage at which an exec hook is run.
+	envHookStage = "ETCDBR_HOOK_STAGE"
+	// maxOutputLength is the maximum length of the output of a failed hook included in its error.
+	maxOutputLength = 1024
+)
+
+// Payload is the metadata of an operation, which is passed to the hooks as JSON.
+type Payload struct {
+	// Hook is the name of the hook.
+	Hook string `json:"hook"`
+	// Stage is the stage of the operation at which the hook is run.
+	Stage brtypes.HookStage `json:"stage"`
+	// Time is the time at which the hook is run.
+	Time time.Time `json:"time"`
+	// Snapshot is the snapshot taken or deleted, or the base snapshot of a restore.
+	// It is not set before a snapshot is taken.
+	Snapshot *brtypes.Snapshot `json:"snapshot,omitempty"`
+	// DeltaSnapshots are the delta snapshots applied on top of the base snapshot of a restore.
+	DeltaSnapshots brtypes.SnapList `json:"deltaSnapshots,omitempty"`
+}
+
+// Runner runs the configured hooks at the stages of an operation.
+// A nil Runner runs no hooks.
+type Runner struct {
+	hooks  []brtypes.HookConfig
+	client *http.Client
+	logger *logrus.Entry
+}
+
+// NewRunner returns a runner of the given hooks, or nil if there are none.
+func NewRunner(hooks []brtypes.HookConfig, logger *logrus.Entry) *Runner {
+	if len(hooks) == 0 {
+		return nil
+	}
+	return &Runner{
+		hooks:  hooks,
+		client: &http.Client{},
+		logger: logger.WithField("actor", "hooks"),
+	}
+}
+
+// Run runs the hooks of the given stage one after the other, in the configured order, with the given payload.
+// It stops and returns an error at the first failed hook whose failure policy is Abort.
+// The failures of the other hooks are only logged.
+func (r *Runner) Run(ctx context.Context, stage brtypes.HookStage, payload Payload) error {
+	if r == nil {
+		return nil
+	}
+	for i := range r.hooks {
+		hook := &r.hooks[i]
+		if !hook.HasStage(stage) {
+			continue
+		}
+		payload.Hook = hook.Name
+		payload.Stage = stage
+		payload.Time = time.Now().UTC()
+		if err := r.runHook(ctx, hook, payload); err != nil {
+			metrics.HookFailuresTotal.With(prometheus.Labels{metrics.LabelStage: string(stage)}).Inc()
+			if hook.IsAbortOnFailure() {
+				return fmt.Errorf("hook %s failed at stage %s: %v", hook.Name, stage, err)
+			}
+			r.logger.Warnf("Ignoring failure of hook %s at stage %s: %v", hook.Name, stage, err)
+			continue
+		}
+		r.logger.Infof("Successfully ran hook %s at stage %s.", hook.Name, stage)
+	}
+	return nil
+}
+
+func (r *Runner) runHook(ctx context.Context, hook *brtypes.HookConfig, payload Payload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, hook.GetTimeout())
+	defer cancel()
+
+	if hook.Exec != nil {
+		return runExecHook(ctx, hook, payload.Stage, data)
+	}
+	return r.runWebhook(ctx, hook, data)
+}
+
+// runExecHook runs the command of the hook with the payload on its standard input.
+func runExecHook(ctx context.Context, hook *brtypes.HookConfig, stage brtypes.HookStage, data []byte) error {
+	cmd := exec.CommandContext(ctx, hook.Exec.Command[0], hook.Exec.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", envHookName, hook.Name), fmt.Sprintf("%s=%s", envHookStage, stage))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("command timed out after %s", hook.GetTimeout())
+		}
+		return fmt.Errorf("command failed: %v: %s", err, truncate(output))
+	}
+	return nil
+}
+
+// runWebhook posts the payload to the URL of the hook. Any response status other than 2xx is a failure.
+func (r *Runner) runWebhook(ctx context.Context, hook *brtypes.HookConfig, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Webhook.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutputLength))
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func truncate(output []byte) []byte {
+	if len(output) > maxOutputLength {
+		return output[:maxOutputLength]
+	}
+	return output
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/hooks"
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Hooks", func() {
+	var (
+		logger   = logrus.New().WithField("actor", "hooks-test")
+		snapshot = &brtypes.Snapshot{
+			Kind:          brtypes.SnapshotKindFull,
+			StartRevision: 0,
+			LastRevision:  42,
+			CreatedOn:     time.Now().UTC(),
+			SnapDir:       "Backup-1",
+			SnapName:      "Full-00000000-00000042-1",
+		}
+		server   *httptest.Server
+		mutex    sync.Mutex
+		requests []*http.Request
+		payloads []hooks.Payload
+		status   int
+		delay    time.Duration
+	)
+
+	BeforeEach(func() {
+		requests, payloads = nil, nil
+		status, delay = http.StatusOK, 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ShouldNot(HaveOccurred())
+			var p hooks.Payload
+			Expect(json.Unmarshal(body, &p)).To(Succeed())
+			mutex.Lock()
+			requests = append(requests, r)
+			payloads = append(payloads, p)
+			mutex.Unlock()
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	webhook := func(name string, stages ...brtypes.HookStage) brtypes.HookConfig {
+		return brtypes.HookConfig{
+			Name:    name,
+			Stages:  stages,
+			Webhook: &brtypes.WebhookConfig{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+		}
+	}
+
+	Describe("#NewRunner", func() {
+		It("should return a nil runner which runs no hooks if no hooks are configured", func() {
+			runner := hooks.NewRunner(nil, logger)
+			Expect(runner).To(BeNil())
+			Expect(runner.Run(context.TODO(), brtypes.HookStagePreFullSnapshot, hooks.Payload{})).To(Succeed())
+		})
+	})
+
+	Describe("#Run", func() {
+		Context("with webhooks", func() {
+			It("should post the snapshot metadata to the hooks of the stage", func() {
+				runner := hooks.NewRunner([]brtypes.HookConfig{
+					webhook("first", brtypes.HookStagePostFullSnapshot),
+					webhook("other", brtypes.HookStagePreFullSnapshot),
+					webhook("second", brtypes.HookStagePreFullSnapshot, brtypes.HookStagePostFullSnapshot),
+				}, logger)
+
+				Expect(runner.Run(context.TODO(), brtypes.HookStagePostFullSnapshot, hooks.Payload{Snapshot: snapshot})).To(Succeed())
+
+				Expect(payloads).To(HaveLen(2))
+				Expect(payloads[0].Hook).To(Equal("first"))
+				Expect(payloads[1].Hook).To(Equal("second"))
+				for i, p := range payloads {
+					Expect(p.Stage).To(Equal(brtypes.HookStagePostFullSnapshot))
+					Expect(p.Snapshot).NotTo(BeNil())
+					Expect(p.Snapshot.SnapName).To(Equal(snapshot.SnapName))
+					Expect(p.Snapshot.LastRevision).To(Equal(snapshot.LastRevision))
+					Expect(requests[i].Method).To(Equal(http.MethodPost))
+					Expect(requests[i].Header.Get("Content-Type")).To(Equal("application/json"))
+					Expect(requests[i].Header.Get("Authorization")).To(Equal("Bearer token"))
+				}
+			})
+
+			It("should ignore a failed hook with the Ignore failure policy and count the failures", func() {
+				failures := &dto.Metric{}
+				Expect(metrics.HookFailuresTotal.With(prometheus.Labels{metrics.LabelStage: string(brtypes.HookStagePreRestore)}).Write(failures)).To(Succeed())
+				failuresBefore := failures.GetCounter().GetValue()
+
+				status = http.StatusInternalServerError
+				runner := hooks.NewRunner([]brtypes.HookConfig{
+					webhook("first", brtypes.HookStagePreRestore),
+					webhook("second", brtypes.HookStagePreRestore),
+				}, logger)
+
+				Expect(runner.Run(context.TODO(), brtypes.HookStagePreRestore, hooks.Payload{})).To(Succeed())
+				Expect(payloads).To(HaveLen(2))
+				Expect(metrics.HookFailuresTotal.With(prometheus.Labels{metrics.LabelStage: string(brtypes.HookStagePreRestore)}).Write(failures)).To(Succeed())
+				Expect(failures.GetCounter().GetValue() - failuresBefore).To(Equal(float64(2)))
+			})
+
+			It("should stop at a failed hook with the Abort failure policy", func() {
+				status = http.StatusForbidden
+				first := webhook("first", brtypes.HookStagePreRestore)
+				first.FailurePolicy = brtypes.HookFailurePolicyAbort
+				runner := hooks.NewRunner([]brtypes.HookConfig{first, webhook("second", brtypes.HookStagePreRestore)}, logger)
+
+				err := runner.Run(context.TODO(), brtypes.HookStagePreRestore, hooks.Payload{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("403"))
+				Expect(payloads).To(HaveLen(1))
+			})
+
+			It("should fail a hook which times out", func() {
+				delay = time.Second
+				hook := webhook("slow", brtypes.HookStagePreRestore)
+				hook.FailurePolicy = brtypes.HookFailurePolicyAbort
+				hook.Timeout = &wrappers.Duration{Duration: 100 * time.Millisecond}
+				runner := hooks.NewRunner([]brtypes.HookConfig{hook}, logger)
+
+				start := time.Now()
+				Expect(runner.Run(context.TODO(), brtypes.HookStagePreRestore, hooks.Payload{})).NotTo(Succeed())
+				Expect(time.Since(start)).To(BeNumerically("<", delay))
+			})
+		})
+
+		Context("with exec hooks", func() {
+			var outputFile string
+
+			BeforeEach(func() {
+				outputFile = filepath.Join(GinkgoT().TempDir(), "payload.json")
+			})
+
+			It("should pass the snapshot metadata on the standard input of the command", func() {
+				runner := hooks.NewRunner([]brtypes.HookConfig{{
+					Name:   "exec",
+					Stages: []brtypes.HookStage{brtypes.HookStagePostDeltaSnapshot},
+					Exec:   &brtypes.ExecHookConfig{Command: []string{"sh", "-c", `cat > "$0" && test "$ETCDBR_HOOK_STAGE" = PostDeltaSnapshot`, outputFile}},
+				}}, logger)
+
+				Expect(runner.Run(context.TODO(), brtypes.HookStagePostDeltaSnapshot, hooks.Payload{Snapshot: snapshot})).To(Succeed())
+
+				data, err := os.ReadFile(outputFile)
+				Expect(err).ShouldNot(HaveOccurred())
+				var p hooks.Payload
+				Expect(json.Unmarshal(data, &p)).To(Succeed())
+				Expect(p.Hook).To(Equal("exec"))
+				Expect(p.Stage).To(Equal(brtypes.HookStagePostDeltaSnapshot))
+				Expect(p.Snapshot.SnapName).To(Equal(snapshot.SnapName))
+			})
+
+			It("should fail with the output of a failed command with the Abort failure policy", func() {
+				runner := hooks.NewRunner([]brtypes.HookConfig{{
+					Name:          "exec",
+					Stages:        []brtypes.HookStage{brtypes.HookStagePreSnapshotDelete},
+					Exec:          &brtypes.ExecHookConfig{Command: []string{"sh", "-c", "echo snapshot is locked; exit 1"}},
+					FailurePolicy: brtypes.HookFailurePolicyAbort,
+				}}, logger)
+
+				err := runner.Run(context.TODO(), brtypes.HookStagePreSnapshotDelete, hooks.Payload{Snapshot: snapshot})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("snapshot is locked"))
+			})
+
+			It("should fail a command which times out", func() {
+				runner := hooks.NewRunner([]brtypes.HookConfig{{
+					Name:          "exec",
+					Stages:        []brtypes.HookStage{brtypes.HookStagePreSnapshotDelete},
+					Exec:          &brtypes.ExecHookConfig{Command: []string{"sleep", "5"}},
+					Timeout:       &wrappers.Duration{Duration: 100 * time.Millisecond},
+					FailurePolicy: brtypes.HookFailurePolicyAbort,
+				}}, logger)
+
+				err := runner.Run(context.TODO(), brtypes.HookStagePreSnapshotDelete, hooks.Payload{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("timed out"))
+			})
+		})
+	})
+
+	Describe("#Validate", func() {
+		It("should accept a valid hook", func() {
+			hook := webhook("hook", brtypes.HookStagePreFullSnapshot)
+			Expect(hook.Validate(brtypes.SnapshotterHookStages)).To(Succeed())
+		})
+
+		It("should reject a stage which is not allowed", func() {
+			hook := webhook("hook", brtypes.HookStagePreRestore)
+			Expect(hook.Validate(brtypes.SnapshotterHookStages)).NotTo(Succeed())
+		})
+
+		It("should reject a hook with both exec and webhook set", func() {
+			hook := webhook("hook", brtypes.HookStagePreFullSnapshot)
+			hook.Exec = &brtypes.ExecHookConfig{Command: []string{"true"}}
+			Expect(hook.Validate(brtypes.SnapshotterHookStages)).NotTo(Succeed())
+		})
+
+		It("should reject an invalid failure policy", func() {
+			hook := webhook("hook", brtypes.HookStagePreFullSnapshot)
+			hook.FailurePolicy = "Retry"
+			Expect(hook.Validate(brtypes.SnapshotterHookStages)).NotTo(Succeed())
+		})
+	})
+})
@@ -40,7 +40,9 @@ const (
 //   - Check if Latest snapshot available.
 //   - Try to perform an Etcd data restoration from the latest snapshot.
 //   - No snapshots are available, start etcd as a fresh installation.
-func (e *EtcdInitializer) Initialize(mode validator.Mode, failBelowRevision int64) error {
+//
+// If a snapshot selector is given, it selects the snapshots to restore from in place of the configured one.
+func (e *EtcdInitializer) Initialize(mode validator.Mode, failBelowRevision int64, selector *brtypes.SnapshotSelector) error {
 	logger := e.Logger.WithField("actor", "initializer")
 	metrics.CurrentClusterSize.With(prometheus.Labels{}).Set(float64(e.Validator.OriginalClusterSize))
 	start := time.Now()
@@ -122,7 +124,7 @@ func (e *EtcdInitializer) Initialize(mode validator.Mode, failBelowRevision int6
 		} else {
 			// For case: ClusterSize=1 or when multi-node cluster(ClusterSize>1) is bootstrapped
 			start := time.Now()
-			restored, err := e.restoreCorruptData()
+			restored, err := e.restoreCorruptData(selector)
 			if err != nil {
 				metrics.RestorationDurationSeconds.With(prometheus.Labels{metrics.LabelRestorationKind: metrics.ValueRestoreSingleNode, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Observe(time.Since(start).Seconds())
 				return fmt.Errorf("error while restoring corrupt data: %v", err)
@@ -162,12 +164,16 @@ func NewInitializer(restoreOptions *brtypes.RestoreOptions, snapstoreConfig *brt
 	}, nil
 }
 
-// restoreCorruptData attempts to restore a corrupted data directory.
+// restoreCorruptData attempts to restore a corrupted data directory
+// from the snapshots selected by the given selector, or by the configured one if it is nil.
 // It returns true only if restoration was successful, and false when
 // bootstrapping a new data directory or if restoration failed
-func (e *EtcdInitializer) restoreCorruptData() (bool, error) {
+func (e *EtcdInitializer) restoreCorruptData(selector *brtypes.SnapshotSelector) (bool, error) {
 	logger := e.Logger
 	tempRestoreOptions := *(e.Config.RestoreOptions.DeepCopy())
+	if selector != nil {
+		tempRestoreOptions.Config.SnapshotSelector = *selector
+	}
 	dataDir := tempRestoreOptions.Config.DataDir
 
 	if e.Config.SnapstoreConfig == nil || len(e.Config.SnapstoreConfig.Provider) == 0 {
@@ -179,10 +185,11 @@ func (e *EtcdInitializer) restoreCorruptData() (bool, error) {
 		err = fmt.Errorf("failed to create snapstore from configured storage provider: %v", err)
 		return false, err
 	}
-	logger.Info("Finding latest set of snapshot to recover from...")
-	baseSnap, deltaSnapList, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+	target := tempRestoreOptions.Config.RestoreTarget()
+	logger.Infof("Finding set of snapshot to recover from the %s up to the %s...", tempRestoreOptions.Config.SnapshotSelector, target)
+	baseSnap, deltaSnapList, err := miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, tempRestoreOptions.Config.SnapshotSelector, target)
 	if err != nil {
-		logger.Errorf("failed to get latest set of snapshot: %v", err)
+		logger.Errorf("failed to get set of snapshot to recover from: %v", err)
 		return false, err
 	}
 	if baseSnap == nil && (deltaSnapList == nil || len(deltaSnapList) == 0) {
@@ -196,14 +203,16 @@ func (e *EtcdInitializer) restoreCorruptData() (bool, error) {
 	tempRestoreOptions.DeltaSnapList = deltaSnapList
 	tempRestoreOptions.Config.DataDir = fmt.Sprintf("%s.%s", tempRestoreOptions.Config.DataDir, "part")
 
-	if err := e.removeDir(tempRestoreOptions.Config.DataDir); err != nil {
-		return false, fmt.Errorf("failed to delete previous temporary data directory: %v", err)
-	}
-
 	rs, err := restorer.NewRestorer(store, logrus.NewEntry(logger))
 	if err != nil {
 		return false, err
 	}
+	// The temporary data directory of an interrupted restoration of the same snapshots is kept to resume it.
+	if rs.IsResumable(tempRestoreOptions) {
+		logger.Infof("Resuming the interrupted restoration into the temporary data directory %s.", tempRestoreOptions.Config.DataDir)
+	} else if err := e.removeDir(tempRestoreOptions.Config.DataDir); err != nil {
+		return false, fmt.Errorf("failed to delete previous temporary data directory: %v", err)
+	}
 	m := member.NewMemberControl(e.Config.EtcdConnectionConfig)
 	if err := rs.RestoreAndStopEtcd(tempRestoreOptions, m); err != nil {
 		err = fmt.Errorf("failed to restore snapshot: %v", err)
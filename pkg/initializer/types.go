@@ -28,5 +28,5 @@ type EtcdInitializer struct {
 
 // Initializer is the interface for etcd initialization actions.
 type Initializer interface {
-	Initialize(validator.Mode, int64) error
+	Initialize(validator.Mode, int64, *brtypes.SnapshotSelector) error
 }
@@ -0,0 +1,253 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package keyrestorer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
+	"github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+)
+
+const (
+	etcdDialTimeout = time.Second * 30
+	// maxTxnOps is the default maximum number of operations of a transaction accepted by etcd.
+	maxTxnOps = 128
+)
+
+// KeyRestorer restores the keys under some prefixes from a backup into a live etcd cluster.
+type KeyRestorer struct {
+	logger *logrus.Entry
+	store  brtypes.SnapStore
+}
+
+// NewKeyRestorer creates a key restorer.
+func NewKeyRestorer(store brtypes.SnapStore, logger *logrus.Entry) *KeyRestorer {
+	return &KeyRestorer{
+		logger: logger,
+		store:  store,
+	}
+}
+
+// RestoreKeys restores the backup into a temporary embedded etcd, and copies the keys under the configured prefixes
+// from it into the etcd cluster of the given KV client, according to the configured conflict policy.
+// Keys of the etcd cluster which are missing in the backup are not deleted, and restored keys are not attached to leases.
+// In dry-run mode, the differences are computed but not applied.
+func (kr *KeyRestorer) RestoreKeys(ctx context.Context, opts *brtypes.KeyRestoreOptions, clientKV clientv3.KV) (*brtypes.KeyRestoreResult, error) {
+	// Deepcopy restoration options ro to avoid any mutation of the passing object
+	restoreOptions := opts.RestoreOptions.DeepCopy()
+	// The restoration into the temporary embedded etcd is internal, so the restore hooks are not run.
+	restoreOptions.Config.Hooks = nil
+
+	if restoreOptions.BaseSnapshot == nil {
+		return nil, fmt.Errorf("no base snapshot found. Nothing is available to restore keys from")
+	}
+
+	dataDir := restoreOptions.Config.DataDir
+	if _, err := os.Stat(dataDir); err == nil {
+		return nil, fmt.Errorf("temporary etcd directory %s for restoration already exists", dataDir)
+	}
+	kr.logger.Infof("Creating temporary etcd directory %s for restoration.", dataDir)
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create temporary etcd directory for restoration: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dataDir); err != nil {
+			kr.logger.Errorf("Failed to remove temporary etcd directory %s: %v", dataDir, err)
+		}
+	}()
+
+	r, err := restorer.NewRestorer(kr.store, kr.logger)
+	if err != nil {
+		return nil, err
+	}
+	embeddedEtcd, err := r.Restore(*restoreOptions, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to restore snapshots into the temporary embedded etcd: %v", err)
+	}
+	// There is a possibility that restore operation may not start an embedded ETCD.
+	if embeddedEtcd == nil {
+		embeddedEtcd, err = miscellaneous.StartEmbeddedEtcd(kr.logger, restoreOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		embeddedEtcd.Server.Stop()
+		embeddedEtcd.Close()
+	}()
+
+	clientFactory := etcdutil.NewClientFactory(restoreOptions.NewClientFactory, brtypes.EtcdConnectionConfig{
+		MaxCallSendMsgSize: restoreOptions.Config.MaxCallSendMsgSize,
+		Endpoints:          []string{embeddedEtcd.Clients[0].Addr().String()},
+		InsecureTransport:  true,
+	})
+	backupKV, err := clientFactory.NewKV()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build etcd KV client of the temporary embedded etcd")
+	}
+	defer backupKV.Close()
+
+	result, values, err := kr.diff(ctx, backupKV, clientKV, opts.KeyRestorerConfig)
+	if err != nil {
+		return nil, err
+	}
+	kr.logger.Infof("Found %d keys to create, %d keys to update and %d keys to skip under the prefixes %v of the backup at revision %d; %d keys are unchanged.",
+		result.Count(brtypes.KeyRestoreActionCreate), result.Count(brtypes.KeyRestoreActionUpdate), result.Count(brtypes.KeyRestoreActionSkip), result.Prefixes, result.Revision, result.Unchanged)
+	if opts.DryRun {
+		return result, nil
+	}
+	if opts.AbortsOnConflict() {
+		if conflicts := countConflicts(result); conflicts > 0 {
+			return result, fmt.Errorf("aborted the restoration of keys, since %d keys exist in the etcd cluster with a different value", conflicts)
+		}
+	}
+	if err := kr.apply(ctx, clientKV, result, values); err != nil {
+		return result, fmt.Errorf("%v; %d of %d keys were restored before the failure", err, result.CountApplied(),
+			result.Count(brtypes.KeyRestoreActionCreate)+result.Count(brtypes.KeyRestoreActionUpdate))
+	}
+	kr.logger.Infof("Restored %d keys into the etcd cluster.", result.Count(brtypes.KeyRestoreActionCreate)+result.Count(brtypes.KeyRestoreActionUpdate))
+	return result, nil
+}
+
+// diff compares the keys under the configured prefixes in the backup and in the etcd cluster,
+// and decides about the action on each differing key according to the configured conflict policy.
+// It returns the values in the backup of the differing keys along with the result.
+func (kr *KeyRestorer) diff(ctx context.Context, backupKV, clientKV clientv3.KV, config *brtypes.KeyRestorerConfig) (*brtypes.KeyRestoreResult, map[string][]byte, error) {
+	result := &brtypes.KeyRestoreResult{
+		Prefixes:       config.Prefixes,
+		ConflictPolicy: config.ConflictPolicy,
+		DryRun:         config.DryRun,
+	}
+	var (
+		seen      = make(map[string]bool)
+		values    = make(map[string][]byte)
+		conflicts int
+	)
+	for _, prefix := range config.Prefixes {
+		getCtx, cancel := context.WithTimeout(ctx, etcdDialTimeout)
+		backupResp, err := backupKV.Get(getCtx, prefix, clientv3.WithPrefix())
+		cancel()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get the keys under the prefix %s from the backup: %v", prefix, err)
+		}
+		result.Revision = backupResp.Header.Revision
+
+		getCtx, cancel = context.WithTimeout(ctx, etcdDialTimeout)
+		clusterResp, err := clientKV.Get(getCtx, prefix, clientv3.WithPrefix())
+		cancel()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get the keys under the prefix %s from the etcd cluster: %v", prefix, err)
+		}
+		clusterKVs := make(map[string]*mvccpb.KeyValue, len(clusterResp.Kvs))
+		for _, kv := range clusterResp.Kvs {
+			clusterKVs[string(kv.Key)] = kv
+		}
+
+		for _, kv := range backupResp.Kvs {
+			key := string(kv.Key)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			clusterKV, ok := clusterKVs[key]
+			switch {
+			case !ok:
+				values[key] = kv.Value
+				result.Diffs = append(result.Diffs, brtypes.KeyDiff{Key: key, Action: brtypes.KeyRestoreActionCreate, BackupModRevision: kv.ModRevision})
+			case bytes.Equal(kv.Value, clusterKV.Value):
+				result.Unchanged++
+			default:
+				values[key] = kv.Value
+				conflicts++
+				action := brtypes.KeyRestoreActionSkip
+				if config.ConflictPolicy == brtypes.KeyConflictPolicyOverwrite {
+					action = brtypes.KeyRestoreActionUpdate
+				}
+				result.Diffs = append(result.Diffs, brtypes.KeyDiff{Key: key, Action: action, BackupModRevision: kv.ModRevision, ModRevision: clusterKV.ModRevision})
+			}
+		}
+	}
+
+	if conflicts > 0 && config.AbortsOnConflict() {
+		kr.logger.Warnf("Aborting the restoration of all keys, since %d keys exist in the etcd cluster with a different value.", conflicts)
+		for i := range result.Diffs {
+			result.Diffs[i].Action = brtypes.KeyRestoreActionSkip
+		}
+	}
+	sort.Slice(result.Diffs, func(i, j int) bool {
+		return result.Diffs[i].Key < result.Diffs[j].Key
+	})
+	return result, values, nil
+}
+
+// countConflicts returns the number of differing keys of the given result which exist in the etcd cluster.
+func countConflicts(result *brtypes.KeyRestoreResult) int {
+	conflicts := 0
+	for _, diff := range result.Diffs {
+		if diff.ModRevision != 0 {
+			conflicts++
+		}
+	}
+	return conflicts
+}
+
+// apply puts the given values of the created and updated keys of the given result into the etcd cluster.
+// The keys are only put if they have not changed in the etcd cluster since they were compared. Since the keys
+// are put in several transactions, the keys of the committed transactions are marked as applied in the result.
+func (kr *KeyRestorer) apply(ctx context.Context, clientKV clientv3.KV, result *brtypes.KeyRestoreResult, values map[string][]byte) error {
+	var (
+		cmps  []clientv3.Cmp
+		ops   []clientv3.Op
+		batch []int
+	)
+	commit := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		txnCtx, cancel := context.WithTimeout(ctx, etcdDialTimeout)
+		defer cancel()
+		resp, err := clientKV.Txn(txnCtx).If(cmps...).Then(ops...).Commit()
+		if err != nil {
+			return fmt.Errorf("failed to put the restored keys into the etcd cluster: %v", err)
+		}
+		if !resp.Succeeded {
+			return fmt.Errorf("failed to put the restored keys into the etcd cluster, since some of them changed during the restoration")
+		}
+		for _, i := range batch {
+			result.Diffs[i].Applied = true
+		}
+		cmps, ops, batch = cmps[:0], ops[:0], batch[:0]
+		return nil
+	}
+	for i, diff := range result.Diffs {
+		switch diff.Action {
+		case brtypes.KeyRestoreActionCreate:
+			cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(diff.Key), "=", 0))
+		case brtypes.KeyRestoreActionUpdate:
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(diff.Key), "=", diff.ModRevision))
+		default:
+			continue
+		}
+		ops = append(ops, clientv3.OpPut(diff.Key, string(values[diff.Key])))
+		batch = append(batch, i)
+		if len(ops) >= maxTxnOps {
+			if err := commit(); err != nil {
+				return err
+			}
+		}
+	}
+	return commit()
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package keyrestorer_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/compressor"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/test/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+)
+
+const (
+	embeddedEtcdPortNo = "9089"
+)
+
+var (
+	testSuiteDir, testEtcdDir, testSnapshotDir string
+	testCtx                                    = context.Background()
+	logger                                     = logrus.New().WithField("suite", "keyrestorer")
+	etcd                                       *embed.Etcd
+	err                                        error
+	endpoints                                  []string
+	// backupKeys are the keys and values in the backup.
+	backupKeys = map[string]string{
+		"/registry/ns-a/k1": "a1",
+		"/registry/ns-a/k2": "a2",
+		"/registry/ns-a/k3": "a3",
+		"/registry/ns-b/k1": "b1",
+	}
+)
+
+func TestKeyRestorer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "KeyRestorer Suite")
+}
+
+var _ = SynchronizedBeforeSuite(func() []byte {
+	var (
+		data []byte
+	)
+
+	testSuiteDir, err = os.MkdirTemp("/tmp", "keyrestorer-test-")
+	Expect(err).ShouldNot(HaveOccurred())
+	testEtcdDir = fmt.Sprintf("%s/etcd/default.etcd", testSuiteDir)
+	testSnapshotDir = fmt.Sprintf("%s/etcd/snapshotter.bkp", testSuiteDir)
+
+	// Start the live ETCD process that will run until all key restoration test cases are run
+	etcd, err = utils.StartEmbeddedEtcd(testCtx, testEtcdDir, logger, utils.DefaultEtcdName, embeddedEtcdPortNo)
+	Expect(err).ShouldNot(HaveOccurred())
+	endpoints = []string{etcd.Clients[0].Addr().String()}
+
+	cli, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 10 * time.Second})
+	Expect(err).ShouldNot(HaveOccurred())
+	defer cli.Close()
+	for key, value := range backupKeys {
+		_, err := cli.Put(testCtx, key, value)
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	// Take a full snapshot of the ETCD database
+	ctx, cancel := context.WithTimeout(testCtx, 2*time.Second)
+	defer cancel()
+	snapstoreConfig := brtypes.SnapstoreConfig{Container: testSnapshotDir, Provider: "Local"}
+	err = utils.RunSnapshotter(logger, snapstoreConfig, time.Second, endpoints, ctx.Done(), true, compressor.NewCompressorConfig())
+	Expect(err).ShouldNot(HaveOccurred())
+	return data
+}, func(data []byte) {})
+
+var _ = SynchronizedAfterSuite(func() {}, cleanUp)
+
+func cleanUp() {
+	logger.Info("Stop the Embedded etcd server.")
+	etcd.Server.Stop()
+	etcd.Close()
+
+	logger.Infof("All tests are done for key restorer suite. %s is being removed.", testSuiteDir)
+	err = os.RemoveAll(testSuiteDir)
+	Expect(err).ShouldNot(HaveOccurred())
+}
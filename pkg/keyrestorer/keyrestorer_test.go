@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package keyrestorer_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/keyrestorer"
+	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/pkg/types"
+)
+
+var _ = Describe("Running KeyRestorer", func() {
+	var (
+		cli         *clientv3.Client
+		kr          *keyrestorer.KeyRestorer
+		restoreOpts *brtypes.RestoreOptions
+	)
+	const (
+		restoreCluster = "default=http://localhost:2380"
+		restorePeerURL = "http://localhost:2380"
+	)
+
+	BeforeEach(func() {
+		store, err := snapstore.GetSnapstore(&brtypes.SnapstoreConfig{Container: testSnapshotDir, Provider: "Local"})
+		Expect(err).ShouldNot(HaveOccurred())
+		kr = keyrestorer.NewKeyRestorer(store, logger)
+
+		clusterUrlsMap, err := types.NewURLsMap(restoreCluster)
+		Expect(err).ShouldNot(HaveOccurred())
+		peerUrls, err := types.NewURLs([]string{restorePeerURL})
+		Expect(err).ShouldNot(HaveOccurred())
+		restorationConfig := brtypes.NewRestorationConfig()
+		restorationConfig.InitialCluster = restoreCluster
+		restorationConfig.InitialAdvertisePeerURLs = []string{restorePeerURL}
+		restorationConfig.DataDir = filepath.Join(testSuiteDir, "key-restore.etcd")
+		restorationConfig.TempSnapshotsDir = filepath.Join(testSuiteDir, "key-restore.tmp")
+		restoreOpts = &brtypes.RestoreOptions{
+			Config:      restorationConfig,
+			ClusterURLs: clusterUrlsMap,
+			PeerURLs:    peerUrls,
+		}
+		restoreOpts.BaseSnapshot, restoreOpts.DeltaSnapList, err = miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		cli, err = clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 10 * time.Second})
+		Expect(err).ShouldNot(HaveOccurred())
+		// reset the live etcd to the backup, then delete and change some keys
+		for key, value := range backupKeys {
+			_, err := cli.Put(testCtx, key, value)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		_, err = cli.Delete(testCtx, "/registry/ns-a/k1")
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = cli.Put(testCtx, "/registry/ns-a/k2", "changed")
+		Expect(err).ShouldNot(HaveOccurred())
+		_, err = cli.Delete(testCtx, "/registry/ns-b/k1")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(cli.Close()).To(Succeed())
+	})
+
+	restoreKeysWithError := func(policy string, dryRun bool) (*brtypes.KeyRestoreResult, error) {
+		result, err := kr.RestoreKeys(testCtx, &brtypes.KeyRestoreOptions{
+			RestoreOptions: restoreOpts,
+			KeyRestorerConfig: &brtypes.KeyRestorerConfig{
+				Prefixes:       []string{"/registry/ns-a/"},
+				ConflictPolicy: policy,
+				DryRun:         dryRun,
+			},
+		}, cli)
+		_, statErr := os.Stat(restoreOpts.Config.DataDir)
+		Expect(os.IsNotExist(statErr)).To(BeTrue())
+		return result, err
+	}
+
+	restoreKeys := func(policy string, dryRun bool) *brtypes.KeyRestoreResult {
+		result, err := restoreKeysWithError(policy, dryRun)
+		Expect(err).ShouldNot(HaveOccurred())
+		return result
+	}
+
+	expectValue := func(key, value string) {
+		resp, err := cli.Get(testCtx, key)
+		Expect(err).ShouldNot(HaveOccurred())
+		if len(value) == 0 {
+			Expect(resp.Kvs).To(BeEmpty())
+			return
+		}
+		Expect(resp.Kvs).To(HaveLen(1))
+		Expect(string(resp.Kvs[0].Value)).To(Equal(value))
+	}
+
+	Context("in dry-run mode", func() {
+		It("should report the differences without changing the etcd cluster", func() {
+			result := restoreKeys(brtypes.KeyConflictPolicyOverwrite, true)
+			Expect(result.Diffs).To(HaveLen(2))
+			Expect(result.Diffs[0].Key).To(Equal("/registry/ns-a/k1"))
+			Expect(result.Diffs[0].Action).To(Equal(brtypes.KeyRestoreActionCreate))
+			Expect(result.Diffs[1].Key).To(Equal("/registry/ns-a/k2"))
+			Expect(result.Diffs[1].Action).To(Equal(brtypes.KeyRestoreActionUpdate))
+			Expect(result.Unchanged).To(Equal(1))
+			Expect(result.CountApplied()).To(Equal(0))
+
+			expectValue("/registry/ns-a/k1", "")
+			expectValue("/registry/ns-a/k2", "changed")
+		})
+	})
+
+	Context("with the overwrite conflict policy", func() {
+		It("should restore the missing and changed keys under the prefixes only", func() {
+			result := restoreKeys(brtypes.KeyConflictPolicyOverwrite, false)
+			Expect(result.Count(brtypes.KeyRestoreActionCreate)).To(Equal(1))
+			Expect(result.Count(brtypes.KeyRestoreActionUpdate)).To(Equal(1))
+			Expect(result.CountApplied()).To(Equal(2))
+
+			expectValue("/registry/ns-a/k1", "a1")
+			expectValue("/registry/ns-a/k2", "a2")
+			expectValue("/registry/ns-a/k3", "a3")
+			expectValue("/registry/ns-b/k1", "")
+		})
+	})
+
+	Context("with the only-missing conflict policy", func() {
+		It("should restore the missing keys only", func() {
+			result := restoreKeys(brtypes.KeyConflictPolicyOnlyMissing, false)
+			Expect(result.Count(brtypes.KeyRestoreActionCreate)).To(Equal(1))
+			Expect(result.Count(brtypes.KeyRestoreActionSkip)).To(Equal(1))
+
+			expectValue("/registry/ns-a/k1", "a1")
+			expectValue("/registry/ns-a/k2", "changed")
+		})
+	})
+
+	for _, policy := range []string{brtypes.KeyConflictPolicyAbort, brtypes.KeyConflictPolicySkip} {
+		policy := policy
+		Context(fmt.Sprintf("with the %s conflict policy", policy), func() {
+			It("should fail without restoring any key if a key conflicts", func() {
+				result, err := restoreKeysWithError(policy, false)
+				Expect(err).To(HaveOccurred())
+				Expect(result.Count(brtypes.KeyRestoreActionSkip)).To(Equal(2))
+				Expect(result.CountApplied()).To(Equal(0))
+
+				expectValue("/registry/ns-a/k1", "")
+				expectValue("/registry/ns-a/k2", "changed")
+			})
+		})
+	}
+})
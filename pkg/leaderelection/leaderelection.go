@@ -11,6 +11,7 @@ import (
 
 	"github.com/gardener/etcd-backup-restore/pkg/errors"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/metrics"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 	"github.com/prometheus/client_golang/prometheus"
@@ -92,6 +93,9 @@ func (le *LeaderElector) Run(ctx context.Context) error {
 					leCancel()
 					le.Callbacks.OnStoppedLeading()
 				}
+				if le.CurrentState != StateUnknown {
+					events.Emit(events.TypeLeadershipChanged, "", events.LeadershipData{State: StateUnknown})
+				}
 				le.CurrentState = StateUnknown
 				le.logger.Infof("backup-restore is in: %v", le.CurrentState)
 				le.logger.Info("waiting for Re-election...")
@@ -109,6 +113,7 @@ func (le *LeaderElector) Run(ctx context.Context) error {
 				}
 				le.CurrentState = StateLeader
 				le.logger.Infof("backup-restore became: %v", le.CurrentState)
+				events.Emit(events.TypeLeadershipChanged, "", events.LeadershipData{State: le.CurrentState})
 
 				if le.Callbacks.OnStartedLeading != nil {
 					leCtx, leCancel = context.WithCancel(ctx)
@@ -124,6 +129,7 @@ func (le *LeaderElector) Run(ctx context.Context) error {
 				le.CurrentState = StateFollower
 				le.logger.Info("backup-restore lost the election")
 				le.logger.Infof("backup-restore became: %v", le.CurrentState)
+				events.Emit(events.TypeLeadershipChanged, "", events.LeadershipData{State: le.CurrentState})
 
 				if leCtx != nil {
 					leCancel()
@@ -135,6 +141,7 @@ func (le *LeaderElector) Run(ctx context.Context) error {
 				}
 				le.CurrentState = StateFollower
 				le.logger.Infof("backup-restore changed the state from %v to %v", StateUnknown, le.CurrentState)
+				events.Emit(events.TypeLeadershipChanged, "", events.LeadershipData{State: le.CurrentState})
 			} else if !isLeader && le.CurrentState == StateFollower {
 				le.logger.Debugf("backup-restore currentState: %v", le.CurrentState)
 
@@ -14,6 +14,7 @@ import (
 	utilError "github.com/gardener/etcd-backup-restore/pkg/errors"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
 	etcdClient "github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/metrics"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
@@ -145,6 +146,7 @@ func (m *memberControl) AddMemberAsLearner(ctx context.Context) error {
 	metrics.IsLearner.With(prometheus.Labels{}).Set(1)
 	metrics.AddLearnerDurationSeconds.With(prometheus.Labels{metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Observe(time.Since(start).Seconds())
 	m.logger.Infof("Added member %v to cluster as a learner", strconv.FormatUint(response.Member.GetID(), 16))
+	events.Emit(events.TypeMemberAdded, m.podName, events.MemberData{Name: m.podName, ID: strconv.FormatUint(response.Member.GetID(), 16), PeerURL: memberURL})
 	return nil
 }
 
@@ -308,7 +310,11 @@ func (m *memberControl) RemoveMember(ctx context.Context) error {
 		return nil
 	}
 
-	return miscellaneous.RemoveMemberFromCluster(memRemoveCtx, cli, foundMember.GetID(), &m.logger)
+	if err := miscellaneous.RemoveMemberFromCluster(memRemoveCtx, cli, foundMember.GetID(), &m.logger); err != nil {
+		return err
+	}
+	events.Emit(events.TypeMemberRemoved, m.podName, events.MemberData{Name: m.podName, ID: strconv.FormatUint(foundMember.GetID(), 16)})
+	return nil
 }
 
 // IsLearnerPresent checks for the learner(non-voting) member in a cluster.
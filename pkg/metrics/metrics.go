@@ -32,12 +32,24 @@ const (
 	LabelRestorationKind = "restore"
 	// LabelEndPoint is metric label for metric of etcd cluster endpoint.
 	LabelEndPoint = "endpoint"
+	// LabelReason is a metric label indicating the reason associated with the metric.
+	LabelReason = "reason"
+	// ValueWatchStalled is value for metric label reason when the etcd watch stalled.
+	ValueWatchStalled = "stalled"
+	// ValueWatchCompacted is value for metric label reason when the etcd watch revision got compacted.
+	ValueWatchCompacted = "compacted"
+	// ValueWatchClosed is value for metric label reason when the etcd watch channel got closed.
+	ValueWatchClosed = "closed"
+	// LabelStage is a metric label indicating the stage of an operation at which a hook is run.
+	LabelStage = "stage"
 
 	namespaceEtcdBR      = "etcdbr"
 	subsystemSnapshot    = "snapshot"
 	subsystemRestore     = "restoration"
 	subsystemSnapstore   = "snapstore"
 	subsystemSnapshotter = "snapshotter"
+	subsystemEvents      = "events"
+	subsystemHooks       = "hooks"
 )
 
 var (
@@ -56,6 +68,12 @@ var (
 			ValueRestoreSingleNode,
 		},
 		LabelEndPoint: {""},
+		LabelReason: {
+			ValueWatchStalled,
+			ValueWatchCompacted,
+			ValueWatchClosed,
+		},
+		LabelStage: hookStages(),
 	}
 
 	// GCSnapshotCounter is metric to count the garbage collected snapshots.
@@ -69,6 +87,17 @@ var (
 		[]string{LabelKind, LabelSucceeded},
 	)
 
+	// GCSnapshotBytes is metric to count the bytes of the garbage collected snapshots.
+	GCSnapshotBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshot,
+			Name:      "gc_bytes_total",
+			Help:      "Total size of garbage collected snapshots in bytes.",
+		},
+		[]string{LabelKind},
+	)
+
 	// LatestSnapshotRevision is metric to expose latest snapshot revision.
 	LatestSnapshotRevision = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -176,6 +205,94 @@ var (
 		[]string{LabelError},
 	)
 
+	// DeltaSnapshotUploadQueueDepth is metric to expose the number of sealed delta snapshots which are not yet committed.
+	DeltaSnapshotUploadQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "delta_upload_queue_depth",
+			Help:      "Number of sealed delta snapshots waiting to be uploaded to the object store.",
+		},
+		[]string{},
+	)
+
+	// DeltaSnapshotUploadLagRevisions is metric to expose the number of revisions observed on the watch but not yet persisted in an uploaded snapshot.
+	DeltaSnapshotUploadLagRevisions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "delta_upload_lag_revisions",
+			Help:      "Number of etcd revisions observed on the watch which are not yet persisted in an uploaded snapshot.",
+		},
+		[]string{},
+	)
+
+	// DeltaSnapshotEffectivePeriodSeconds is metric to expose the period after which delta snapshots are currently taken.
+	DeltaSnapshotEffectivePeriodSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "delta_effective_period_seconds",
+			Help:      "Period in seconds after which delta snapshots are currently taken.",
+		},
+		[]string{},
+	)
+
+	// WatchRecoveriesTotal is metric to count the recoveries of the snapshotter's etcd watch.
+	WatchRecoveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "watch_recoveries_total",
+			Help:      "Total number of recoveries of the etcd watch.",
+		},
+		[]string{LabelReason},
+	)
+
+	// WatchMissedRevisionsTotal is metric to count the etcd revisions which were compacted before the watch could observe them.
+	WatchMissedRevisionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "watch_missed_revisions_total",
+			Help:      "Total number of etcd revisions which were compacted before they could be captured in a delta snapshot.",
+		},
+		[]string{},
+	)
+
+	// WatchStale is metric to expose whether the etcd watch is stale.
+	WatchStale = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemSnapshotter,
+			Name:      "watch_stale",
+			Help:      "Whether the etcd watch is considered stalled, 1 if stale and 0 otherwise.",
+		},
+		[]string{},
+	)
+
+	// EventsTotal is metric to count the backup lifecycle events, by whether they were delivered.
+	EventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemEvents,
+			Name:      "total",
+			Help:      "Total number of backup lifecycle event deliveries, including the events dropped as the event buffer was full.",
+		},
+		[]string{LabelSucceeded},
+	)
+
+	// HookFailuresTotal is metric to count the failed runs of hooks, by the stage they were run at.
+	HookFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespaceEtcdBR,
+			Subsystem: subsystemHooks,
+			Name:      "failures_total",
+			Help:      "Total number of failed runs of hooks.",
+		},
+		[]string{LabelStage},
+	)
+
 	// CurrentClusterSize is metric to expose the current Etcd cluster size.
 	CurrentClusterSize = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -237,6 +354,15 @@ var (
 	)
 )
 
+// hookStages returns the stages at which hooks are run as label values.
+func hookStages() []string {
+	var stages []string
+	for _, stage := range append(brtypes.SnapshotterHookStages, brtypes.RestorationHookStages...) {
+		stages = append(stages, string(stage))
+	}
+	return stages
+}
+
 // generateLabelCombinations generates combinations of label values for metrics
 func generateLabelCombinations(labelValues map[string][]string) []map[string]string {
 	labels := make([]string, len(labelValues))
@@ -331,6 +457,15 @@ func init() {
 		GCSnapshotCounter.With(prometheus.Labels(combination))
 	}
 
+	// GCSnapshotBytes
+	gcSnapshotBytesLabelValues := map[string][]string{
+		LabelKind: labels[LabelKind],
+	}
+	gcSnapshotBytesCombinations := generateLabelCombinations(gcSnapshotBytesLabelValues)
+	for _, combination := range gcSnapshotBytesCombinations {
+		GCSnapshotBytes.With(prometheus.Labels(combination))
+	}
+
 	// LatestSnapshotRevision
 	latestSnapshotRevisionLabelValues := map[string][]string{
 		LabelKind: labels[LabelKind],
@@ -442,6 +577,48 @@ func init() {
 	//SnapshotterOperationFailure
 	SnapshotterOperationFailure.With(prometheus.Labels(map[string]string{LabelError: ""}))
 
+	// DeltaSnapshotUploadQueueDepth
+	DeltaSnapshotUploadQueueDepth.With(prometheus.Labels(map[string]string{}))
+
+	// DeltaSnapshotUploadLagRevisions
+	DeltaSnapshotUploadLagRevisions.With(prometheus.Labels(map[string]string{}))
+
+	// DeltaSnapshotEffectivePeriodSeconds
+	DeltaSnapshotEffectivePeriodSeconds.With(prometheus.Labels(map[string]string{}))
+
+	// WatchRecoveriesTotal
+	watchRecoveriesTotalLabelValues := map[string][]string{
+		LabelReason: labels[LabelReason],
+	}
+	watchRecoveriesTotalCombinations := generateLabelCombinations(watchRecoveriesTotalLabelValues)
+	for _, combination := range watchRecoveriesTotalCombinations {
+		WatchRecoveriesTotal.With(prometheus.Labels(combination))
+	}
+
+	// WatchMissedRevisionsTotal
+	WatchMissedRevisionsTotal.With(prometheus.Labels(map[string]string{}))
+
+	// WatchStale
+	WatchStale.With(prometheus.Labels(map[string]string{}))
+
+	// EventsTotal
+	eventsTotalLabelValues := map[string][]string{
+		LabelSucceeded: labels[LabelSucceeded],
+	}
+	eventsTotalCombinations := generateLabelCombinations(eventsTotalLabelValues)
+	for _, combination := range eventsTotalCombinations {
+		EventsTotal.With(prometheus.Labels(combination))
+	}
+
+	// HookFailuresTotal
+	hookFailuresTotalLabelValues := map[string][]string{
+		LabelStage: labels[LabelStage],
+	}
+	hookFailuresTotalCombinations := generateLabelCombinations(hookFailuresTotalLabelValues)
+	for _, combination := range hookFailuresTotalCombinations {
+		HookFailuresTotal.With(prometheus.Labels(combination))
+	}
+
 	//CurrentClusterSize
 	CurrentClusterSize.With(prometheus.Labels(map[string]string{}))
 
@@ -450,6 +627,7 @@ func init() {
 
 	// Metrics have to be registered to be exposed:
 	prometheus.MustRegister(GCSnapshotCounter)
+	prometheus.MustRegister(GCSnapshotBytes)
 
 	prometheus.MustRegister(LatestSnapshotRevision)
 	prometheus.MustRegister(LatestSnapshotTimestamp)
@@ -464,6 +642,14 @@ func init() {
 	prometheus.MustRegister(SnapstoreLatestDeltasRevisionsTotal)
 
 	prometheus.MustRegister(SnapshotterOperationFailure)
+	prometheus.MustRegister(DeltaSnapshotUploadQueueDepth)
+	prometheus.MustRegister(DeltaSnapshotUploadLagRevisions)
+	prometheus.MustRegister(DeltaSnapshotEffectivePeriodSeconds)
+	prometheus.MustRegister(WatchRecoveriesTotal)
+	prometheus.MustRegister(WatchMissedRevisionsTotal)
+	prometheus.MustRegister(WatchStale)
+	prometheus.MustRegister(EventsTotal)
+	prometheus.MustRegister(HookFailuresTotal)
 
 	prometheus.MustRegister(CurrentClusterSize)
 	prometheus.MustRegister(IsLearner)
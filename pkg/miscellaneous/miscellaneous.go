@@ -89,6 +89,84 @@ func GetLatestFullSnapshotAndDeltaSnapList(store brtypes.SnapStore) (*brtypes.Sn
 	return fullSnapshot, deltaSnapList, nil
 }
 
+// GetFullSnapshotAndDeltaSnapListForRestore returns the full snapshot selected by the given selector before the given
+// restore target, along with the delta snapshots after it which hold the events up to the target. The events of the last
+// delta snapshot may partly be after the target. If the selector and the target select the latest snapshots, it returns
+// the latest snapshots.
+func GetFullSnapshotAndDeltaSnapListForRestore(store brtypes.SnapStore, selector brtypes.SnapshotSelector, target brtypes.RestoreTarget) (*brtypes.Snapshot, brtypes.SnapList, error) {
+	if selector.IsLatest() && target.IsLatest() {
+		return GetLatestFullSnapshotAndDeltaSnapList(store)
+	}
+	snapList, err := store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fullSnapshotIndex := -1
+	for index, snap := range snapList {
+		if !snap.IsChunk && snap.Kind == brtypes.SnapshotKindFull && selector.Selects(snap) {
+			if !target.IncludesSnapshot(snap) {
+				if !selector.IsLatest() {
+					return nil, nil, fmt.Errorf("%s is after the restore target %s", selector, target)
+				}
+				break
+			}
+			fullSnapshotIndex = index
+		}
+	}
+	if fullSnapshotIndex == -1 {
+		return nil, nil, fmt.Errorf("no %s found before the restore target %s", selector, target)
+	}
+	return snapList[fullSnapshotIndex], getDeltaSnapListForRestore(snapList, fullSnapshotIndex, selector, target), nil
+}
+
+// GetPreviousFullSnapshotAndDeltaSnapList returns the full snapshot preceding the given full snapshot, along with the
+// delta snapshots after it which hold the events up to the given restore target, and at most as many as the given selector allows.
+// It returns a nil snapshot if there is no preceding full snapshot.
+func GetPreviousFullSnapshotAndDeltaSnapList(store brtypes.SnapStore, fullSnapshot *brtypes.Snapshot, selector brtypes.SnapshotSelector, target brtypes.RestoreTarget) (*brtypes.Snapshot, brtypes.SnapList, error) {
+	snapList, err := store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fullSnapshotIndex := -1
+	for index, snap := range snapList {
+		if snap.SnapDir == fullSnapshot.SnapDir && snap.SnapName == fullSnapshot.SnapName {
+			break
+		}
+		if !snap.IsChunk && snap.Kind == brtypes.SnapshotKindFull {
+			fullSnapshotIndex = index
+		}
+	}
+	if fullSnapshotIndex == -1 {
+		return nil, nil, nil
+	}
+	return snapList[fullSnapshotIndex], getDeltaSnapListForRestore(snapList, fullSnapshotIndex, selector, target), nil
+}
+
+// getDeltaSnapListForRestore returns the delta snapshots after the full snapshot at the given index which hold the events
+// up to the given restore target, and at most as many as the given selector allows.
+func getDeltaSnapListForRestore(snapList brtypes.SnapList, fullSnapshotIndex int, selector brtypes.SnapshotSelector, target brtypes.RestoreTarget) brtypes.SnapList {
+	var deltaSnapList brtypes.SnapList
+	for _, snap := range snapList[fullSnapshotIndex+1:] {
+		if snap.IsChunk {
+			continue
+		}
+		if snap.Kind == brtypes.SnapshotKindFull || target.Revision != 0 && snap.StartRevision > target.Revision {
+			break
+		}
+		if selector.MaxDeltaSnapshots != 0 && len(deltaSnapList) == selector.MaxDeltaSnapshots {
+			break
+		}
+		deltaSnapList = append(deltaSnapList, snap)
+		if !target.IncludesSnapshot(snap) {
+			break
+		}
+	}
+	sort.Sort(deltaSnapList)
+	return deltaSnapList
+}
+
 type backup struct {
 	FullSnapshot      *brtypes.Snapshot
 	DeltaSnapshotList brtypes.SnapList
@@ -567,21 +645,6 @@ func IsPeerURLTLSEnabled() (bool, error) {
 	return peerURL.Scheme == https, nil
 }
 
-// GetPrevScheduledSnapTime returns the previous schedule snapshot time.
-// TODO: Previous full snapshot time should be calculated on basis of previous cron schedule of full snapshot.
-func GetPrevScheduledSnapTime(nextSnapSchedule time.Time, timeWindow float64) time.Time {
-	return time.Date(
-		nextSnapSchedule.Year(),
-		nextSnapSchedule.Month(),
-		nextSnapSchedule.Day(),
-		nextSnapSchedule.Hour()-int(timeWindow),
-		nextSnapSchedule.Minute(),
-		nextSnapSchedule.Second(),
-		nextSnapSchedule.Nanosecond(),
-		nextSnapSchedule.Location(),
-	)
-}
-
 // CreateBackoff returns the backoff with Factor=2 with upper limit of 120sec.
 func CreateBackoff(retryPeriod time.Duration, steps int) wait.Backoff {
 	return wait.Backoff{
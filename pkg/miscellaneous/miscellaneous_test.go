@@ -17,6 +17,7 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -100,6 +101,104 @@ var _ = Describe("Miscellaneous Tests", func() {
 		})
 	})
 
+	Describe("Finding snapshots for a restore", func() {
+		var now time.Time
+
+		BeforeEach(func() {
+			now = time.Now().UTC().Truncate(time.Second)
+			snapList = brtypes.SnapList{}
+			for i := 0; i < 3; i++ {
+				startRevision := int64(i*30 + 1)
+				createdOn := now.Add(time.Duration(i*3-9) * time.Hour)
+				snapList = append(snapList, &brtypes.Snapshot{
+					SnapName:     fmt.Sprintf("%s-%d", brtypes.SnapshotKindFull, i),
+					Kind:         brtypes.SnapshotKindFull,
+					LastRevision: startRevision,
+					CreatedOn:    createdOn,
+				})
+				for j := 0; j < 2; j++ {
+					snapList = append(snapList, &brtypes.Snapshot{
+						SnapName:      fmt.Sprintf("%s-%d-%d", brtypes.SnapshotKindDelta, i, j),
+						Kind:          brtypes.SnapshotKindDelta,
+						StartRevision: startRevision + int64(j*10) + 1,
+						LastRevision:  startRevision + int64(j*10) + 10,
+						CreatedOn:     createdOn.Add(time.Duration(j+1) * time.Hour),
+					})
+				}
+			}
+			ds = NewDummyStore(snapList)
+		})
+
+		It("should return the latest snapshots if no target is set", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{}, brtypes.RestoreTarget{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-2"))
+			Expect(deltaSnapList).To(HaveLen(2))
+		})
+
+		It("should return the snapshots up to the delta snapshot holding the target revision", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{}, brtypes.RestoreTarget{Revision: 35})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-1"))
+			Expect(deltaSnapList).To(HaveLen(1))
+			Expect(deltaSnapList[0].SnapName).To(Equal("Incr-1-0"))
+		})
+
+		It("should return the full snapshot alone if the target revision is its revision", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{}, brtypes.RestoreTarget{Revision: 61})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-2"))
+			Expect(deltaSnapList).To(BeEmpty())
+		})
+
+		It("should return the snapshots up to the delta snapshot holding the target time", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{}, brtypes.RestoreTarget{Time: now.Add(-4*time.Hour - 30*time.Minute)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-1"))
+			Expect(deltaSnapList).To(HaveLen(2))
+			Expect(deltaSnapList[1].SnapName).To(Equal("Incr-1-1"))
+		})
+
+		It("should fail if there is no full snapshot before the target", func() {
+			_, _, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{}, brtypes.RestoreTarget{Time: now.Add(-10 * time.Hour)})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return the full snapshot of the given name and its delta snapshots", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{BaseSnapshotName: "Full-1"}, brtypes.RestoreTarget{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-1"))
+			Expect(deltaSnapList).To(HaveLen(2))
+			Expect(deltaSnapList[1].SnapName).To(Equal("Incr-1-1"))
+		})
+
+		It("should return the full snapshot of the given revision and at most the given number of delta snapshots", func() {
+			fullSnap, deltaSnapList, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{BaseSnapshotRevision: 1, MaxDeltaSnapshots: 1}, brtypes.RestoreTarget{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-0"))
+			Expect(deltaSnapList).To(HaveLen(1))
+			Expect(deltaSnapList[0].SnapName).To(Equal("Incr-0-0"))
+		})
+
+		It("should fail if the selected full snapshot does not exist or is after the target", func() {
+			_, _, err := GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{BaseSnapshotName: "Full-3"}, brtypes.RestoreTarget{})
+			Expect(err).To(HaveOccurred())
+			_, _, err = GetFullSnapshotAndDeltaSnapListForRestore(&ds, brtypes.SnapshotSelector{BaseSnapshotName: "Full-2"}, brtypes.RestoreTarget{Revision: 35})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return the full snapshot preceding the given one and its delta snapshots", func() {
+			fullSnap, deltaSnapList, err := GetPreviousFullSnapshotAndDeltaSnapList(&ds, snapList[6], brtypes.SnapshotSelector{}, brtypes.RestoreTarget{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap.SnapName).To(Equal("Full-1"))
+			Expect(deltaSnapList).To(HaveLen(2))
+
+			fullSnap, _, err = GetPreviousFullSnapshotAndDeltaSnapList(&ds, snapList[0], brtypes.SnapshotSelector{}, brtypes.RestoreTarget{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fullSnap).To(BeNil())
+		})
+	})
+
 	Describe("Etcd Cluster", func() {
 		var (
 			dummyID              = uint64(1111)
@@ -390,6 +489,96 @@ var _ = Describe("Miscellaneous Tests", func() {
 
 	})
 
+	Describe("Selecting the full snapshot source member", func() {
+		var (
+			logger    = logrus.New().WithField("actor", "snapshot-source-test")
+			endpoints = []string{"http://127.0.0.1:2379", "http://127.0.0.1:3379", "http://127.0.0.1:4379"}
+			// status of each member by endpoint, with the first member being the leader.
+			statuses map[string]*clientv3.StatusResponse
+		)
+
+		BeforeEach(func() {
+			statuses = map[string]*clientv3.StatusResponse{
+				endpoints[0]: {Leader: 1, RaftIndex: 5000, RaftAppliedIndex: 5000},
+				endpoints[1]: {Leader: 1, RaftIndex: 4990, RaftAppliedIndex: 4990},
+				endpoints[2]: {Leader: 1, RaftIndex: 4995, RaftAppliedIndex: 4995},
+			}
+			cl.EXPECT().MemberList(gomock.Any()).DoAndReturn(func(_ context.Context) (*clientv3.MemberListResponse, error) {
+				response := new(clientv3.MemberListResponse)
+				for i, endpoint := range endpoints {
+					response.Members = append(response.Members, &etcdserverpb.Member{
+						ID:         uint64(i + 1),
+						Name:       fmt.Sprintf("etcd-%d", i),
+						ClientURLs: []string{endpoint},
+					})
+				}
+				return response, nil
+			})
+			cm.EXPECT().Status(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+				status, ok := statuses[endpoint]
+				if !ok {
+					return nil, fmt.Errorf("unable to connect to the dummy etcd")
+				}
+				return status, nil
+			}).AnyTimes()
+		})
+
+		Context("with the Follower policy", func() {
+			It("should select a caught up follower", func() {
+				source, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceFollower, "", 100, time.Second, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(source.IsLeader).Should(BeFalse())
+				Expect(source.Name).Should(BeElementOf("etcd-1", "etcd-2"))
+			})
+
+			It("should not select a follower which lags behind the leader", func() {
+				statuses[endpoints[1]].RaftAppliedIndex = 100
+				source, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceFollower, "", 100, time.Second, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(source.Name).Should(Equal("etcd-2"))
+				Expect(source.Endpoint).Should(Equal(endpoints[2]))
+				Expect(source.RaftIndex).Should(Equal(uint64(4995)))
+			})
+
+			It("should fall back to the leader if no follower is healthy and caught up", func() {
+				statuses[endpoints[1]].RaftAppliedIndex = 100
+				delete(statuses, endpoints[2])
+				source, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceFollower, "", 100, time.Second, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(source.Name).Should(Equal("etcd-0"))
+				Expect(source.ID).Should(Equal("1"))
+				Expect(source.IsLeader).Should(BeTrue())
+			})
+		})
+
+		Context("with the Member policy", func() {
+			It("should select the configured member", func() {
+				source, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceMember, "etcd-1", 100, time.Second, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(source.Name).Should(Equal("etcd-1"))
+				Expect(source.IsLeader).Should(BeFalse())
+			})
+
+			It("should fall back to the leader if the configured member lags behind the leader", func() {
+				statuses[endpoints[1]].RaftAppliedIndex = 100
+				source, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceMember, "etcd-1", 100, time.Second, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(source.Name).Should(Equal("etcd-0"))
+				Expect(source.IsLeader).Should(BeTrue())
+			})
+		})
+
+		Context("without an etcd leader", func() {
+			It("should return error", func() {
+				for _, status := range statuses {
+					status.Leader = NoLeaderState
+				}
+				_, err := SelectFullSnapshotSourceMember(testCtx, cl, cm, brtypes.FullSnapshotSourceFollower, "", 100, time.Second, logger)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("BackupLeaderEndpoint", func() {
 		var (
 			portNo    = uint(8080)
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package miscellaneous
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	etcdClient "github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// memberStatus is the status of an etcd member, as reported by the member itself.
+type memberStatus struct {
+	name     string
+	id       uint64
+	endpoint string
+	leader   uint64
+	index    uint64
+	applied  uint64
+	latency  time.Duration
+}
+
+// SelectFullSnapshotSourceMember selects the etcd member from which a full snapshot is taken according to the given policy:
+//   - with the Follower policy, the follower which answered its status request the fastest, among the healthy followers
+//     whose applied raft index is at most maxRaftLag behind the committed raft index of the leader.
+//   - with the Member policy, the member of the given name, if it is healthy and caught up as above.
+//
+// The leader is selected if no member qualifies. Learners are never selected.
+// It returns an error if the leader can't be determined either.
+func SelectFullSnapshotSourceMember(ctx context.Context, cluster etcdClient.ClusterCloser, maintenance etcdClient.MaintenanceCloser, policy, memberName string, maxRaftLag uint64, timeout time.Duration, logger *logrus.Entry) (*brtypes.SnapshotSourceMember, error) {
+	listCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	membersInfo, err := cluster.MemberList(listCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the etcd members: %v", err)
+	}
+
+	var statuses []*memberStatus
+	for _, member := range membersInfo.Members {
+		if member.IsLearner || len(member.ClientURLs) == 0 {
+			continue
+		}
+		status, err := getMemberStatus(ctx, maintenance, member.Name, member.ID, member.ClientURLs[0], timeout)
+		if err != nil {
+			logger.Warnf("Not taking the full snapshot from member %s: %v", member.Name, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	leader := findLeaderStatus(statuses)
+	if leader == nil {
+		return nil, fmt.Errorf("failed to find a healthy etcd leader among %d healthy members", len(statuses))
+	}
+
+	var selected *memberStatus
+	for _, status := range statuses {
+		if status.id == leader.id {
+			continue
+		}
+		if lag := raftLag(leader.index, status.applied); lag > maxRaftLag {
+			logger.Infof("Not taking the full snapshot from member %s, which is %d raft entries behind the leader.", status.name, lag)
+			continue
+		}
+		switch policy {
+		case brtypes.FullSnapshotSourceFollower:
+			if selected == nil || status.latency < selected.latency {
+				selected = status
+			}
+		case brtypes.FullSnapshotSourceMember:
+			if status.name == memberName {
+				selected = status
+			}
+		}
+	}
+	if policy == brtypes.FullSnapshotSourceMember && leader.name == memberName {
+		selected = leader
+	}
+	if selected == nil {
+		logger.Infof("No member qualifies for the full snapshot source policy %s, falling back to the leader %s.", policy, leader.name)
+		selected = leader
+	}
+
+	return &brtypes.SnapshotSourceMember{
+		Name:      selected.name,
+		ID:        strconv.FormatUint(selected.id, 16),
+		Endpoint:  selected.endpoint,
+		IsLeader:  selected.id == leader.id,
+		RaftIndex: selected.applied,
+	}, nil
+}
+
+func getMemberStatus(ctx context.Context, maintenance etcdClient.MaintenanceCloser, name string, id uint64, endpoint string, timeout time.Duration) (*memberStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	response, err := maintenance.Status(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of etcd endpoint %s: %v", endpoint, err)
+	}
+	if len(response.Errors) != 0 {
+		return nil, fmt.Errorf("etcd endpoint %s reports errors: %v", endpoint, response.Errors)
+	}
+	return &memberStatus{
+		name:     name,
+		id:       id,
+		endpoint: endpoint,
+		leader:   response.Leader,
+		index:    response.RaftIndex,
+		applied:  response.RaftAppliedIndex,
+		latency:  time.Since(start),
+	}, nil
+}
+
+// findLeaderStatus returns the status of the member which considers itself the leader, if any.
+func findLeaderStatus(statuses []*memberStatus) *memberStatus {
+	for _, status := range statuses {
+		if status.leader != NoLeaderState && status.leader == status.id {
+			return status
+		}
+	}
+	return nil
+}
+
+func raftLag(leaderIndex, applied uint64) uint64 {
+	if applied >= leaderIndex {
+		return 0
+	}
+	return leaderIndex - applied
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/defragmentor"
 	"github.com/gardener/etcd-backup-restore/pkg/errors"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/health/heartbeat"
 	"github.com/gardener/etcd-backup-restore/pkg/health/membergarbagecollector"
 	"github.com/gardener/etcd-backup-restore/pkg/initializer"
@@ -109,6 +110,12 @@ func (b *BackupRestoreServer) Run(ctx context.Context) error {
 		b.logger.Warnf("No snapstore storage provider configured. Will not start backup schedule.")
 		runServerWithSnapshotter = false
 	}
+
+	if emitter := events.NewEmitter(b.config.EventsConfig, b.logger); emitter != nil {
+		b.logger.Info("Starting the delivery of backup lifecycle events...")
+		events.SetDefault(emitter)
+		go emitter.Run(ctx)
+	}
 	return b.runServer(ctx, options)
 }
 
@@ -133,6 +140,7 @@ func (b *BackupRestoreServer) startHTTPServer(initializer initializer.Initialize
 		EtcdConnectionConfig: etcdConfig,
 		StorageProvider:      storageProvider,
 		SnapstoreConfig:      snapstoreConfig,
+		RestorationConfig:    b.config.RestorationConfig,
 	}
 	handler.SetStatus(http.StatusServiceUnavailable)
 	b.logger.Info("Registering the http request handlers...")
@@ -378,7 +386,7 @@ func (b *BackupRestoreServer) runEtcdProbeLoopWithSnapshotter(ctx context.Contex
 			// the delta snapshot memory limit), after which a full snapshot
 			// is taken and the regular snapshot schedule comes into effect.
 
-			fullSnapshotMaxTimeWindowInHours := ssr.GetFullSnapshotMaxTimeWindow(b.config.SnapshotterConfig.FullSnapshotSchedule)
+			fullSnapshotMaxTimeWindowInHours := ssr.GetFullSnapshotSchedulesMaxTimeWindow()
 			initialDeltaSnapshotTaken = false
 			if !ssr.IsFullSnapshotRequiredAtStartup(fullSnapshotMaxTimeWindowInHours) {
 				ssrStopped, err := ssr.CollectEventsSincePrevSnapshot(ssrStopCh)
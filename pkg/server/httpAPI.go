@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
 	etcdclient "github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
@@ -27,6 +28,7 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/initializer/validator"
 	"github.com/gardener/etcd-backup-restore/pkg/member"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
+	"github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
 	"github.com/gardener/etcd-backup-restore/pkg/snapshot/snapshotter"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
@@ -87,11 +89,16 @@ type HTTPHandler struct {
 	ServerTLSKeyFile          string
 	HTTPHandlerMutex          *sync.Mutex
 	SnapstoreConfig           *brtypes.SnapstoreConfig
+	RestorationConfig         *brtypes.RestorationConfig
 }
 
 // healthCheck contains the HealthStatus of backup restore.
 type healthCheck struct {
 	HealthStatus bool `json:"health"`
+	// SnapshotterWatchStale is set if the etcd watch of the snapshotter is stalled.
+	SnapshotterWatchStale bool `json:"snapshotterWatchStale,omitempty"`
+	// LastWatchResponseTime is the time of the last response on a stale etcd watch.
+	LastWatchResponseTime *time.Time `json:"lastWatchResponseTime,omitempty"`
 }
 
 // GetStatus returns the current status in the HTTPHandler
@@ -134,6 +141,9 @@ func (h *HTTPHandler) RegisterHandler() {
 	mux.HandleFunc("/snapshot/full", h.serveFullSnapshotTrigger)
 	mux.HandleFunc("/snapshot/delta", h.serveDeltaSnapshotTrigger)
 	mux.HandleFunc("/snapshot/latest", h.serveLatestSnapshotMetadata)
+	mux.HandleFunc("/snapshot/gc/plan", h.serveGarbageCollectionPlan)
+	mux.HandleFunc("/restore/plan", h.serveRestorePlan)
+	mux.HandleFunc("/snapshot/pin", h.serveSnapshotPin)
 	mux.HandleFunc("/config", h.serveConfig)
 	mux.HandleFunc("/healthz", h.serveHealthz)
 	mux.Handle("/metrics", promhttp.Handler())
@@ -196,12 +206,18 @@ func (h *HTTPHandler) Stop() error {
 // serveHealthz serves the health status of the server
 func (h *HTTPHandler) serveHealthz(rw http.ResponseWriter, req *http.Request) {
 	h.checkAndSetSecurityHeaders(rw)
-	rw.WriteHeader(h.GetStatus())
-	healthCheck := &healthCheck{
-		HealthStatus: func() bool {
-			return h.GetStatus() == http.StatusOK
-		}(),
+	status := h.GetStatus()
+	healthCheck := &healthCheck{}
+	// a stale watch means that no delta snapshots are taken, so it is reported as unhealthy.
+	if ssr := h.Snapshotter; status == http.StatusOK && ssr != nil && ssr.IsWatchStale() {
+		healthCheck.SnapshotterWatchStale = true
+		if lastWatchResponseTime := ssr.LastWatchResponseTime(); !lastWatchResponseTime.IsZero() {
+			healthCheck.LastWatchResponseTime = &lastWatchResponseTime
+		}
+		status = http.StatusServiceUnavailable
 	}
+	healthCheck.HealthStatus = status == http.StatusOK
+	rw.WriteHeader(status)
 	json, err := json.Marshal(healthCheck)
 	if err != nil {
 		h.Logger.Errorf("Unable to marshal health status to json: %v", err)
@@ -247,7 +263,18 @@ func (h *HTTPHandler) serveInitialize(rw http.ResponseWriter, req *http.Request)
 				mode = validator.Full
 			}
 			h.Logger.Infof("Validation mode: %s", mode)
-			err := h.Initializer.Initialize(mode, failBelowRevision)
+			selector, err := parseSnapshotSelector(req.URL.Query())
+			if err != nil {
+				h.initializationStatusMutex.Lock()
+				defer h.initializationStatusMutex.Unlock()
+				h.Logger.Errorf("Failed initialization due wrong snapshot selection parameters: %v", err)
+				h.initializationStatus = initializationStatusFailed
+				return
+			}
+			if selector != nil {
+				h.Logger.Infof("Restoring from the %s if required", selector)
+			}
+			err = h.Initializer.Initialize(mode, failBelowRevision, selector)
 			h.initializationStatusMutex.Lock()
 			defer h.initializationStatusMutex.Unlock()
 			if err != nil {
@@ -262,6 +289,35 @@ func (h *HTTPHandler) serveInitialize(rw http.ResponseWriter, req *http.Request)
 	rw.WriteHeader(http.StatusOK)
 }
 
+// parseSnapshotSelector parses the parameters `basesnapshot`, `basesnapshotrevision`, `maxdeltasnapshots` and `fallback`
+// selecting the snapshots to restore from. It returns nil if none of them is given.
+func parseSnapshotSelector(query url.Values) (*brtypes.SnapshotSelector, error) {
+	if !query.Has("basesnapshot") && !query.Has("basesnapshotrevision") && !query.Has("maxdeltasnapshots") && !query.Has("fallback") {
+		return nil, nil
+	}
+	selector := &brtypes.SnapshotSelector{BaseSnapshotName: query.Get("basesnapshot")}
+	var err error
+	if value := query.Get("basesnapshotrevision"); len(value) != 0 {
+		if selector.BaseSnapshotRevision, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid parameter value `basesnapshotrevision`: %v", err)
+		}
+	}
+	if value := query.Get("maxdeltasnapshots"); len(value) != 0 {
+		if selector.MaxDeltaSnapshots, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid parameter value `maxdeltasnapshots`: %v", err)
+		}
+	}
+	if value := query.Get("fallback"); len(value) != 0 {
+		if selector.FallbackToPreviousSnapshot, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid parameter value `fallback`: %v", err)
+		}
+	}
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
+
 // serveInitializationStatus serves the etcd initialization progress status
 func (h *HTTPHandler) serveInitializationStatus(rw http.ResponseWriter, req *http.Request) {
 	h.checkAndSetSecurityHeaders(rw)
@@ -392,6 +448,201 @@ func (h *HTTPHandler) serveLatestSnapshotMetadata(rw http.ResponseWriter, req *h
 	rw.Write(json)
 }
 
+func (h *HTTPHandler) serveGarbageCollectionPlan(rw http.ResponseWriter, req *http.Request) {
+	h.checkAndSetSecurityHeaders(rw)
+	if h.Snapshotter == nil {
+		if len(h.StorageProvider) > 0 {
+			h.Logger.Info("Fowarding the request of garbage collection plan to backup-restore leader")
+			h.delegateReqToLeader(rw, req)
+			return
+		}
+		h.Logger.Warnf("Ignoring garbage collection plan request as snapshotter is not configured")
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, err := snapstore.GetSnapstore(h.SnapstoreConfig)
+	if err != nil {
+		h.Logger.Warnf("Unable to create snapstore from configured storage provider: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	plan, err := h.Snapshotter.PlanGarbageCollection(store)
+	if err != nil {
+		h.Logger.Warnf("Unable to plan garbage collection: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json, err := json.Marshal(plan)
+	if err != nil {
+		h.Logger.Warnf("Unable to marshal garbage collection plan to json: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(json)
+}
+
+// serveSnapshotPin lists the pinned snapshots on GET, pins the snapshot given by the request parameter 'snapshot'
+// on POST, with the optional request parameters 'reason' and 'ttl', and unpins it on DELETE.
+func (h *HTTPHandler) serveSnapshotPin(rw http.ResponseWriter, req *http.Request) {
+	h.checkAndSetSecurityHeaders(rw)
+	if len(h.StorageProvider) == 0 {
+		h.Logger.Warnf("Ignoring snapshot pin request as snapstore is not configured")
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	store, err := snapstore.GetSnapstore(h.SnapstoreConfig)
+	if err != nil {
+		h.Logger.Warnf("Unable to create snapstore from configured storage provider: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var resp interface{}
+	switch req.Method {
+	case http.MethodGet:
+		if resp, err = snapstore.ListSnapshotPins(store); err != nil {
+			h.Logger.Warnf("Unable to list snapshot pins: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost, http.MethodDelete:
+		snapName := req.URL.Query().Get("snapshot")
+		if len(snapName) == 0 {
+			h.Logger.Warnf("Missing request parameter 'snapshot'")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if ttlValue := req.URL.Query().Get("ttl"); ttlValue != "" {
+			if ttl, err = time.ParseDuration(ttlValue); err != nil {
+				h.Logger.Warnf("Could not parse request parameter 'ttl' to duration: %v", err)
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		snapList, err := store.List()
+		if err != nil {
+			h.Logger.Warnf("Unable to list snapshots from snapstore: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		snap := snapstore.FindSnapshot(snapList, snapName)
+		if snap == nil {
+			h.Logger.Warnf("Snapshot %s not found in snapstore", snapName)
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pinned := brtypes.PinnedSnapshot{Snapshot: snap}
+		if req.Method == http.MethodPost {
+			pinned.Pin = brtypes.NewSnapshotPin(req.URL.Query().Get("reason"), ttl, time.Now())
+			if err := snapstore.PinSnapshot(store, *snap, pinned.Pin); err != nil {
+				h.Logger.Warnf("Unable to pin snapshot: %v", err)
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			h.Logger.Infof("Snapshot %s %s", snapName, pinned.Pin)
+		} else {
+			if err := snapstore.UnpinSnapshot(store, *snap); err != nil {
+				h.Logger.Warnf("Unable to unpin snapshot: %v", err)
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			h.Logger.Infof("Snapshot %s unpinned", snapName)
+		}
+		resp = pinned
+
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	json, err := json.Marshal(resp)
+	if err != nil {
+		h.Logger.Warnf("Unable to marshal snapshot pins to json: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(json)
+}
+
+// serveRestorePlan serves the plan of a restoration from the configured snapstore, without restoring anything.
+// The request parameters `basesnapshot`, `basesnapshotrevision`, `maxdeltasnapshots` and `fallback` replace the
+// configured snapshot selection, and the request parameters `targetrevision` and `targettime` the configured target.
+func (h *HTTPHandler) serveRestorePlan(rw http.ResponseWriter, req *http.Request) {
+	h.checkAndSetSecurityHeaders(rw)
+	if len(h.StorageProvider) == 0 || h.RestorationConfig == nil {
+		h.Logger.Warnf("Ignoring restoration plan request as snapstore is not configured")
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := *h.RestorationConfig
+	query := req.URL.Query()
+	selector, err := parseSnapshotSelector(query)
+	if err != nil {
+		h.Logger.Warnf("Invalid snapshot selection parameters: %v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if selector != nil {
+		config.SnapshotSelector = *selector
+	}
+	if query.Has("targetrevision") || query.Has("targettime") {
+		config.TargetRevision, config.TargetTime = 0, query.Get("targettime")
+		if value := query.Get("targetrevision"); len(value) != 0 {
+			if config.TargetRevision, err = strconv.ParseInt(value, 10, 64); err != nil {
+				h.Logger.Warnf("Invalid parameter value `targetrevision`: %v", err)
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if err := config.Validate(); err != nil {
+		h.Logger.Warnf("Invalid restoration plan parameters: %v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	store, err := snapstore.GetSnapstore(h.SnapstoreConfig)
+	if err != nil {
+		h.Logger.Warnf("Unable to create snapstore from configured storage provider: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	baseSnap, deltaSnapList, err := miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, config.SnapshotSelector, config.RestoreTarget())
+	if err != nil {
+		h.Logger.Warnf("Unable to get snapshots to restore from: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if baseSnap == nil {
+		h.Logger.Warnf("No base snapshot found to restore from")
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	plan := restorer.NewRestorePlan(brtypes.RestoreOptions{
+		Config:        &config,
+		BaseSnapshot:  baseSnap,
+		DeltaSnapList: deltaSnapList,
+	})
+	json, err := json.Marshal(plan)
+	if err != nil {
+		h.Logger.Warnf("Unable to marshal restoration plan to json: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(json)
+}
+
 func (h *HTTPHandler) serveConfig(rw http.ResponseWriter, req *http.Request) {
 	inputFileName := miscellaneous.EtcdConfigFilePath
 	dir, err := os.UserHomeDir()
@@ -30,6 +30,7 @@ func NewBackupRestoreComponentConfig() *BackupRestoreComponentConfig {
 		HealthConfig:             brtypes.NewHealthConfig(),
 		LeaderElectionConfig:     brtypes.NewLeaderElectionConfig(),
 		ExponentialBackoffConfig: brtypes.NewExponentialBackOffConfig(),
+		EventsConfig:             brtypes.NewEventsConfig(),
 	}
 }
 
@@ -44,6 +45,7 @@ func (c *BackupRestoreComponentConfig) AddFlags(fs *flag.FlagSet) {
 	c.HealthConfig.AddFlags(fs)
 	c.LeaderElectionConfig.AddFlags(fs)
 	c.ExponentialBackoffConfig.AddFlags(fs)
+	c.EventsConfig.AddFlags(fs)
 
 	// Miscellaneous
 	fs.StringVar(&c.DefragmentationSchedule, "defragmentation-schedule", c.DefragmentationSchedule, "schedule to defragment etcd data directory")
@@ -81,6 +83,9 @@ func (c *BackupRestoreComponentConfig) Validate() error {
 	if err := c.ExponentialBackoffConfig.Validate(); err != nil {
 		return err
 	}
+	if err := c.EventsConfig.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
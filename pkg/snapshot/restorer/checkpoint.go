@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/member"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"go.etcd.io/etcd/embed"
+)
+
+// restoreCheckpointFileName is the name of the file in the restoration temp directory the progress of a restoration is persisted in.
+const restoreCheckpointFileName = "restoration.checkpoint.json"
+
+// errRestoreCheckpointMismatch is returned when the restored data is not at the revision of the restoration checkpoint,
+// e.g. since the restoration was interrupted in the middle of a delta snapshot.
+var errRestoreCheckpointMismatch = errors.New("restoration checkpoint mismatch")
+
+// restoreCheckpoint is the progress of a restoration, from which an interrupted restoration is resumed.
+type restoreCheckpoint struct {
+	// DataDir is the data directory being restored.
+	DataDir string `json:"dataDir"`
+	// BaseSnapshot is the path of the base snapshot the data directory was restored from.
+	BaseSnapshot string `json:"baseSnapshot"`
+	// BaseSnapshotHash is the verified sha256 hash of the base snapshot, if it has one.
+	BaseSnapshotHash string `json:"baseSnapshotHash,omitempty"`
+	// Target is the target of the restoration.
+	Target brtypes.RestoreTarget `json:"target"`
+	// AppliedDeltaSnapshots is the number of delta snapshots fully applied.
+	AppliedDeltaSnapshots int `json:"appliedDeltaSnapshots"`
+	// LastAppliedDeltaSnapshot is the path of the last delta snapshot fully applied.
+	LastAppliedDeltaSnapshot string `json:"lastAppliedDeltaSnapshot,omitempty"`
+	// Revision is the revision of the embedded etcd after applying the last delta snapshot.
+	Revision int64 `json:"revision,omitempty"`
+	// UpdatedAt is the time the checkpoint was last persisted.
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// restoreCheckpointPath returns the path of the checkpoint file of the restoration with the given options.
+func restoreCheckpointPath(ro brtypes.RestoreOptions) string {
+	return filepath.Join(ro.Config.TempSnapshotsDir, restoreCheckpointFileName)
+}
+
+// readRestoreCheckpoint reads the checkpoint file at the given path. It returns nil if the file does not exist.
+func readRestoreCheckpoint(filePath string) (*restoreCheckpoint, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	checkpoint := &restoreCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal restoration checkpoint %s: %v", filePath, err)
+	}
+	return checkpoint, nil
+}
+
+// save persists the checkpoint at the given path. The file is replaced atomically, so that an interruption
+// leaves either the previous or the new checkpoint.
+func (c *restoreCheckpoint) save(filePath string) error {
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tempFilePath := filePath + ".tmp"
+	f, err := os.OpenFile(tempFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, filePath)
+}
+
+// resumes returns an error if the restoration with the given options and target does not resume the restoration of the checkpoint.
+func (c *restoreCheckpoint) resumes(ro brtypes.RestoreOptions, target brtypes.RestoreTarget) error {
+	if c.DataDir != ro.Config.DataDir {
+		return fmt.Errorf("checkpoint is of data directory %s", c.DataDir)
+	}
+	if baseSnapshot := path.Join(ro.BaseSnapshot.SnapDir, ro.BaseSnapshot.SnapName); c.BaseSnapshot != baseSnapshot {
+		return fmt.Errorf("checkpoint is of base snapshot %s instead of %s", c.BaseSnapshot, baseSnapshot)
+	}
+	if c.Target != target {
+		return fmt.Errorf("checkpoint is of restore target %s instead of %s", c.Target, target)
+	}
+	if c.AppliedDeltaSnapshots > len(ro.DeltaSnapList) {
+		return fmt.Errorf("checkpoint has %d delta snapshots applied, but only %d are to be applied", c.AppliedDeltaSnapshots, len(ro.DeltaSnapList))
+	}
+	if c.AppliedDeltaSnapshots > 0 {
+		lastApplied := ro.DeltaSnapList[c.AppliedDeltaSnapshots-1]
+		if lastAppliedDeltaSnapshot := path.Join(lastApplied.SnapDir, lastApplied.SnapName); c.LastAppliedDeltaSnapshot != lastAppliedDeltaSnapshot {
+			return fmt.Errorf("checkpoint has delta snapshot %s applied instead of %s", c.LastAppliedDeltaSnapshot, lastAppliedDeltaSnapshot)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ro.Config.DataDir, "member")); err != nil {
+		return fmt.Errorf("member directory of the checkpoint is not accessible: %v", err)
+	}
+	return nil
+}
+
+// IsResumable returns true if the restoration with the given options resumes an interrupted restoration
+// from its checkpoint, instead of restoring the base snapshot into an empty data directory.
+func (r *Restorer) IsResumable(ro brtypes.RestoreOptions) bool {
+	checkpoint, err := readRestoreCheckpoint(restoreCheckpointPath(ro))
+	if err != nil || checkpoint == nil {
+		return false
+	}
+	return checkpoint.resumes(ro, ro.Config.RestoreTarget()) == nil
+}
+
+// loadRestoreCheckpoint returns the checkpoint of the interrupted restoration which the restoration with the
+// given options resumes, or nil if there is none. A checkpoint of another restoration is removed.
+func (r *Restorer) loadRestoreCheckpoint(ro brtypes.RestoreOptions) *restoreCheckpoint {
+	checkpointPath := restoreCheckpointPath(ro)
+	checkpoint, err := readRestoreCheckpoint(checkpointPath)
+	if err == nil && checkpoint == nil {
+		return nil
+	}
+	if err == nil {
+		err = checkpoint.resumes(ro, r.target)
+	}
+	if err != nil {
+		r.logger.Warnf("Ignoring restoration checkpoint %s: %v", checkpointPath, err)
+		if err := os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+			r.logger.Errorf("Failed to remove restoration checkpoint %s: %v", checkpointPath, err)
+		}
+		return nil
+	}
+	return checkpoint
+}
+
+// recordAppliedDeltaSnapshot persists that the given delta snapshot is fully applied, and the embedded etcd is at
+// the given revision. The revision is 0 if no event of the snapshot was applied. A failure to persist the progress
+// does not fail the restoration, but a restart then resumes from an earlier checkpoint.
+func (r *Restorer) recordAppliedDeltaSnapshot(snap *brtypes.Snapshot, revision int64) {
+	if r.checkpoint == nil {
+		return
+	}
+	r.checkpoint.AppliedDeltaSnapshots++
+	r.checkpoint.LastAppliedDeltaSnapshot = path.Join(snap.SnapDir, snap.SnapName)
+	if revision != 0 {
+		r.checkpoint.Revision = revision
+	}
+	if err := r.checkpoint.save(r.checkpointPath); err != nil {
+		r.logger.Warnf("Failed to persist restoration checkpoint %s: %v", r.checkpointPath, err)
+	}
+}
+
+// restartRestoration discards the data directory and the checkpoint of the resumed restoration, whose revision does
+// not match the restored data, and restarts the restoration from the base snapshot.
+func (r *Restorer) restartRestoration(ro brtypes.RestoreOptions, m member.Control, cause error) (*embed.Etcd, error) {
+	r.logger.Warnf("Restarting the restoration from the base snapshot: %v", cause)
+	if err := os.Remove(r.checkpointPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove restoration checkpoint %s: %v", r.checkpointPath, err)
+	}
+	if err := os.RemoveAll(ro.Config.DataDir); err != nil {
+		return nil, fmt.Errorf("failed to remove data directory %s: %v", ro.Config.DataDir, err)
+	}
+	return r.restore(ro, m)
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"go.etcd.io/etcd/etcdserver/api/membership"
+	"go.etcd.io/etcd/pkg/types"
+)
+
+// stagingDirName is the name of the directory in the data directory into which the backup is restored once for all members.
+const stagingDirName = ".staging"
+
+// RestoreMembers restores the data directories of all members of the initial cluster of the given options, each into
+// the sub directory of the data directory named after the member. The snapshots are fetched and applied only once,
+// into a staging data directory restored as a single member cluster. Its database is then copied into the data
+// directory of each member, along with the WAL and raft snapshot of the member in the whole cluster.
+// It returns the data directories of the members by name.
+func (r *Restorer) RestoreMembers(ro brtypes.RestoreOptions) (map[string]string, error) {
+	names := make([]string, 0, len(ro.ClusterURLs))
+	for name := range ro.ClusterURLs {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no members found in the initial cluster")
+	}
+	sort.Strings(names)
+
+	dataDirs := make(map[string]string, len(names))
+	for _, name := range names {
+		dataDir := filepath.Join(ro.Config.DataDir, name)
+		if _, err := os.Stat(filepath.Join(dataDir, "member")); err == nil {
+			return nil, fmt.Errorf("member directory in data directory(%q) of member %s exists", dataDir, name)
+		}
+		dataDirs[name] = dataDir
+	}
+
+	staging := ro.DeepCopy()
+	staging.Config.DataDir = filepath.Join(ro.Config.DataDir, stagingDirName)
+	staging.Config.Name = names[0]
+	staging.ClusterURLs = types.URLsMap{names[0]: ro.ClusterURLs[names[0]]}
+	staging.PeerURLs = ro.ClusterURLs[names[0]]
+	r.logger.Infof("Restoring the backup into the staging data directory %s for %d members.", staging.Config.DataDir, len(names))
+	if err := r.RestoreAndStopEtcd(*staging, nil); err != nil {
+		return nil, err
+	}
+
+	stagingDBPath := filepath.Join(staging.Config.DataDir, "member", "snap", "db")
+	for _, name := range names {
+		cl, err := membership.NewClusterFromURLsMap(r.zapLogger, ro.Config.InitialClusterToken, ro.ClusterURLs)
+		if err != nil {
+			return nil, err
+		}
+		memberDir := filepath.Join(dataDirs[name], "member")
+		snapDir := filepath.Join(memberDir, "snap")
+		if err := os.MkdirAll(snapDir, 0700); err != nil {
+			return nil, err
+		}
+		dbPath := filepath.Join(snapDir, "db")
+		if err := copyFile(stagingDBPath, dbPath); err != nil {
+			return nil, fmt.Errorf("failed to copy the restored database into the data directory of member %s: %v", name, err)
+		}
+		if err := r.resetDB(dbPath, len(cl.Members())); err != nil {
+			return nil, err
+		}
+		if err := makeWALAndSnap(r.zapLogger, filepath.Join(memberDir, "wal"), snapDir, cl, name); err != nil {
+			return nil, err
+		}
+		r.logger.Infof("Restored the data directory %s of member %s with ID %s of cluster %s.", dataDirs[name], name, cl.MemberByName(name).ID, cl.ID())
+	}
+
+	if err := os.RemoveAll(staging.Config.DataDir); err != nil {
+		r.logger.Errorf("failed to remove the staging data directory %s: %v", staging.Config.DataDir, err)
+	}
+	return dataDirs, nil
+}
+
+// copyFile copies the file at the source path to the destination path, and syncs it.
+func copyFile(source, destination string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
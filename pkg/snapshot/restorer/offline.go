@@ -0,0 +1,325 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"go.etcd.io/etcd/lease"
+	"go.etcd.io/etcd/lease/leasepb"
+	"go.etcd.io/etcd/mvcc"
+	"go.etcd.io/etcd/mvcc/backend"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+	"go.etcd.io/etcd/pkg/traceutil"
+)
+
+var (
+	// keyBucketName and metaBucketName are the buckets of the mvcc backend holding the revisions of the keys and the metadata.
+	keyBucketName  = []byte("key")
+	metaBucketName = []byte("meta")
+	// leaseBucketName is the bucket of the mvcc backend holding the leases.
+	leaseBucketName = []byte("lease")
+	// consistentIndexKeyName is the key of the consistent index in the meta bucket.
+	consistentIndexKeyName = []byte("consistent_index")
+)
+
+const (
+	// revBytesLen is the length of a revision in the key bucket: the main revision, '_' and the sub revision.
+	revBytesLen = 8 + 1 + 8
+	// markTombstone marks the revision of a deletion in the key bucket.
+	markTombstone byte = 't'
+)
+
+// applyDeltaSnapshotsOffline applies the events of the delta snapshots directly into the database restored from the
+// base snapshot, without starting an embedded etcd. The events are written into the key bucket of the mvcc backend
+// with their own revisions, so the revisions are preserved exactly. The restored keys are not attached to leases,
+// unless leases are preserved, in which case the leases of the restored keys are re-created.
+// Finally, the history is compacted up to the last revision, as the embedded etcd would be made lean.
+func (r *Restorer) applyDeltaSnapshotsOffline(ro brtypes.RestoreOptions) error {
+	dbPath := filepath.Join(ro.Config.DataDir, "member", "snap", "db")
+	be := backend.NewDefaultBackend(dbPath)
+	defer func() {
+		if err := be.Close(); err != nil {
+			r.logger.Errorf("failed to close the restored database %s: %v", dbPath, err)
+		}
+	}()
+
+	consistentIndex, err := readConsistentIndex(be)
+	if err != nil {
+		return err
+	}
+	revision, err := r.offlineRevision(be, consistentIndex, 0)
+	if err != nil {
+		return err
+	}
+
+	var (
+		// attached holds the time a lease was first attached to a key by the applied events, if leases are preserved.
+		attached     map[int64]time.Time
+		restoredTime time.Time
+	)
+	if ro.Config.PreserveLeases {
+		attached = make(map[int64]time.Time)
+	}
+
+	snapList := ro.DeltaSnapList
+	if r.checkpoint != nil && r.checkpoint.AppliedDeltaSnapshots > 0 {
+		if r.checkpoint.Revision != 0 && r.checkpoint.Revision != revision {
+			return fmt.Errorf("%w: failed to verify the revision of restoration checkpoint %s: expected %d but the restored database is at revision %d", errRestoreCheckpointMismatch, r.checkpointPath, r.checkpoint.Revision, revision)
+		}
+		snapList = snapList[r.checkpoint.AppliedDeltaSnapshots:]
+		r.logger.Infof("Resuming the restoration after delta snapshot %s at revision %d, with %d delta snapshots left.", r.checkpoint.LastAppliedDeltaSnapshot, revision, len(snapList))
+	}
+
+	for i, snap := range snapList {
+		r.logger.Infof("Applying delta snapshot %s offline [%d/%d]", path.Join(snap.SnapDir, snap.SnapName), i+1, len(snapList))
+		events, err := r.getEventsFromDeltaSnapshot(*snap)
+		if err != nil {
+			return fmt.Errorf("failed to read events from delta snapshot %s: %v", snap.SnapName, err)
+		}
+		events, lastRevision := r.eventsUpToTarget(events, snap)
+		if lastRevision == 0 {
+			r.logger.Infof("Skipping delta snapshot %s, whose events are after the restore target %s", snap.SnapName, r.target)
+			r.recordAppliedDeltaSnapshot(snap, 0)
+			continue
+		}
+		if revision, err = r.writeEvents(be, events, revision, attached); err != nil {
+			return fmt.Errorf("failed to write events of delta snapshot %s into the restored database: %v", snap.SnapName, err)
+		}
+		be.ForceCommit()
+		// The revisions of the filtered out keys are missing in a partial backup, so the last revision of the
+		// snapshot may be higher than the revision of its last event.
+		if r.keyFilter == nil && revision != lastRevision {
+			return fmt.Errorf("snapshot revision verification failed for delta snapshot %s : mismatched event revision, expected %d but applied %d", snap.SnapName, lastRevision, revision)
+		}
+		r.recordAppliedDeltaSnapshot(snap, revision)
+		restoredTime = events[len(events)-1].Time
+	}
+
+	if ro.Config.PreserveLeases {
+		if err := r.recreateLeases(be, attached, restoredTime, ro.Config.DefaultLeaseTTL.Duration); err != nil {
+			return fmt.Errorf("failed to re-create the leases of the restored keys: %v", err)
+		}
+	}
+	if _, err := r.offlineRevision(be, consistentIndex, revision); err != nil {
+		return err
+	}
+	r.logger.Infof("Successfully applied delta snapshots offline up to revision %d.", revision)
+	return nil
+}
+
+// writeEvents writes the given events into the key bucket of the given backend, skipping the events up to the given
+// revision of the database. It returns the revision of the database after the last written event.
+// The events of a revision are written with increasing sub revisions, as etcd writes the operations of a transaction.
+// Unless the backup is partial, the revisions of the events must follow each other without gaps.
+// If attached is not nil, the restored keys keep their leases, and the time a lease is first attached to a key is
+// recorded in it. Else, the restored keys are not attached to leases.
+func (r *Restorer) writeEvents(be backend.Backend, events []brtypes.Event, revision int64, attached map[int64]time.Time) (int64, error) {
+	tx := be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+
+	var (
+		sub              int64
+		databaseRevision = revision
+	)
+	for _, e := range events {
+		kv := e.EtcdEvent.Kv
+		switch {
+		case kv.ModRevision <= databaseRevision:
+			// The event is already in the database, since the first delta snapshot may overlap with the base snapshot.
+			continue
+		case kv.ModRevision == revision:
+			sub++
+		case kv.ModRevision < revision:
+			return revision, fmt.Errorf("event of revision %d follows an event of revision %d", kv.ModRevision, revision)
+		case r.keyFilter == nil && kv.ModRevision != revision+1:
+			return revision, fmt.Errorf("missing revisions between %d and %d", revision, kv.ModRevision)
+		default:
+			revision, sub = kv.ModRevision, 0
+		}
+
+		revBytes := revisionBytes(revision, sub)
+
+		var value mvccpb.KeyValue
+		switch e.EtcdEvent.Type {
+		case mvccpb.PUT:
+			value = *kv
+			if attached == nil {
+				value.Lease = 0
+			} else if _, ok := attached[value.Lease]; value.Lease != 0 && !ok {
+				attached[value.Lease] = e.Time
+			}
+		case mvccpb.DELETE:
+			revBytes = append(revBytes, markTombstone)
+			value = mvccpb.KeyValue{Key: kv.Key}
+		default:
+			return revision, fmt.Errorf("unexpected event type")
+		}
+		data, err := value.Marshal()
+		if err != nil {
+			return revision, err
+		}
+		tx.UnsafeSeqPut(keyBucketName, revBytes, data)
+	}
+	return revision, nil
+}
+
+// recreateLeases creates the leases of the live keys of the given backend which are missing in its lease bucket.
+// Since the delta snapshots do not record the grants of leases, a lease is assumed to be granted with the given
+// default TTL when it was first attached to a key, and is created with the TTL remaining at the given restored time.
+// The leases of the base snapshot are kept as they are.
+func (r *Restorer) recreateLeases(be backend.Backend, attached map[int64]time.Time, restoredTime time.Time, defaultTTL time.Duration) error {
+	tx := be.BatchTx()
+	tx.Lock()
+	defer tx.Unlock()
+
+	// The revisions of the key bucket are in ascending order, so the last revision of a key holds its current lease.
+	keyLeases := make(map[string]int64)
+	if err := tx.UnsafeForEach(keyBucketName, func(k, v []byte) error {
+		var kv mvccpb.KeyValue
+		if err := kv.Unmarshal(v); err != nil {
+			return err
+		}
+		if len(k) > revBytesLen && k[revBytesLen] == markTombstone || kv.Lease == 0 {
+			delete(keyLeases, string(kv.Key))
+			return nil
+		}
+		keyLeases[string(kv.Key)] = kv.Lease
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	tx.UnsafeCreateBucket(leaseBucketName)
+	created := make(map[int64]bool)
+	for _, id := range keyLeases {
+		if created[id] {
+			continue
+		}
+		idBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(idBytes, uint64(id))
+		if _, values := tx.UnsafeRange(leaseBucketName, idBytes, nil, 0); len(values) != 0 {
+			continue
+		}
+		ttl := defaultTTL
+		if attachedTime, ok := attached[id]; ok {
+			ttl -= restoredTime.Sub(attachedTime)
+		}
+		// The remaining TTL is stored as TTL, since etcd grants the full TTL to the recovered leases.
+		lpb := leasepb.Lease{ID: id, TTL: int64(math.Max(math.Ceil(ttl.Seconds()), 1))}
+		data, err := lpb.Marshal()
+		if err != nil {
+			return err
+		}
+		tx.UnsafePut(leaseBucketName, idBytes, data)
+		created[id] = true
+	}
+	r.logger.Infof("Re-created %d leases of the restored keys.", len(created))
+	return nil
+}
+
+// offlineRevision opens the mvcc store of the given backend, which rebuilds the index of the keys from the key bucket,
+// and returns its current revision. If compactRevision is not 0, the store must be at that revision, and its history
+// is compacted up to it.
+func (r *Restorer) offlineRevision(be backend.Backend, consistentIndex uint64, compactRevision int64) (int64, error) {
+	// a lessor that never times out leases
+	lessor := lease.NewLessor(r.zapLogger, be, lease.LessorConfig{MinLeaseTTL: math.MaxInt64})
+	defer lessor.Stop()
+	index := brtypes.InitIndex(consistentIndex)
+	s := mvcc.NewStore(r.zapLogger, be, lessor, &index, mvcc.StoreConfig{})
+	defer s.Close()
+
+	revision := s.Rev()
+	if compactRevision == 0 {
+		return revision, nil
+	}
+	if revision != compactRevision {
+		return revision, fmt.Errorf("mismatched revision of the restored database, expected %d but found %d", compactRevision, revision)
+	}
+	doneCh, err := s.Compact(traceutil.New("compact", r.zapLogger), compactRevision)
+	if err == mvcc.ErrCompacted {
+		return revision, nil
+	}
+	if err != nil {
+		return revision, fmt.Errorf("failed to compact the restored database at revision %d: %v", compactRevision, err)
+	}
+	<-doneCh
+	s.Commit()
+	r.logger.Infof("Successfully compacted the restored database till revision: %d", compactRevision)
+	return revision, nil
+}
+
+// bumpRevision bumps the revision of the restored database by the configured amount, and marks it as compacted at the
+// bumped revision if configured, as etcdutl does. Watchers of the restored etcd resuming from a revision of the backed
+// up cluster then fail with a compaction error and relist, instead of missing the changes of the reused revisions.
+// Marking the database as compacted does not require bumping its revision.
+func (r *Restorer) bumpRevision(ro brtypes.RestoreOptions) error {
+	if ro.Config.BumpRevision == 0 && !ro.Config.MarkCompacted {
+		return nil
+	}
+	dbPath := filepath.Join(ro.Config.DataDir, "member", "snap", "db")
+	be := backend.NewDefaultBackend(dbPath)
+	defer func() {
+		if err := be.Close(); err != nil {
+			r.logger.Errorf("failed to close the restored database %s: %v", dbPath, err)
+		}
+	}()
+
+	consistentIndex, err := readConsistentIndex(be)
+	if err != nil {
+		return err
+	}
+	revision, err := r.offlineRevision(be, consistentIndex, 0)
+	if err != nil {
+		return err
+	}
+	bumpedRevision := revision + ro.Config.BumpRevision
+	if ro.Config.BumpRevision != 0 {
+		r.logger.Infof("Bumping the revision of the restored database from %d to %d.", revision, bumpedRevision)
+
+		// A tombstone of the empty key, which etcd never writes, advances the revision without changing any key.
+		// It is removed by the compaction, after which the compacted revision keeps the revision of the database.
+		tx := be.BatchTx()
+		tx.Lock()
+		tx.UnsafePut(keyBucketName, append(revisionBytes(bumpedRevision, 0), markTombstone), []byte{})
+		tx.Unlock()
+		be.ForceCommit()
+	}
+
+	if ro.Config.MarkCompacted {
+		if _, err := r.offlineRevision(be, consistentIndex, bumpedRevision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revisionBytes returns the key in the key bucket of the given main and sub revision.
+func revisionBytes(main, sub int64) []byte {
+	revBytes := make([]byte, revBytesLen, revBytesLen+1)
+	binary.BigEndian.PutUint64(revBytes, uint64(main))
+	revBytes[8] = '_'
+	binary.BigEndian.PutUint64(revBytes[9:], uint64(sub))
+	return revBytes
+}
+
+// readConsistentIndex returns the consistent index stored in the meta bucket of the given backend.
+func readConsistentIndex(be backend.Backend) (uint64, error) {
+	tx := be.ReadTx()
+	tx.RLock()
+	defer tx.RUnlock()
+	_, values := tx.UnsafeRange(metaBucketName, consistentIndexKeyName, nil, 0)
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no consistent index found in the restored database")
+	}
+	return binary.BigEndian.Uint64(values[0]), nil
+}
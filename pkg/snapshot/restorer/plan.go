@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer
+
+import (
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+)
+
+// RestorePlan describes the snapshots a restoration applies, without restoring anything.
+type RestorePlan struct {
+	// BaseSnapshot is the full snapshot the data directory is restored from.
+	BaseSnapshot *brtypes.Snapshot `json:"baseSnapshot"`
+	// DeltaSnapshots are the delta snapshots applied over the base snapshot, in order.
+	DeltaSnapshots brtypes.SnapList `json:"deltaSnapshots"`
+	// SnapshotSelector is the selection of the base snapshot and the delta snapshots.
+	SnapshotSelector brtypes.SnapshotSelector `json:"snapshotSelector"`
+	// Target is the target of the restoration.
+	Target brtypes.RestoreTarget `json:"target"`
+	// TotalBytes is the total size of the snapshots to download, as found when listing the snapstore.
+	TotalBytes int64 `json:"totalBytes"`
+	// Revision is the highest revision the restoration reaches. If the target is reached within the last delta
+	// snapshot, the restoration stops at the last event up to the target, whose revision may be lower.
+	Revision int64 `json:"revision"`
+	// Gaps are the breaks in the continuity of the revisions of the snapshots.
+	Gaps []RestorePlanGap `json:"gaps,omitempty"`
+}
+
+// RestorePlanGap is a break in the continuity of the revisions between a snapshot and the delta snapshot following it.
+type RestorePlanGap struct {
+	// Previous is the name of the snapshot before the gap.
+	Previous string `json:"previous"`
+	// Snapshot is the name of the delta snapshot after the gap.
+	Snapshot string `json:"snapshot"`
+	// ExpectedStartRevision is the start revision the delta snapshot should have.
+	ExpectedStartRevision int64 `json:"expectedStartRevision"`
+	// StartRevision is the start revision the delta snapshot has.
+	StartRevision int64 `json:"startRevision"`
+}
+
+// NewRestorePlan returns the plan of the restoration with the given options.
+// The start revision of each delta snapshot must follow the last revision of the previous delta snapshot. Since the
+// revision in the name of a full snapshot may be lower than the revision it holds, the first delta snapshot may
+// overlap with the base snapshot, but must not start after it.
+func NewRestorePlan(ro brtypes.RestoreOptions) *RestorePlan {
+	plan := &RestorePlan{
+		BaseSnapshot:     ro.BaseSnapshot,
+		DeltaSnapshots:   ro.DeltaSnapList,
+		SnapshotSelector: ro.Config.SnapshotSelector,
+		Target:           ro.Config.RestoreTarget(),
+		TotalBytes:       ro.BaseSnapshot.Size,
+		Revision:         ro.BaseSnapshot.LastRevision,
+	}
+	if plan.DeltaSnapshots == nil {
+		plan.DeltaSnapshots = brtypes.SnapList{}
+	}
+
+	previous := ro.BaseSnapshot
+	for i, snap := range ro.DeltaSnapList {
+		plan.TotalBytes += snap.Size
+		expectedStartRevision := previous.LastRevision + 1
+		if snap.StartRevision > expectedStartRevision || i > 0 && snap.StartRevision < expectedStartRevision {
+			plan.Gaps = append(plan.Gaps, RestorePlanGap{
+				Previous:              previous.SnapName,
+				Snapshot:              snap.SnapName,
+				ExpectedStartRevision: expectedStartRevision,
+				StartRevision:         snap.StartRevision,
+			})
+		}
+		if snap.LastRevision > plan.Revision {
+			plan.Revision = snap.LastRevision
+		}
+		previous = snap
+	}
+	if plan.Target.Revision != 0 && plan.Target.Revision < plan.Revision {
+		plan.Revision = plan.Target.Revision
+	}
+	return plan
+}
+
+// IsContinuous returns true if there are no gaps in the revisions of the snapshots.
+func (p *RestorePlan) IsContinuous() bool {
+	return len(p.Gaps) == 0
+}
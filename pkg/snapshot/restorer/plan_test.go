@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer_test
+
+import (
+	"fmt"
+
+	"github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Restore plan", func() {
+	var (
+		ro brtypes.RestoreOptions
+
+		makeSnap = func(kind string, startRevision, lastRevision, size int64) *brtypes.Snapshot {
+			return &brtypes.Snapshot{
+				Kind:          kind,
+				StartRevision: startRevision,
+				LastRevision:  lastRevision,
+				Size:          size,
+				SnapName:      fmt.Sprintf("%s-%08d-%08d", kind, startRevision, lastRevision),
+			}
+		}
+	)
+
+	BeforeEach(func() {
+		ro = brtypes.RestoreOptions{
+			Config:       brtypes.NewRestorationConfig(),
+			BaseSnapshot: makeSnap(brtypes.SnapshotKindFull, 0, 100, 1000),
+			DeltaSnapList: brtypes.SnapList{
+				makeSnap(brtypes.SnapshotKindDelta, 101, 110, 10),
+				makeSnap(brtypes.SnapshotKindDelta, 111, 120, 20),
+				makeSnap(brtypes.SnapshotKindDelta, 121, 130, 30),
+			},
+		}
+	})
+
+	It("should sum up the sizes and find the revision of a continuous delta chain", func() {
+		plan := restorer.NewRestorePlan(ro)
+		Expect(plan.BaseSnapshot).To(Equal(ro.BaseSnapshot))
+		Expect(plan.DeltaSnapshots).To(HaveLen(3))
+		Expect(plan.TotalBytes).To(Equal(int64(1060)))
+		Expect(plan.Revision).To(Equal(int64(130)))
+		Expect(plan.IsContinuous()).To(BeTrue())
+	})
+
+	It("should find the revision of the base snapshot without delta snapshots", func() {
+		ro.DeltaSnapList = nil
+		plan := restorer.NewRestorePlan(ro)
+		Expect(plan.DeltaSnapshots).To(BeEmpty())
+		Expect(plan.TotalBytes).To(Equal(int64(1000)))
+		Expect(plan.Revision).To(Equal(int64(100)))
+		Expect(plan.IsContinuous()).To(BeTrue())
+	})
+
+	It("should stop at the target revision", func() {
+		ro.Config.TargetRevision = 125
+		plan := restorer.NewRestorePlan(ro)
+		Expect(plan.Target.Revision).To(Equal(int64(125)))
+		Expect(plan.Revision).To(Equal(int64(125)))
+	})
+
+	It("should accept a first delta snapshot overlapping with the base snapshot", func() {
+		ro.DeltaSnapList[0].StartRevision = 95
+		Expect(restorer.NewRestorePlan(ro).IsContinuous()).To(BeTrue())
+	})
+
+	It("should report a gap between the base snapshot and the first delta snapshot", func() {
+		ro.DeltaSnapList[0].StartRevision = 105
+		plan := restorer.NewRestorePlan(ro)
+		Expect(plan.IsContinuous()).To(BeFalse())
+		Expect(plan.Gaps).To(ConsistOf(restorer.RestorePlanGap{
+			Previous:              ro.BaseSnapshot.SnapName,
+			Snapshot:              ro.DeltaSnapList[0].SnapName,
+			ExpectedStartRevision: 101,
+			StartRevision:         105,
+		}))
+	})
+
+	It("should report gaps and overlaps between delta snapshots", func() {
+		ro.DeltaSnapList[1].StartRevision = 115
+		ro.DeltaSnapList[2].StartRevision = 119
+		plan := restorer.NewRestorePlan(ro)
+		Expect(plan.Gaps).To(HaveLen(2))
+		Expect(plan.Gaps[0].Snapshot).To(Equal(ro.DeltaSnapList[1].SnapName))
+		Expect(plan.Gaps[0].ExpectedStartRevision).To(Equal(int64(111)))
+		Expect(plan.Gaps[1].Snapshot).To(Equal(ro.DeltaSnapList[2].SnapName))
+		Expect(plan.Gaps[1].ExpectedStartRevision).To(Equal(int64(121)))
+	})
+})
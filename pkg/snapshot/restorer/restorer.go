@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -23,8 +25,11 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/compressor"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
+	"github.com/gardener/etcd-backup-restore/pkg/hooks"
 	"github.com/gardener/etcd-backup-restore/pkg/member"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/etcd/clientv3"
@@ -54,11 +59,25 @@ const (
 	thresholdPercentageForDBSizeAlarm             float64 = 80.0 / 100.0
 )
 
+// ErrSnapshotHashMismatch is returned when the integrity hash of a base snapshot is missing or does not match its data.
+var ErrSnapshotHashMismatch = errors.New("snapshot hash mismatch")
+
 // Restorer is a struct for etcd data directory restorer
 type Restorer struct {
 	logger    *logrus.Entry
 	zapLogger *zap.Logger
 	store     brtypes.SnapStore
+	// keyFilter is the filter with which the backup being restored was recorded, if it is partial.
+	keyFilter *brtypes.KeyPrefixFilter
+	// target is the point up to which the backup being restored is restored.
+	target brtypes.RestoreTarget
+	// baseSnapshotHash is the verified sha256 hash of the last restored base snapshot, if it has one.
+	baseSnapshotHash string
+	// checkpoint is the progress of the restoration being run, persisted at checkpointPath.
+	checkpoint     *restoreCheckpoint
+	checkpointPath string
+	// verifiedDeltaSnapshots are the files of the delta snapshots fetched and verified before applying any, by snapshot name.
+	verifiedDeltaSnapshots map[string]string
 }
 
 // NewRestorer returns the restorer object.
@@ -74,6 +93,11 @@ func NewRestorer(store brtypes.SnapStore, logger *logrus.Entry) (*Restorer, erro
 	}, nil
 }
 
+// KeyFilter returns the key filter with which the last restored backup was recorded, or nil if it was complete.
+func (r *Restorer) KeyFilter() *brtypes.KeyPrefixFilter {
+	return r.keyFilter
+}
+
 // RestoreAndStopEtcd restore the etcd data directory as per specified restore options but doesn't return the ETCD server that it statrted.
 func (r *Restorer) RestoreAndStopEtcd(ro brtypes.RestoreOptions, m member.Control) error {
 	embeddedEtcd, err := r.Restore(ro, m)
@@ -87,32 +111,122 @@ func (r *Restorer) RestoreAndStopEtcd(ro brtypes.RestoreOptions, m member.Contro
 }
 
 // Restore restores the etcd data directory as per specified restore options but returns the ETCD server that it statrted.
+// The restore hooks of the restoration config are run before and after a successful restore.
 func (r *Restorer) Restore(ro brtypes.RestoreOptions, m member.Control) (*embed.Etcd, error) {
-	if err := r.restoreFromBaseSnapshot(ro); err != nil {
-		return nil, fmt.Errorf("failed to restore from the base snapshot: %v", err)
+	hookRunner := hooks.NewRunner(ro.Config.Hooks, r.logger)
+	payload := hooks.Payload{Snapshot: ro.BaseSnapshot, DeltaSnapshots: ro.DeltaSnapList}
+	if err := hookRunner.Run(context.TODO(), brtypes.HookStagePreRestore, payload); err != nil {
+		return nil, err
+	}
+	data := events.RestoreData{BaseSnapshot: ro.BaseSnapshot, DeltaSnapshots: len(ro.DeltaSnapList)}
+	events.Emit(events.TypeRestoreStarted, ro.Config.DataDir, data)
+	e, err := r.restore(ro, m)
+	if err == nil {
+		err = hookRunner.Run(context.TODO(), brtypes.HookStagePostRestore, payload)
+	}
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Succeeded = true
+	}
+	events.Emit(events.TypeRestoreFinished, ro.Config.DataDir, data)
+	return e, err
+}
+
+func (r *Restorer) restore(ro brtypes.RestoreOptions, m member.Control) (e *embed.Etcd, err error) {
+	r.target = ro.Config.RestoreTarget()
+	if !r.target.IsLatest() {
+		r.logger.Infof("Restoring the backup up to the target %s.", r.target)
+	}
+
+	r.checkpoint, r.checkpointPath = nil, restoreCheckpointPath(ro)
+	r.verifiedDeltaSnapshots = nil
+	checkpoint := r.loadRestoreCheckpoint(ro)
+	if checkpoint != nil {
+		r.logger.Infof("Resuming the interrupted restoration from base snapshot %s with %d of %d delta snapshots applied.", checkpoint.BaseSnapshot, checkpoint.AppliedDeltaSnapshots, len(ro.DeltaSnapList))
+	}
+	for checkpoint == nil {
+		err := r.restoreFromBaseSnapshot(ro)
+		if err == nil {
+			checkpoint = &restoreCheckpoint{
+				DataDir:          ro.Config.DataDir,
+				BaseSnapshot:     path.Join(ro.BaseSnapshot.SnapDir, ro.BaseSnapshot.SnapName),
+				BaseSnapshotHash: r.baseSnapshotHash,
+				Target:           r.target,
+			}
+			break
+		}
+		if !ro.Config.SnapshotSelector.FallbackToPreviousSnapshot || !errors.Is(err, ErrSnapshotHashMismatch) {
+			return nil, fmt.Errorf("failed to restore from the base snapshot: %v", err)
+		}
+		if ro, err = r.fallbackToPreviousSnapshot(ro, err); err != nil {
+			return nil, err
+		}
+	}
+
+	snapList := append(brtypes.SnapList{ro.BaseSnapshot}, ro.DeltaSnapList...)
+	keyFilter, err := snapstore.GetKeyFilter(r.store, snapList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the snapshot metadata: %v", err)
+	}
+	r.keyFilter = keyFilter
+	if keyFilter != nil {
+		r.logger.Warnf("Restoring from a partial backup, whose delta snapshots only record the keys selected by the key filter (%s).", keyFilter)
 	}
 
 	if len(ro.DeltaSnapList) == 0 {
 		r.logger.Infof("No delta snapshots present over base snapshot.")
-		return nil, nil
+		return nil, r.bumpRevision(ro)
 	}
 
 	r.logger.Infof("Attempting to apply %d delta snapshots for restoration.", len(ro.DeltaSnapList))
 	r.logger.Infof("Creating temporary directory %s for persisting delta snapshots locally.", ro.Config.TempSnapshotsDir)
 
-	err := os.MkdirAll(ro.Config.TempSnapshotsDir, 0700)
+	err = os.MkdirAll(ro.Config.TempSnapshotsDir, 0700)
 	if err != nil {
 		return nil, err
 	}
 
+	// The checkpoint in the temporary directory is kept if the restoration fails, so that it is resumed on the next attempt.
 	defer func() {
+		if err != nil {
+			r.removeVerifiedDeltaSnapshots()
+			r.logger.Infof("Keeping restoration checkpoint %s to resume the restoration.", r.checkpointPath)
+			return
+		}
 		if err := os.RemoveAll(ro.Config.TempSnapshotsDir); err != nil {
 			r.logger.Errorf("failed to remove restoration temp directory %s: %v", ro.Config.TempSnapshotsDir, err)
 		}
 	}()
 
+	r.checkpoint = checkpoint
+	if err := r.checkpoint.save(r.checkpointPath); err != nil {
+		r.logger.Warnf("Failed to persist restoration checkpoint %s: %v", r.checkpointPath, err)
+	}
+
+	if ro.Config.DeltaSnapshotVerification == brtypes.DeltaSnapshotVerificationFail || ro.Config.DeltaSnapshotVerification == brtypes.DeltaSnapshotVerificationTruncate {
+		if ro.DeltaSnapList, err = r.verifyDeltaSnapshots(ro); err != nil {
+			return nil, err
+		}
+		if len(ro.DeltaSnapList) == 0 {
+			r.logger.Infof("No consistent delta snapshots present over base snapshot.")
+			return nil, r.bumpRevision(ro)
+		}
+	}
+
+	if ro.Config.DeltaSnapshotApplyMode == brtypes.DeltaSnapshotApplyModeOffline {
+		r.logger.Infof("Applying delta snapshots offline into the restored database...")
+		if err = r.applyDeltaSnapshotsOffline(ro); err != nil {
+			if errors.Is(err, errRestoreCheckpointMismatch) {
+				return r.restartRestoration(ro, m, err)
+			}
+			return nil, err
+		}
+		return nil, r.bumpRevision(ro)
+	}
+
 	r.logger.Infof("Starting an embedded etcd server...")
-	e, err := miscellaneous.StartEmbeddedEtcd(r.logger, &ro)
+	e, err = miscellaneous.StartEmbeddedEtcd(r.logger, &ro)
 	if err != nil {
 		return e, err
 	}
@@ -126,10 +240,32 @@ func (r *Restorer) Restore(ro brtypes.RestoreOptions, m member.Control) (*embed.
 	})
 
 	r.logger.Infof("Applying delta snapshots...")
-	if err := r.applyDeltaSnapshots(clientFactory, embeddedEtcdEndpoints, ro); err != nil {
+	if err = r.applyDeltaSnapshots(clientFactory, embeddedEtcdEndpoints, ro); err != nil {
+		if errors.Is(err, errRestoreCheckpointMismatch) {
+			e.Server.Stop()
+			e.Close()
+			return r.restartRestoration(ro, m, err)
+		}
 		return e, err
 	}
 
+	if ro.Config.BumpRevision != 0 || ro.Config.MarkCompacted {
+		// The revision is bumped in the database of the stopped embedded etcd, which is started again afterwards.
+		e.Server.Stop()
+		e.Close()
+		if err = r.bumpRevision(ro); err != nil {
+			return nil, err
+		}
+		if e, err = miscellaneous.StartEmbeddedEtcd(r.logger, &ro); err != nil {
+			return e, err
+		}
+		clientFactory = etcdutil.NewClientFactory(ro.NewClientFactory, brtypes.EtcdConnectionConfig{
+			MaxCallSendMsgSize: ro.Config.MaxCallSendMsgSize,
+			Endpoints:          []string{e.Clients[0].Addr().String()},
+			InsecureTransport:  true,
+		})
+	}
+
 	if m != nil {
 		clientCluster, err := clientFactory.NewCluster()
 		if err != nil {
@@ -145,9 +281,30 @@ func (r *Restorer) Restore(ro brtypes.RestoreOptions, m member.Control) (*embed.
 	return e, nil
 }
 
+// fallbackToPreviousSnapshot returns the restore options to restore from the full snapshot preceding the base snapshot
+// and its delta snapshots, after the hash verification of the base snapshot failed with the given error.
+// It removes what was restored from the base snapshot.
+func (r *Restorer) fallbackToPreviousSnapshot(ro brtypes.RestoreOptions, hashErr error) (brtypes.RestoreOptions, error) {
+	baseSnapshot, deltaSnapList, err := miscellaneous.GetPreviousFullSnapshotAndDeltaSnapList(r.store, ro.BaseSnapshot, ro.Config.SnapshotSelector, r.target)
+	if err != nil {
+		return ro, fmt.Errorf("failed to get the snapshots preceding the base snapshot %s: %v", ro.BaseSnapshot.SnapName, err)
+	}
+	if baseSnapshot == nil {
+		return ro, fmt.Errorf("failed to restore from the base snapshot: %v, and there is no previous full snapshot to fall back to", hashErr)
+	}
+	r.logger.Warnf("Hash verification of base snapshot %s failed: %v. Falling back to the previous full snapshot %s with %d delta snapshots.", ro.BaseSnapshot.SnapName, hashErr, baseSnapshot.SnapName, len(deltaSnapList))
+	if err := os.RemoveAll(filepath.Join(ro.Config.DataDir, "member")); err != nil {
+		return ro, fmt.Errorf("failed to remove the member directory restored from the base snapshot %s: %v", ro.BaseSnapshot.SnapName, err)
+	}
+	ro.BaseSnapshot = baseSnapshot
+	ro.DeltaSnapList = deltaSnapList
+	return ro, nil
+}
+
 // restoreFromBaseSnapshot restore the etcd data directory from base snapshot.
 func (r *Restorer) restoreFromBaseSnapshot(ro brtypes.RestoreOptions) error {
 	var err error
+	r.baseSnapshotHash = ""
 	if path.Join(ro.BaseSnapshot.SnapDir, ro.BaseSnapshot.SnapName) == "" {
 		r.logger.Warnf("Base snapshot path not provided. Will do nothing.")
 		return nil
@@ -233,7 +390,7 @@ func (r *Restorer) makeDB(snapDir string, snap *brtypes.Snapshot, commit int, sk
 	}
 	hasHash := (off % 512) == sha256.Size
 	if !hasHash && !skipHashCheck {
-		err := fmt.Errorf("snapshot missing hash but --skip-hash-check=false")
+		err := fmt.Errorf("%w: snapshot missing hash but --skip-hash-check=false", ErrSnapshotHashMismatch)
 		return err
 	}
 
@@ -263,9 +420,10 @@ func (r *Restorer) makeDB(snapDir string, snap *brtypes.Snapshot, commit int, sk
 			}
 			dbSha := h.Sum(nil)
 			if !reflect.DeepEqual(sha, dbSha) {
-				err := fmt.Errorf("expected sha256 %v, got %v", sha, dbSha)
+				err := fmt.Errorf("%w: expected sha256 %v, got %v", ErrSnapshotHashMismatch, sha, dbSha)
 				return err
 			}
+			r.baseSnapshotHash = hex.EncodeToString(dbSha)
 		}
 	}
 
@@ -273,7 +431,12 @@ func (r *Restorer) makeDB(snapDir string, snap *brtypes.Snapshot, commit int, sk
 	if err := db.Close(); err != nil {
 		return err
 	}
+	return r.resetDB(dbPath, commit)
+}
 
+// resetDB resets the consistent index of the database at the given path to the given commit index of a new raft
+// instance, and deletes the members of the old cluster from it.
+func (r *Restorer) resetDB(dbPath string, commit int) error {
 	// update consistentIndex so applies go through on etcdserver despite
 	// having a new raft instance
 	be := backend.NewDefaultBackend(dbPath)
@@ -427,6 +590,19 @@ func (r *Restorer) applyDeltaSnapshots(clientFactory client.Factory, endPoints [
 	snapList := ro.DeltaSnapList
 	numMaxFetchers := ro.Config.MaxFetchers
 
+	if r.checkpoint != nil && r.checkpoint.AppliedDeltaSnapshots > 0 {
+		if r.checkpoint.Revision != 0 {
+			if err := r.verifySnapshotRevision(clientKV, &brtypes.Snapshot{LastRevision: r.checkpoint.Revision}); err != nil {
+				return fmt.Errorf("%w: failed to verify the revision of restoration checkpoint %s: %v", errRestoreCheckpointMismatch, r.checkpointPath, err)
+			}
+		}
+		snapList = snapList[r.checkpoint.AppliedDeltaSnapshots:]
+		if len(snapList) == 0 {
+			return nil
+		}
+		r.logger.Infof("Resuming the restoration after delta snapshot %s at revision %d, with %d delta snapshots left.", r.checkpoint.LastAppliedDeltaSnapshot, r.checkpoint.Revision, len(snapList))
+	}
+
 	firstDeltaSnap := snapList[0]
 
 	if err := r.applyFirstDeltaSnapshot(clientKV, firstDeltaSnap); err != nil {
@@ -435,10 +611,6 @@ func (r *Restorer) applyDeltaSnapshots(clientFactory client.Factory, endPoints [
 
 	embeddedEtcdQuotaBytes := float64(ro.Config.EmbeddedEtcdQuotaBytes)
 
-	if err := verifySnapshotRevision(clientKV, snapList[0]); err != nil {
-		return err
-	}
-
 	// no more delta snapshots available
 	if len(snapList) == 1 {
 		return nil
@@ -535,18 +707,22 @@ func (r *Restorer) fetchSnaps(fetcherIndex int, fetcherInfoCh <-chan brtypes.Fet
 				return
 			}
 		default:
-			r.logger.Infof("Fetcher #%d fetching delta snapshot %s", fetcherIndex+1, path.Join(fetcherInfo.Snapshot.SnapDir, fetcherInfo.Snapshot.SnapName))
-
-			rc, err := r.store.Fetch(fetcherInfo.Snapshot)
-			if err != nil {
-				errCh <- fmt.Errorf("failed to fetch delta snapshot %s from store : %v", fetcherInfo.Snapshot.SnapName, err)
-				applierInfoCh <- brtypes.ApplierInfo{SnapIndex: -1} // cannot use close(ch) as concurrent fetchSnaps routines might try to send on channel, causing a panic
-			}
+			snapTempFilePath, verified := r.verifiedDeltaSnapshots[fetcherInfo.Snapshot.SnapName]
+			if !verified {
+				r.logger.Infof("Fetcher #%d fetching delta snapshot %s", fetcherIndex+1, path.Join(fetcherInfo.Snapshot.SnapDir, fetcherInfo.Snapshot.SnapName))
+				rc, err := r.store.Fetch(fetcherInfo.Snapshot)
+				if err != nil {
+					errCh <- fmt.Errorf("failed to fetch delta snapshot %s from store : %v", fetcherInfo.Snapshot.SnapName, err)
+					applierInfoCh <- brtypes.ApplierInfo{SnapIndex: -1} // cannot use close(ch) as concurrent fetchSnaps routines might try to send on channel, causing a panic
+					return
+				}
 
-			snapTempFilePath := filepath.Join(tempDir, fetcherInfo.Snapshot.SnapName)
-			if err = persistRawDeltaSnapshot(rc, snapTempFilePath); err != nil {
-				errCh <- fmt.Errorf("failed to persist delta snapshot %s to temp file path %s : %v", fetcherInfo.Snapshot.SnapName, snapTempFilePath, err)
-				applierInfoCh <- brtypes.ApplierInfo{SnapIndex: -1}
+				snapTempFilePath = filepath.Join(tempDir, fetcherInfo.Snapshot.SnapName)
+				if err = persistRawDeltaSnapshot(rc, snapTempFilePath); err != nil {
+					errCh <- fmt.Errorf("failed to persist delta snapshot %s to temp file path %s : %v", fetcherInfo.Snapshot.SnapName, snapTempFilePath, err)
+					applierInfoCh <- brtypes.ApplierInfo{SnapIndex: -1}
+					return
+				}
 			}
 
 			snapLocationsCh <- snapTempFilePath // used for cleanup later
@@ -618,7 +794,7 @@ func (r *Restorer) applySnaps(clientKV client.KVCloser, clientMaintenance client
 					}
 
 					r.logger.Infof("Applying delta snapshot %s [%d/%d]", path.Join(remainingSnaps[currSnapIndex].SnapDir, remainingSnaps[currSnapIndex].SnapName), currSnapIndex+2, len(remainingSnaps)+1)
-					if err := applyEventsAndVerify(clientKV, events, remainingSnaps[currSnapIndex]); err != nil {
+					if err := r.applyEventsAndVerify(clientKV, events, remainingSnaps[currSnapIndex]); err != nil {
 						errCh <- err
 						return
 					}
@@ -638,7 +814,7 @@ func (r *Restorer) applySnaps(clientKV client.KVCloser, clientMaintenance client
 
 					if numberOfDeltaSnapApplied%periodicallyMakeEtcdLeanDeltaSnapshotInterval == 0 || prevAttemptToMakeEtcdLeanFailed {
 						r.logger.Info("making an embedded etcd lean and check for db size alarm")
-						if err := r.MakeEtcdLeanAndCheckAlarm(int64(remainingSnaps[currSnapIndex].LastRevision), endPoints, embeddedEtcdQuotaBytes, dbSizeAlarmCh, dbSizeAlarmDisarmCh, clientKV, clientMaintenance); err != nil {
+						if err := r.MakeEtcdLeanAndCheckAlarm(r.leanRevision(clientKV, remainingSnaps[currSnapIndex]), endPoints, embeddedEtcdQuotaBytes, dbSizeAlarmCh, dbSizeAlarmDisarmCh, clientKV, clientMaintenance); err != nil {
 							r.logger.Errorf("unable to make embedded etcd lean: %v", err)
 							r.logger.Warn("etcd mvcc: database space might exceeds its quota limit")
 							r.logger.Info("backup-restore will try again in next attempt...")
@@ -657,22 +833,59 @@ func (r *Restorer) applySnaps(clientKV client.KVCloser, clientMaintenance client
 }
 
 // applyEventsAndVerify applies events from one snapshot to the embedded etcd and verifies the correctness of the sequence of snapshot applied.
-func applyEventsAndVerify(clientKV client.KVCloser, events []brtypes.Event, snap *brtypes.Snapshot) error {
+// The progress is recorded in the restoration checkpoint.
+// The events after the restore target are not applied.
+func (r *Restorer) applyEventsAndVerify(clientKV client.KVCloser, events []brtypes.Event, snap *brtypes.Snapshot) error {
+	events, lastRevision := r.eventsUpToTarget(events, snap)
+	if lastRevision == 0 {
+		r.logger.Infof("Skipping delta snapshot %s, whose events are after the restore target %s", snap.SnapName, r.target)
+		r.recordAppliedDeltaSnapshot(snap, 0)
+		return nil
+	}
 	if err := applyEventsToEtcd(clientKV, events); err != nil {
 		return fmt.Errorf("failed to apply events to etcd for delta snapshot %s : %v", snap.SnapName, err)
 	}
 
-	if err := verifySnapshotRevision(clientKV, snap); err != nil {
+	verifiedSnap := *snap
+	verifiedSnap.LastRevision = lastRevision
+	if err := r.verifySnapshotRevision(clientKV, &verifiedSnap); err != nil {
 		return fmt.Errorf("snapshot revision verification failed for delta snapshot %s : %v", snap.SnapName, err)
 	}
+	r.recordAppliedDeltaSnapshot(snap, lastRevision)
 	return nil
 }
 
+// eventsUpToTarget returns the events of the given delta snapshot up to the restore target, along with the revision
+// etcd has after applying them, or 0 if all the events are after the target. Since the events are sorted by revision
+// and time, they are truncated at the first event after the target. The events of a transaction share a revision, but
+// their times differ slightly, so they are truncated at the next revision instead, to not split the transaction.
+func (r *Restorer) eventsUpToTarget(events []brtypes.Event, snap *brtypes.Snapshot) ([]brtypes.Event, int64) {
+	if r.target.IsLatest() {
+		return events, snap.LastRevision
+	}
+	for i := range events {
+		if !r.target.Includes(&events[i]) {
+			if i == 0 {
+				return nil, 0
+			}
+			for i < len(events) && events[i].EtcdEvent.Kv.ModRevision == events[i-1].EtcdEvent.Kv.ModRevision {
+				i++
+			}
+			if i == len(events) {
+				return events, snap.LastRevision
+			}
+			r.logger.Infof("Reached the restore target %s in delta snapshot %s at revision %d", r.target, snap.SnapName, events[i-1].EtcdEvent.Kv.ModRevision)
+			return events[:i], events[i-1].EtcdEvent.Kv.ModRevision
+		}
+	}
+	return events, snap.LastRevision
+}
+
 // applyFirstDeltaSnapshot applies the events from first delta snapshot to etcd.
 func (r *Restorer) applyFirstDeltaSnapshot(clientKV client.KVCloser, snap *brtypes.Snapshot) error {
 	r.logger.Infof("Applying first delta snapshot %s", path.Join(snap.SnapDir, snap.SnapName))
 
-	rc, err := r.store.Fetch(*snap)
+	rc, err := r.fetchDeltaSnapshot(*snap)
 	if err != nil {
 		return fmt.Errorf("failed to fetch delta snapshot %s from store : %v", snap.SnapName, err)
 	}
@@ -699,6 +912,11 @@ func (r *Restorer) applyFirstDeltaSnapshot(clientKV client.KVCloser, snap *brtyp
 		return fmt.Errorf("failed to get etcd latest revision: %v", err)
 	}
 	lastRevision := resp.Header.Revision
+	// The revisions of the filtered out keys are missing in a partial backup, so the etcd revision is
+	// behind the revisions of the events. The base snapshot is then named with its exact revision.
+	if r.keyFilter != nil {
+		lastRevision = snap.StartRevision - 1
+	}
 
 	var newRevisionIndex int
 	for index, event := range events {
@@ -710,7 +928,7 @@ func (r *Restorer) applyFirstDeltaSnapshot(clientKV client.KVCloser, snap *brtyp
 
 	r.logger.Infof("Applying first delta snapshot %s", path.Join(snap.SnapDir, snap.SnapName))
 
-	return applyEventsToEtcd(clientKV, events[newRevisionIndex:])
+	return r.applyEventsAndVerify(clientKV, events[newRevisionIndex:], snap)
 }
 
 // getEventsFromDeltaSnapshot returns the events from delta snapshot from snap store.
@@ -730,7 +948,7 @@ func (r *Restorer) getEventsFromDeltaSnapshot(snap brtypes.Snapshot) ([]brtypes.
 
 // getEventsDataFromDeltaSnapshot fetches the events data from delta snapshot from snap store.
 func (r *Restorer) getEventsDataFromDeltaSnapshot(snap brtypes.Snapshot) ([]byte, error) {
-	rc, err := r.store.Fetch(snap)
+	rc, err := r.fetchDeltaSnapshot(snap)
 	if err != nil {
 		return nil, err
 	}
@@ -833,6 +1051,15 @@ func applyEventsToEtcd(clientKV client.KVCloser, events []brtypes.Event) error {
 	return err
 }
 
+// verifySnapshotRevision verifies that the revision of etcd matches the last revision of the applied snapshot.
+// It is skipped for a partial backup, since the revisions of the filtered out keys are missing in it.
+func (r *Restorer) verifySnapshotRevision(clientKV client.KVCloser, snap *brtypes.Snapshot) error {
+	if r.keyFilter != nil {
+		return nil
+	}
+	return verifySnapshotRevision(clientKV, snap)
+}
+
 func verifySnapshotRevision(clientKV client.KVCloser, snap *brtypes.Snapshot) error {
 	ctx := context.TODO()
 	getResponse, err := clientKV.Get(ctx, "foo")
@@ -965,6 +1192,22 @@ func (r *Restorer) HandleAlarm(stopHandleAlarmCh chan bool, dbSizeAlarmCh <-chan
 	}
 }
 
+// leanRevision returns the revision at which the embedded etcd is compacted after applying the given snapshot.
+// For a partial backup, this is the current etcd revision, which is behind the last revision of the snapshot.
+func (r *Restorer) leanRevision(clientKV client.KVCloser, snap *brtypes.Snapshot) int64 {
+	if r.keyFilter == nil {
+		return snap.LastRevision
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), etcdConnectionTimeout)
+	defer cancel()
+	resp, err := clientKV.Get(ctx, "", clientv3.WithLastRev()...)
+	if err != nil {
+		r.logger.Warnf("Failed to get etcd latest revision: %v", err)
+		return snap.LastRevision
+	}
+	return resp.Header.Revision
+}
+
 // MakeEtcdLeanAndCheckAlarm calls etcd compaction on given revision number and raise db size alarm if embedded etcd db size crosses threshold.
 func (r *Restorer) MakeEtcdLeanAndCheckAlarm(revision int64, endPoints []string, embeddedEtcdQuotaBytes float64, dbSizeAlarmCh chan string, dbSizeAlarmDisarmCh <-chan bool, clientKV client.KVCloser, clientMaintenance client.MaintenanceCloser) error {
 
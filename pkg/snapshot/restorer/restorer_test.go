@@ -5,12 +5,17 @@
 package restorer_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,10 +25,14 @@ import (
 	mockfactory "github.com/gardener/etcd-backup-restore/pkg/mock/etcdutil/client"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
 	"github.com/gardener/etcd-backup-restore/test/utils"
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+	"go.etcd.io/etcd/mvcc/mvccpb"
 	"go.etcd.io/etcd/pkg/types"
 
 	. "github.com/gardener/etcd-backup-restore/pkg/snapshot/restorer"
@@ -622,6 +631,817 @@ var _ = Describe("Running Restorer", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 		})
+
+		Context("with a target revision in the middle of a delta snapshot", func() {
+			It("Should restore the events up to the target revision only", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+
+				// populate the etcd with the data before and after the target
+				targetResp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1003, targetResp)
+				Expect(targetResp.Err).ShouldNot(HaveOccurred())
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1004, 1006, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+
+				// take a delta snapshot holding the events before and after the target
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+
+				err = os.RemoveAll(memberPath)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				restorationConfig.TargetRevision = targetResp.EndRevision
+				Expect(restorationConfig.Validate()).To(Succeed())
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).NotTo(BeEmpty())
+				Expect(deltaSnapList[len(deltaSnapList)-1].LastRevision).To(BeNumerically(">", targetResp.EndRevision))
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1006)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(targetResp.EndRevision))
+				Expect(keys).To(ConsistOf(1001, 1002, 1003))
+			})
+		})
+
+		Context("with a target time in the middle of a transaction", func() {
+			It("Should restore all the events of the transaction", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+
+				err = os.RemoveAll(memberPath)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				// save a delta snapshot holding a transaction whose events are recorded before and after the target time
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+				Expect(err).ShouldNot(HaveOccurred())
+				lastRevision := baseSnapshot.LastRevision
+				if len(deltaSnapList) != 0 {
+					lastRevision = deltaSnapList[len(deltaSnapList)-1].LastRevision
+				}
+				targetTime := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+				deltaSnap := snapstore.NewSnapshot(brtypes.SnapshotKindDelta, lastRevision+1, lastRevision+3, "", false)
+				err = store.Save(*deltaSnap, io.NopCloser(bytes.NewReader(deltaSnapshotData([]brtypes.Event{
+					newTestPutEvent(1001, lastRevision+1, targetTime.Add(-time.Second)),
+					newTestPutEvent(1002, lastRevision+2, targetTime),
+					newTestPutEvent(1003, lastRevision+2, targetTime.Add(time.Millisecond)),
+					newTestPutEvent(1004, lastRevision+3, targetTime.Add(time.Second)),
+				}))))
+				Expect(err).ShouldNot(HaveOccurred())
+
+				restorationConfig.TargetTime = targetTime.Format(time.RFC3339)
+				Expect(restorationConfig.Validate()).To(Succeed())
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).NotTo(BeEmpty())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1004)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(lastRevision + 2))
+				Expect(keys).To(ConsistOf(1001, 1002, 1003))
+			})
+		})
+
+		Context("with a corrupted latest full snapshot", func() {
+			It("Should fall back to the previous full snapshot if configured", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				compressionConfig.Enabled = false
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take two full snapshots with different data
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1002, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1003, 1004, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				// corrupt the data of the latest full snapshot
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				snapshotPath := path.Join(baseSnapshot.Prefix, baseSnapshot.SnapDir, baseSnapshot.SnapName)
+				data, err := os.ReadFile(snapshotPath)
+				Expect(err).ShouldNot(HaveOccurred())
+				data[len(data)/2] ^= 0xff
+				Expect(os.WriteFile(snapshotPath, data, 0600)).To(Succeed())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).Should(MatchError(ContainSubstring(ErrSnapshotHashMismatch.Error())))
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				restorationConfig.SnapshotSelector.FallbackToPreviousSnapshot = true
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				_, keys, err := getTestKeys(cli, 1001, 1004)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(keys).To(ConsistOf(1001, 1002))
+			})
+		})
+
+		Context("with a restoration interrupted while applying delta snapshots", func() {
+			It("Should resume the restoration from the last applied delta snapshot", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot followed by two delta snapshots with different data
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1002, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1003, 1004, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(len(deltaSnapList)).To(BeNumerically(">=", 2))
+
+				// interrupt the restoration at the last delta snapshot by making it unreadable
+				lastDeltaSnap := deltaSnapList[len(deltaSnapList)-1]
+				snapshotPath := path.Join(lastDeltaSnap.Prefix, lastDeltaSnap.SnapDir, lastDeltaSnap.SnapName)
+				data, err := os.ReadFile(snapshotPath)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(os.WriteFile(snapshotPath, []byte("corrupted"), 0600)).To(Succeed())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				Expect(restorer.IsResumable(restoreOpts)).To(BeFalse())
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).Should(HaveOccurred())
+				Expect(restorer.IsResumable(restoreOpts)).To(BeTrue())
+
+				// resume the restoration without removing the data directory
+				Expect(os.WriteFile(snapshotPath, data, 0600)).To(Succeed())
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(restorer.IsResumable(restoreOpts)).To(BeFalse())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1004)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(lastDeltaSnap.LastRevision))
+				Expect(keys).To(ConsistOf(1001, 1002, 1003, 1004))
+			})
+
+			It("Should restart the restoration from the base snapshot if it was interrupted in the middle of a delta snapshot", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot followed by two delta snapshots with different data
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1002, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1003, 1004, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(len(deltaSnapList)).To(BeNumerically(">=", 2))
+
+				// interrupt the restoration at the last delta snapshot by making it unreadable
+				lastDeltaSnap := deltaSnapList[len(deltaSnapList)-1]
+				snapshotPath := path.Join(lastDeltaSnap.Prefix, lastDeltaSnap.SnapDir, lastDeltaSnap.SnapName)
+				data, err := os.ReadFile(snapshotPath)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(os.WriteFile(snapshotPath, []byte("corrupted"), 0600)).To(Succeed())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).Should(HaveOccurred())
+				Expect(restorer.IsResumable(restoreOpts)).To(BeTrue())
+
+				// advance the restored data past the checkpoint, as a delta snapshot applied partially does
+				restoredEtcd, cli, err := startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = cli.Put(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1005), "partially-applied")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cli.Close()).To(Succeed())
+				restoredEtcd.Server.Stop()
+				restoredEtcd.Close()
+
+				// resume the restoration, which restarts from the base snapshot
+				Expect(os.WriteFile(snapshotPath, data, 0600)).To(Succeed())
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(restorer.IsResumable(restoreOpts)).To(BeFalse())
+
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1005)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(lastDeltaSnap.LastRevision))
+				Expect(keys).To(ConsistOf(1001, 1002, 1003, 1004))
+			})
+		})
+
+		Context("with the verification of the delta snapshots before applying them", func() {
+			It("Should fail fast, or apply the delta snapshots up to the last consistent one", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot followed by two delta snapshots with different data
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1002, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1003, 1004, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(len(deltaSnapList)).To(BeNumerically(">=", 2))
+
+				// corrupt the last delta snapshot
+				lastDeltaSnap := deltaSnapList[len(deltaSnapList)-1]
+				Expect(os.WriteFile(path.Join(lastDeltaSnap.Prefix, lastDeltaSnap.SnapDir, lastDeltaSnap.SnapName), []byte("corrupted"), 0600)).To(Succeed())
+
+				restorationConfig.DeltaSnapshotVerification = brtypes.DeltaSnapshotVerificationFail
+				Expect(restorationConfig.Validate()).To(Succeed())
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(lastDeltaSnap.SnapName))
+
+				// resume the restoration, which applies none of the delta snapshots yet
+				restorationConfig.DeltaSnapshotVerification = brtypes.DeltaSnapshotVerificationTruncate
+				Expect(restorer.IsResumable(restoreOpts)).To(BeTrue())
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1004)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(deltaSnapList[len(deltaSnapList)-2].LastRevision))
+				Expect(keys).To(ConsistOf(1001, 1002))
+			})
+		})
+
+		Context("with the offline delta snapshot apply mode", func() {
+			It("Should restore the delta snapshots with their revisions", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// take a full snapshot followed by two delta snapshots, one of them holding a transaction of several operations
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1003, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				cli, err := clientv3.New(clientv3.Config{Endpoints: endpoints})
+				Expect(err).ShouldNot(HaveOccurred())
+				txnResp, err := cli.Txn(testCtx).Then(
+					clientv3.OpPut(fmt.Sprintf("%s%d", utils.KeyPrefix, 1004), "value-1004"),
+					clientv3.OpDelete(fmt.Sprintf("%s%d", utils.KeyPrefix, 1001)),
+					clientv3.OpPut(fmt.Sprintf("%s%d", utils.KeyPrefix, 1005), "value-1005"),
+				).Commit()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cli.Close()).To(Succeed())
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1006, 1007, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				restorationConfig.DeltaSnapshotApplyMode = brtypes.DeltaSnapshotApplyModeOffline
+				Expect(restorationConfig.Validate()).To(Succeed())
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(len(deltaSnapList)).To(BeNumerically(">=", 2))
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1007)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(deltaSnapList[len(deltaSnapList)-1].LastRevision))
+				Expect(keys).To(ConsistOf(1002, 1003, 1004, 1005, 1006, 1007))
+				getResp, err := cli.Get(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1004), clientv3.WithRange(fmt.Sprintf("%s%d", utils.KeyPrefix, 1006)))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(getResp.Kvs).To(HaveLen(2))
+				for _, kv := range getResp.Kvs {
+					Expect(kv.ModRevision).To(Equal(txnResp.Header.Revision))
+					Expect(kv.CreateRevision).To(Equal(txnResp.Header.Revision))
+				}
+			})
+
+			It("Should re-create the leases of the restored keys if leases are preserved", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				// attach a key to a lease before the full snapshot, and another key to a lease granted after it
+				cli, err := clientv3.New(clientv3.Config{Endpoints: endpoints})
+				Expect(err).ShouldNot(HaveOccurred())
+				baseLease, err := cli.Grant(testCtx, 600)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = cli.Put(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1001), "value-1001", clientv3.WithLease(baseLease.ID))
+				Expect(err).ShouldNot(HaveOccurred())
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				deltaLease, err := cli.Grant(testCtx, 300)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = cli.Put(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1002), "value-1002", clientv3.WithLease(deltaLease.ID))
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = cli.Put(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1003), "value-1003")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(cli.Close()).To(Succeed())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				restorationConfig.DeltaSnapshotApplyMode = brtypes.DeltaSnapshotApplyModeOffline
+				restorationConfig.PreserveLeases = true
+				restorationConfig.DefaultLeaseTTL = wrappers.Duration{Duration: 300 * time.Second}
+				Expect(restorationConfig.Validate()).To(Succeed())
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).NotTo(BeEmpty())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				for key, leaseID := range map[int]clientv3.LeaseID{1001: baseLease.ID, 1002: deltaLease.ID, 1003: clientv3.NoLease} {
+					getResp, err := cli.Get(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, key))
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(getResp.Kvs).To(HaveLen(1))
+					Expect(clientv3.LeaseID(getResp.Kvs[0].Lease)).To(Equal(leaseID))
+				}
+				ttlResp, err := cli.TimeToLive(testCtx, baseLease.ID, clientv3.WithAttachedKeys())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ttlResp.GrantedTTL).To(Equal(int64(600)))
+				Expect(ttlResp.Keys).To(Equal([][]byte{[]byte(fmt.Sprintf("%s%d", utils.KeyPrefix, 1001))}))
+				ttlResp, err = cli.TimeToLive(testCtx, deltaLease.ID, clientv3.WithAttachedKeys())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ttlResp.GrantedTTL).To(BeNumerically("<=", 300))
+				Expect(ttlResp.TTL).To(BeNumerically(">", 0))
+				Expect(ttlResp.Keys).To(Equal([][]byte{[]byte(fmt.Sprintf("%s%d", utils.KeyPrefix, 1002))}))
+			})
+		})
+
+		Context("with the data directories of all members", func() {
+			It("Should restore the data directories of a cluster of three members", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1003, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				initialCluster := "etcd-0=http://localhost:22380,etcd-1=http://localhost:22480,etcd-2=http://localhost:22580"
+				restorationConfig.InitialCluster = initialCluster
+				clusterUrlsMap, err = types.NewURLsMap(initialCluster)
+				Expect(err).ShouldNot(HaveOccurred())
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).NotTo(BeEmpty())
+
+				restorer, err = NewRestorer(store, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				dataDirs, err := restorer.RestoreMembers(restoreOpts)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(dataDirs).To(HaveLen(3))
+				Expect(path.Join(etcdDir, ".staging")).NotTo(BeAnExistingFile())
+
+				members, err := startRestoredCluster(dataDirs, initialCluster)
+				Expect(err).ShouldNot(HaveOccurred())
+				etcd = members[0]
+				defer func() {
+					for _, member := range members[1:] {
+						member.Server.Stop()
+						member.Close()
+					}
+				}()
+				for _, member := range members {
+					cli, err := clientv3.New(clientv3.Config{Endpoints: []string{member.Clients[0].Addr().String()}})
+					Expect(err).ShouldNot(HaveOccurred())
+					defer cli.Close()
+					revision, keys, err := getTestKeys(cli, 1001, 1003)
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(revision).To(Equal(deltaSnapList[len(deltaSnapList)-1].LastRevision))
+					Expect(keys).To(ConsistOf(1001, 1002, 1003))
+					memberResp, err := cli.MemberList(testCtx)
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(memberResp.Members).To(HaveLen(3))
+				}
+			})
+		})
+
+		Context("with a bumped revision", func() {
+			for _, c := range []struct {
+				mode string
+				bump int64
+			}{
+				{brtypes.DeltaSnapshotApplyModeEmbeddedEtcd, 1000},
+				{brtypes.DeltaSnapshotApplyModeOffline, 1000},
+				{brtypes.DeltaSnapshotApplyModeEmbeddedEtcd, 0},
+				{brtypes.DeltaSnapshotApplyModeOffline, 0},
+			} {
+				mode, bump := c.mode, c.bump
+				It(fmt.Sprintf("Should bump the revision by %d and mark it compacted with the %s delta snapshot apply mode", bump, mode), func() {
+					memberPath := path.Join(etcdDir, "member")
+					compressionConfig := compressor.NewCompressorConfig()
+					snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+					ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+					err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+					cancel()
+					resp := &utils.EtcdDataPopulationResponse{}
+					utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1003, resp)
+					Expect(resp.Err).ShouldNot(HaveOccurred())
+					ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+					err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+					cancel()
+					etcd.Server.Stop()
+					etcd.Close()
+					Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+					restorationConfig.DeltaSnapshotApplyMode = mode
+					restorationConfig.BumpRevision = bump
+					restorationConfig.MarkCompacted = true
+					Expect(restorationConfig.Validate()).To(Succeed())
+					baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(store, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(deltaSnapList).NotTo(BeEmpty())
+					lastRevision := deltaSnapList[len(deltaSnapList)-1].LastRevision
+
+					restorer, err = NewRestorer(store, logger)
+					Expect(err).ShouldNot(HaveOccurred())
+					restoreOpts := brtypes.RestoreOptions{
+						Config:        restorationConfig,
+						BaseSnapshot:  baseSnapshot,
+						DeltaSnapList: deltaSnapList,
+						ClusterURLs:   clusterUrlsMap,
+						PeerURLs:      peerUrls,
+					}
+					err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					var cli *clientv3.Client
+					etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+					Expect(err).ShouldNot(HaveOccurred())
+					defer cli.Close()
+					revision, keys, err := getTestKeys(cli, 1001, 1003)
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(revision).To(Equal(lastRevision + bump))
+					Expect(keys).To(ConsistOf(1001, 1002, 1003))
+					_, err = cli.Get(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1003), clientv3.WithRev(lastRevision+bump-1))
+					Expect(err).To(MatchError(rpctypes.ErrCompacted))
+					putResp, err := cli.Put(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, 1004), "value-1004")
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(putResp.Header.Revision).To(Equal(lastRevision + bump + 1))
+				})
+			}
+		})
+
+		Context("with snapshot files outside of a snapstore", func() {
+			It("Should restore from the snapshot files in a directory", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				resp := &utils.EtcdDataPopulationResponse{}
+				utils.PopulateEtcd(testCtx, logger, endpoints, 1001, 1003, resp)
+				Expect(resp.Err).ShouldNot(HaveOccurred())
+				ctx, cancel = context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), false, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				// Copy the snapshot files into a single directory, as if downloaded from the snapstore.
+				filesDir := GinkgoT().TempDir()
+				snapList, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				for _, snap := range snapList {
+					data, err := os.ReadFile(path.Join(snap.Prefix, snap.SnapDir, snap.SnapName))
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(os.WriteFile(path.Join(filesDir, path.Base(snap.SnapName)), data, 0600)).To(Succeed())
+				}
+				filesStore, err := snapstore.NewFilesSnapStore([]string{filesDir})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(filesStore, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(baseSnapshot.Prefix).To(Equal(filesDir))
+				Expect(deltaSnapList).NotTo(BeEmpty())
+
+				restorer, err = NewRestorer(filesStore, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				revision, keys, err := getTestKeys(cli, 1001, 1003)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(revision).To(Equal(deltaSnapList[len(deltaSnapList)-1].LastRevision))
+				Expect(keys).To(ConsistOf(1001, 1002, 1003))
+			})
+
+			It("Should restore a partial backup from the snapshot files with their metadata", func() {
+				memberPath := path.Join(etcdDir, "member")
+				compressionConfig := compressor.NewCompressorConfig()
+				snapstoreConfig := brtypes.SnapstoreConfig{Container: snapstoreDir, Provider: "Local"}
+
+				ctx, cancel := context.WithTimeout(testCtx, time.Duration(2*time.Second))
+				err = utils.RunSnapshotter(logger, snapstoreConfig, deltaSnapshotPeriod, endpoints, ctx.Done(), true, compressionConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+				cancel()
+				etcd.Server.Stop()
+				etcd.Close()
+				Expect(os.RemoveAll(memberPath)).To(Succeed())
+
+				// Copy the full snapshot into a single directory, along with a delta snapshot of a partial backup
+				// and its metadata. The revision of the filtered out key is missing in the delta snapshot.
+				filesDir := GinkgoT().TempDir()
+				fullSnapshot, deltaSnapList, err := miscellaneous.GetLatestFullSnapshotAndDeltaSnapList(store)
+				Expect(err).ShouldNot(HaveOccurred())
+				lastRevision := fullSnapshot.LastRevision
+				if len(deltaSnapList) != 0 {
+					lastRevision = deltaSnapList[len(deltaSnapList)-1].LastRevision
+				}
+				data, err := os.ReadFile(path.Join(fullSnapshot.Prefix, fullSnapshot.SnapDir, fullSnapshot.SnapName))
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(os.WriteFile(path.Join(filesDir, path.Base(fullSnapshot.SnapName)), data, 0600)).To(Succeed())
+				for _, snap := range deltaSnapList {
+					data, err := os.ReadFile(path.Join(snap.Prefix, snap.SnapDir, snap.SnapName))
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(os.WriteFile(path.Join(filesDir, path.Base(snap.SnapName)), data, 0600)).To(Succeed())
+				}
+				now := time.Now().UTC()
+				deltaSnap := snapstore.NewSnapshot(brtypes.SnapshotKindDelta, lastRevision+1, lastRevision+3, "", false)
+				Expect(os.WriteFile(path.Join(filesDir, deltaSnap.SnapName), deltaSnapshotData([]brtypes.Event{
+					newTestPutEvent(1001, lastRevision+1, now),
+					newTestPutEvent(1003, lastRevision+3, now),
+				}), 0600)).To(Succeed())
+				metadata, err := json.Marshal(&brtypes.SnapshotMetadata{KeyFilter: &brtypes.KeyPrefixFilter{Exclude: []string{"/excluded/"}}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(os.WriteFile(path.Join(filesDir, deltaSnap.SnapName+brtypes.SnapshotMetadataSuffix), metadata, 0600)).To(Succeed())
+				filesStore, err := snapstore.NewFilesSnapStore([]string{filesDir})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				baseSnapshot, deltaSnapList, err = miscellaneous.GetFullSnapshotAndDeltaSnapListForRestore(filesStore, restorationConfig.SnapshotSelector, restorationConfig.RestoreTarget())
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deltaSnapList).NotTo(BeEmpty())
+				Expect(deltaSnapList[len(deltaSnapList)-1].HasMetadata).To(BeTrue())
+
+				restorer, err = NewRestorer(filesStore, logger)
+				Expect(err).ShouldNot(HaveOccurred())
+				restoreOpts := brtypes.RestoreOptions{
+					Config:        restorationConfig,
+					BaseSnapshot:  baseSnapshot,
+					DeltaSnapList: deltaSnapList,
+					ClusterURLs:   clusterUrlsMap,
+					PeerURLs:      peerUrls,
+				}
+				err = restorer.RestoreAndStopEtcd(restoreOpts, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				var cli *clientv3.Client
+				etcd, cli, err = startRestoredEtcd(restoreOpts.Config.DataDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				defer cli.Close()
+				_, keys, err := getTestKeys(cli, 1001, 1003)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(keys).To(ConsistOf(1001, 1003))
+			})
+		})
 	})
 
 	Describe("Handle Alarm and Make etcd lean", func() {
@@ -1256,3 +2076,108 @@ func takeInvalidV1Snaps(container string) error {
 
 	return nil
 }
+
+// startRestoredEtcd starts an embedded etcd on the given restored data directory, and returns it along with a client of it.
+func startRestoredEtcd(dataDir string) (*embed.Etcd, *clientv3.Client, error) {
+	etcd, err := utils.StartEmbeddedEtcd(testCtx, dataDir, logger, utils.DefaultEtcdName, embeddedEtcdPortNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{etcd.Clients[0].Addr().String()}})
+	if err != nil {
+		etcd.Close()
+		return nil, nil, err
+	}
+	return etcd, cli, nil
+}
+
+// startRestoredCluster starts an embedded etcd on the data directory of each member of the given initial cluster,
+// and waits for all of them to be ready.
+func startRestoredCluster(dataDirs map[string]string, initialCluster string) ([]*embed.Etcd, error) {
+	clusterURLs, err := types.NewURLsMap(initialCluster)
+	if err != nil {
+		return nil, err
+	}
+	var members []*embed.Etcd
+	stop := func() {
+		for _, member := range members {
+			member.Server.Stop()
+			member.Close()
+		}
+	}
+	for name, peerURLs := range clusterURLs {
+		peerURL := peerURLs[0]
+		port, err := strconv.Atoi(peerURL.Port())
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		clientURL := url.URL{Scheme: "http", Host: fmt.Sprintf("localhost:%d", port-1)}
+		cfg := embed.NewConfig()
+		cfg.Name = name
+		cfg.Dir = dataDirs[name]
+		cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+		cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+		cfg.InitialCluster = initialCluster
+		cfg.Logger = "zap"
+		member, err := embed.StartEtcd(cfg)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	for _, member := range members {
+		select {
+		case <-member.Server.ReadyNotify():
+		case <-time.After(time.Minute):
+			stop()
+			return nil, fmt.Errorf("restored cluster took too long to start")
+		}
+	}
+	return members, nil
+}
+
+// getTestKeys returns the current etcd revision, and which of the test keys 'keyFrom' through 'keyTo' are present in etcd.
+// newTestPutEvent returns the event of a put of the test key with the given number at the given revision and time.
+func newTestPutEvent(key int, revision int64, t time.Time) brtypes.Event {
+	return brtypes.Event{
+		EtcdEvent: &clientv3.Event{
+			Type: mvccpb.PUT,
+			Kv: &mvccpb.KeyValue{
+				Key:            []byte(fmt.Sprintf("%s%d", utils.KeyPrefix, key)),
+				Value:          []byte(fmt.Sprintf("%s%d", utils.ValuePrefix, key)),
+				CreateRevision: revision,
+				ModRevision:    revision,
+				Version:        1,
+			},
+		},
+		Time: t,
+	}
+}
+
+// deltaSnapshotData returns the contents of a delta snapshot holding the given events, followed by their hash.
+func deltaSnapshotData(events []brtypes.Event) []byte {
+	data, err := json.Marshal(events)
+	Expect(err).ShouldNot(HaveOccurred())
+	hash := sha256.Sum256(data)
+	return append(data, hash[:]...)
+}
+
+func getTestKeys(cli *clientv3.Client, keyFrom, keyTo int) (int64, []int, error) {
+	var (
+		revision int64
+		keys     []int
+	)
+	for key := keyFrom; key <= keyTo; key++ {
+		resp, err := cli.Get(testCtx, fmt.Sprintf("%s%d", utils.KeyPrefix, key))
+		if err != nil {
+			return 0, nil, err
+		}
+		revision = resp.Header.Revision
+		if len(resp.Kvs) != 0 {
+			keys = append(keys, key)
+		}
+	}
+	return revision, keys, nil
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package restorer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sync"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+)
+
+// verifyDeltaSnapshots fetches the delta snapshots left to apply in parallel, with the fetchers of the restoration, and
+// verifies their hashes and the continuity of their revisions before any of them is applied. The verified files are
+// kept in the temporary directory, so that they are applied without fetching them again.
+// If a delta snapshot is not consistent, the restoration fails. With the truncate verification, the delta snapshots
+// are returned only up to the last consistent one before it instead.
+func (r *Restorer) verifyDeltaSnapshots(ro brtypes.RestoreOptions) (brtypes.SnapList, error) {
+	applied := 0
+	if r.checkpoint != nil {
+		applied = r.checkpoint.AppliedDeltaSnapshots
+	}
+	snapList := ro.DeltaSnapList[applied:]
+	if len(snapList) == 0 {
+		return ro.DeltaSnapList, nil
+	}
+	r.logger.Infof("Verifying %d delta snapshots before applying them.", len(snapList))
+
+	// firstInconsistent is the index of the first delta snapshot which is not consistent, and inconsistentErr tells why.
+	var (
+		firstInconsistent = len(ro.DeltaSnapList)
+		inconsistentErr   error
+	)
+	indexes := make(map[string]int, len(ro.DeltaSnapList))
+	for i, snap := range ro.DeltaSnapList {
+		indexes[snap.SnapName] = i
+	}
+	for _, gap := range NewRestorePlan(ro).Gaps {
+		if index := indexes[gap.Snapshot]; index >= applied {
+			firstInconsistent = index
+			inconsistentErr = fmt.Errorf("delta snapshot %s starts at revision %d, but %s ends at revision %d", gap.Snapshot, gap.StartRevision, gap.Previous, gap.ExpectedStartRevision-1)
+			break
+		}
+	}
+	if inconsistentErr != nil && ro.Config.DeltaSnapshotVerification == brtypes.DeltaSnapshotVerificationFail {
+		return nil, fmt.Errorf("failed to verify the delta snapshots: %v", inconsistentErr)
+	}
+
+	var (
+		numSnaps        = len(snapList)
+		numFetchers     = int(math.Min(float64(ro.Config.MaxFetchers), float64(numSnaps)))
+		snapLocationsCh = make(chan string, numSnaps)
+		errCh           = make(chan error, numFetchers)
+		fetcherInfoCh   = make(chan brtypes.FetcherInfo, numSnaps)
+		applierInfoCh   = make(chan brtypes.ApplierInfo, numSnaps)
+		stopCh          = make(chan bool)
+		wg              sync.WaitGroup
+		fetchErr        error
+		verified        = make(map[string]string, numSnaps)
+	)
+	for f := 0; f < numFetchers; f++ {
+		go r.fetchSnaps(f, fetcherInfoCh, applierInfoCh, snapLocationsCh, errCh, stopCh, &wg, ro.Config.TempSnapshotsDir)
+	}
+	for i, snap := range snapList {
+		fetcherInfoCh <- brtypes.FetcherInfo{Snapshot: *snap, SnapIndex: i}
+	}
+	close(fetcherInfoCh)
+
+	for received := 0; received < numSnaps && fetchErr == nil; {
+		if inconsistentErr != nil && ro.Config.DeltaSnapshotVerification == brtypes.DeltaSnapshotVerificationFail {
+			break
+		}
+		select {
+		case fetchErr = <-errCh:
+		case applierInfo := <-applierInfoCh:
+			if applierInfo.SnapIndex == -1 {
+				continue
+			}
+			received++
+			index := applied + applierInfo.SnapIndex
+			snap := ro.DeltaSnapList[index]
+			if err := r.verifyDeltaSnapshotFile(applierInfo.SnapFilePath, snap); err != nil {
+				if index < firstInconsistent {
+					firstInconsistent = index
+					inconsistentErr = fmt.Errorf("delta snapshot %s is not consistent: %v", snap.SnapName, err)
+				}
+				continue
+			}
+			verified[snap.SnapName] = applierInfo.SnapFilePath
+		}
+	}
+
+	close(stopCh)
+	wg.Wait()
+	close(snapLocationsCh)
+	// Only the files of the verified delta snapshots which are applied are kept.
+	r.verifiedDeltaSnapshots = make(map[string]string, len(verified))
+	if fetchErr == nil && (inconsistentErr == nil || ro.Config.DeltaSnapshotVerification == brtypes.DeltaSnapshotVerificationTruncate) {
+		for _, snap := range ro.DeltaSnapList[applied:firstInconsistent] {
+			r.verifiedDeltaSnapshots[snap.SnapName] = verified[snap.SnapName]
+		}
+	}
+	for filePath := range snapLocationsCh {
+		if snapName := path.Base(filePath); r.verifiedDeltaSnapshots[snapName] != filePath {
+			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+				r.logger.Warnf("Unable to remove file: %s; err: %v", filePath, err)
+			}
+		}
+	}
+
+	if fetchErr != nil {
+		return nil, fmt.Errorf("failed to verify the delta snapshots: %v", fetchErr)
+	}
+	if inconsistentErr != nil {
+		if ro.Config.DeltaSnapshotVerification != brtypes.DeltaSnapshotVerificationTruncate {
+			return nil, fmt.Errorf("failed to verify the delta snapshots: %v", inconsistentErr)
+		}
+		r.logger.Warnf("Applying the delta snapshots only up to the last consistent one, %d of %d: %v", firstInconsistent, len(ro.DeltaSnapList), inconsistentErr)
+		return ro.DeltaSnapList[:firstInconsistent], nil
+	}
+	r.logger.Infof("Successfully verified %d delta snapshots.", numSnaps)
+	return ro.DeltaSnapList, nil
+}
+
+// verifyDeltaSnapshotFile verifies the hash of the delta snapshot file at the given path, and that the revisions of its
+// events are ordered and within the revisions of the delta snapshot.
+func (r *Restorer) verifyDeltaSnapshotFile(filePath string, snap *brtypes.Snapshot) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s for delta snapshot %s : %v", filePath, snap.SnapName, err)
+	}
+	defer file.Close()
+	data, err := r.readSnapshotContentsFromReadCloser(file, snap)
+	if err != nil {
+		return err
+	}
+
+	var events []brtypes.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return fmt.Errorf("failed to unmarshal events: %v", err)
+	}
+	var revision int64
+	for _, e := range events {
+		eventRevision := e.EtcdEvent.Kv.ModRevision
+		if eventRevision < revision {
+			return fmt.Errorf("event of revision %d follows an event of revision %d", eventRevision, revision)
+		}
+		if eventRevision < snap.StartRevision || eventRevision > snap.LastRevision {
+			return fmt.Errorf("event of revision %d is out of the revisions %d to %d of the snapshot", eventRevision, snap.StartRevision, snap.LastRevision)
+		}
+		revision = eventRevision
+	}
+	// The revisions of the filtered out keys are missing in a partial backup.
+	if r.keyFilter == nil && revision != snap.LastRevision {
+		return fmt.Errorf("last event has revision %d, but the snapshot ends at revision %d", revision, snap.LastRevision)
+	}
+	return nil
+}
+
+// fetchDeltaSnapshot returns the contents of the given delta snapshot, from its file verified before applying any delta
+// snapshot if there is one, else from the snapstore.
+func (r *Restorer) fetchDeltaSnapshot(snap brtypes.Snapshot) (io.ReadCloser, error) {
+	if filePath, ok := r.verifiedDeltaSnapshots[snap.SnapName]; ok {
+		return os.Open(filePath)
+	}
+	return r.store.Fetch(snap)
+}
+
+// removeVerifiedDeltaSnapshots removes the files of the verified delta snapshots which are left.
+func (r *Restorer) removeVerifiedDeltaSnapshots() {
+	for _, filePath := range r.verifiedDeltaSnapshots {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			r.logger.Warnf("Unable to remove file: %s; err: %v", filePath, err)
+		}
+	}
+	r.verifiedDeltaSnapshots = nil
+}
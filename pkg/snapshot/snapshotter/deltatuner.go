@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deltaTunerSmoothingFactor is the weight of the latest observation in the moving averages of the delta snapshot tuner.
+const deltaTunerSmoothingFactor = 0.3
+
+// deltaSnapshotTuner adjusts the delta snapshot period and memory limit within their configured bounds,
+// so that the etcd writes are persisted in an uploaded snapshot within the recovery point objective:
+//   - the period leaves room for the upload latency within the recovery point objective, and it is shortened
+//     further so that the events collected at the observed event rate don't exceed the memory limit.
+//   - the memory limit allows a delta snapshot to be uploaded within half the recovery point objective
+//     at the observed upload throughput.
+//   - the period is doubled after each cycle without events, and shortened again as soon as events arrive.
+//
+// Uploads are observed concurrently by the delta upload pipeline, so the tuner is safe for concurrent use.
+type deltaSnapshotTuner struct {
+	mutex            sync.Mutex
+	minPeriod        time.Duration
+	maxPeriod        time.Duration
+	minMemoryLimit   uint
+	maxMemoryLimit   uint
+	rpo              time.Duration
+	period           time.Duration
+	memoryLimit      uint
+	eventRate        float64 // bytes per second
+	uploadLatency    float64 // seconds
+	uploadThroughput float64 // bytes per second
+}
+
+// newDeltaSnapshotTuner returns a tuner for the given config, starting with the configured delta snapshot period and memory limit.
+func newDeltaSnapshotTuner(config *brtypes.SnapshotterConfig) *deltaSnapshotTuner {
+	t := &deltaSnapshotTuner{
+		minPeriod:      config.MinDeltaSnapshotPeriod.Duration,
+		maxPeriod:      config.MaxDeltaSnapshotPeriod.Duration,
+		minMemoryLimit: config.MinDeltaSnapshotMemoryLimit,
+		maxMemoryLimit: config.MaxDeltaSnapshotMemoryLimit,
+		rpo:            config.DeltaSnapshotRecoveryPointObjective.Duration,
+	}
+	t.period = t.clampPeriod(config.DeltaSnapshotPeriod.Duration)
+	t.memoryLimit = t.clampMemoryLimit(float64(config.DeltaSnapshotMemoryLimit))
+	return t
+}
+
+// effectivePeriod returns the current delta snapshot period.
+func (t *deltaSnapshotTuner) effectivePeriod() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.period
+}
+
+// effectiveMemoryLimit returns the current delta snapshot memory limit.
+func (t *deltaSnapshotTuner) effectiveMemoryLimit() uint {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.memoryLimit
+}
+
+// collectingPeriod returns the delta snapshot period for a cycle in which events are collected,
+// which meets the recovery point objective regardless of a longer period after cycles without events.
+func (t *deltaSnapshotTuner) collectingPeriod() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.computeCollectingPeriod()
+}
+
+// observeCycle records a delta snapshot cycle in which the given number of bytes of events were collected.
+func (t *deltaSnapshotTuner) observeCycle(size int, elapsed time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if elapsed > 0 {
+		t.eventRate = smooth(t.eventRate, float64(size)/elapsed.Seconds())
+	}
+	if size == 0 {
+		t.period = t.clampPeriod(2 * t.period)
+		return
+	}
+	t.period = t.computeCollectingPeriod()
+}
+
+// observeUpload records the upload of a delta snapshot of the given size.
+func (t *deltaSnapshotTuner) observeUpload(size int, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.uploadLatency = smooth(t.uploadLatency, latency.Seconds())
+	if latency > 0 {
+		t.uploadThroughput = smooth(t.uploadThroughput, float64(size)/latency.Seconds())
+		t.memoryLimit = t.clampMemoryLimit(t.uploadThroughput * t.rpo.Seconds() / 2)
+	}
+}
+
+func (t *deltaSnapshotTuner) computeCollectingPeriod() time.Duration {
+	period := t.rpo - time.Duration(t.uploadLatency*float64(time.Second))
+	if t.eventRate > 0 {
+		// time in seconds until the memory limit is reached at the observed event rate.
+		if fillTime := float64(t.memoryLimit) / t.eventRate; fillTime < period.Seconds() {
+			period = time.Duration(fillTime * float64(time.Second))
+		}
+	}
+	return t.clampPeriod(period)
+}
+
+func (t *deltaSnapshotTuner) clampPeriod(period time.Duration) time.Duration {
+	period = period.Round(time.Second)
+	if period < t.minPeriod {
+		return t.minPeriod
+	}
+	if period > t.maxPeriod {
+		return t.maxPeriod
+	}
+	return period
+}
+
+func (t *deltaSnapshotTuner) clampMemoryLimit(limit float64) uint {
+	if limit < float64(t.minMemoryLimit) {
+		return t.minMemoryLimit
+	}
+	if limit > float64(t.maxMemoryLimit) {
+		return t.maxMemoryLimit
+	}
+	return uint(limit)
+}
+
+// smooth returns the exponential moving average after the given observation.
+func smooth(average, observation float64) float64 {
+	if average == 0 {
+		return observation
+	}
+	return deltaTunerSmoothingFactor*observation + (1-deltaTunerSmoothingFactor)*average
+}
+
+// deltaSnapshotPeriod returns the period after which the next delta snapshot is taken.
+func (ssr *Snapshotter) deltaSnapshotPeriod() time.Duration {
+	if ssr.deltaSnapshotTuner == nil {
+		return ssr.config.DeltaSnapshotPeriod.Duration
+	}
+	return ssr.deltaSnapshotTuner.effectivePeriod()
+}
+
+// deltaSnapshotMemoryLimit returns the size of the collected events after which a delta snapshot is taken.
+func (ssr *Snapshotter) deltaSnapshotMemoryLimit() uint {
+	if ssr.deltaSnapshotTuner == nil {
+		return ssr.config.DeltaSnapshotMemoryLimit
+	}
+	return ssr.deltaSnapshotTuner.effectiveMemoryLimit()
+}
+
+// observeDeltaSnapshotCycle records the delta snapshot cycle which ended with the given size of collected events.
+func (ssr *Snapshotter) observeDeltaSnapshotCycle(size int) {
+	if ssr.deltaSnapshotTuner == nil {
+		return
+	}
+	ssr.deltaSnapshotTuner.observeCycle(size, time.Since(ssr.deltaSnapshotCycleStart))
+}
+
+// shortenDeltaSnapshotTimer makes sure that the first events collected after cycles without events, which
+// lengthened the delta snapshot period, are persisted within the recovery point objective.
+func (ssr *Snapshotter) shortenDeltaSnapshotTimer() {
+	if ssr.deltaSnapshotTuner == nil || ssr.deltaSnapshotTimer == nil {
+		return
+	}
+	period := ssr.deltaSnapshotTuner.collectingPeriod()
+	due := time.Now().Add(period)
+	if !due.Before(ssr.deltaSnapshotDue) {
+		return
+	}
+	ssr.deltaSnapshotTimer.Stop()
+	ssr.logger.Infof("Received events, resetting delta snapshot to run after %s.", period.String())
+	ssr.deltaSnapshotTimer.Reset(period)
+	// the event rate of this cycle is measured from its first events.
+	ssr.deltaSnapshotCycleStart = time.Now()
+	ssr.deltaSnapshotDue = due
+	metrics.DeltaSnapshotEffectivePeriodSeconds.With(prometheus.Labels{}).Set(period.Seconds())
+}
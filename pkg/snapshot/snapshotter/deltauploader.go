@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gardener/etcd-backup-restore/pkg/events"
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sealedDeltaSnapshot is a delta snapshot whose events are collected and hashed,
+// and which is ready to be uploaded to the snapstore.
+type sealedDeltaSnapshot struct {
+	seq   uint64
+	snap  *brtypes.Snapshot
+	data  []byte
+	store brtypes.SnapStore
+}
+
+// deltaUploadResult is the outcome of uploading a sealed delta snapshot.
+type deltaUploadResult struct {
+	delta *sealedDeltaSnapshot
+	err   error
+}
+
+// deltaUploadPipeline decouples the upload of delta snapshots from the consumption of the etcd watch.
+// Sealed delta snapshots are put on a bounded queue and uploaded by a pool of uploaders, possibly in
+// parallel. The results are handed back to the snapshot event handler, which commits the snapshots
+// to PrevSnapshot strictly in the order in which they were sealed.
+// Apart from the uploaders, the pipeline must only be accessed from the snapshot event handler.
+type deltaUploadPipeline struct {
+	queue    chan *sealedDeltaSnapshot
+	resultCh chan deltaUploadResult
+	wg       sync.WaitGroup
+	// failed is read by the uploaders to skip the uploads after a failure.
+	failed atomic.Bool
+
+	nextSeq       uint64
+	nextCommitSeq uint64
+	// awaiting is the number of sealed snapshots whose upload result is not received yet.
+	awaiting int
+	// completed holds the successfully uploaded snapshots which can't be committed yet.
+	completed  map[uint64]*sealedDeltaSnapshot
+	lastSealed *brtypes.Snapshot
+	failedSeq  uint64
+	err        error
+}
+
+// results returns the channel on which upload results are delivered.
+// It returns nil, which blocks forever on receive, if the pipeline is not running.
+func (p *deltaUploadPipeline) results() <-chan deltaUploadResult {
+	if p == nil {
+		return nil
+	}
+	return p.resultCh
+}
+
+// pending returns the number of sealed delta snapshots which are not committed yet.
+func (p *deltaUploadPipeline) pending() int {
+	return p.awaiting + len(p.completed)
+}
+
+// startDeltaUploadPipeline starts the uploaders of the delta upload pipeline, if it is enabled.
+func (ssr *Snapshotter) startDeltaUploadPipeline() {
+	if ssr.config.DeltaSnapshotUploadQueueSize == 0 || ssr.deltaUploader != nil {
+		return
+	}
+	uploaders := int(ssr.config.MaxParallelDeltaSnapshotUploads)
+	if uploaders < 1 {
+		uploaders = brtypes.DefaultMaxParallelDeltaSnapshotUploads
+	}
+	queueSize := int(ssr.config.DeltaSnapshotUploadQueueSize)
+
+	p := &deltaUploadPipeline{
+		queue:     make(chan *sealedDeltaSnapshot, queueSize),
+		resultCh:  make(chan deltaUploadResult, queueSize+uploaders),
+		completed: map[uint64]*sealedDeltaSnapshot{},
+	}
+	p.wg.Add(uploaders)
+	for i := 0; i < uploaders; i++ {
+		go ssr.runDeltaUploader(p)
+	}
+	ssr.deltaUploader = p
+	metrics.DeltaSnapshotUploadQueueDepth.With(prometheus.Labels{}).Set(0)
+	ssr.logger.Infof("Started delta snapshot upload pipeline with queue size %d and %d uploader(s).", queueSize, uploaders)
+}
+
+// runDeltaUploader uploads the sealed delta snapshots from the queue until the queue is closed.
+func (ssr *Snapshotter) runDeltaUploader(p *deltaUploadPipeline) {
+	defer p.wg.Done()
+	for d := range p.queue {
+		var err error
+		if p.failed.Load() {
+			err = fmt.Errorf("upload aborted due to a previous delta snapshot upload failure")
+		} else {
+			err = ssr.uploadDeltaSnapshot(d)
+		}
+		p.resultCh <- deltaUploadResult{delta: d, err: err}
+	}
+}
+
+// enqueueDeltaSnapshot seals the etcd events collected up till now into a delta snapshot and
+// hands it over to the upload pipeline. If the queue is full, it commits the upload results
+// received meanwhile until there is room in the queue again.
+func (ssr *Snapshotter) enqueueDeltaSnapshot() (*brtypes.Snapshot, error) {
+	p := ssr.deltaUploader
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if err := ssr.runPreDeltaSnapshotHook(); err != nil {
+		events.Emit(events.TypeDeltaSnapshotFailed, "", events.SnapshotData{Error: err.Error()})
+		return nil, err
+	}
+	d, err := ssr.sealDeltaSnapshot()
+	if err != nil {
+		events.Emit(events.TypeDeltaSnapshotFailed, "", events.SnapshotData{Error: err.Error()})
+		return nil, err
+	}
+	if d == nil {
+		return nil, nil
+	}
+	d.seq = p.nextSeq
+	p.nextSeq++
+	p.awaiting++
+	p.lastSealed = d.snap
+	metrics.DeltaSnapshotUploadQueueDepth.With(prometheus.Labels{}).Set(float64(p.pending()))
+
+	for {
+		select {
+		case p.queue <- d:
+			ssr.logger.Infof("Queued delta snapshot %s for upload.", path.Join(d.snap.SnapDir, d.snap.SnapName))
+			return d.snap, nil
+		case res := <-p.resultCh:
+			if _, err := ssr.handleDeltaUploadResult(res); err != nil {
+				// the sealed snapshot never reaches an uploader.
+				p.awaiting--
+				return nil, err
+			}
+		}
+	}
+}
+
+// handleDeltaUploadResult processes the result of a delta snapshot upload and commits all
+// the uploaded snapshots which are next in order. It returns the number of committed snapshots.
+func (ssr *Snapshotter) handleDeltaUploadResult(res deltaUploadResult) (int, error) {
+	p := ssr.deltaUploader
+	p.awaiting--
+
+	if res.err != nil {
+		if p.err == nil || res.delta.seq < p.failedSeq {
+			p.failedSeq = res.delta.seq
+		}
+		if p.err == nil {
+			p.err = fmt.Errorf("failed to upload delta snapshot %s: %v", path.Join(res.delta.snap.SnapDir, res.delta.snap.SnapName), res.err)
+			p.failed.Store(true)
+			events.Emit(events.TypeDeltaSnapshotFailed, path.Join(res.delta.snap.SnapDir, res.delta.snap.SnapName), events.SnapshotData{Error: res.err.Error()})
+		}
+	} else {
+		p.completed[res.delta.seq] = res.delta
+	}
+
+	var committed int
+	for {
+		d, ok := p.completed[p.nextCommitSeq]
+		if !ok || (p.err != nil && d.seq >= p.failedSeq) {
+			break
+		}
+		delete(p.completed, p.nextCommitSeq)
+		ssr.commitDeltaSnapshot(d.snap)
+		p.nextCommitSeq++
+		committed++
+	}
+	if p.pending() == 0 {
+		p.lastSealed = nil
+	}
+	metrics.DeltaSnapshotUploadQueueDepth.With(prometheus.Labels{}).Set(float64(p.pending()))
+	return committed, p.err
+}
+
+// flushDeltaSnapshots waits till all the sealed delta snapshots are uploaded and committed.
+func (ssr *Snapshotter) flushDeltaSnapshots() error {
+	p := ssr.deltaUploader
+	if p == nil {
+		return nil
+	}
+	for p.awaiting > 0 {
+		if _, err := ssr.handleDeltaUploadResult(<-p.resultCh); err != nil {
+			return err
+		}
+	}
+	return p.err
+}
+
+// stopDeltaUploadPipeline uploads and commits the remaining sealed delta snapshots and stops the uploaders.
+// Snapshots which were uploaded after a failed upload can't be committed without leaving a gap in the
+// revisions, so they are removed from the snapstore again.
+func (ssr *Snapshotter) stopDeltaUploadPipeline() {
+	p := ssr.deltaUploader
+	if p == nil {
+		return
+	}
+
+	close(p.queue)
+	for p.awaiting > 0 {
+		if _, err := ssr.handleDeltaUploadResult(<-p.resultCh); err != nil {
+			ssr.logger.Warnf("Delta snapshot upload pipeline failed: %v", err)
+		}
+	}
+	p.wg.Wait()
+
+	for _, d := range p.completed {
+		snapPath := path.Join(d.snap.SnapDir, d.snap.SnapName)
+		ssr.logger.Infof("Deleting delta snapshot %s uploaded after a failed upload", snapPath)
+		if err := d.store.Delete(*d.snap); err != nil {
+			ssr.logger.Warnf("Failed to delete delta snapshot %s: %v", snapPath, err)
+			continue
+		}
+		if err := snapstore.DeleteSnapshotMetadata(d.store, *d.snap); err != nil {
+			ssr.logger.Warnf("%v", err)
+		}
+	}
+
+	ssr.deltaUploader = nil
+	metrics.DeltaSnapshotUploadQueueDepth.With(prometheus.Labels{}).Set(0)
+	ssr.logger.Info("Stopped delta snapshot upload pipeline.")
+}
+
+// lastSealedRevision returns the last revision of the latest sealed delta snapshot,
+// which is the previous snapshot's last revision if there are no uncommitted snapshots.
+func (ssr *Snapshotter) lastSealedRevision() int64 {
+	if p := ssr.deltaUploader; p != nil && p.lastSealed != nil && p.lastSealed.LastRevision > ssr.PrevSnapshot.LastRevision {
+		return p.lastSealed.LastRevision
+	}
+	return ssr.PrevSnapshot.LastRevision
+}
@@ -5,10 +5,12 @@
 package snapshotter
 
 import (
-	"math"
+	"context"
 	"path"
 	"time"
 
+	"github.com/gardener/etcd-backup-restore/pkg/events"
+	"github.com/gardener/etcd-backup-restore/pkg/hooks"
 	"github.com/gardener/etcd-backup-restore/pkg/metrics"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
@@ -39,146 +41,127 @@ func (ssr *Snapshotter) RunGarbageCollector(stopCh <-chan struct{}) {
 				continue
 			}
 
-			total := 0
 			ssr.logger.Info("GC: Executing garbage collection...")
-			snapList, err := ssr.store.List()
+			plan, err := ssr.PlanGarbageCollection(ssr.store)
 			if err != nil {
 				metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
 				ssr.logger.Warnf("GC: Failed to list snapshots: %v", err)
 				continue
 			}
+			ssr.ApplyGarbageCollectionPlan(plan)
+		}
+	}
+}
 
-			// Skip chunk deletion for openstack swift provider, since the manifest object is a virtual
-			// representation of the object, and the actual data is stored in the segment objects, aka chunks
-			// Chunk deletion for this provider is handled in regular snapshot deletion
-			if ssr.snapstoreConfig.Provider == brtypes.SnapstoreProviderSwift {
-				var filteredSnapList brtypes.SnapList
-				for _, snap := range snapList {
-					if !snap.IsChunk {
-						filteredSnapList = append(filteredSnapList, snap)
-					}
-				}
-				snapList = filteredSnapList
-			} else {
-				// chunksDeleted stores the no of chunks deleted in the current iteration of GC.
-				var chunksDeleted int
-				chunksDeleted, snapList = ssr.GarbageCollectChunks(snapList)
-				ssr.logger.Infof("GC: Total number garbage collected chunks: %d", chunksDeleted)
-			}
-
-			snapStreamIndexList := getSnapStreamIndexList(snapList)
+// PlanGarbageCollection lists the snapshots of the given store and returns the decisions of the garbage collector about them,
+// without deleting any snapshot.
+// Snapshots whose pin cannot be read are kept, and reported in the warnings of the plan.
+func (ssr *Snapshotter) PlanGarbageCollection(store brtypes.SnapStore) (*GarbageCollectionPlan, error) {
+	snapList, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	pins, pinErr := snapstore.GetActiveSnapshotPins(store, snapList, time.Now().UTC())
+	plan := ssr.gcPlanner.Plan(snapList, ssr.PrevSnapshot.LastRevision, pins)
+	if pinErr != nil {
+		plan.Warnings = append(plan.Warnings, pinErr.Error())
+	}
+	return plan, nil
+}
 
-			switch ssr.config.GarbageCollectionPolicy {
-			case brtypes.GarbageCollectionPolicyExponential:
-				// Overall policy:
-				// Delete delta snapshots in all snapStream but the latest one.
-				// Keep only the last 24 hourly backups and of all other backups only the last backup in a day.
-				// Keep only the last 7 daily backups and of all other backups only the last backup in a week.
-				// Keep only the last 4 weekly backups.
-				var (
-					deleteSnap bool
-					threshold  int
-					now        = time.Now().UTC()
-					// Round off current time to EOD
-					eod          = now.Truncate(24 * time.Hour).Add(23 * time.Hour).Add(59 * time.Minute).Add(59 * time.Second)
-					trackingWeek = 0
-				)
-				// Here we start processing from second last snapstream, because we want to keep last snapstream
-				// including delta snapshots in it.
-				for snapStreamIndex := len(snapStreamIndexList) - 1; snapStreamIndex > 0; snapStreamIndex-- {
-					snap := snapList[snapStreamIndexList[snapStreamIndex]]
-					nextSnap := snapList[snapStreamIndexList[snapStreamIndex-1]]
+// ApplyGarbageCollectionPlan deletes the snapshots which the given plan deletes from the snapstore of the snapshotter.
+// The delta snapshots of a snapStream are deleted from the latest to the oldest, and the full snapshot of a snapStream
+// is deleted only if all of them were deleted. It returns the number of deleted chunks and snapshots.
+func (ssr *Snapshotter) ApplyGarbageCollectionPlan(plan *GarbageCollectionPlan) (int, int) {
+	for _, warning := range plan.Warnings {
+		ssr.logger.Warnf("GC: %s", warning)
+	}
 
-					// garbage collect delta snapshots.
-					deletedSnap, err := ssr.GarbageCollectDeltaSnapshots(snapList[snapStreamIndexList[snapStreamIndex-1]:snapStreamIndexList[snapStreamIndex]])
-					total += deletedSnap
-					if err != nil {
-						continue
-					}
+	var (
+		snapList      brtypes.SnapList
+		garbage       = make(map[*brtypes.Snapshot]bool)
+		chunksDeleted = 0
+		total         = 0
+	)
+	for _, decision := range plan.Decisions {
+		snap := decision.Snapshot
+		if !snap.IsChunk {
+			snapList = append(snapList, snap)
+			garbage[snap] = decision.Action == GarbageCollectionActionDelete
+			continue
+		}
+		if decision.Action == GarbageCollectionActionDelete && ssr.deleteChunk(snap) {
+			chunksDeleted++
+		}
+	}
+	ssr.logger.Infof("GC: Total number garbage collected chunks: %d", chunksDeleted)
 
-					delta := eod.Sub(nextSnap.CreatedOn)
-					// Depending on how old the nextSnap is, decide what is the criteria of saving it (1 per hour or day or week)
-					switch {
-					case delta < time.Duration(24)*time.Hour:
-						// Snapshot of current day
-						if nextSnap.CreatedOn.Hour() == now.Hour() {
-							// Save snapshot of current hour
-							threshold = 0
-							break
-						}
-						threshold = 1
-					case delta < time.Duration(8*24)*time.Hour:
-						// Snapshot of week ending with previous day
-						threshold = 24
-					case delta < time.Duration(5*7*24)*time.Hour:
-						// Snapshot of month ending 8 days back (i.e., lesser than 5 weeks old)
-						if trackingWeek == 0 {
-							// As The week ends previous day, to keep track of change in week
-							// we shift eod to previous day's EOD when start tracking week
-							eod = eod.Add(-24 * time.Hour)
-							trackingWeek = 1
-						}
-						threshold = 24 * 7
-					default:
-						// Delete snapshots older than 4 weeks
-						threshold = math.MaxInt32
-					}
+	if len(snapList) != 0 {
+		snapStreamIndexList := append(getSnapStreamIndexList(snapList), len(snapList))
+		for snapStreamIndex := 0; snapStreamIndex < len(snapStreamIndexList)-1; snapStreamIndex++ {
+			snapStream := snapList[snapStreamIndexList[snapStreamIndex]:snapStreamIndexList[snapStreamIndex+1]]
+			deletedSnap, err := ssr.deleteDeltaSnapshots(snapStream, func(snap *brtypes.Snapshot) bool { return garbage[snap] })
+			total += deletedSnap
+			if err != nil {
+				continue
+			}
+			if snap := snapStream[0]; snap.Kind == brtypes.SnapshotKindFull && garbage[snap] && ssr.deleteFullSnapshot(snap) {
+				total++
+			}
+		}
+	}
+	ssr.logger.Infof("GC: Total number garbage collected snapshots: %d", total)
+	return chunksDeleted, total
+}
 
-					// Were snap and nextSnap created in different hour windows
-					hourChange := int(eod.Sub(nextSnap.CreatedOn).Hours()) - int(eod.Sub(snap.CreatedOn).Hours())
-					// Were snap and nextSnap created in different day windows
-					dayChange := int(eod.Sub(nextSnap.CreatedOn).Hours()/24) - int(eod.Sub(snap.CreatedOn).Hours()/24)
-					// Were snap and nextSnap created in different week windows
-					weekChange := int(eod.Sub(nextSnap.CreatedOn).Hours()/(24*7)) - int(eod.Sub(snap.CreatedOn).Hours()/(24*7))
+// deleteFullSnapshot deletes the given garbage collected full snapshot and records the outcome in the metrics.
+// It returns whether the snapshot was deleted.
+func (ssr *Snapshotter) deleteFullSnapshot(snap *brtypes.Snapshot) bool {
+	snapPath := path.Join(snap.SnapDir, snap.SnapName)
+	ssr.logger.Infof("GC: Deleting old full snapshot: %s", snapPath)
+	if err := ssr.deleteSnapshot(snap); err != nil {
+		ssr.logger.Warnf("GC: Failed to delete snapshot %s: %v", snapPath, err)
+		metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
+		metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
+		return false
+	}
+	metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
+	return true
+}
 
-					if threshold == 0 || hourChange/threshold != 0 || dayChange*24/threshold != 0 || weekChange*24*7/threshold != 0 {
-						// The change in parameter was more than the threshold, so don't delete the snapshot
-						deleteSnap = false
-					} else {
-						// The change in parameter was less than the threshold, so delete the snapshot
-						deleteSnap = true
-					}
+// deleteSnapshot deletes the given garbage collected snapshot along with its metadata, and runs the snapshot delete hooks.
+// A snapshot is not deleted if a pre snapshot delete hook aborts.
+func (ssr *Snapshotter) deleteSnapshot(snap *brtypes.Snapshot) error {
+	if err := ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePreSnapshotDelete, hooks.Payload{Snapshot: snap}); err != nil {
+		return err
+	}
+	if err := ssr.store.Delete(*snap); err != nil {
+		return err
+	}
+	metrics.GCSnapshotBytes.With(prometheus.Labels{metrics.LabelKind: snap.Kind}).Add(float64(snap.Size))
+	ssr.deleteSnapshotMetadata(snap)
+	events.Emit(events.TypeSnapshotDeleted, path.Join(snap.SnapDir, snap.SnapName), events.SnapshotData{Snapshot: snap})
+	return ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePostSnapshotDelete, hooks.Payload{Snapshot: snap})
+}
 
-					if deleteSnap {
-						ssr.logger.Infof("GC: Deleting old full snapshot: %s %v", nextSnap.CreatedOn.UTC(), deleteSnap)
-						if err := ssr.store.Delete(*nextSnap); err != nil {
-							ssr.logger.Warnf("GC: Failed to delete snapshot %s: %v", path.Join(nextSnap.SnapDir, nextSnap.SnapName), err)
-							metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
-							metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
-							continue
-						}
-						metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
-						total++
-					}
-				}
+// deleteSnapshotMetadata deletes the metadata and the expired pin stored alongside the given garbage collected snapshot.
+func (ssr *Snapshotter) deleteSnapshotMetadata(snap *brtypes.Snapshot) {
+	if err := snapstore.DeleteSnapshotMetadata(ssr.store, *snap); err != nil {
+		ssr.logger.Warnf("GC: %v", err)
+	}
+	if err := snapstore.UnpinSnapshot(ssr.store, *snap); err != nil {
+		ssr.logger.Warnf("GC: %v", err)
+	}
+}
 
-			case brtypes.GarbageCollectionPolicyLimitBased:
-				// Delete delta snapshots in all snapStream but the latest one.
-				// Delete all snapshots beyond limit set by ssr.maxBackups.
-				for snapStreamIndex := 0; snapStreamIndex < len(snapStreamIndexList)-1; snapStreamIndex++ {
-					deletedSnap, err := ssr.GarbageCollectDeltaSnapshots(snapList[snapStreamIndexList[snapStreamIndex]:snapStreamIndexList[snapStreamIndex+1]])
-					total += deletedSnap
-					if err != nil {
-						continue
-					}
-					if snapStreamIndex < len(snapStreamIndexList)-int(ssr.config.MaxBackups) {
-						snap := snapList[snapStreamIndexList[snapStreamIndex]]
-						snapPath := path.Join(snap.SnapDir, snap.SnapName)
-						ssr.logger.Infof("GC: Deleting old full snapshot: %s", snapPath)
-						if err := ssr.store.Delete(*snap); err != nil {
-							ssr.logger.Warnf("GC: Failed to delete snapshot %s: %v", snapPath, err)
-							metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
-							metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
-							continue
-						}
-						metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
-						total++
-					}
-				}
-			}
-			ssr.logger.Infof("GC: Total number garbage collected snapshots: %d", total)
-		}
+// activeSnapshotPins returns the active pins of the snapshots in the given list. Snapshots whose pin
+// cannot be read are treated as pinned.
+func (ssr *Snapshotter) activeSnapshotPins(snapList brtypes.SnapList) map[*brtypes.Snapshot]*brtypes.SnapshotPin {
+	pins, err := snapstore.GetActiveSnapshotPins(ssr.store, snapList, time.Now().UTC())
+	if err != nil {
+		ssr.logger.Warnf("GC: %v", err)
 	}
+	return pins
 }
 
 // getSnapStreamIndexList lists the index of snapStreams in snapList which consist of collection of snapStream.
@@ -201,9 +184,11 @@ func getSnapStreamIndexList(snapList brtypes.SnapList) []int {
 // GarbageCollectChunks removes obsolete chunks based on the latest recorded snapshot.
 // It eliminates chunks associated with snapshots that have already been uploaded.
 // Additionally, it avoids deleting chunks linked to snapshots currently being uploaded to prevent the garbage collector from removing chunks before the composite is formed.
+// Chunks of pinned snapshots are not deleted either.
 func (ssr *Snapshotter) GarbageCollectChunks(snapList brtypes.SnapList) (int, brtypes.SnapList) {
 	var nonChunkSnapList brtypes.SnapList
 	chunksDeleted := 0
+	pins := ssr.activeSnapshotPins(snapList)
 	for _, snap := range snapList {
 		// If not chunk, add to list and continue
 		if !snap.IsChunk {
@@ -214,23 +199,36 @@ func (ssr *Snapshotter) GarbageCollectChunks(snapList brtypes.SnapList) (int, br
 		if ssr.PrevSnapshot.LastRevision == 0 || snap.StartRevision > ssr.PrevSnapshot.LastRevision {
 			continue
 		}
-		// delete the chunk object
-		snapPath := path.Join(snap.SnapDir, snap.SnapName)
-		ssr.logger.Infof("GC: Deleting chunk for old snapshot: %s", snapPath)
-		if err := ssr.store.Delete(*snap); err != nil {
-			ssr.logger.Warnf("GC: Failed to delete chunk %s: %v", snapPath, err)
-			metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
-			metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindChunk, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
+		if pin := snapshotPin(pins, snap); pin != nil {
+			ssr.logger.Infof("GC: Skipping chunk of snapshot %s", pin)
 			continue
 		}
-		chunksDeleted++
-		metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindChunk, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
+		if ssr.deleteChunk(snap) {
+			chunksDeleted++
+		}
 	}
 	return chunksDeleted, nonChunkSnapList
 }
 
+// deleteChunk deletes the given obsolete chunk and records the outcome in the metrics.
+// It returns whether the chunk was deleted.
+func (ssr *Snapshotter) deleteChunk(snap *brtypes.Snapshot) bool {
+	snapPath := path.Join(snap.SnapDir, snap.SnapName)
+	ssr.logger.Infof("GC: Deleting chunk for old snapshot: %s", snapPath)
+	if err := ssr.store.Delete(*snap); err != nil {
+		ssr.logger.Warnf("GC: Failed to delete chunk %s: %v", snapPath, err)
+		metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
+		metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindChunk, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
+		return false
+	}
+	metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindChunk, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Inc()
+	metrics.GCSnapshotBytes.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindChunk}).Add(float64(snap.Size))
+	return true
+}
+
 /*
 GarbageCollectDeltaSnapshots traverses the list of snapshots and removes delta snapshots that are older than the retention period specified in the Snapshotter's configuration.
+Pinned delta snapshots are not removed.
 
 Parameters:
 
@@ -242,14 +240,23 @@ Returns:
 	error - Error information, if any error occurred during the garbage collection. Returns 'nil' if operation is successful.
 */
 func (ssr *Snapshotter) GarbageCollectDeltaSnapshots(snapStream brtypes.SnapList) (int, error) {
-	totalDeleted := 0
 	cutoffTime := time.Now().UTC().Add(-ssr.config.DeltaSnapshotRetentionPeriod.Duration)
+	pins := ssr.activeSnapshotPins(snapStream)
+	return ssr.deleteDeltaSnapshots(snapStream, func(snap *brtypes.Snapshot) bool {
+		return snap.CreatedOn.Before(cutoffTime) && pins[snap] == nil
+	})
+}
+
+// deleteDeltaSnapshots deletes the delta snapshots of the given snapStream selected by isGarbage, from the latest to the oldest.
+// It stops at the first snapshot which cannot be deleted, and returns the number of deleted snapshots.
+func (ssr *Snapshotter) deleteDeltaSnapshots(snapStream brtypes.SnapList, isGarbage func(*brtypes.Snapshot) bool) (int, error) {
+	totalDeleted := 0
 	for i := len(snapStream) - 1; i >= 0; i-- {
-		if (*snapStream[i]).Kind == brtypes.SnapshotKindDelta && snapStream[i].CreatedOn.Before(cutoffTime) {
+		if (*snapStream[i]).Kind == brtypes.SnapshotKindDelta && isGarbage(snapStream[i]) {
 			snapPath := path.Join(snapStream[i].SnapDir, snapStream[i].SnapName)
 			ssr.logger.Infof("GC: Deleting old delta snapshot: %s", snapPath)
 
-			if err := ssr.store.Delete(*snapStream[i]); err != nil {
+			if err := ssr.deleteSnapshot(snapStream[i]); err != nil {
 				ssr.logger.Warnf("GC: Failed to delete snapshot %s: %v", snapPath, err)
 				metrics.SnapshotterOperationFailure.With(prometheus.Labels{metrics.LabelError: err.Error()}).Inc()
 				metrics.GCSnapshotCounter.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Inc()
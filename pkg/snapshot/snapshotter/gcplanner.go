@@ -0,0 +1,326 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"k8s.io/utils/clock"
+)
+
+const (
+	// GarbageCollectionActionKeep is the action of a snapshot which is kept by the garbage collector.
+	GarbageCollectionActionKeep = "Keep"
+	// GarbageCollectionActionDelete is the action of a snapshot which is deleted by the garbage collector.
+	GarbageCollectionActionDelete = "Delete"
+)
+
+// GarbageCollectionDecision is the decision of the garbage collector about a snapshot.
+type GarbageCollectionDecision struct {
+	// Snapshot is the snapshot the decision is about.
+	Snapshot *brtypes.Snapshot `json:"snapshot"`
+	// Action is either Keep or Delete.
+	Action string `json:"action"`
+	// Reason explains why the snapshot is kept or deleted.
+	Reason string `json:"reason"`
+}
+
+// GarbageCollectionPlan holds the decisions of the garbage collector about the snapshots of a snapstore.
+type GarbageCollectionPlan struct {
+	// Time is the time at which the plan was made.
+	Time time.Time `json:"time"`
+	// Policies are the garbage collection policies the plan was made with.
+	Policies []string `json:"policies"`
+	// Decisions are the decisions about the snapshots, in the order they are listed by the snapstore.
+	Decisions []GarbageCollectionDecision `json:"decisions"`
+	// Warnings are the issues found while making the plan, e.g. a max backup size which cannot be met.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Deleted returns the snapshots which the plan deletes.
+func (p *GarbageCollectionPlan) Deleted() brtypes.SnapList {
+	var snapList brtypes.SnapList
+	for _, decision := range p.Decisions {
+		if decision.Action == GarbageCollectionActionDelete {
+			snapList = append(snapList, decision.Snapshot)
+		}
+	}
+	return snapList
+}
+
+// GarbageCollectionPlanner decides which snapshots are deleted by the garbage collector according to the configured
+// garbage collection policies. It does not access the snapstore, so that its decisions can be inspected before they are applied.
+type GarbageCollectionPlanner struct {
+	config             *brtypes.SnapshotterConfig
+	provider           string
+	gfsRetentionPolicy *GFSRetentionPolicy
+	clock              clock.PassiveClock
+}
+
+// NewGarbageCollectionPlanner returns a planner for the given config and storage provider, which evaluates the age of
+// the snapshots against the time of the given clock.
+func NewGarbageCollectionPlanner(config *brtypes.SnapshotterConfig, provider string, clock clock.PassiveClock) (*GarbageCollectionPlanner, error) {
+	var gfsRetentionPolicy *GFSRetentionPolicy
+	if config.HasGarbageCollectionPolicy(brtypes.GarbageCollectionPolicyGFS) {
+		var err error
+		if gfsRetentionPolicy, err = NewGFSRetentionPolicy(config.GFSRetention, clock); err != nil {
+			return nil, err
+		}
+	}
+	return &GarbageCollectionPlanner{
+		config:             config,
+		provider:           provider,
+		gfsRetentionPolicy: gfsRetentionPolicy,
+		clock:              clock,
+	}, nil
+}
+
+// Plan returns the decisions about the given snapshots, sorted as listed by the snapstore.
+// Chunks starting after the given revision of the latest uploaded snapshot belong to a snapshot being uploaded.
+// The latest full snapshot and its delta snapshots, as well as the snapshots with an active pin, are always kept.
+func (p *GarbageCollectionPlanner) Plan(snapList brtypes.SnapList, latestRevision int64, pins map[*brtypes.Snapshot]*brtypes.SnapshotPin) *GarbageCollectionPlan {
+	plan := &GarbageCollectionPlan{
+		Time:      p.clock.Now().UTC(),
+		Policies:  p.config.GarbageCollectionPolicies(),
+		Decisions: make([]GarbageCollectionDecision, 0, len(snapList)),
+	}
+	decisions := make(map[*brtypes.Snapshot]GarbageCollectionDecision, len(snapList))
+	keep := func(snap *brtypes.Snapshot, reason string) {
+		decisions[snap] = GarbageCollectionDecision{Snapshot: snap, Action: GarbageCollectionActionKeep, Reason: reason}
+	}
+	remove := func(snap *brtypes.Snapshot, reason string) {
+		decisions[snap] = GarbageCollectionDecision{Snapshot: snap, Action: GarbageCollectionActionDelete, Reason: reason}
+	}
+
+	var nonChunkSnapList brtypes.SnapList
+	for _, snap := range snapList {
+		pin := snapshotPin(pins, snap)
+		switch {
+		case !snap.IsChunk:
+			nonChunkSnapList = append(nonChunkSnapList, snap)
+		case pin != nil:
+			keep(snap, fmt.Sprintf("chunk of a snapshot %s", pin))
+		case p.provider == brtypes.SnapstoreProviderSwift:
+			// The manifest object is a virtual representation of the object, and the actual data is stored in the segment
+			// objects, aka chunks. Chunk deletion for this provider is handled in regular snapshot deletion.
+			keep(snap, "segment of a snapshot, which is deleted along with the snapshot")
+		case latestRevision == 0 || snap.StartRevision > latestRevision:
+			keep(snap, "chunk of a snapshot which is being uploaded")
+		default:
+			remove(snap, "obsolete chunk of an uploaded snapshot")
+		}
+	}
+
+	if len(nonChunkSnapList) != 0 {
+		snapStreamIndexList := getSnapStreamIndexList(nonChunkSnapList)
+		garbage, warnings := p.selectGarbageFullSnapshots(nonChunkSnapList, snapStreamIndexList, pins)
+		plan.Warnings = warnings
+		deltaCutoffTime := p.clock.Now().UTC().Add(-p.config.DeltaSnapshotRetentionPeriod.Duration)
+		latestSnapStreamStart := snapStreamIndexList[len(snapStreamIndexList)-1]
+		for index, snap := range nonChunkSnapList {
+			switch {
+			case pins[snap] != nil:
+				keep(snap, pins[snap].String())
+			case index >= latestSnapStreamStart:
+				keep(snap, "snapshot of the latest snapshot stream, which is always kept")
+			case snap.Kind == brtypes.SnapshotKindDelta && snap.CreatedOn.Before(deltaCutoffTime):
+				remove(snap, fmt.Sprintf("delta snapshot older than the delta snapshot retention period of %s", p.config.DeltaSnapshotRetentionPeriod.Duration))
+			case snap.Kind == brtypes.SnapshotKindDelta:
+				keep(snap, fmt.Sprintf("delta snapshot within the delta snapshot retention period of %s", p.config.DeltaSnapshotRetentionPeriod.Duration))
+			case len(garbage[snap]) != 0:
+				remove(snap, strings.Join(garbage[snap], "; "))
+			default:
+				keep(snap, "full snapshot retained by the garbage collection policies")
+			}
+		}
+	}
+
+	for _, snap := range snapList {
+		plan.Decisions = append(plan.Decisions, decisions[snap])
+	}
+	return plan
+}
+
+// selectGarbageFullSnapshots returns the full snapshots, besides the one of the latest snapStream, which are selected
+// for deletion by any of the configured garbage collection policies, along with the reasons of the policies.
+// The SizeBased policy is applied last, to the snapshots retained by the other policies or pinned.
+func (p *GarbageCollectionPlanner) selectGarbageFullSnapshots(snapList brtypes.SnapList, snapStreamIndexList []int, pins map[*brtypes.Snapshot]*brtypes.SnapshotPin) (map[*brtypes.Snapshot][]string, []string) {
+	garbage := make(map[*brtypes.Snapshot][]string)
+	fullSnapshotsOfPastStreams := func() brtypes.SnapList {
+		var fullSnapList brtypes.SnapList
+		for snapStreamIndex := 0; snapStreamIndex < len(snapStreamIndexList)-1; snapStreamIndex++ {
+			if snap := snapList[snapStreamIndexList[snapStreamIndex]]; snap.Kind == brtypes.SnapshotKindFull {
+				fullSnapList = append(fullSnapList, snap)
+			}
+		}
+		return fullSnapList
+	}
+
+	for _, policy := range p.config.GarbageCollectionPolicies() {
+		switch policy {
+		case brtypes.GarbageCollectionPolicyExponential:
+			p.selectExponentialGarbage(snapList, snapStreamIndexList, garbage)
+
+		case brtypes.GarbageCollectionPolicyLimitBased:
+			// Delete all snapshots beyond limit set by ssr.maxBackups.
+			reason := fmt.Sprintf("%s: beyond the %d most recent full snapshots", policy, p.config.MaxBackups)
+			for snapStreamIndex := 0; snapStreamIndex < len(snapStreamIndexList)-int(p.config.MaxBackups); snapStreamIndex++ {
+				snap := snapList[snapStreamIndexList[snapStreamIndex]]
+				garbage[snap] = append(garbage[snap], reason)
+			}
+
+		case brtypes.GarbageCollectionPolicyGFS:
+			// Delete all full snapshots which are not retained by the configured GFS retention policy.
+			var fullSnapList brtypes.SnapList
+			for _, snapStreamIndex := range snapStreamIndexList {
+				if snap := snapList[snapStreamIndex]; snap.Kind == brtypes.SnapshotKindFull {
+					fullSnapList = append(fullSnapList, snap)
+				}
+			}
+			retained := p.gfsRetentionPolicy.Retained(fullSnapList)
+			for _, snap := range fullSnapshotsOfPastStreams() {
+				if !retained[snap] {
+					garbage[snap] = append(garbage[snap], fmt.Sprintf("%s: not retained by the GFS retention policy", policy))
+				}
+			}
+
+		case brtypes.GarbageCollectionPolicyAgeBased:
+			// Delete all full snapshots older than the full snapshot retention period.
+			cutoffTime := p.clock.Now().UTC().Add(-p.config.FullSnapshotRetentionPeriod.Duration)
+			for _, snap := range fullSnapshotsOfPastStreams() {
+				if snap.CreatedOn.Before(cutoffTime) {
+					garbage[snap] = append(garbage[snap], fmt.Sprintf("%s: older than the full snapshot retention period of %s", policy, p.config.FullSnapshotRetentionPeriod.Duration))
+				}
+			}
+		}
+	}
+	var warnings []string
+	if p.config.HasGarbageCollectionPolicy(brtypes.GarbageCollectionPolicySizeBased) {
+		if warning := p.selectSizeBasedGarbage(snapList, snapStreamIndexList, garbage, pins); len(warning) != 0 {
+			warnings = append(warnings, warning)
+		}
+	}
+	return garbage, warnings
+}
+
+// selectExponentialGarbage selects the full snapshots for deletion according to the exponential policy:
+// Keep only the last 24 hourly backups and of all other backups only the last backup in a day.
+// Keep only the last 7 daily backups and of all other backups only the last backup in a week.
+// Keep only the last 4 weekly backups.
+func (p *GarbageCollectionPlanner) selectExponentialGarbage(snapList brtypes.SnapList, snapStreamIndexList []int, garbage map[*brtypes.Snapshot][]string) {
+	var (
+		threshold int
+		reason    string
+		now       = p.clock.Now().UTC()
+		// Round off current time to EOD
+		eod          = now.Truncate(24 * time.Hour).Add(23 * time.Hour).Add(59 * time.Minute).Add(59 * time.Second)
+		trackingWeek = 0
+	)
+	// Here we start processing from second last snapstream, because we want to keep last snapstream
+	// including delta snapshots in it.
+	for snapStreamIndex := len(snapStreamIndexList) - 1; snapStreamIndex > 0; snapStreamIndex-- {
+		snap := snapList[snapStreamIndexList[snapStreamIndex]]
+		nextSnap := snapList[snapStreamIndexList[snapStreamIndex-1]]
+
+		delta := eod.Sub(nextSnap.CreatedOn)
+		// Depending on how old the nextSnap is, decide what is the criteria of saving it (1 per hour or day or week)
+		switch {
+		case delta < time.Duration(24)*time.Hour:
+			// Snapshot of current day
+			if nextSnap.CreatedOn.Hour() == now.Hour() {
+				// Save snapshot of current hour
+				threshold = 0
+				break
+			}
+			threshold = 1
+			reason = "not the latest full snapshot of its hour"
+		case delta < time.Duration(8*24)*time.Hour:
+			// Snapshot of week ending with previous day
+			threshold = 24
+			reason = "not the latest full snapshot of its day"
+		case delta < time.Duration(5*7*24)*time.Hour:
+			// Snapshot of month ending 8 days back (i.e., lesser than 5 weeks old)
+			if trackingWeek == 0 {
+				// As The week ends previous day, to keep track of change in week
+				// we shift eod to previous day's EOD when start tracking week
+				eod = eod.Add(-24 * time.Hour)
+				trackingWeek = 1
+			}
+			threshold = 24 * 7
+			reason = "not the latest full snapshot of its week"
+		default:
+			// Delete snapshots older than 4 weeks
+			threshold = math.MaxInt32
+			reason = "older than 5 weeks"
+		}
+
+		// Were snap and nextSnap created in different hour windows
+		hourChange := int(eod.Sub(nextSnap.CreatedOn).Hours()) - int(eod.Sub(snap.CreatedOn).Hours())
+		// Were snap and nextSnap created in different day windows
+		dayChange := int(eod.Sub(nextSnap.CreatedOn).Hours()/24) - int(eod.Sub(snap.CreatedOn).Hours()/24)
+		// Were snap and nextSnap created in different week windows
+		weekChange := int(eod.Sub(nextSnap.CreatedOn).Hours()/(24*7)) - int(eod.Sub(snap.CreatedOn).Hours()/(24*7))
+
+		if threshold == 0 || hourChange/threshold != 0 || dayChange*24/threshold != 0 || weekChange*24*7/threshold != 0 {
+			// The change in parameter was more than the threshold, so don't delete the snapshot
+			continue
+		}
+		// The change in parameter was less than the threshold, so delete the snapshot
+		garbage[nextSnap] = append(garbage[nextSnap], fmt.Sprintf("%s: %s", brtypes.GarbageCollectionPolicyExponential, reason))
+	}
+}
+
+// selectSizeBasedGarbage selects the oldest full snapshots for deletion, besides the ones already selected,
+// until the total size of the retained snapshots is within the max backup size.
+// The pinned snapshots and the delta snapshots within the delta snapshot retention period are retained,
+// so they count towards the total size.
+// It returns a warning if the total size still exceeds the max backup size.
+func (p *GarbageCollectionPlanner) selectSizeBasedGarbage(snapList brtypes.SnapList, snapStreamIndexList []int, garbage map[*brtypes.Snapshot][]string, pins map[*brtypes.Snapshot]*brtypes.SnapshotPin) string {
+	var (
+		deltaCutoffTime = p.clock.Now().UTC().Add(-p.config.DeltaSnapshotRetentionPeriod.Duration)
+		latestSnapStart = snapStreamIndexList[len(snapStreamIndexList)-1]
+		maxSize         = int64(p.config.MaxBackupSize)
+		totalSize       int64
+	)
+	for index, snap := range snapList {
+		if index < latestSnapStart && pins[snap] == nil && (len(garbage[snap]) != 0 || snap.Kind == brtypes.SnapshotKindDelta && snap.CreatedOn.Before(deltaCutoffTime)) {
+			continue
+		}
+		totalSize += snap.Size
+	}
+	// Delete the oldest snapStreams first.
+	for snapStreamIndex := 0; snapStreamIndex < len(snapStreamIndexList)-1 && totalSize > maxSize; snapStreamIndex++ {
+		snap := snapList[snapStreamIndexList[snapStreamIndex]]
+		if snap.Kind != brtypes.SnapshotKindFull || len(garbage[snap]) != 0 || pins[snap] != nil {
+			continue
+		}
+		garbage[snap] = append(garbage[snap], fmt.Sprintf("%s: the total size of the backups exceeds the max backup size of %d bytes", brtypes.GarbageCollectionPolicySizeBased, maxSize))
+		totalSize -= snap.Size
+	}
+	if totalSize > maxSize {
+		return fmt.Sprintf("total size of the retained snapshots %d bytes exceeds the max backup size %d bytes, as the latest full snapshot, the pinned snapshots and the delta snapshots within the retention period are not garbage collected", totalSize, maxSize)
+	}
+	return ""
+}
+
+// snapshotPin returns the active pin of the given snapshot among the given pins, or nil if it is not pinned.
+// A chunk is pinned along with the snapshot it is part of.
+func snapshotPin(pins map[*brtypes.Snapshot]*brtypes.SnapshotPin, snap *brtypes.Snapshot) *brtypes.SnapshotPin {
+	if !snap.IsChunk {
+		return pins[snap]
+	}
+	for pinned, pin := range pins {
+		if pinned.SnapDir == snap.SnapDir && pinned.SnapName == path.Dir(snap.SnapName) {
+			return pin
+		}
+	}
+	return nil
+}
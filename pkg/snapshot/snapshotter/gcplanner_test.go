@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/gardener/etcd-backup-restore/pkg/snapshot/snapshotter"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Garbage collection planner", func() {
+	var (
+		fakeClock *testclock.FakeClock
+		config    *brtypes.SnapshotterConfig
+		provider  string
+		pins      map[*brtypes.Snapshot]*brtypes.SnapshotPin
+	)
+
+	// newSnapList returns the given number of hourly snapshot streams, each of a full snapshot followed by a delta snapshot
+	// 30 minutes later, the latest one starting an hour before the time of the fake clock.
+	newSnapList := func(streams int, size int64) brtypes.SnapList {
+		var snapList brtypes.SnapList
+		for i := 0; i < streams; i++ {
+			createdOn := fakeClock.Now().Add(-time.Duration(streams-i) * time.Hour)
+			revision := int64(100 * i)
+			snapList = append(snapList,
+				&brtypes.Snapshot{Kind: brtypes.SnapshotKindFull, StartRevision: 0, LastRevision: revision + 1, CreatedOn: createdOn, SnapName: fmt.Sprintf("Full-%d", i), Size: size},
+				&brtypes.Snapshot{Kind: brtypes.SnapshotKindDelta, StartRevision: revision + 2, LastRevision: revision + 50, CreatedOn: createdOn.Add(30 * time.Minute), SnapName: fmt.Sprintf("Incr-%d", i), Size: size},
+			)
+		}
+		return snapList
+	}
+	plan := func(snapList brtypes.SnapList, latestRevision int64) *GarbageCollectionPlan {
+		planner, err := NewGarbageCollectionPlanner(config, provider, fakeClock)
+		Expect(err).ShouldNot(HaveOccurred())
+		return planner.Plan(snapList, latestRevision, pins)
+	}
+	actions := func(plan *GarbageCollectionPlan) []string {
+		var actions []string
+		for _, decision := range plan.Decisions {
+			actions = append(actions, decision.Action)
+		}
+		return actions
+	}
+
+	BeforeEach(func() {
+		fakeClock = testclock.NewFakeClock(time.Date(2024, time.June, 14, 12, 0, 0, 0, time.UTC))
+		config = &brtypes.SnapshotterConfig{
+			GarbageCollectionPolicy:      brtypes.GarbageCollectionPolicyLimitBased,
+			MaxBackups:                   2,
+			DeltaSnapshotRetentionPeriod: wrappers.Duration{Duration: 2 * time.Hour},
+		}
+		provider = brtypes.SnapstoreProviderLocal
+		pins = nil
+	})
+
+	It("should return a decision with a reason for each snapshot", func() {
+		snapList := newSnapList(4, 10)
+		p := plan(snapList, 350)
+
+		Expect(p.Time).Should(Equal(fakeClock.Now()))
+		Expect(p.Policies).Should(Equal([]string{brtypes.GarbageCollectionPolicyLimitBased}))
+		Expect(p.Decisions).Should(HaveLen(len(snapList)))
+		for i, decision := range p.Decisions {
+			Expect(decision.Snapshot).Should(BeIdenticalTo(snapList[i]))
+			Expect(decision.Reason).ShouldNot(BeEmpty())
+		}
+		// the 2 oldest full snapshots are beyond the 2 most recent, and the delta snapshots of the 2 oldest streams are older
+		// than the delta snapshot retention period.
+		Expect(actions(p)).Should(Equal([]string{
+			GarbageCollectionActionDelete, GarbageCollectionActionDelete,
+			GarbageCollectionActionDelete, GarbageCollectionActionDelete,
+			GarbageCollectionActionKeep, GarbageCollectionActionKeep,
+			GarbageCollectionActionKeep, GarbageCollectionActionKeep,
+		}))
+		Expect(p.Decisions[0].Reason).Should(ContainSubstring("LimitBased"))
+		Expect(p.Deleted()).Should(Equal(snapList[:4]))
+	})
+
+	It("should always keep the latest snapshot stream", func() {
+		config.GarbageCollectionPolicy = brtypes.GarbageCollectionPolicyAgeBased
+		config.FullSnapshotRetentionPeriod = wrappers.Duration{Duration: time.Minute}
+		config.DeltaSnapshotRetentionPeriod = wrappers.Duration{Duration: time.Minute}
+		snapList := newSnapList(3, 10)
+		p := plan(snapList, 250)
+
+		Expect(p.Deleted()).Should(Equal(snapList[:4]))
+		Expect(p.Decisions[4].Action).Should(Equal(GarbageCollectionActionKeep))
+		Expect(p.Decisions[5].Action).Should(Equal(GarbageCollectionActionKeep))
+	})
+
+	It("should give the reasons of all policies which delete a full snapshot", func() {
+		config.GarbageCollectionPolicy = "LimitBased,AgeBased"
+		config.FullSnapshotRetentionPeriod = wrappers.Duration{Duration: 200 * time.Minute}
+		snapList := newSnapList(4, 10)
+		p := plan(snapList, 350)
+
+		Expect(p.Decisions[0].Action).Should(Equal(GarbageCollectionActionDelete))
+		Expect(p.Decisions[0].Reason).Should(And(ContainSubstring("LimitBased"), ContainSubstring("AgeBased")))
+		Expect(p.Decisions[2].Action).Should(Equal(GarbageCollectionActionDelete))
+		Expect(p.Decisions[2].Reason).Should(ContainSubstring("LimitBased"))
+		Expect(p.Decisions[2].Reason).ShouldNot(ContainSubstring("AgeBased"))
+	})
+
+	It("should delete only the chunks of uploaded snapshots", func() {
+		snapList := newSnapList(1, 10)
+		uploadedChunk := &brtypes.Snapshot{Kind: brtypes.SnapshotKindFull, StartRevision: 0, LastRevision: 1, SnapName: "Full-0/1", IsChunk: true}
+		uploadingChunk := &brtypes.Snapshot{Kind: brtypes.SnapshotKindDelta, StartRevision: 51, LastRevision: 60, SnapName: "Incr-1/1", IsChunk: true}
+		snapList = append(brtypes.SnapList{uploadedChunk}, append(snapList, uploadingChunk)...)
+
+		Expect(actions(plan(snapList, 50))).Should(Equal([]string{
+			GarbageCollectionActionDelete, GarbageCollectionActionKeep, GarbageCollectionActionKeep, GarbageCollectionActionKeep,
+		}))
+
+		provider = brtypes.SnapstoreProviderSwift
+		Expect(plan(snapList, 50).Deleted()).Should(BeEmpty())
+	})
+
+	It("should warn if the max backup size cannot be met", func() {
+		config.GarbageCollectionPolicy = brtypes.GarbageCollectionPolicySizeBased
+		config.MaxBackupSize = 30
+		snapList := newSnapList(3, 20)
+		p := plan(snapList, 250)
+
+		// the delta snapshot of the second stream is within the delta snapshot retention period.
+		Expect(p.Deleted()).Should(Equal(snapList[:3]))
+		Expect(p.Warnings).Should(HaveLen(1))
+
+		config.MaxBackupSize = 60
+		Expect(plan(snapList, 250).Warnings).Should(BeEmpty())
+	})
+
+	It("should keep pinned snapshots along with their chunks", func() {
+		snapList := newSnapList(4, 10)
+		chunk := &brtypes.Snapshot{Kind: brtypes.SnapshotKindFull, StartRevision: 0, LastRevision: 1, SnapName: "Full-0/1", IsChunk: true}
+		snapList = append(brtypes.SnapList{chunk}, snapList...)
+		pins = map[*brtypes.Snapshot]*brtypes.SnapshotPin{
+			snapList[1]: {Reason: "cluster upgrade", CreatedOn: fakeClock.Now()},
+		}
+		p := plan(snapList, 350)
+
+		Expect(p.Decisions[0].Action).Should(Equal(GarbageCollectionActionKeep))
+		Expect(p.Decisions[0].Reason).Should(ContainSubstring("cluster upgrade"))
+		Expect(p.Decisions[1].Action).Should(Equal(GarbageCollectionActionKeep))
+		Expect(p.Decisions[1].Reason).Should(Equal("pinned (cluster upgrade) indefinitely"))
+		Expect(p.Deleted()).Should(Equal(snapList[2:5]))
+	})
+
+	It("should count pinned snapshots towards the max backup size", func() {
+		config.GarbageCollectionPolicy = brtypes.GarbageCollectionPolicySizeBased
+		config.MaxBackupSize = 80
+		snapList := newSnapList(3, 20)
+		pins = map[*brtypes.Snapshot]*brtypes.SnapshotPin{
+			snapList[0]: {CreatedOn: fakeClock.Now()},
+		}
+		p := plan(snapList, 250)
+
+		// the pinned full snapshot is kept, so the full snapshot of the second stream is deleted instead.
+		Expect(p.Deleted()).Should(Equal(brtypes.SnapList{snapList[1], snapList[2]}))
+		Expect(p.Warnings).Should(BeEmpty())
+	})
+})
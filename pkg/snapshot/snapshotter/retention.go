@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"k8s.io/utils/clock"
+)
+
+// GFSRetentionPolicy decides which full snapshots are kept by the grandfather-father-son garbage collection policy.
+type GFSRetentionPolicy struct {
+	config   brtypes.GFSRetentionConfig
+	location *time.Location
+	clock    clock.PassiveClock
+}
+
+// retentionPeriod is a kind of period of the GFS retention policy, e.g. the hours.
+type retentionPeriod struct {
+	count uint
+	// start returns the start of the period which is the given number of periods after the one containing t.
+	start func(t time.Time, offset int) time.Time
+}
+
+// NewGFSRetentionPolicy returns the GFS retention policy of the given config, which evaluates the age of
+// the snapshots against the time of the given clock.
+func NewGFSRetentionPolicy(config brtypes.GFSRetentionConfig, clock clock.PassiveClock) (*GFSRetentionPolicy, error) {
+	loc, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+	return &GFSRetentionPolicy{
+		config:   config,
+		location: loc,
+		clock:    clock,
+	}, nil
+}
+
+// Retained returns the full snapshots of the given list, sorted by creation time, which are kept:
+//   - the KeepLast most recent full snapshots.
+//   - for each of the configured number of most recent hours, days, weeks, months and years, the latest full snapshot taken in it.
+func (p *GFSRetentionPolicy) Retained(fullSnapList brtypes.SnapList) map[*brtypes.Snapshot]bool {
+	retained := make(map[*brtypes.Snapshot]bool)
+	for i := len(fullSnapList) - 1; i >= 0 && len(fullSnapList)-i <= int(p.config.KeepLast); i-- {
+		retained[fullSnapList[i]] = true
+	}
+
+	now := p.clock.Now().In(p.location)
+	for _, period := range p.periods() {
+		if period.count == 0 {
+			continue
+		}
+		oldest := period.start(now, 1-int(period.count))
+		seen := make(map[int64]bool)
+		for i := len(fullSnapList) - 1; i >= 0; i-- {
+			createdOn := fullSnapList[i].CreatedOn.In(p.location)
+			if createdOn.Before(oldest) {
+				break
+			}
+			if start := period.start(createdOn, 0).Unix(); !seen[start] {
+				seen[start] = true
+				retained[fullSnapList[i]] = true
+			}
+		}
+	}
+	return retained
+}
+
+func (p *GFSRetentionPolicy) periods() []retentionPeriod {
+	return []retentionPeriod{
+		{count: p.config.Hourly, start: func(t time.Time, offset int) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(time.Duration(offset) * time.Hour)
+		}},
+		{count: p.config.Daily, start: func(t time.Time, offset int) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, t.Location())
+		}},
+		{count: p.config.Weekly, start: func(t time.Time, offset int) time.Time {
+			daysSinceMonday := (int(t.Weekday()) + 6) % 7
+			return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday+7*offset, 0, 0, 0, 0, t.Location())
+		}},
+		{count: p.config.Monthly, start: func(t time.Time, offset int) time.Time {
+			return time.Date(t.Year(), t.Month()+time.Month(offset), 1, 0, 0, 0, 0, t.Location())
+		}},
+		{count: p.config.Yearly, start: func(t time.Time, offset int) time.Time {
+			return time.Date(t.Year()+offset, time.January, 1, 0, 0, 0, 0, t.Location())
+		}},
+	}
+}
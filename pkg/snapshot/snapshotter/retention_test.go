@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter_test
+
+import (
+	"time"
+
+	. "github.com/gardener/etcd-backup-restore/pkg/snapshot/snapshotter"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	testclock "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("GFS retention policy", func() {
+	var (
+		fakeClock *testclock.FakeClock
+		config    brtypes.GFSRetentionConfig
+	)
+
+	newSnapshot := func(createdOn time.Time) *brtypes.Snapshot {
+		return &brtypes.Snapshot{Kind: brtypes.SnapshotKindFull, CreatedOn: createdOn}
+	}
+	// retain returns the snapshots of the list retained by the policy, in the same order.
+	retain := func(snapList brtypes.SnapList) brtypes.SnapList {
+		policy, err := NewGFSRetentionPolicy(config, fakeClock)
+		Expect(err).ShouldNot(HaveOccurred())
+		retained := policy.Retained(snapList)
+		var retainedList brtypes.SnapList
+		for _, snap := range snapList {
+			if retained[snap] {
+				retainedList = append(retainedList, snap)
+			}
+		}
+		return retainedList
+	}
+	// simulate takes a snapshot every interval until the given time, running the retention policy after each snapshot.
+	simulate := func(snapList brtypes.SnapList, interval time.Duration, until time.Time) brtypes.SnapList {
+		for !fakeClock.Now().After(until) {
+			snapList = retain(append(snapList, newSnapshot(fakeClock.Now())))
+			fakeClock.Step(interval)
+		}
+		return snapList
+	}
+	// countDistinct returns the number of distinct values of the key of the snapshots of the list.
+	countDistinct := func(snapList brtypes.SnapList, key func(time.Time) string) int {
+		keys := make(map[string]bool)
+		for _, snap := range snapList {
+			keys[key(snap.CreatedOn.UTC())] = true
+		}
+		return len(keys)
+	}
+
+	BeforeEach(func() {
+		fakeClock = testclock.NewFakeClock(time.Date(2023, time.January, 1, 0, 30, 0, 0, time.UTC))
+		config = brtypes.GFSRetentionConfig{KeepLast: 1}
+	})
+
+	It("should keep only the most recent snapshots", func() {
+		config.KeepLast = 3
+		snapList := simulate(nil, time.Hour, fakeClock.Now().Add(48*time.Hour))
+		Expect(snapList).Should(HaveLen(3))
+		Expect(snapList[2].CreatedOn).Should(Equal(fakeClock.Now().Add(-time.Hour)))
+	})
+
+	It("should keep the latest snapshot of each configured hour, day, week, month and year", func() {
+		config = brtypes.GFSRetentionConfig{KeepLast: 1, Hourly: 24, Daily: 7, Weekly: 4, Monthly: 6, Yearly: 2}
+		snapList := simulate(nil, time.Hour, time.Date(2024, time.June, 14, 12, 30, 0, 0, time.UTC))
+		now := fakeClock.Now().Add(-time.Hour)
+
+		hourly := countDistinct(snapList, func(t time.Time) string { return t.Format("2006-01-02T15") })
+		daily := countDistinct(snapList, func(t time.Time) string { return t.Format("2006-01-02") })
+		monthly := countDistinct(snapList, func(t time.Time) string { return t.Format("2006-01") })
+		yearly := countDistinct(snapList, func(t time.Time) string { return t.Format("2006") })
+		// 24 hourly snapshots (June 13, 13:30 to June 14, 12:30), 5 more daily snapshots (June 8 to 12), 2 more weekly
+		// snapshots (Sundays, May 26 and June 2, as June 9 is a daily one), 5 more monthly snapshots (January to May)
+		// and 1 more yearly snapshot (December 31, 2023).
+		Expect(snapList).Should(HaveLen(24 + 5 + 2 + 5 + 1))
+		Expect(hourly).Should(Equal(len(snapList)))
+		Expect(daily).Should(Equal(len(snapList) - 22))
+		Expect(monthly).Should(Equal(7))
+		Expect(yearly).Should(Equal(2))
+
+		// all snapshots of the last 24 hours are kept.
+		Expect(snapList[len(snapList)-24].CreatedOn).Should(Equal(now.Add(-23 * time.Hour)))
+		// the latest snapshot of each month is kept.
+		Expect(snapList).Should(ContainElement(HaveField("CreatedOn", time.Date(2024, time.May, 31, 23, 30, 0, 0, time.UTC))))
+		Expect(snapList).Should(ContainElement(HaveField("CreatedOn", time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC))))
+		// the latest snapshot of the previous year is kept.
+		Expect(snapList[0].CreatedOn).Should(Equal(time.Date(2023, time.December, 31, 23, 30, 0, 0, time.UTC)))
+	})
+
+	It("should keep the most recent snapshots if no snapshot was taken within the configured periods", func() {
+		config = brtypes.GFSRetentionConfig{KeepLast: 2, Hourly: 24, Daily: 7}
+		snapList := simulate(nil, time.Hour, fakeClock.Now().Add(10*time.Hour))
+		fakeClock.Step(30 * 24 * time.Hour)
+		snapList = retain(snapList)
+		Expect(snapList).Should(HaveLen(2))
+	})
+
+	It("should start the periods in the configured time zone", func() {
+		config = brtypes.GFSRetentionConfig{Daily: 2, TimeZone: "Asia/Kolkata"}
+		fakeClock.SetTime(time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC))
+		snapList := brtypes.SnapList{
+			newSnapshot(time.Date(2024, time.March, 8, 17, 0, 0, 0, time.UTC)),  // March 8, 22:30 IST
+			newSnapshot(time.Date(2024, time.March, 9, 18, 0, 0, 0, time.UTC)),  // March 9, 23:30 IST
+			newSnapshot(time.Date(2024, time.March, 9, 19, 0, 0, 0, time.UTC)),  // March 10, 00:30 IST
+			newSnapshot(time.Date(2024, time.March, 10, 10, 0, 0, 0, time.UTC)), // March 10, 15:30 IST
+		}
+		Expect(retain(snapList)).Should(Equal(brtypes.SnapList{snapList[1], snapList[3]}))
+
+		config.TimeZone = ""
+		Expect(retain(snapList)).Should(Equal(brtypes.SnapList{snapList[2], snapList[3]}))
+	})
+
+	It("should fail for an invalid time zone", func() {
+		config.TimeZone = "Invalid/Zone"
+		_, err := NewGFSRetentionPolicy(config, fakeClock)
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"fmt"
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// maxBlackoutSkips is the maximum number of consecutive activations of a schedule which are skipped
+	// because they fall into a blackout window, before the schedule is considered to never be due again.
+	maxBlackoutSkips = 1000
+	// maxGapHorizon is the period over which the gaps between the activations of the schedules are checked,
+	// which covers every cycle of a cron schedule.
+	maxGapHorizon = 2 * 366 * 24 * time.Hour
+	// maxGapActivations is the maximum number of activations of the schedules checked for the largest gap
+	// between them, which limits the period checked for frequent schedules.
+	maxGapActivations = 100000
+)
+
+// fullSnapshotSchedule is the union of the configured full snapshot schedules.
+type fullSnapshotSchedule []*calendarSchedule
+
+// calendarSchedule is a cron schedule evaluated in a time zone, whose activations within
+// one of its blackout windows are skipped.
+type calendarSchedule struct {
+	schedule        cron.Schedule
+	blackoutWindows []blackoutWindow
+}
+
+// blackoutWindow is a recurring window of time, starting at each activation of a cron schedule.
+type blackoutWindow struct {
+	start    cron.Schedule
+	duration time.Duration
+}
+
+// newFullSnapshotSchedule parses the given full snapshot schedules.
+func newFullSnapshotSchedule(configs []brtypes.FullSnapshotScheduleConfig) (fullSnapshotSchedule, error) {
+	var schedules fullSnapshotSchedule
+	for i := range configs {
+		config := &configs[i]
+		sdl, err := config.ParseCron(config.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid full snapshot schedule provided %s : %v", config.Schedule, err)
+		}
+		s := &calendarSchedule{schedule: sdl}
+		for _, w := range config.BlackoutWindows {
+			start, err := config.ParseCron(w.Start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start of blackout window provided %s : %v", w.Start, err)
+			}
+			if w.Duration.Duration <= 0 {
+				return nil, fmt.Errorf("invalid duration of blackout window provided %s", w.Duration.Duration)
+			}
+			s.blackoutWindows = append(s.blackoutWindows, blackoutWindow{start: start, duration: w.Duration.Duration})
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// Next returns the earliest time after the given time at which any of the schedules is due,
+// or the zero time if none of them is ever due again.
+func (f fullSnapshotSchedule) Next(t time.Time) time.Time {
+	var next time.Time
+	for _, s := range f {
+		n := s.Next(t)
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// Prev returns the latest time at or before the given time, and within the given window before it,
+// at which any of the schedules was due, or the zero time if none of them was due within the window.
+func (f fullSnapshotSchedule) Prev(t time.Time, window time.Duration) time.Time {
+	var prev time.Time
+	for next := f.Next(t.Add(-window)); !next.IsZero() && !next.After(t); next = f.Next(next) {
+		prev = next
+	}
+	return prev
+}
+
+// MaxGap returns the largest gap between consecutive times after the given time at which any of the schedules is due,
+// taking their blackout windows into account. It returns maxGapHorizon if the schedules are due less than twice within it.
+func (f fullSnapshotSchedule) MaxGap(t time.Time) time.Duration {
+	var (
+		maxGap time.Duration
+		prev   = f.Next(t)
+		end    = t.Add(maxGapHorizon)
+	)
+	if prev.IsZero() {
+		return maxGapHorizon
+	}
+	for i := 0; i < maxGapActivations; i++ {
+		next := f.Next(prev)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		if gap := next.Sub(prev); gap > maxGap {
+			maxGap = gap
+		}
+		prev = next
+	}
+	if maxGap == 0 {
+		return maxGapHorizon
+	}
+	return maxGap
+}
+
+// Next returns the first activation of the schedule after the given time which does not fall
+// into any of its blackout windows, or the zero time if there is none.
+func (s *calendarSchedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t)
+	for i := 0; i < maxBlackoutSkips && !next.IsZero(); i++ {
+		end, blackedOut := s.blackoutEnd(next)
+		if !blackedOut {
+			return next
+		}
+		// the window ends exclusively, so the schedule may be due exactly at its end.
+		next = s.schedule.Next(end.Add(-time.Second))
+	}
+	return time.Time{}
+}
+
+// blackoutEnd returns the latest end of the blackout windows the given time falls into, if any.
+func (s *calendarSchedule) blackoutEnd(t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, w := range s.blackoutWindows {
+		// The window which started last before the given time is the first one to start after
+		// the given time minus the duration of the window, if it did not start after the given time.
+		start := w.start.Next(t.Add(-w.duration))
+		if start.IsZero() || start.After(t) {
+			continue
+		}
+		if e := start.Add(w.duration); e.After(end) {
+			end = e
+		}
+	}
+	return end, !end.IsZero()
+}
@@ -15,12 +15,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/compressor"
 	"github.com/gardener/etcd-backup-restore/pkg/errors"
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	etcdClient "github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	"github.com/gardener/etcd-backup-restore/pkg/events"
 	"github.com/gardener/etcd-backup-restore/pkg/health/heartbeat"
+	"github.com/gardener/etcd-backup-restore/pkg/hooks"
 	"github.com/gardener/etcd-backup-restore/pkg/metrics"
 	"github.com/gardener/etcd-backup-restore/pkg/miscellaneous"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
@@ -28,9 +32,9 @@ import (
 	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
 
 	"github.com/prometheus/client_golang/prometheus"
-	cron "github.com/robfig/cron/v3"
 	"github.com/sirupsen/logrus"
 	"go.etcd.io/etcd/clientv3"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -61,12 +65,28 @@ type result struct {
 // NewSnapshotterConfig returns the snapshotter config.
 func NewSnapshotterConfig() *brtypes.SnapshotterConfig {
 	return &brtypes.SnapshotterConfig{
-		FullSnapshotSchedule:     brtypes.DefaultFullSnapshotSchedule,
-		DeltaSnapshotPeriod:      wrappers.Duration{Duration: brtypes.DefaultDeltaSnapshotInterval},
-		DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
-		GarbageCollectionPeriod:  wrappers.Duration{Duration: brtypes.DefaultGarbageCollectionPeriod},
-		GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicyExponential,
-		MaxBackups:               brtypes.DefaultMaxBackups,
+		FullSnapshotSchedule:                brtypes.DefaultFullSnapshotSchedule,
+		DeltaSnapshotPeriod:                 wrappers.Duration{Duration: brtypes.DefaultDeltaSnapshotInterval},
+		DeltaSnapshotMemoryLimit:            brtypes.DefaultDeltaSnapMemoryLimit,
+		GarbageCollectionPeriod:             wrappers.Duration{Duration: brtypes.DefaultGarbageCollectionPeriod},
+		GarbageCollectionPolicy:             brtypes.GarbageCollectionPolicyExponential,
+		MaxBackups:                          brtypes.DefaultMaxBackups,
+		DeltaSnapshotUploadQueueSize:        brtypes.DefaultDeltaSnapshotUploadQueueSize,
+		MaxParallelDeltaSnapshotUploads:     brtypes.DefaultMaxParallelDeltaSnapshotUploads,
+		WatchStallTimeout:                   wrappers.Duration{Duration: brtypes.DefaultWatchStallTimeout},
+		MinDeltaSnapshotPeriod:              wrappers.Duration{Duration: brtypes.DefaultMinDeltaSnapshotPeriod},
+		MaxDeltaSnapshotPeriod:              wrappers.Duration{Duration: brtypes.DefaultMaxDeltaSnapshotPeriod},
+		MinDeltaSnapshotMemoryLimit:         brtypes.DefaultMinDeltaSnapMemoryLimit,
+		MaxDeltaSnapshotMemoryLimit:         brtypes.DefaultMaxDeltaSnapMemoryLimit,
+		DeltaSnapshotRecoveryPointObjective: wrappers.Duration{Duration: brtypes.DefaultDeltaSnapshotRecoveryPointObjective},
+		FullSnapshotSourcePolicy:            brtypes.FullSnapshotSourceLocal,
+		FullSnapshotSourceMaxRaftLag:        brtypes.DefaultFullSnapshotSourceMaxRaftLag,
+		GFSRetention: brtypes.GFSRetentionConfig{
+			KeepLast: brtypes.DefaultGFSKeepLast,
+			Hourly:   brtypes.DefaultGFSHourly,
+			Daily:    brtypes.DefaultGFSDaily,
+			Weekly:   brtypes.DefaultGFSWeekly,
+		},
 	}
 }
 
@@ -78,7 +98,7 @@ type Snapshotter struct {
 	config                       *brtypes.SnapshotterConfig
 	compressionConfig            *compressor.CompressionConfig
 	HealthConfig                 *brtypes.HealthConfig
-	schedule                     cron.Schedule
+	schedule                     fullSnapshotSchedule
 	PrevSnapshot                 *brtypes.Snapshot
 	PrevFullSnapshot             *brtypes.Snapshot
 	PrevDeltaSnapshots           brtypes.SnapList
@@ -99,14 +119,28 @@ type Snapshotter struct {
 	K8sClientset                 client.Client
 	snapstoreConfig              *brtypes.SnapstoreConfig
 	lastSecretModifiedTime       time.Time
+	latestWatchRevision          int64
+	deltaUploader                *deltaUploadPipeline
+	watchProgressTimer           *time.Timer
+	watchRestartTimer            *time.Timer
+	watchRestarts                int
+	watchAppliedTime             time.Time
+	lastWatchResponseTime        atomic.Int64
+	watchStale                   atomic.Bool
+	keyFilter                    *brtypes.KeyPrefixFilter
+	deltaSnapshotTuner           *deltaSnapshotTuner
+	deltaSnapshotCycleStart      time.Time
+	deltaSnapshotDue             time.Time
+	hookRunner                   *hooks.Runner
+	gcPlanner                    *GarbageCollectionPlanner
 }
 
 // NewSnapshotter returns the snapshotter object.
 func NewSnapshotter(logger *logrus.Entry, config *brtypes.SnapshotterConfig, store brtypes.SnapStore, etcdConnectionConfig *brtypes.EtcdConnectionConfig, compressionConfig *compressor.CompressionConfig, healthConfig *brtypes.HealthConfig, storeConfig *brtypes.SnapstoreConfig) (*Snapshotter, error) {
-	sdl, err := cron.ParseStandard(config.FullSnapshotSchedule)
+	// Ideally this should be validated before.
+	sdl, err := newFullSnapshotSchedule(config.GetFullSnapshotSchedules())
 	if err != nil {
-		// Ideally this should be validated before.
-		return nil, fmt.Errorf("invalid full snapshot schedule provided %s : %v", config.FullSnapshotSchedule, err)
+		return nil, err
 	}
 
 	var prevSnapshot *brtypes.Snapshot
@@ -138,6 +172,26 @@ func NewSnapshotter(logger *logrus.Entry, config *brtypes.SnapshotterConfig, sto
 		}
 	}
 
+	keyFilter := config.KeyFilter()
+	if keyFilter != nil {
+		logger.Infof("Recording only the keys selected by the key filter (%s) in delta snapshots.", keyFilter)
+	}
+
+	var tuner *deltaSnapshotTuner
+	if config.AdaptiveDeltaSnapshotPeriod && config.DeltaSnapshotPeriod.Duration >= brtypes.DeltaSnapshotIntervalThreshold {
+		tuner = newDeltaSnapshotTuner(config)
+		logger.Infof("Adapting delta snapshot period between %s and %s to meet the recovery point objective of %s.", config.MinDeltaSnapshotPeriod.Duration, config.MaxDeltaSnapshotPeriod.Duration, config.DeltaSnapshotRecoveryPointObjective.Duration)
+	}
+
+	var provider string
+	if storeConfig != nil {
+		provider = storeConfig.Provider
+	}
+	gcPlanner, err := NewGarbageCollectionPlanner(config, provider, clock.RealClock{})
+	if err != nil {
+		return nil, err
+	}
+
 	return &Snapshotter{
 		logger:               logger.WithField("actor", "snapshotter"),
 		store:                store,
@@ -158,6 +212,10 @@ func NewSnapshotter(logger *logrus.Entry, config *brtypes.SnapshotterConfig, sto
 		cancelWatch:          func() {},
 		K8sClientset:         clientSet,
 		snapstoreConfig:      storeConfig,
+		keyFilter:            keyFilter,
+		deltaSnapshotTuner:   tuner,
+		hookRunner:           hooks.NewRunner(config.Hooks, logger),
+		gcPlanner:            gcPlanner,
 	}, nil
 }
 
@@ -179,12 +237,20 @@ func (ssr *Snapshotter) Run(stopCh <-chan struct{}, startWithFullSnapshot bool)
 			if ssrStopped {
 				return nil
 			}
-			if err != nil {
+			if err != nil && !isWatchCompacted(err) {
 				return fmt.Errorf("failed to collect events for first delta snapshot(s): %v", err)
 			}
+			if err != nil {
+				// the events since the previous snapshot are lost, so start with a full snapshot.
+				ssr.logger.Infof("Taking a full snapshot, as the events since previous snapshot can't be collected: %v", err)
+				startWithFullSnapshot = true
+				ssr.fullSnapshotTimer = time.NewTimer(0)
+			}
 		}
-		if err := ssr.resetFullSnapshotTimer(); err != nil {
-			return fmt.Errorf("failed to reset full snapshot timer: %v", err)
+		if !startWithFullSnapshot {
+			if err := ssr.resetFullSnapshotTimer(); err != nil {
+				return fmt.Errorf("failed to reset full snapshot timer: %v", err)
+			}
 		}
 	}
 	if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
@@ -192,9 +258,10 @@ func (ssr *Snapshotter) Run(stopCh <-chan struct{}, startWithFullSnapshot bool)
 	}
 	ssr.deltaSnapshotTimer = time.NewTimer(brtypes.DefaultDeltaSnapshotInterval)
 	if ssr.config.DeltaSnapshotPeriod.Duration >= brtypes.DeltaSnapshotIntervalThreshold {
-		ssr.deltaSnapshotTimer.Stop()
-		ssr.deltaSnapshotTimer.Reset(ssr.config.DeltaSnapshotPeriod.Duration)
+		ssr.resetDeltaSnapshotTimer()
+		ssr.startDeltaUploadPipeline()
 	}
+	ssr.resetWatchProgressTimer()
 
 	return ssr.snapshotEventHandler(stopCh)
 }
@@ -245,9 +312,18 @@ func (ssr *Snapshotter) stop(FullSnapshotLeaseStopCh chan struct{}) {
 		ssr.deltaSnapshotTimer.Stop()
 		ssr.deltaSnapshotTimer = nil
 	}
+	if ssr.watchProgressTimer != nil {
+		ssr.watchProgressTimer.Stop()
+		ssr.watchProgressTimer = nil
+	}
+	ssr.stopWatchRestartTimer()
+	ssr.watchRestarts = 0
+	ssr.watchStale.Store(false)
+	metrics.WatchStale.With(prometheus.Labels{}).Set(0)
 	if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
 		FullSnapshotLeaseStopCh <- emptyStruct
 	}
+	ssr.stopDeltaUploadPipeline()
 	ssr.SetSnapshotterInactive()
 	ssr.closeEtcdClient()
 }
@@ -292,6 +368,7 @@ func (ssr *Snapshotter) TakeFullSnapshotAndResetTimer(isFinal bool) (*brtypes.Sn
 		// As per design principle, in business critical service if backup is not working,
 		// it's better to fail the process. So, we are quiting here.
 		ssr.logger.Warnf("Taking scheduled full snapshot failed: %v", err)
+		events.Emit(events.TypeFullSnapshotFailed, "", events.SnapshotData{Error: err.Error()})
 		return nil, err
 	}
 
@@ -303,6 +380,11 @@ func (ssr *Snapshotter) TakeFullSnapshotAndResetTimer(isFinal bool) (*brtypes.Sn
 // store it to underlying snapstore on the fly.
 func (ssr *Snapshotter) takeFullSnapshot(isFinal bool) (*brtypes.Snapshot, error) {
 	defer ssr.cleanupInMemoryEvents()
+	// delta snapshots which are already sealed have to be committed before
+	// the full snapshot replaces the previous snapshot.
+	if err := ssr.flushDeltaSnapshots(); err != nil {
+		return nil, err
+	}
 	// close previous watch and client.
 	ssr.closeEtcdClient()
 
@@ -331,8 +413,9 @@ func (ssr *Snapshotter) takeFullSnapshot(isFinal bool) (*brtypes.Snapshot, error
 	defer clientKV.Close()
 
 	ctx, cancel := context.WithTimeout(context.TODO(), ssr.etcdConnectionConfig.ConnectionTimeout.Duration)
-	// Note: Although Get and snapshot call are not atomic, so revision number in snapshot file
-	// may be ahead of the revision found from GET call. But currently this is the only workaround available
+	// Note: Get and snapshot call are not atomic, so the revision found from GET call may be behind
+	// the revision of the snapshot. It is only used to skip unchanged snapshots, the snapshot itself
+	// is named with the exact revision read from its content.
 	// Refer: https://github.com/coreos/etcd/issues/9037
 	resp, err := clientKV.Get(ctx, "", clientv3.WithLastRev()...)
 	cancel()
@@ -356,16 +439,27 @@ func (ssr *Snapshotter) takeFullSnapshot(isFinal bool) (*brtypes.Snapshot, error
 			return nil, fmt.Errorf("failed to get compressionSuffix: %v", err)
 		}
 
-		clientMaintenance, err := clientFactory.NewMaintenance()
+		clientMaintenance, source, err := ssr.newFullSnapshotMaintenanceClient(clientFactory)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build etcd maintenance client")
 		}
 		defer clientMaintenance.Close()
 
-		s, err := etcdutil.TakeAndSaveFullSnapshot(ctx, clientMaintenance, ssr.store, lastRevision, ssr.compressionConfig, compressionSuffix, isFinal, ssr.logger)
+		if err := ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePreFullSnapshot, hooks.Payload{}); err != nil {
+			return nil, err
+		}
+
+		s, err := etcdutil.TakeAndSaveFullSnapshot(ctx, clientMaintenance, ssr.store, ssr.tempDir(), lastRevision, ssr.compressionConfig, compressionSuffix, isFinal, ssr.logger)
 		if err != nil {
 			return nil, err
 		}
+		if source != nil {
+			if err := snapstore.SaveSnapshotMetadata(ssr.store, *s, &brtypes.SnapshotMetadata{SourceMember: source}); err != nil {
+				ssr.logger.Warnf("Failed to save the source member of full snapshot %s: %v", s.SnapName, err)
+			} else {
+				s.HasMetadata = true
+			}
+		}
 
 		ssr.PrevSnapshot = s
 		ssr.PrevFullSnapshot = s
@@ -375,8 +469,15 @@ func (ssr *Snapshotter) takeFullSnapshot(isFinal bool) (*brtypes.Snapshot, error
 		metrics.LatestSnapshotTimestamp.With(prometheus.Labels{metrics.LabelKind: ssr.PrevSnapshot.Kind}).Set(float64(ssr.PrevSnapshot.CreatedOn.Unix()))
 		metrics.SnapstoreLatestDeltasTotal.With(prometheus.Labels{}).Set(0)
 		metrics.SnapstoreLatestDeltasRevisionsTotal.With(prometheus.Labels{}).Set(0)
+		ssr.updateDeltaSnapshotUploadLag()
 
 		ssr.logger.Infof("Successfully saved full snapshot at: %s", path.Join(s.SnapDir, s.SnapName))
+		events.Emit(events.TypeFullSnapshotSucceeded, path.Join(s.SnapDir, s.SnapName), events.SnapshotData{Snapshot: s})
+
+		// the full snapshot can't be undone anymore, so a failed hook is only logged.
+		if err := ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePostFullSnapshot, hooks.Payload{Snapshot: s}); err != nil {
+			ssr.logger.Errorf("Post full snapshot hook failed for snapshot %s: %v", path.Join(s.SnapDir, s.SnapName), err)
+		}
 	}
 	// setting `snapshotRequired` to 0 for both full and delta snapshot
 	// for the following cases:
@@ -390,28 +491,69 @@ func (ssr *Snapshotter) takeFullSnapshot(isFinal bool) (*brtypes.Snapshot, error
 		return ssr.PrevSnapshot, nil
 	}
 
-	ssrEtcdWatchClient, err := clientFactory.NewWatcher()
-	if err != nil {
-		return nil, &errors.EtcdError{
-			Message: fmt.Sprintf("failed to create etcd watch client for snapshotter: %v", err),
-		}
+	if err := ssr.applyWatch(clientFactory, ssr.PrevSnapshot.LastRevision+1); err != nil {
+		return nil, err
 	}
-	watchCtx, cancelWatch := context.WithCancel(context.TODO())
-	ssr.cancelWatch = cancelWatch
-	ssr.etcdWatchClient = &ssrEtcdWatchClient
-	ssr.watchCh = ssrEtcdWatchClient.Watch(watchCtx, "", clientv3.WithPrefix(), clientv3.WithRev(ssr.PrevSnapshot.LastRevision+1))
-	ssr.logger.Infof("Applied watch on etcd from revision: %d", ssr.PrevSnapshot.LastRevision+1)
 
 	return ssr.PrevSnapshot, nil
 }
 
+// newFullSnapshotMaintenanceClient returns the maintenance client with which the full snapshot is taken.
+// With the Local policy it is built from the configured etcd endpoints. Otherwise it is built from the endpoint of the
+// member chosen by the full snapshot source policy, which is returned along with the client. If no member can be chosen,
+// the configured etcd endpoints are used.
+func (ssr *Snapshotter) newFullSnapshotMaintenanceClient(clientFactory etcdClient.Factory) (etcdClient.MaintenanceCloser, *brtypes.SnapshotSourceMember, error) {
+	if ssr.config.FullSnapshotSourcePolicy == "" || ssr.config.FullSnapshotSourcePolicy == brtypes.FullSnapshotSourceLocal {
+		clientMaintenance, err := clientFactory.NewMaintenance()
+		return clientMaintenance, nil, err
+	}
+
+	source, err := ssr.selectFullSnapshotSourceMember(clientFactory)
+	if err != nil {
+		ssr.logger.Warnf("Failed to choose the etcd member to take the full snapshot from, taking it from the configured endpoints: %v", err)
+		clientMaintenance, err := clientFactory.NewMaintenance()
+		return clientMaintenance, nil, err
+	}
+	ssr.logger.Infof("Taking the full snapshot from etcd member %s at %s (leader: %t).", source.Name, source.Endpoint, source.IsLeader)
+
+	connectionConfig := *ssr.etcdConnectionConfig
+	connectionConfig.Endpoints = []string{source.Endpoint}
+	clientMaintenance, err := etcdutil.NewFactory(connectionConfig).NewMaintenance()
+	return clientMaintenance, source, err
+}
+
+func (ssr *Snapshotter) selectFullSnapshotSourceMember(clientFactory etcdClient.Factory) (*brtypes.SnapshotSourceMember, error) {
+	clientCluster, err := clientFactory.NewCluster()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build etcd cluster client: %v", err)
+	}
+	defer clientCluster.Close()
+
+	clientMaintenance, err := clientFactory.NewMaintenance()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build etcd maintenance client: %v", err)
+	}
+	defer clientMaintenance.Close()
+
+	return miscellaneous.SelectFullSnapshotSourceMember(context.TODO(), clientCluster, clientMaintenance, ssr.config.FullSnapshotSourcePolicy, ssr.config.FullSnapshotSourceMember, ssr.config.FullSnapshotSourceMaxRaftLag, ssr.etcdConnectionConfig.ConnectionTimeout.Duration, ssr.logger)
+}
+
 func (ssr *Snapshotter) cleanupInMemoryEvents() {
 	ssr.events = []byte{}
 	ssr.lastEventRevision = -1
 }
 
 func (ssr *Snapshotter) takeDeltaSnapshotAndResetTimer() (*brtypes.Snapshot, error) {
-	s, err := ssr.TakeDeltaSnapshot()
+	var (
+		s    *brtypes.Snapshot
+		err  error
+		size = len(ssr.events)
+	)
+	if ssr.deltaUploader != nil {
+		s, err = ssr.enqueueDeltaSnapshot()
+	} else {
+		s, err = ssr.TakeDeltaSnapshot()
+	}
 	if err != nil {
 		// As per design principle, in business critical service if backup is not working,
 		// it's better to fail the process. So, we are quiting here.
@@ -419,23 +561,75 @@ func (ssr *Snapshotter) takeDeltaSnapshotAndResetTimer() (*brtypes.Snapshot, err
 		return nil, err
 	}
 
+	ssr.observeDeltaSnapshotCycle(size)
+	ssr.resetDeltaSnapshotTimer()
+	return s, nil
+}
+
+func (ssr *Snapshotter) resetDeltaSnapshotTimer() {
+	period := ssr.deltaSnapshotPeriod()
 	if ssr.deltaSnapshotTimer == nil {
-		ssr.deltaSnapshotTimer = time.NewTimer(ssr.config.DeltaSnapshotPeriod.Duration)
+		ssr.deltaSnapshotTimer = time.NewTimer(period)
 	} else {
 		ssr.logger.Infof("Stopping delta snapshot...")
 		ssr.deltaSnapshotTimer.Stop()
-		ssr.logger.Infof("Resetting delta snapshot to run after %s.", ssr.config.DeltaSnapshotPeriod.Duration.String())
-		ssr.deltaSnapshotTimer.Reset(ssr.config.DeltaSnapshotPeriod.Duration)
+		ssr.logger.Infof("Resetting delta snapshot to run after %s.", period.String())
+		ssr.deltaSnapshotTimer.Reset(period)
 	}
-	return s, nil
+	ssr.deltaSnapshotCycleStart = time.Now()
+	ssr.deltaSnapshotDue = ssr.deltaSnapshotCycleStart.Add(period)
+	metrics.DeltaSnapshotEffectivePeriodSeconds.With(prometheus.Labels{}).Set(period.Seconds())
 }
 
 // TakeDeltaSnapshot takes a delta snapshot that contains
 // the etcd events collected up till now
 func (ssr *Snapshotter) TakeDeltaSnapshot() (*brtypes.Snapshot, error) {
-	defer ssr.cleanupInMemoryEvents()
+	s, err := ssr.takeDeltaSnapshot()
+	if err != nil {
+		events.Emit(events.TypeDeltaSnapshotFailed, "", events.SnapshotData{Error: err.Error()})
+	}
+	return s, err
+}
+
+func (ssr *Snapshotter) takeDeltaSnapshot() (*brtypes.Snapshot, error) {
 	ssr.logger.Infof("Taking delta snapshot for time: %s", time.Now().Local())
 
+	if err := ssr.runPreDeltaSnapshotHook(); err != nil {
+		return nil, err
+	}
+
+	// delta snapshots which are already sealed have to be committed first,
+	// so that this snapshot continues from the right revision.
+	if err := ssr.flushDeltaSnapshots(); err != nil {
+		return nil, err
+	}
+
+	d, err := ssr.sealDeltaSnapshot()
+	if err != nil || d == nil {
+		return nil, err
+	}
+
+	if err := ssr.uploadDeltaSnapshot(d); err != nil {
+		return nil, err
+	}
+	ssr.commitDeltaSnapshot(d.snap)
+	return d.snap, nil
+}
+
+// runPreDeltaSnapshotHook runs the pre delta snapshot hook if any events were collected. It runs before the events
+// are sealed, so that the collected events are kept if the hook aborts the delta snapshot.
+func (ssr *Snapshotter) runPreDeltaSnapshotHook() error {
+	if len(ssr.events) == 0 {
+		return nil
+	}
+	return ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePreDeltaSnapshot, hooks.Payload{})
+}
+
+// sealDeltaSnapshot closes the etcd events collected up till now into a delta snapshot
+// which is ready to be uploaded. It returns nil if no events were collected.
+func (ssr *Snapshotter) sealDeltaSnapshot() (*sealedDeltaSnapshot, error) {
+	defer ssr.cleanupInMemoryEvents()
+
 	if len(ssr.events) == 0 {
 		ssr.logger.Infof("No events received to save snapshot. Skipping delta snapshot.")
 		metrics.SnapshotRequired.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta}).Set(0)
@@ -464,17 +658,27 @@ func (ssr *Snapshotter) TakeDeltaSnapshot() (*brtypes.Snapshot, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get compressionSuffix: %v", err)
 	}
-	snap := snapstore.NewSnapshot(brtypes.SnapshotKindDelta, ssr.PrevSnapshot.LastRevision+1, ssr.lastEventRevision, compressionSuffix, false)
+	snap := snapstore.NewSnapshot(brtypes.SnapshotKindDelta, ssr.lastSealedRevision()+1, ssr.lastEventRevision, compressionSuffix, false)
 
 	// compute hash
 	hash := sha256.New()
 	if _, err := hash.Write(ssr.events); err != nil {
 		return nil, fmt.Errorf("failed to compute hash of events: %v", err)
 	}
-	ssr.events = hash.Sum(ssr.events)
 
+	return &sealedDeltaSnapshot{
+		snap:  snap,
+		data:  hash.Sum(ssr.events),
+		store: ssr.store,
+	}, nil
+}
+
+// uploadDeltaSnapshot compresses the sealed delta snapshot if required and saves it to the snapstore.
+// It doesn't modify the state of the snapshotter, so it can be called concurrently for different snapshots.
+func (ssr *Snapshotter) uploadDeltaSnapshot(d *sealedDeltaSnapshot) error {
+	var err error
 	startTime := time.Now()
-	rc := io.NopCloser(bytes.NewReader(ssr.events))
+	rc := io.NopCloser(bytes.NewReader(d.data))
 
 	// if compression is enabled
 	//    then compress the snapshot.
@@ -482,20 +686,38 @@ func (ssr *Snapshotter) TakeDeltaSnapshot() (*brtypes.Snapshot, error) {
 		ssr.logger.Info("start the Compression of delta snapshot")
 		rc, err = compressor.CompressSnapshot(rc, ssr.compressionConfig.CompressionPolicy)
 		if err != nil {
-			return nil, fmt.Errorf("unable to compress delta snapshot: %v", err)
+			return fmt.Errorf("unable to compress delta snapshot: %v", err)
 		}
 	}
 	defer rc.Close()
 
-	if err := ssr.store.Save(*snap, rc); err != nil {
+	// the metadata is saved first, so that a partial delta snapshot is never listed without it.
+	if ssr.keyFilter != nil {
+		if err := snapstore.SaveSnapshotMetadata(d.store, *d.snap, &brtypes.SnapshotMetadata{KeyFilter: ssr.keyFilter}); err != nil {
+			ssr.logger.Errorf("Error saving delta snapshot metadata. %v", err)
+			return err
+		}
+		d.snap.HasMetadata = true
+	}
+
+	if err := d.store.Save(*d.snap, rc); err != nil {
 		timeTaken := time.Since(startTime).Seconds()
 		metrics.SnapshotDurationSeconds.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta, metrics.LabelSucceeded: metrics.ValueSucceededFalse}).Observe(timeTaken)
 		ssr.logger.Errorf("Error saving delta snapshots. %v", err)
-		return nil, err
+		return err
 	}
-	timeTaken := time.Since(startTime).Seconds()
-	metrics.SnapshotDurationSeconds.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Observe(timeTaken)
-	logrus.Infof("Total time to save delta snapshot: %f seconds.", timeTaken)
+	timeTaken := time.Since(startTime)
+	metrics.SnapshotDurationSeconds.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta, metrics.LabelSucceeded: metrics.ValueSucceededTrue}).Observe(timeTaken.Seconds())
+	ssr.logger.Infof("Total time to save delta snapshot: %f seconds.", timeTaken.Seconds())
+	if ssr.deltaSnapshotTuner != nil {
+		ssr.deltaSnapshotTuner.observeUpload(len(d.data), timeTaken)
+	}
+	return nil
+}
+
+// commitDeltaSnapshot records the uploaded delta snapshot as the latest snapshot of the snapshotter.
+// The delta snapshot can't be undone anymore, so a failed post delta snapshot hook is only logged.
+func (ssr *Snapshotter) commitDeltaSnapshot(snap *brtypes.Snapshot) {
 	ssr.PrevSnapshot = snap
 	ssr.PrevDeltaSnapshots = append(ssr.PrevDeltaSnapshots, snap)
 
@@ -504,9 +726,23 @@ func (ssr *Snapshotter) TakeDeltaSnapshot() (*brtypes.Snapshot, error) {
 	metrics.SnapshotRequired.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta}).Set(0)
 	metrics.SnapstoreLatestDeltasTotal.With(prometheus.Labels{}).Inc()
 	metrics.SnapstoreLatestDeltasRevisionsTotal.With(prometheus.Labels{}).Add(float64(snap.LastRevision - snap.StartRevision))
+	ssr.updateDeltaSnapshotUploadLag()
 
 	ssr.logger.Infof("Successfully saved delta snapshot at: %s", path.Join(snap.SnapDir, snap.SnapName))
-	return snap, nil
+	events.Emit(events.TypeDeltaSnapshotSucceeded, path.Join(snap.SnapDir, snap.SnapName), events.SnapshotData{Snapshot: snap})
+	if err := ssr.hookRunner.Run(context.TODO(), brtypes.HookStagePostDeltaSnapshot, hooks.Payload{Snapshot: snap}); err != nil {
+		ssr.logger.Errorf("Post delta snapshot hook failed for snapshot %s: %v", path.Join(snap.SnapDir, snap.SnapName), err)
+	}
+}
+
+// updateDeltaSnapshotUploadLag exposes the number of revisions observed on the watch
+// which are not yet persisted in an uploaded snapshot.
+func (ssr *Snapshotter) updateDeltaSnapshotUploadLag() {
+	lag := ssr.latestWatchRevision - ssr.PrevSnapshot.LastRevision
+	if lag < 0 {
+		lag = 0
+	}
+	metrics.DeltaSnapshotUploadLagRevisions.With(prometheus.Labels{}).Set(float64(lag))
 }
 
 // CollectEventsSincePrevSnapshot takes the first delta snapshot on etcd startup.
@@ -542,18 +778,9 @@ func (ssr *Snapshotter) CollectEventsSincePrevSnapshot(stopCh <-chan struct{}) (
 		metrics.SnapshotRequired.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull}).Set(1)
 	}
 
-	ssrEtcdWatchClient, err := clientFactory.NewWatcher()
-	if err != nil {
-		return false, &errors.EtcdError{
-			Message: fmt.Sprintf("failed to create etcd watch client for snapshotter: %v", err),
-		}
+	if err := ssr.applyWatch(clientFactory, ssr.PrevSnapshot.LastRevision+1); err != nil {
+		return false, err
 	}
-	// TODO: Use parent context. Passing parent context here directly requires some additional management of error handling.
-	watchCtx, cancelWatch := context.WithCancel(context.TODO())
-	ssr.cancelWatch = cancelWatch
-	ssr.etcdWatchClient = &ssrEtcdWatchClient
-	ssr.watchCh = ssrEtcdWatchClient.Watch(watchCtx, "", clientv3.WithPrefix(), clientv3.WithRev(ssr.PrevSnapshot.LastRevision+1))
-	ssr.logger.Infof("Applied watch on etcd from revision: %d", ssr.PrevSnapshot.LastRevision+1)
 
 	if ssr.PrevSnapshot.LastRevision == lastEtcdRevision {
 		ssr.logger.Infof("No new events since last snapshot. Skipping initial delta snapshot.")
@@ -572,11 +799,22 @@ func (ssr *Snapshotter) CollectEventsSincePrevSnapshot(stopCh <-chan struct{}) (
 			if !ok {
 				return false, fmt.Errorf("watch channel closed")
 			}
+			ssr.markWatchResponse()
+			if wr.CompactRevision != 0 {
+				ssr.recordWatchCompaction(wr.CompactRevision)
+				ssr.cleanupInMemoryEvents()
+				return false, fmt.Errorf("failed to collect events since previous snapshot: %w", wr.Err())
+			}
 			if err := ssr.handleDeltaWatchEvents(wr); err != nil {
 				return false, err
 			}
 
-			lastWatchRevision := wr.Events[len(wr.Events)-1].Kv.ModRevision
+			// progress notifications don't carry any events, but confirm that
+			// the watch has observed all revisions till the header revision.
+			lastWatchRevision := wr.Header.Revision
+			if len(wr.Events) > 0 {
+				lastWatchRevision = wr.Events[len(wr.Events)-1].Kv.ModRevision
+			}
 			if lastWatchRevision >= lastEtcdRevision {
 				return false, nil
 			}
@@ -591,8 +829,14 @@ func (ssr *Snapshotter) handleDeltaWatchEvents(wr clientv3.WatchResponse) error
 	if err := wr.Err(); err != nil {
 		return err
 	}
+	// the watch works again, so later closures of its channel are not consecutive anymore.
+	ssr.watchRestarts = 0
+	firstEvents := len(ssr.events) == 0
 	// aggregate events
 	for _, ev := range wr.Events {
+		if !ssr.keyFilter.Matches(ev.Kv.Key) {
+			continue
+		}
 		timedEvent := newEvent(ev)
 		jsonByte, err := json.Marshal(timedEvent)
 		if err != nil {
@@ -605,11 +849,16 @@ func (ssr *Snapshotter) handleDeltaWatchEvents(wr clientv3.WatchResponse) error
 		}
 		ssr.events = append(ssr.events, jsonByte...)
 		ssr.lastEventRevision = ev.Kv.ModRevision
+		ssr.latestWatchRevision = ev.Kv.ModRevision
 		metrics.SnapshotRequired.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull}).Set(1)
 		metrics.SnapshotRequired.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindDelta}).Set(1)
 	}
+	ssr.updateDeltaSnapshotUploadLag()
 	ssr.logger.Debugf("Added events till revision: %d", ssr.lastEventRevision)
-	if len(ssr.events) >= int(ssr.config.DeltaSnapshotMemoryLimit) {
+	if firstEvents && len(ssr.events) != 0 {
+		ssr.shortenDeltaSnapshotTimer()
+	}
+	if len(ssr.events) >= int(ssr.deltaSnapshotMemoryLimit()) {
 		ssr.logger.Infof("Delta events memory crossed the memory limit: %d Bytes", len(ssr.events))
 		_, err := ssr.takeDeltaSnapshotAndResetTimer()
 		return err
@@ -646,7 +895,12 @@ func (ssr *Snapshotter) snapshotEventHandler(stopCh <-chan struct{}) error {
 			}
 
 		case <-ssr.deltaSnapshotReqCh:
-			s, err := ssr.takeDeltaSnapshotAndResetTimer()
+			// out of schedule delta snapshots are uploaded synchronously, so that
+			// the caller gets to know the result of the upload.
+			s, err := ssr.TakeDeltaSnapshot()
+			if err == nil {
+				ssr.resetDeltaSnapshotTimer()
+			}
 			res := result{
 				Snapshot: s,
 				Err:      err,
@@ -656,11 +910,7 @@ func (ssr *Snapshotter) snapshotEventHandler(stopCh <-chan struct{}) error {
 				return err
 			}
 			if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
-				ctx, cancel := context.WithTimeout(leaseUpdateCtx, brtypes.LeaseUpdateTimeoutDuration)
-				if err = heartbeat.DeltaSnapshotCaseLeaseUpdate(ctx, ssr.logger, ssr.K8sClientset, ssr.HealthConfig.DeltaSnapshotLeaseName, ssr.store); err != nil {
-					ssr.logger.Warnf("Snapshot lease update failed : %v", err)
-				}
-				cancel()
+				ssr.updateDeltaSnapshotLease(leaseUpdateCtx)
 			}
 
 		case <-ssr.fullSnapshotTimer.C:
@@ -674,35 +924,65 @@ func (ssr *Snapshotter) snapshotEventHandler(stopCh <-chan struct{}) error {
 
 		case <-ssr.deltaSnapshotTimer.C:
 			if ssr.config.DeltaSnapshotPeriod.Duration >= time.Second {
+				snapshots := len(ssr.PrevDeltaSnapshots)
 				if _, err := ssr.takeDeltaSnapshotAndResetTimer(); err != nil {
 					return err
 				}
-				if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
-					ctx, cancel := context.WithTimeout(leaseUpdateCtx, brtypes.LeaseUpdateTimeoutDuration)
-					if err := heartbeat.DeltaSnapshotCaseLeaseUpdate(ctx, ssr.logger, ssr.K8sClientset, ssr.HealthConfig.DeltaSnapshotLeaseName, ssr.store); err != nil {
-						ssr.logger.Warnf("Snapshot lease update failed : %v", err)
-					}
-					cancel()
+				//Call UpdateDeltaSnapshotLease only if new delta snapshot was uploaded
+				if ssr.HealthConfig.SnapshotLeaseRenewalEnabled && snapshots < len(ssr.PrevDeltaSnapshots) {
+					ssr.updateDeltaSnapshotLease(leaseUpdateCtx)
 				}
 			}
 
+		case res := <-ssr.deltaUploader.results():
+			committed, err := ssr.handleDeltaUploadResult(res)
+			if err != nil {
+				return err
+			}
+			if ssr.HealthConfig.SnapshotLeaseRenewalEnabled && committed > 0 {
+				ssr.updateDeltaSnapshotLease(leaseUpdateCtx)
+			}
+
+		case <-ssr.watchProgressTimerC():
+			if err := ssr.checkWatchProgress(); err != nil {
+				return err
+			}
+
+		case <-ssr.watchRestartTimerC():
+			ssr.watchRestartTimer = nil
+			if err := ssr.restartWatch(); err != nil {
+				return err
+			}
+
 		case wr, ok := <-ssr.watchCh:
 			if !ok {
-				return fmt.Errorf("watch channel closed")
+				metrics.WatchRecoveriesTotal.With(prometheus.Labels{metrics.LabelReason: metrics.ValueWatchClosed}).Inc()
+				if err := ssr.handleWatchClosed(); err != nil {
+					return err
+				}
+				continue
+			}
+			ssr.markWatchResponse()
+			if wr.CompactRevision != 0 {
+				// the events till the compacted revision can't be captured in delta snapshots anymore,
+				// so a full snapshot is taken instead, which also re-applies the watch.
+				ssr.recordWatchCompaction(wr.CompactRevision)
+				if _, err := ssr.TakeFullSnapshotAndResetTimer(false); err != nil {
+					return err
+				}
+				if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
+					ssr.FullSnapshotLeaseUpdateTimer.Stop()
+					ssr.FullSnapshotLeaseUpdateTimer.Reset(time.Nanosecond)
+				}
+				continue
 			}
 			snapshots := len(ssr.PrevDeltaSnapshots)
 			if err := ssr.handleDeltaWatchEvents(wr); err != nil {
 				return err
 			}
-			if ssr.HealthConfig.SnapshotLeaseRenewalEnabled {
-				//Call UpdateDeltaSnapshotLease only if new delta snapshot taken
-				if snapshots < len(ssr.PrevDeltaSnapshots) {
-					ctx, cancel := context.WithTimeout(leaseUpdateCtx, brtypes.LeaseUpdateTimeoutDuration)
-					if err := heartbeat.DeltaSnapshotCaseLeaseUpdate(ctx, ssr.logger, ssr.K8sClientset, ssr.HealthConfig.DeltaSnapshotLeaseName, ssr.store); err != nil {
-						ssr.logger.Warnf("Snapshot lease update failed : %v", err)
-					}
-					cancel()
-				}
+			//Call UpdateDeltaSnapshotLease only if new delta snapshot taken
+			if ssr.HealthConfig.SnapshotLeaseRenewalEnabled && snapshots < len(ssr.PrevDeltaSnapshots) {
+				ssr.updateDeltaSnapshotLease(leaseUpdateCtx)
 			}
 
 		case <-stopCh:
@@ -713,6 +993,14 @@ func (ssr *Snapshotter) snapshotEventHandler(stopCh <-chan struct{}) error {
 	}
 }
 
+func (ssr *Snapshotter) updateDeltaSnapshotLease(leaseUpdateCtx context.Context) {
+	ctx, cancel := context.WithTimeout(leaseUpdateCtx, brtypes.LeaseUpdateTimeoutDuration)
+	defer cancel()
+	if err := heartbeat.DeltaSnapshotCaseLeaseUpdate(ctx, ssr.logger, ssr.K8sClientset, ssr.HealthConfig.DeltaSnapshotLeaseName, ssr.store); err != nil {
+		ssr.logger.Warnf("Snapshot lease update failed : %v", err)
+	}
+}
+
 func (ssr *Snapshotter) resetFullSnapshotTimer() error {
 	now := time.Now()
 	effective := ssr.schedule.Next(now)
@@ -734,6 +1022,15 @@ func (ssr *Snapshotter) resetFullSnapshotTimer() error {
 	return nil
 }
 
+// tempDir returns the directory for temporary files of the snapshotter, which is the
+// snapstore temp directory or the default directory for temporary files if none is configured.
+func (ssr *Snapshotter) tempDir() string {
+	if ssr.snapstoreConfig == nil {
+		return ""
+	}
+	return ssr.snapstoreConfig.TempDir
+}
+
 // hasSnapStoreSecretUpdated checks if the snapstore secret has been updated
 func (ssr *Snapshotter) hasSnapStoreSecretUpdated() (bool, error) {
 	ssr.logger.Debug("checking the timestamp of snapstore secret...")
@@ -765,11 +1062,11 @@ func (ssr *Snapshotter) IsFullSnapshotRequiredAtStartup(timeWindow float64) bool
 }
 
 // WasScheduledFullSnapshotMissed determines whether the preceding full-snapshot was missed or not.
+// The preceding full-snapshot is the latest one any of the full snapshot schedules was due for within the given time window.
 func (ssr *Snapshotter) WasScheduledFullSnapshotMissed(timeWindow float64) bool {
-	now := time.Now()
-	nextSnapSchedule := ssr.schedule.Next(now)
+	prevSnapSchedule := ssr.schedule.Prev(time.Now(), time.Duration(timeWindow*float64(time.Hour)))
 
-	if miscellaneous.GetPrevScheduledSnapTime(nextSnapSchedule, timeWindow) == ssr.PrevFullSnapshot.CreatedOn {
+	if !prevSnapSchedule.IsZero() && !ssr.PrevFullSnapshot.CreatedOn.Before(prevSnapSchedule) {
 		ssr.logger.Info("previous full snapshot was taken at scheduled time, skipping the full snapshot at startup")
 		return false
 	}
@@ -787,8 +1084,11 @@ func (ssr *Snapshotter) IsNextFullSnapshotBeyondTimeWindow(timeWindow float64) b
 
 // GetFullSnapshotMaxTimeWindow returns the maximum time period in hours for which backup-restore must take atleast one full snapshot.
 func (ssr *Snapshotter) GetFullSnapshotMaxTimeWindow(fullSnapScheduleSpec string) float64 {
-	// Split on whitespace.
+	// Split on whitespace, ignoring the time zone of the schedule.
 	schedule := strings.Fields(fullSnapScheduleSpec)
+	if len(schedule) > 0 && (strings.HasPrefix(schedule[0], "TZ=") || strings.HasPrefix(schedule[0], "CRON_TZ=")) {
+		schedule = schedule[1:]
+	}
 	if len(schedule) < 5 {
 		return defaultFullSnapMaxTimeWindow
 	}
@@ -805,3 +1105,14 @@ func (ssr *Snapshotter) GetFullSnapshotMaxTimeWindow(fullSnapScheduleSpec string
 
 	return defaultFullSnapMaxTimeWindow
 }
+
+// GetFullSnapshotSchedulesMaxTimeWindow returns the maximum time period in hours for which backup-restore must take atleast
+// one full snapshot with the configured full snapshot schedules. As a full snapshot is taken whenever any of the schedules
+// is due, this is the largest gap between consecutive activations of the combined schedules, outside of their blackout windows.
+// Without multiple schedules, it is the time window of the single full snapshot schedule.
+func (ssr *Snapshotter) GetFullSnapshotSchedulesMaxTimeWindow() float64 {
+	if len(ssr.config.FullSnapshotSchedules) == 0 {
+		return ssr.GetFullSnapshotMaxTimeWindow(ssr.config.FullSnapshotSchedule)
+	}
+	return ssr.schedule.MaxGap(time.Now()).Hours()
+}
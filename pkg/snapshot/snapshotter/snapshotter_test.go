@@ -6,8 +6,12 @@ package snapshotter_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strconv"
@@ -17,6 +21,8 @@ import (
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/compressor"
+	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
 	. "github.com/gardener/etcd-backup-restore/pkg/snapshot/snapshotter"
 	"github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
@@ -27,6 +33,9 @@ import (
 	"github.com/gardener/etcd-backup-restore/test/utils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.etcd.io/etcd/clientv3"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -326,6 +335,330 @@ var _ = Describe("Snapshotter", func() {
 							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
 						})
 					})
+
+					Context("with full snapshot taken while etcd is being populated", func() {
+						It("should name the full snapshot with the revision of its content", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_9.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:     fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:      wrappers.Duration{Duration: deltaSnapshotInterval},
+								DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:  wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:               maxBackups,
+							}
+
+							populatorCtx, cancelPopulator := context.WithTimeout(testCtx, 5*time.Second)
+							defer cancelPopulator()
+							wg := &sync.WaitGroup{}
+							wg.Add(1)
+							go utils.PopulateEtcdWithWaitGroup(populatorCtx, wg, logger, etcdConnectionConfig.Endpoints, nil)
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ssrCtx := utils.ContextWithWaitGroup(testCtx, wg)
+							Expect(ssr.Run(ssrCtx.Done(), true)).ShouldNot(HaveOccurred())
+
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+
+							rc, err := store.Fetch(*list[0])
+							Expect(err).ShouldNot(HaveOccurred())
+							isCompressed, compressionPolicy, err := compressor.IsSnapshotCompressed(list[0].CompressionSuffix)
+							Expect(err).ShouldNot(HaveOccurred())
+							if isCompressed {
+								rc, err = compressor.DecompressSnapshot(rc, compressionPolicy)
+								Expect(err).ShouldNot(HaveOccurred())
+							}
+							defer rc.Close()
+							dbPath := path.Join(outputDir, "snapshotter_9.db")
+							dbFile, err := os.Create(dbPath)
+							Expect(err).ShouldNot(HaveOccurred())
+							defer os.Remove(dbPath)
+							_, err = io.Copy(dbFile, rc)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(dbFile.Close()).ShouldNot(HaveOccurred())
+
+							dbRevision, err := etcdutil.GetDBRevision(dbPath)
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].LastRevision).Should(Equal(dbRevision))
+							if len(list) > 1 {
+								Expect(list[1].StartRevision).Should(Equal(dbRevision + 1))
+							}
+						})
+					})
+
+					Context("with key prefix filter configured", func() {
+						It("should record only the selected keys in delta snapshots along with the filter", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_10.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:     fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:      wrappers.Duration{Duration: time.Second},
+								DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:  wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:               maxBackups,
+								ExcludeKeyPrefixes:       []string{"/registry/events/"},
+							}
+
+							cli, err := clientv3.New(clientv3.Config{
+								Endpoints:   etcdConnectionConfig.Endpoints,
+								DialTimeout: etcdConnectionConfig.ConnectionTimeout.Duration,
+							})
+							Expect(err).ShouldNot(HaveOccurred())
+							defer cli.Close()
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ctx, cancel := context.WithTimeout(testCtx, 5*time.Second)
+							defer cancel()
+							go func() {
+								defer GinkgoRecover()
+								time.Sleep(time.Second)
+								for i := 0; i < 10; i++ {
+									_, err := cli.Put(ctx, fmt.Sprintf("/registry/events/key-%d", i), "value")
+									Expect(err).ShouldNot(HaveOccurred())
+									_, err = cli.Put(ctx, fmt.Sprintf("/registry/pods/key-%d", i), "value")
+									Expect(err).ShouldNot(HaveOccurred())
+								}
+							}()
+							Expect(ssr.Run(ctx.Done(), true)).ShouldNot(HaveOccurred())
+
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+							Expect(list[0].HasMetadata).Should(BeFalse())
+							Expect(len(list)).Should(BeNumerically(">", 1))
+
+							var recordedKeys []string
+							for _, snap := range list[1:] {
+								Expect(snap.Kind).Should(Equal(brtypes.SnapshotKindDelta))
+								Expect(snap.HasMetadata).Should(BeTrue())
+								metadata, err := snapstore.GetSnapshotMetadata(store, *snap)
+								Expect(err).ShouldNot(HaveOccurred())
+								Expect(metadata.IsPartial()).Should(BeTrue())
+								Expect(metadata.KeyFilter.Exclude).Should(Equal(snapshotterConfig.ExcludeKeyPrefixes))
+
+								rc, err := store.Fetch(*snap)
+								Expect(err).ShouldNot(HaveOccurred())
+								isCompressed, compressionPolicy, err := compressor.IsSnapshotCompressed(snap.CompressionSuffix)
+								Expect(err).ShouldNot(HaveOccurred())
+								if isCompressed {
+									rc, err = compressor.DecompressSnapshot(rc, compressionPolicy)
+									Expect(err).ShouldNot(HaveOccurred())
+								}
+								data, err := io.ReadAll(rc)
+								Expect(err).ShouldNot(HaveOccurred())
+								Expect(rc.Close()).ShouldNot(HaveOccurred())
+								var events []brtypes.Event
+								Expect(json.Unmarshal(data[:len(data)-sha256.Size], &events)).ShouldNot(HaveOccurred())
+								for _, ev := range events {
+									recordedKeys = append(recordedKeys, string(ev.EtcdEvent.Kv.Key))
+								}
+							}
+							Expect(recordedKeys).Should(HaveLen(10))
+							for _, key := range recordedKeys {
+								Expect(key).Should(HavePrefix("/registry/pods/"))
+							}
+						})
+					})
+
+					Context("with full snapshot source policy configured", func() {
+						// The embedded etcd advertises an unreachable client URL, so no member can be chosen.
+						It("should take the full snapshot from the configured endpoints if no member can be chosen", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_12.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:         fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:          wrappers.Duration{Duration: time.Second},
+								DeltaSnapshotMemoryLimit:     brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:      wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:      brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:                   maxBackups,
+								FullSnapshotSourcePolicy:     brtypes.FullSnapshotSourceFollower,
+								FullSnapshotSourceMaxRaftLag: brtypes.DefaultFullSnapshotSourceMaxRaftLag,
+							}
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ctx, cancel := context.WithTimeout(testCtx, 2*time.Second)
+							defer cancel()
+							Expect(ssr.Run(ctx.Done(), true)).ShouldNot(HaveOccurred())
+
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+							Expect(list[0].HasMetadata).Should(BeFalse())
+						})
+					})
+
+					Context("with adaptive delta snapshot period configured", func() {
+						It("should lengthen the delta snapshot period without events and shorten it when events arrive", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_11.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:                fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:                 wrappers.Duration{Duration: time.Second},
+								DeltaSnapshotMemoryLimit:            brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:             wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:             brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:                          maxBackups,
+								AdaptiveDeltaSnapshotPeriod:         true,
+								MinDeltaSnapshotPeriod:              wrappers.Duration{Duration: time.Second},
+								MaxDeltaSnapshotPeriod:              wrappers.Duration{Duration: 8 * time.Second},
+								MinDeltaSnapshotMemoryLimit:         brtypes.DefaultMinDeltaSnapMemoryLimit,
+								MaxDeltaSnapshotMemoryLimit:         brtypes.DefaultMaxDeltaSnapMemoryLimit,
+								DeltaSnapshotRecoveryPointObjective: wrappers.Duration{Duration: 2 * time.Second},
+							}
+							effectivePeriod := func() float64 {
+								m := &dto.Metric{}
+								Expect(metrics.DeltaSnapshotEffectivePeriodSeconds.With(prometheus.Labels{}).Write(m)).To(Succeed())
+								return m.GetGauge().GetValue()
+							}
+
+							cli, err := clientv3.New(clientv3.Config{
+								Endpoints:   etcdConnectionConfig.Endpoints,
+								DialTimeout: etcdConnectionConfig.ConnectionTimeout.Duration,
+							})
+							Expect(err).ShouldNot(HaveOccurred())
+							defer cli.Close()
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ctx, cancel := context.WithTimeout(testCtx, 9*time.Second)
+							defer cancel()
+							quietPeriodCh := make(chan float64, 1)
+							go func() {
+								defer GinkgoRecover()
+								// without events, the period is doubled after each delta snapshot cycle.
+								time.Sleep(4 * time.Second)
+								quietPeriodCh <- effectivePeriod()
+								for i := 0; ctx.Err() == nil; i++ {
+									if _, err := cli.Put(ctx, fmt.Sprintf("/registry/pods/key-%d", i), "value"); err != nil {
+										return
+									}
+									time.Sleep(100 * time.Millisecond)
+								}
+							}()
+							Expect(ssr.Run(ctx.Done(), true)).ShouldNot(HaveOccurred())
+
+							Expect(<-quietPeriodCh).Should(BeNumerically(">", time.Second.Seconds()))
+							Expect(effectivePeriod()).Should(BeNumerically("<=", snapshotterConfig.DeltaSnapshotRecoveryPointObjective.Seconds()))
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+							Expect(len(list)).Should(BeNumerically(">", 1))
+							for _, snap := range list[1:] {
+								Expect(snap.Kind).Should(Equal(brtypes.SnapshotKindDelta))
+							}
+						})
+					})
+
+					Context("with events since previous snapshot compacted by etcd", func() {
+						It("should take a full snapshot instead of failing", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_8.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:     fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:      wrappers.Duration{Duration: deltaSnapshotInterval},
+								DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:  wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:               maxBackups,
+								WatchStallTimeout:        wrappers.Duration{Duration: brtypes.DefaultWatchStallTimeout},
+							}
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ctx, cancel := context.WithTimeout(testCtx, 5*time.Second)
+							defer cancel()
+							Expect(ssr.Run(ctx.Done(), true)).ShouldNot(HaveOccurred())
+
+							cli, err := clientv3.New(clientv3.Config{
+								Endpoints:   etcdConnectionConfig.Endpoints,
+								DialTimeout: etcdConnectionConfig.ConnectionTimeout.Duration,
+							})
+							Expect(err).ShouldNot(HaveOccurred())
+							defer cli.Close()
+							var lastRevision int64
+							for i := 0; i < 10; i++ {
+								resp, err := cli.Put(testCtx, fmt.Sprintf("compacted-key-%d", i), "value")
+								Expect(err).ShouldNot(HaveOccurred())
+								lastRevision = resp.Header.Revision
+							}
+							_, err = cli.Compact(testCtx, lastRevision, clientv3.WithCompactPhysical())
+							Expect(err).ShouldNot(HaveOccurred())
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ctx, cancel = context.WithTimeout(testCtx, 5*time.Second)
+							defer cancel()
+							Expect(ssr.Run(ctx.Done(), false)).ShouldNot(HaveOccurred())
+
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(len(list)).Should(Equal(2))
+							for _, snap := range list {
+								Expect(snap.Kind).Should(Equal(brtypes.SnapshotKindFull))
+							}
+							Expect(list[1].LastRevision).Should(Equal(lastRevision))
+						})
+					})
+
+					Context("with delta snapshot upload pipeline enabled", func() {
+						It("should upload a contiguous chain of delta snapshots", func() {
+							currentHour := time.Now().Hour()
+							snapstoreConfig = &brtypes.SnapstoreConfig{Container: path.Join(outputDir, "snapshotter_7.bkp")}
+							store, err = snapstore.GetSnapstore(snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							snapshotterConfig := &brtypes.SnapshotterConfig{
+								FullSnapshotSchedule:            fmt.Sprintf("59 %d * * *", (currentHour+1)%24), // This make sure that full snapshot timer doesn't trigger full snapshot.
+								DeltaSnapshotPeriod:             wrappers.Duration{Duration: 2 * time.Second},
+								DeltaSnapshotMemoryLimit:        brtypes.DefaultDeltaSnapMemoryLimit,
+								GarbageCollectionPeriod:         wrappers.Duration{Duration: garbageCollectionPeriod},
+								GarbageCollectionPolicy:         brtypes.GarbageCollectionPolicyExponential,
+								MaxBackups:                      maxBackups,
+								DeltaSnapshotUploadQueueSize:    2,
+								MaxParallelDeltaSnapshotUploads: 3,
+							}
+
+							populatorCtx, cancelPopulator := context.WithTimeout(testCtx, 20*time.Second)
+							defer cancelPopulator()
+							wg := &sync.WaitGroup{}
+							wg.Add(1)
+							// populating etcd so that snapshots will be taken
+							go utils.PopulateEtcdWithWaitGroup(populatorCtx, wg, logger, etcdConnectionConfig.Endpoints, nil)
+
+							ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+							Expect(err).ShouldNot(HaveOccurred())
+							ssrCtx := utils.ContextWithWaitGroup(testCtx, wg)
+							err = ssr.Run(ssrCtx.Done(), true)
+							Expect(err).ShouldNot(HaveOccurred())
+
+							list, err := store.List()
+							Expect(err).ShouldNot(HaveOccurred())
+							Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+							Expect(len(list)).Should(BeNumerically(">", 2))
+							for i := 1; i < len(list); i++ {
+								Expect(list[i].Kind).Should(Equal(brtypes.SnapshotKindDelta))
+								Expect(list[i].StartRevision).Should(Equal(list[i-1].LastRevision + 1))
+							}
+							Expect(ssr.PrevSnapshot.LastRevision).Should(Equal(list[len(list)-1].LastRevision))
+						})
+					})
 				})
 			})
 		})
@@ -422,6 +755,147 @@ var _ = Describe("Snapshotter", func() {
 				}
 			})
 
+			It("should garbage collect with the GFS policy", func() {
+				now := time.Now().UTC()
+				store, snapstoreConfig := prepareStoreForGarbageCollection(now, "garbagecollector_gfs.bkp", "v2")
+				snapshotterConfig := &brtypes.SnapshotterConfig{
+					FullSnapshotSchedule:     schedule,
+					DeltaSnapshotPeriod:      wrappers.Duration{Duration: 10 * time.Second},
+					DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
+					GarbageCollectionPeriod:  wrappers.Duration{Duration: garbageCollectionPeriod},
+					GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicyGFS,
+					GFSRetention:             brtypes.GFSRetentionConfig{KeepLast: 1, Daily: 10},
+				}
+
+				ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				gcCtx, cancel := context.WithTimeout(testCtx, testTimeout)
+				defer cancel()
+				ssr.RunGarbageCollector(gcCtx.Done())
+
+				list, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				// the latest full snapshot of each of the last 10 days is retained, along with the delta snapshots of the latest one.
+				incr := false
+				fullSnapCount := 0
+				days := make(map[string]bool)
+				for _, snap := range list {
+					if snap.Kind == brtypes.SnapshotKindDelta {
+						incr = true
+						continue
+					}
+					Expect(incr).Should(BeFalse())
+					fullSnapCount++
+					days[snap.CreatedOn.UTC().Format(time.DateOnly)] = true
+				}
+				Expect(days).Should(HaveLen(10))
+				Expect(fullSnapCount).Should(Equal(10))
+			})
+
+			It("should garbage collect full snapshots older than the full snapshot retention period with the AgeBased policy", func() {
+				now := time.Now().UTC()
+				store, snapstoreConfig := prepareStoreForGarbageCollection(now, "garbagecollector_age_based.bkp", "v2")
+				snapshotterConfig := &brtypes.SnapshotterConfig{
+					FullSnapshotSchedule:        schedule,
+					DeltaSnapshotPeriod:         wrappers.Duration{Duration: 10 * time.Second},
+					DeltaSnapshotMemoryLimit:    brtypes.DefaultDeltaSnapMemoryLimit,
+					GarbageCollectionPeriod:     wrappers.Duration{Duration: garbageCollectionPeriod},
+					GarbageCollectionPolicy:     brtypes.GarbageCollectionPolicyAgeBased,
+					FullSnapshotRetentionPeriod: wrappers.Duration{Duration: 10 * 24 * time.Hour},
+				}
+
+				ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				gcCtx, cancel := context.WithTimeout(testCtx, testTimeout)
+				defer cancel()
+				ssr.RunGarbageCollector(gcCtx.Done())
+
+				list, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(list).ShouldNot(BeEmpty())
+				Expect(list[0].Kind).Should(Equal(brtypes.SnapshotKindFull))
+				Expect(list[0].CreatedOn).Should(BeTemporally(">=", now.Add(-10*24*time.Hour-time.Minute)))
+				Expect(list[0].CreatedOn).Should(BeTemporally("<", now.Add(-10*24*time.Hour+30*time.Minute)))
+			})
+
+			It("should garbage collect the oldest full snapshots beyond the max backup size with the SizeBased policy", func() {
+				now := time.Now().UTC()
+				store, snapstoreConfig := prepareStoreForGarbageCollection(now, "garbagecollector_size_based.bkp", "v2")
+				list, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				snapSize := list[0].Size
+				Expect(snapSize).Should(BeNumerically(">", 0))
+
+				snapshotterConfig := &brtypes.SnapshotterConfig{
+					FullSnapshotSchedule:     schedule,
+					DeltaSnapshotPeriod:      wrappers.Duration{Duration: 10 * time.Second},
+					DeltaSnapshotMemoryLimit: brtypes.DefaultDeltaSnapMemoryLimit,
+					GarbageCollectionPeriod:  wrappers.Duration{Duration: garbageCollectionPeriod},
+					GarbageCollectionPolicy:  brtypes.GarbageCollectionPolicySizeBased,
+					MaxBackupSize:            uint64(10 * snapSize),
+				}
+
+				ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				deletedBytes := &dto.Metric{}
+				Expect(metrics.GCSnapshotBytes.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull}).Write(deletedBytes)).To(Succeed())
+				deletedBytesBefore := deletedBytes.GetCounter().GetValue()
+
+				gcCtx, cancel := context.WithTimeout(testCtx, testTimeout)
+				defer cancel()
+				ssr.RunGarbageCollector(gcCtx.Done())
+
+				retainedList, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				var totalSize int64
+				for _, snap := range retainedList {
+					totalSize += snap.Size
+				}
+				Expect(totalSize).Should(BeNumerically("<=", 10*snapSize))
+				// the newest full snapshots are retained.
+				Expect(retainedList[len(retainedList)-1].CreatedOn).Should(Equal(list[len(list)-1].CreatedOn))
+				Expect(len(retainedList)).Should(BeNumerically(">=", 10-1))
+
+				Expect(metrics.GCSnapshotBytes.With(prometheus.Labels{metrics.LabelKind: brtypes.SnapshotKindFull}).Write(deletedBytes)).To(Succeed())
+				Expect(deletedBytes.GetCounter().GetValue() - deletedBytesBefore).Should(BeNumerically(">", 0))
+			})
+
+			It("should garbage collect the full snapshots selected by any of the combined policies", func() {
+				now := time.Now().UTC()
+				store, snapstoreConfig := prepareStoreForGarbageCollection(now, "garbagecollector_combined.bkp", "v2")
+				snapshotterConfig := &brtypes.SnapshotterConfig{
+					FullSnapshotSchedule:        schedule,
+					DeltaSnapshotPeriod:         wrappers.Duration{Duration: 10 * time.Second},
+					DeltaSnapshotMemoryLimit:    brtypes.DefaultDeltaSnapMemoryLimit,
+					GarbageCollectionPeriod:     wrappers.Duration{Duration: garbageCollectionPeriod},
+					GarbageCollectionPolicy:     brtypes.GarbageCollectionPolicyLimitBased + "," + brtypes.GarbageCollectionPolicyAgeBased,
+					MaxBackups:                  100,
+					FullSnapshotRetentionPeriod: wrappers.Duration{Duration: 2 * time.Hour},
+				}
+
+				ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				gcCtx, cancel := context.WithTimeout(testCtx, testTimeout)
+				defer cancel()
+				ssr.RunGarbageCollector(gcCtx.Done())
+
+				list, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				fullSnapCount := 0
+				for _, snap := range list {
+					if snap.Kind == brtypes.SnapshotKindFull {
+						fullSnapCount++
+						Expect(snap.CreatedOn).Should(BeTemporally(">=", now.Add(-2*time.Hour-time.Minute)))
+					}
+				}
+				Expect(fullSnapCount).Should(BeNumerically("<=", 5))
+			})
+
 			Describe("###GarbageCollectDeltaSnapshots", func() {
 				const (
 					deltaSnapshotCount = 6
@@ -528,6 +1002,79 @@ var _ = Describe("Snapshotter", func() {
 						Expect(len(list)).Should(Equal(3))
 					})
 				})
+
+				Context("with snapshot delete hooks configured", func() {
+					var (
+						server   *httptest.Server
+						mutex    sync.Mutex
+						status   int
+						payloads []map[string]interface{}
+					)
+
+					BeforeEach(func() {
+						status, payloads = http.StatusOK, nil
+						server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							var p map[string]interface{}
+							Expect(json.NewDecoder(r.Body).Decode(&p)).To(Succeed())
+							mutex.Lock()
+							payloads = append(payloads, p)
+							mutex.Unlock()
+							w.WriteHeader(status)
+						}))
+						snapshotterConfig.DeltaSnapshotRetentionPeriod = wrappers.Duration{Duration: 35 * time.Minute}
+						snapshotterConfig.Hooks = []brtypes.HookConfig{{
+							Name:          "delete",
+							Stages:        []brtypes.HookStage{brtypes.HookStagePreSnapshotDelete, brtypes.HookStagePostSnapshotDelete},
+							Webhook:       &brtypes.WebhookConfig{URL: server.URL},
+							FailurePolicy: brtypes.HookFailurePolicyAbort,
+						}}
+					})
+
+					AfterEach(func() {
+						server.Close()
+					})
+
+					It("should run the hooks around the deletion of each snapshot", func() {
+						store := prepareStoreWithDeltaSnapshots(testDir, deltaSnapshotCount)
+						list, err := store.List()
+						Expect(err).ShouldNot(HaveOccurred())
+
+						ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+						Expect(err).ShouldNot(HaveOccurred())
+
+						deleted, err := ssr.GarbageCollectDeltaSnapshots(list)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(deleted).To(Equal(3))
+
+						Expect(payloads).To(HaveLen(2 * deleted))
+						for i, p := range payloads {
+							stage := brtypes.HookStagePreSnapshotDelete
+							if i%2 == 1 {
+								stage = brtypes.HookStagePostSnapshotDelete
+							}
+							Expect(p["stage"]).To(BeEquivalentTo(stage))
+							Expect(p["snapshot"]).To(HaveKeyWithValue("kind", brtypes.SnapshotKindDelta))
+						}
+					})
+
+					It("should not delete the snapshots if a pre snapshot delete hook aborts", func() {
+						status = http.StatusConflict
+						store := prepareStoreWithDeltaSnapshots(testDir, deltaSnapshotCount)
+						list, err := store.List()
+						Expect(err).ShouldNot(HaveOccurred())
+
+						ssr, err := NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+						Expect(err).ShouldNot(HaveOccurred())
+
+						deleted, err := ssr.GarbageCollectDeltaSnapshots(list)
+						Expect(err).To(HaveOccurred())
+						Expect(deleted).Should(BeZero())
+
+						list, err = store.List()
+						Expect(err).ShouldNot(HaveOccurred())
+						Expect(len(list)).Should(Equal(deltaSnapshotCount))
+					})
+				})
 			})
 			Describe("###GarbageCollectChunkSnapshots", func() {
 				const (
@@ -836,6 +1383,60 @@ var _ = Describe("Snapshotter", func() {
 					Expect(isFullSnapCanBeMissed).Should(BeTrue())
 				})
 			})
+
+			Context("Previous full snapshot was taken at the scheduled time of a schedule in another time zone", func() {
+				It("should return false", func() {
+					location, err := time.LoadLocation("Asia/Kolkata")
+					Expect(err).ShouldNot(HaveOccurred())
+					scheduledTime := time.Now().In(location).Add(-2 * time.Hour).Truncate(time.Minute)
+					snapshotterConfig := &brtypes.SnapshotterConfig{
+						FullSnapshotSchedules: []brtypes.FullSnapshotScheduleConfig{
+							{Schedule: "0 0 1 1 *"},
+							{Schedule: fmt.Sprintf("%d %d * * *", scheduledTime.Minute(), scheduledTime.Hour()), TimeZone: "Asia/Kolkata"},
+						},
+					}
+
+					ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					// Previous full snapshot was taken shortly after the scheduled time
+					ssr.PrevFullSnapshot = &brtypes.Snapshot{
+						CreatedOn: scheduledTime.Add(10 * time.Second),
+					}
+					isFullSnapMissed := ssr.IsFullSnapshotRequiredAtStartup(fullSnapshotTimeWindow)
+					Expect(isFullSnapMissed).Should(BeFalse())
+				})
+			})
+
+			Context("Previous snapshot was taken within 24hrs and next schedule full-snapshot is postponed beyond 24hrs by a blackout window", func() {
+				It("should return true", func() {
+					blackoutStart := time.Now().Add(-time.Minute)
+					snapshotterConfig := &brtypes.SnapshotterConfig{
+						FullSnapshotSchedules: []brtypes.FullSnapshotScheduleConfig{
+							{
+								Schedule: "0 * * * *",
+								BlackoutWindows: []brtypes.BlackoutWindow{
+									{
+										Start:    fmt.Sprintf("%d %d * * *", blackoutStart.Minute(), blackoutStart.Hour()),
+										Duration: wrappers.Duration{Duration: 10 * time.Hour},
+									},
+								},
+							},
+						},
+					}
+
+					ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					// Previous full snapshot was taken 18hrs(<24hrs) before startup of backup-restore, and the
+					// next hourly full snapshot is only due after the blackout window ends in about 10hrs.
+					ssr.PrevFullSnapshot = &brtypes.Snapshot{
+						CreatedOn: time.Now().Add(-18 * time.Hour),
+					}
+					isFullSnapCanBeMissed := ssr.IsFullSnapshotRequiredAtStartup(fullSnapshotTimeWindow)
+					Expect(isFullSnapCanBeMissed).Should(BeTrue())
+				})
+			})
 		})
 
 		Describe("Scenarios to get maximum time window for full snapshot", func() {
@@ -896,6 +1497,63 @@ var _ = Describe("Snapshotter", func() {
 					Expect(timeWindow).Should(Equal(float64(scheduleHour)))
 				})
 			})
+
+			Context("Multiple full snapshot schedules", func() {
+				It("should return the largest gap between the activations of the schedules", func() {
+					snapshotterConfig := &brtypes.SnapshotterConfig{
+						FullSnapshotSchedule: "0 0 * * 1",
+						FullSnapshotSchedules: []brtypes.FullSnapshotScheduleConfig{
+							{Schedule: "0 0 * * 1"},
+							{Schedule: "0 */4 * * *", TimeZone: "UTC"},
+						},
+					}
+
+					ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					timeWindow := ssr.GetFullSnapshotSchedulesMaxTimeWindow()
+					Expect(timeWindow).Should(Equal(float64(4)))
+				})
+
+				It("should return the gap over the weekend for schedules covering only the business hours", func() {
+					snapshotterConfig := &brtypes.SnapshotterConfig{
+						FullSnapshotSchedules: []brtypes.FullSnapshotScheduleConfig{
+							{Schedule: "0 9-17 * * 1-5", TimeZone: "UTC"},
+							{Schedule: "0 12 * * 1-5", TimeZone: "UTC"},
+						},
+					}
+
+					ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					// from 17:00 on friday to 09:00 on monday
+					timeWindow := ssr.GetFullSnapshotSchedulesMaxTimeWindow()
+					Expect(timeWindow).Should(Equal(float64(64)))
+				})
+			})
+
+			Context("Full snapshot schedule for every 4 hours with a blackout window of 2 hours", func() {
+				It("should return 8 hours of timeWindow", func() {
+					snapshotterConfig := &brtypes.SnapshotterConfig{
+						FullSnapshotSchedules: []brtypes.FullSnapshotScheduleConfig{
+							{
+								Schedule: "0 */4 * * *",
+								TimeZone: "UTC",
+								BlackoutWindows: []brtypes.BlackoutWindow{
+									{Start: "30 3 * * *", Duration: wrappers.Duration{Duration: 2 * time.Hour}},
+								},
+							},
+						},
+					}
+
+					ssr, err = NewSnapshotter(logger, snapshotterConfig, store, etcdConnectionConfig, compressionConfig, healthConfig, snapstoreConfig)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					// the full snapshot at 04:00 is blacked out, so the one at 00:00 is followed by the one at 08:00.
+					timeWindow := ssr.GetFullSnapshotSchedulesMaxTimeWindow()
+					Expect(timeWindow).Should(Equal(float64(8)))
+				})
+			})
 		})
 
 		Describe("Scenarios to update full snapshot lease", func() {
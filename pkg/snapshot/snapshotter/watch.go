@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshotter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	brerrors "github.com/gardener/etcd-backup-restore/pkg/errors"
+	"github.com/gardener/etcd-backup-restore/pkg/etcdutil"
+	"github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	"github.com/gardener/etcd-backup-restore/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+const (
+	// maxConsecutiveWatchRestarts is the number of consecutive closures of the etcd watch without any response
+	// in between, after which the snapshotter gives up on re-establishing the watch.
+	maxConsecutiveWatchRestarts = 5
+	// watchRestartBackoff is the delay before re-establishing a closed etcd watch, which doubles with every consecutive closure.
+	watchRestartBackoff = time.Second
+)
+
+// applyWatch applies a watch on all the keys in etcd, starting from the given revision.
+// The watch requests progress notifications, so that a stalled watch can be told apart from an idle etcd.
+func (ssr *Snapshotter) applyWatch(clientFactory client.Factory, revision int64) error {
+	ssrEtcdWatchClient, err := clientFactory.NewWatcher()
+	if err != nil {
+		return &brerrors.EtcdError{
+			Message: fmt.Sprintf("failed to create etcd watch client for snapshotter: %v", err),
+		}
+	}
+	// TODO: Use parent context. Passing parent context here directly requires some additional management of error handling.
+	watchCtx, cancelWatch := context.WithCancel(context.TODO())
+	ssr.cancelWatch = cancelWatch
+	ssr.etcdWatchClient = &ssrEtcdWatchClient
+	ssr.stopWatchRestartTimer()
+	ssr.watchCh = ssrEtcdWatchClient.Watch(watchCtx, "", clientv3.WithPrefix(), clientv3.WithRev(revision), clientv3.WithProgressNotify())
+	ssr.watchAppliedTime = time.Now()
+	ssr.logger.Infof("Applied watch on etcd from revision: %d", revision)
+	return nil
+}
+
+// restartWatch closes the current watch and re-applies it from the first revision which
+// was not yet observed, so that the events collected in memory are retained.
+func (ssr *Snapshotter) restartWatch() error {
+	revision := ssr.lastSealedRevision()
+	if ssr.lastEventRevision > revision {
+		revision = ssr.lastEventRevision
+	}
+	ssr.closeEtcdClient()
+	return ssr.applyWatch(etcdutil.NewFactory(*ssr.etcdConnectionConfig), revision+1)
+}
+
+// handleWatchClosed closes the etcd watch whose channel got closed, and schedules re-establishing it after a
+// backoff which grows with the number of consecutive closures. It returns an error once the watch got closed
+// more than maxConsecutiveWatchRestarts times without any response in between.
+func (ssr *Snapshotter) handleWatchClosed() error {
+	ssr.watchRestarts++
+	if ssr.watchRestarts > maxConsecutiveWatchRestarts {
+		return fmt.Errorf("watch channel closed %d consecutive times without any response", ssr.watchRestarts)
+	}
+	backoff := watchRestartBackoff << (ssr.watchRestarts - 1)
+	ssr.logger.Warnf("Etcd watch channel closed unexpectedly. Re-establishing the watch in %s.", backoff)
+	ssr.closeEtcdClient()
+	ssr.watchRestartTimer = time.NewTimer(backoff)
+	return nil
+}
+
+// watchRestartTimerC returns the channel of the timer for re-establishing a closed watch.
+// It returns nil, which blocks forever on receive, if no restart is pending.
+func (ssr *Snapshotter) watchRestartTimerC() <-chan time.Time {
+	if ssr.watchRestartTimer == nil {
+		return nil
+	}
+	return ssr.watchRestartTimer.C
+}
+
+// stopWatchRestartTimer cancels a pending restart of a closed watch.
+func (ssr *Snapshotter) stopWatchRestartTimer() {
+	if ssr.watchRestartTimer != nil {
+		ssr.watchRestartTimer.Stop()
+		ssr.watchRestartTimer = nil
+	}
+}
+
+// markWatchResponse records that a response was received on the watch, which means it is not stale.
+func (ssr *Snapshotter) markWatchResponse() {
+	ssr.lastWatchResponseTime.Store(time.Now().UnixNano())
+	if ssr.watchStale.Swap(false) {
+		ssr.logger.Info("Etcd watch is responsive again.")
+		metrics.WatchStale.With(prometheus.Labels{}).Set(0)
+	}
+}
+
+// IsWatchStale returns true if no response was received on the etcd watch of the snapshotter
+// within the configured watch stall timeout.
+func (ssr *Snapshotter) IsWatchStale() bool {
+	return ssr.watchStale.Load()
+}
+
+// LastWatchResponseTime returns the time at which the last response was received on the etcd watch.
+// It returns the zero time if no response was received yet.
+func (ssr *Snapshotter) LastWatchResponseTime() time.Time {
+	if t := ssr.lastWatchResponseTime.Load(); t != 0 {
+		return time.Unix(0, t)
+	}
+	return time.Time{}
+}
+
+// watchCheckInterval returns the interval at which the watch is checked for progress,
+// or 0 if stall detection is disabled.
+func (ssr *Snapshotter) watchCheckInterval() time.Duration {
+	if ssr.config.DeltaSnapshotPeriod.Duration < time.Second {
+		return 0
+	}
+	return ssr.config.WatchStallTimeout.Duration / 2
+}
+
+// resetWatchProgressTimer resets the timer for the next check of the watch progress.
+func (ssr *Snapshotter) resetWatchProgressTimer() {
+	interval := ssr.watchCheckInterval()
+	if interval <= 0 {
+		return
+	}
+	if ssr.watchProgressTimer == nil {
+		ssr.watchProgressTimer = time.NewTimer(interval)
+		return
+	}
+	ssr.watchProgressTimer.Stop()
+	ssr.watchProgressTimer.Reset(interval)
+}
+
+// watchProgressTimerC returns the channel of the watch progress timer.
+// It returns nil, which blocks forever on receive, if stall detection is disabled.
+func (ssr *Snapshotter) watchProgressTimerC() <-chan time.Time {
+	if ssr.watchProgressTimer == nil {
+		return nil
+	}
+	return ssr.watchProgressTimer.C
+}
+
+// checkWatchProgress requests a progress notification on a watch which was idle for half the
+// watch stall timeout, and re-establishes the watch if it was idle for the complete timeout.
+func (ssr *Snapshotter) checkWatchProgress() error {
+	defer ssr.resetWatchProgressTimer()
+	if ssr.watchCh == nil || ssr.etcdWatchClient == nil {
+		return nil
+	}
+
+	// a newly applied watch is not idle even if it didn't receive any response yet.
+	lastActivity := ssr.LastWatchResponseTime()
+	if ssr.watchAppliedTime.After(lastActivity) {
+		lastActivity = ssr.watchAppliedTime
+	}
+	idle := time.Since(lastActivity)
+	if idle >= ssr.config.WatchStallTimeout.Duration {
+		ssr.logger.Warnf("No response on etcd watch since %s. Re-establishing the stalled watch.", idle.Round(time.Second))
+		ssr.watchStale.Store(true)
+		metrics.WatchStale.With(prometheus.Labels{}).Set(1)
+		metrics.WatchRecoveriesTotal.With(prometheus.Labels{metrics.LabelReason: metrics.ValueWatchStalled}).Inc()
+		return ssr.restartWatch()
+	}
+
+	if idle >= ssr.watchCheckInterval() {
+		ssr.logger.Debugf("No response on etcd watch since %s. Requesting progress notification.", idle.Round(time.Second))
+		ctx, cancel := context.WithTimeout(context.TODO(), ssr.etcdConnectionConfig.ConnectionTimeout.Duration)
+		defer cancel()
+		if err := (*ssr.etcdWatchClient).RequestProgress(ctx); err != nil {
+			ssr.logger.Warnf("Failed to request progress notification on etcd watch: %v", err)
+		}
+	}
+	return nil
+}
+
+// recordWatchCompaction logs and records in the metrics the revisions which were compacted by
+// etcd before they could be observed on the watch, i.e. the gap in the delta snapshots.
+func (ssr *Snapshotter) recordWatchCompaction(compactRevision int64) {
+	firstMissed := ssr.lastSealedRevision() + 1
+	if ssr.lastEventRevision >= firstMissed {
+		firstMissed = ssr.lastEventRevision + 1
+	}
+	metrics.WatchRecoveriesTotal.With(prometheus.Labels{metrics.LabelReason: metrics.ValueWatchCompacted}).Inc()
+	if compactRevision <= firstMissed {
+		ssr.logger.Warnf("Etcd watch revision %d has been compacted.", firstMissed)
+		return
+	}
+	metrics.WatchMissedRevisionsTotal.With(prometheus.Labels{}).Add(float64(compactRevision - firstMissed))
+	ssr.logger.Warnf("Etcd watch revision %d has been compacted, revisions [%d, %d] are missing in the delta snapshots.", firstMissed, firstMissed, compactRevision-1)
+}
+
+// isWatchCompacted returns true if the error is caused by a compacted watch revision.
+func isWatchCompacted(err error) bool {
+	return errors.Is(err, rpctypes.ErrCompacted)
+}
@@ -235,6 +235,7 @@ func (a *ABSSnapStore) List() (brtypes.SnapList, error) {
 	// Consider the parent of the backup version level (Required for Backward Compatibility)
 	prefix := path.Join(strings.Join(prefixTokens[:len(prefixTokens)-1], "/"))
 	var snapList brtypes.SnapList
+	metadata := snapshotMetadataIndex{}
 	opts := azblob.ListBlobsSegmentOptions{Prefix: prefix}
 	for marker := (azblob.Marker{}); marker.NotDone(); {
 		// Get a result segment starting with the blob indicated by the current Marker.
@@ -249,15 +250,26 @@ func (a *ABSSnapStore) List() (brtypes.SnapList, error) {
 			if strings.Contains(blob.Name, backupVersionV1) || strings.Contains(blob.Name, backupVersionV2) {
 				//the blob may contain the full path in its name including the prefix
 				blobName := strings.TrimPrefix(blob.Name, prefix)
+				if IsSnapshotMetadata(blobName) {
+					metadata.add(path.Join(prefix, blobName))
+					continue
+				}
+				if IsDeduplicationChunk(blobName) {
+					continue
+				}
 				s, err := ParseSnapshot(path.Join(prefix, blobName))
 				if err != nil {
 					logrus.Warnf("Invalid snapshot found. Ignoring it:%s\n", blob.Name)
 				} else {
+					if blob.Properties.ContentLength != nil {
+						s.Size = *blob.Properties.ContentLength
+					}
 					snapList = append(snapList, s)
 				}
 			}
 		}
 	}
+	metadata.mark(snapList)
 	sort.Sort(snapList)
 	return snapList, nil
 }
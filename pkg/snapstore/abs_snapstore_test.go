@@ -45,24 +45,33 @@ func newFakeABSSnapstore() brtypes.SnapStore {
 
 // newFakePolicyFactory creates a 'Fake' policy factory.
 func newFakePolicyFactory(bucket, prefix string, objectMap map[string]*[]byte) pipeline.Factory {
-	return &fakePolicyFactory{bucket, prefix, objectMap}
+	return &fakePolicyFactory{
+		bucket:           bucket,
+		prefix:           prefix,
+		objectMap:        objectMap,
+		multiPartUploads: make(map[string]map[string][]byte, 0),
+	}
 }
 
 type fakePolicyFactory struct {
 	bucket    string
 	prefix    string
 	objectMap map[string]*[]byte
+	// multiPartUploads is shared by the policies, since a new policy is created for every request.
+	multiPartUploads      map[string]map[string][]byte
+	multiPartUploadsMutex sync.Mutex
 }
 
 // New initializes a Fake policy object.
 func (f *fakePolicyFactory) New(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.Policy {
 	return &fakePolicy{
-		next:             next,
-		po:               po,
-		bucket:           f.bucket,
-		prefix:           f.prefix,
-		objectMap:        f.objectMap,
-		multiPartUploads: make(map[string]map[string][]byte, 0),
+		next:                  next,
+		po:                    po,
+		bucket:                f.bucket,
+		prefix:                f.prefix,
+		objectMap:             f.objectMap,
+		multiPartUploads:      f.multiPartUploads,
+		multiPartUploadsMutex: &f.multiPartUploadsMutex,
 	}
 }
 
@@ -73,7 +82,7 @@ type fakePolicy struct {
 	prefix                string
 	objectMap             map[string]*[]byte
 	multiPartUploads      map[string]map[string][]byte
-	multiPartUploadsMutex sync.Mutex
+	multiPartUploadsMutex *sync.Mutex
 }
 
 // Do method is called on pipeline to process the request. This will internally call the `Do` method
@@ -151,8 +160,10 @@ func (p *fakePolicy) handleListObjects(w *http.Response) error {
 	sort.Strings(keys)
 	for _, key := range keys {
 		if strings.Compare(key, marker) > 0 {
+			size := int64(len(*p.objectMap[key]))
 			blob := blobItem{
-				Name: key,
+				Name:       key,
+				Properties: azblob.BlobProperties{ContentLength: &size},
 			}
 			blobs = append(blobs, blob)
 			if len(blobs) == limit {
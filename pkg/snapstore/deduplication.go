@@ -0,0 +1,594 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// deduplicationManifestHeader is the first line of the manifest of a deduplicated snapshot,
+// by which it is told apart from a snapshot stored as a whole.
+const deduplicationManifestHeader = "etcdbr-deduplication-manifest/v1\n"
+
+// deduplicationChunkDeletionsName names the object in the chunk directory which holds the chunks marked for deletion.
+const deduplicationChunkDeletionsName = "deletions" + brtypes.DeduplicationChunkSuffix
+
+// deduplicationManifest lists the chunks of a deduplicated snapshot in their order.
+type deduplicationManifest struct {
+	// Size is the size of the snapshot.
+	Size int64 `json:"size"`
+	// Chunks are the chunks of the snapshot.
+	Chunks []deduplicationChunkRef `json:"chunks"`
+}
+
+// deduplicationChunkDeletions holds the chunks marked for deletion, along with the time they were last marked at.
+type deduplicationChunkDeletions struct {
+	Chunks map[string]time.Time `json:"chunks"`
+}
+
+// deduplicationChunkRef refers to a chunk of a deduplicated snapshot.
+type deduplicationChunkRef struct {
+	// Hash is the hexadecimal SHA-256 hash of the chunk, which names the chunk object.
+	Hash string `json:"hash"`
+	// Size is the size of the chunk.
+	Size int64 `json:"size"`
+}
+
+// IsDeduplicationChunk returns true if the object at the given path in the snapstore is a chunk
+// of deduplicated snapshots, or a part of it, rather than a snapshot.
+func IsDeduplicationChunk(objectPath string) bool {
+	for _, tok := range strings.Split(objectPath, "/") {
+		if strings.HasSuffix(tok, brtypes.DeduplicationChunkSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeduplicatingSnapStore is a snapstore which stores the full snapshots in another snapstore as content-defined chunks.
+// Each chunk is stored once, named after its hash, and shared by all the snapshots which contain it. In place of a
+// snapshot, a manifest listing its chunks is stored. Delta snapshots are stored as they are, and snapshots which were
+// stored as a whole, e.g. before deduplication was enabled, are read as they are.
+// Deduplicated snapshots are read and deleted this way also if deduplication is disabled.
+//
+// The chunks are reference counted by the manifests. As other processes, like the compactor, store snapshots too,
+// a chunk isn't deleted along with the last snapshot which contains it, since a snapshot being saved elsewhere may
+// have skipped uploading it. Instead, the chunks of a deleted snapshot are marked for deletion, and a chunk is only
+// deleted once it stayed marked for the grace period, which is longer than it takes to save any snapshot, and no
+// manifest refers to it anymore. A chunk marked for deletion which a snapshot contains is uploaded again after the
+// manifest of the snapshot is stored, as it may have been deleted meanwhile.
+type DeduplicatingSnapStore struct {
+	store                brtypes.SnapStore
+	deduplicate          bool
+	prefix               string
+	chunkSize            int
+	maxParallelUploads   uint
+	maxParallelDownloads uint
+	gracePeriod          time.Duration
+
+	// mutex guards the references to the chunks.
+	mutex sync.Mutex
+	// manifests caches the manifests of the full snapshots in the snapstore by their path,
+	// which are nil for snapshots stored as a whole. Manifests never change once they are stored.
+	manifests map[string]*deduplicationManifest
+	// refs counts the references to each chunk by the stored manifests.
+	refs map[string]int
+	// pending counts the references to each chunk by the snapshots being saved.
+	pending map[string]int
+}
+
+// NewDeduplicatingSnapStore returns a snapstore which deduplicates the full snapshots stored in the given snapstore,
+// if deduplication is enabled in the given config. The chunks are stored under the given prefix of the snapstore.
+func NewDeduplicatingSnapStore(store brtypes.SnapStore, prefix string, config *brtypes.SnapstoreConfig) *DeduplicatingSnapStore {
+	chunkSize := config.DeduplicationChunkSize
+	if chunkSize <= 0 {
+		chunkSize = brtypes.DefaultDeduplicationChunkSize
+	}
+	maxParallelUploads := config.MaxParallelChunkUploads
+	if maxParallelUploads <= 0 {
+		maxParallelUploads = 1
+	}
+	maxParallelDownloads := config.MaxParallelChunkDownloads
+	if maxParallelDownloads <= 0 {
+		maxParallelDownloads = 1
+	}
+	gracePeriod := config.DeduplicationChunkGracePeriod.Duration
+	if gracePeriod <= 0 {
+		gracePeriod = brtypes.DefaultDeduplicationChunkGracePeriod
+	}
+	return &DeduplicatingSnapStore{
+		store:                store,
+		deduplicate:          config.Deduplication,
+		prefix:               prefix,
+		chunkSize:            int(chunkSize),
+		maxParallelUploads:   maxParallelUploads,
+		maxParallelDownloads: maxParallelDownloads,
+		gracePeriod:          gracePeriod,
+		manifests:            map[string]*deduplicationManifest{},
+		refs:                 map[string]int{},
+		pending:              map[string]int{},
+	}
+}
+
+// Fetch should open reader for the snapshot file from store.
+// The chunks of a deduplicated snapshot are fetched in parallel and reassembled in their order.
+func (s *DeduplicatingSnapStore) Fetch(snap brtypes.Snapshot) (io.ReadCloser, error) {
+	rc, err := s.store.Fetch(snap)
+	if err != nil || !isDeduplicated(snap) {
+		return rc, err
+	}
+	manifest, rc, err := readDeduplicationManifest(rc)
+	if err != nil || manifest == nil {
+		return rc, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.fetchChunks(manifest, pw))
+	}()
+	return pr, nil
+}
+
+// List will return sorted list with all snapshot files on store.
+// If deduplication is enabled, the size of a deduplicated snapshot is taken from its manifest, rather than the size
+// of the manifest itself, so that the size-based garbage collection accounts for the whole snapshot.
+func (s *DeduplicatingSnapStore) List() (brtypes.SnapList, error) {
+	snapList, err := s.store.List()
+	if err != nil || !s.deduplicate {
+		return snapList, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, snap := range snapList {
+		if !isDeduplicated(*snap) {
+			continue
+		}
+		manifest, err := s.getCachedManifest(*snap)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			snap.Size = manifest.Size
+		}
+	}
+	return snapList, nil
+}
+
+// Save will write the snapshot to store.
+// A full snapshot is split into chunks, of which only those which aren't stored yet are uploaded, in parallel.
+func (s *DeduplicatingSnapStore) Save(snap brtypes.Snapshot, rc io.ReadCloser) error {
+	if !s.deduplicate || !isDeduplicated(snap) {
+		return s.store.Save(snap, rc)
+	}
+	defer rc.Close()
+
+	s.mutex.Lock()
+	err := s.loadReferences()
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	deletions := s.fetchChunkDeletions()
+
+	manifest, uploaded, marked, err := s.saveChunks(rc, deletions)
+	if err == nil {
+		err = s.saveManifest(snap, manifest)
+	}
+	if err == nil {
+		if err = s.saveMarkedChunks(marked); err != nil {
+			if deleteErr := s.store.Delete(snap); deleteErr != nil {
+				logrus.Warnf("Failed to delete the manifest of snapshot %s: %v", snap.SnapName, deleteErr)
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, chunk := range manifest.Chunks {
+		if s.pending[chunk.Hash]--; s.pending[chunk.Hash] == 0 {
+			delete(s.pending, chunk.Hash)
+		}
+		if err == nil {
+			s.refs[chunk.Hash]++
+		}
+	}
+	if err != nil {
+		if markErr := s.markUnreferencedChunks(uploaded); markErr != nil {
+			logrus.Warnf("Failed to mark the chunks uploaded for snapshot %s for deletion: %v", snap.SnapName, markErr)
+		}
+		return err
+	}
+	s.manifests[path.Join(snap.SnapDir, snap.SnapName)] = manifest
+	logrus.Infof("Saved deduplicated snapshot %s of size %d in %d chunks, of which %d were uploaded.", snap.SnapName, manifest.Size, len(manifest.Chunks), len(uploaded))
+	return nil
+}
+
+// Delete should delete the snapshot file from store.
+// The chunks of a deduplicated snapshot are marked for deletion, and the chunks which stayed marked for the
+// grace period are deleted if no snapshot contains them anymore.
+func (s *DeduplicatingSnapStore) Delete(snap brtypes.Snapshot) error {
+	if !isDeduplicated(snap) {
+		return s.store.Delete(snap)
+	}
+	manifest, err := s.getManifest(snap)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return s.store.Delete(snap)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// the chunks are marked before the manifest is deleted, so that they are not left behind if deleting it fails.
+	deletions := s.fetchChunkDeletions()
+	now := time.Now()
+	for _, chunk := range manifest.Chunks {
+		deletions[chunk.Hash] = now
+	}
+	if err := s.saveChunkDeletions(deletions); err != nil {
+		return err
+	}
+	if err := s.store.Delete(snap); err != nil {
+		return err
+	}
+	delete(s.manifests, path.Join(snap.SnapDir, snap.SnapName))
+
+	sweepErr := s.sweepChunks(deletions)
+	return errors.Join(sweepErr, s.saveChunkDeletions(deletions))
+}
+
+// isDeduplicated returns true if the given snapshot is stored deduplicated, or may have been, which are the full snapshots.
+func isDeduplicated(snap brtypes.Snapshot) bool {
+	return snap.Kind == brtypes.SnapshotKindFull && !snap.IsChunk && !IsSnapshotMetadata(snap.SnapName)
+}
+
+// chunkSnapshot returns the snapstore object holding the chunk of the given hash.
+func (s *DeduplicatingSnapStore) chunkSnapshot(hash string) brtypes.Snapshot {
+	return brtypes.Snapshot{
+		Prefix:   s.prefix,
+		SnapDir:  brtypes.DeduplicationChunkDir,
+		SnapName: hash + brtypes.DeduplicationChunkSuffix,
+	}
+}
+
+// chunkDeletionsSnapshot returns the snapstore object holding the chunks marked for deletion.
+func (s *DeduplicatingSnapStore) chunkDeletionsSnapshot() brtypes.Snapshot {
+	return brtypes.Snapshot{
+		Prefix:   s.prefix,
+		SnapDir:  brtypes.DeduplicationChunkDir,
+		SnapName: deduplicationChunkDeletionsName,
+	}
+}
+
+// loadReferences counts the references to the chunks by the manifests in the snapstore.
+// The snapstore is listed again each time, as other processes, like the compactor, may store snapshots too,
+// but only the manifests which aren't cached yet are fetched. The caller must hold the mutex.
+func (s *DeduplicatingSnapStore) loadReferences() error {
+	snapList, err := s.store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots to count the references to the deduplication chunks: %v", err)
+	}
+	manifests := map[string]*deduplicationManifest{}
+	refs := map[string]int{}
+	for _, snap := range snapList {
+		if !isDeduplicated(*snap) {
+			continue
+		}
+		manifest, err := s.getCachedManifest(*snap)
+		if err != nil {
+			return err
+		}
+		manifests[path.Join(snap.SnapDir, snap.SnapName)] = manifest
+		if manifest == nil {
+			continue
+		}
+		for _, chunk := range manifest.Chunks {
+			refs[chunk.Hash]++
+		}
+	}
+	s.manifests = manifests
+	s.refs = refs
+	return nil
+}
+
+// getCachedManifest returns the manifest of the given snapshot like getManifest, fetching it only if it isn't cached yet.
+// The caller must hold the mutex.
+func (s *DeduplicatingSnapStore) getCachedManifest(snap brtypes.Snapshot) (*deduplicationManifest, error) {
+	key := path.Join(snap.SnapDir, snap.SnapName)
+	if manifest, ok := s.manifests[key]; ok {
+		return manifest, nil
+	}
+	manifest, err := s.getManifest(snap)
+	if err != nil {
+		return nil, err
+	}
+	s.manifests[key] = manifest
+	return manifest, nil
+}
+
+// fetchChunkDeletions returns the chunks marked for deletion, along with the time they were last marked at.
+// No chunk is marked if they cannot be fetched, which is the case as long as no deduplicated snapshot was deleted.
+func (s *DeduplicatingSnapStore) fetchChunkDeletions() map[string]time.Time {
+	rc, err := s.store.Fetch(s.chunkDeletionsSnapshot())
+	if err != nil {
+		return map[string]time.Time{}
+	}
+	defer rc.Close()
+	deletions := &deduplicationChunkDeletions{}
+	if err := json.NewDecoder(rc).Decode(deletions); err != nil || deletions.Chunks == nil {
+		return map[string]time.Time{}
+	}
+	return deletions.Chunks
+}
+
+// saveChunkDeletions stores the chunks marked for deletion.
+func (s *DeduplicatingSnapStore) saveChunkDeletions(chunks map[string]time.Time) error {
+	data, err := json.Marshal(&deduplicationChunkDeletions{Chunks: chunks})
+	if err != nil {
+		return fmt.Errorf("failed to marshal deduplication chunks marked for deletion: %v", err)
+	}
+	if err := s.store.Save(s.chunkDeletionsSnapshot(), io.NopCloser(bytes.NewReader(data))); err != nil {
+		return fmt.Errorf("failed to save deduplication chunks marked for deletion: %v", err)
+	}
+	return nil
+}
+
+// sweepChunks deletes the given chunks marked for deletion which stayed marked for the grace period, unless a
+// stored manifest or a snapshot being saved refers to them, and unmarks them. The caller must hold the mutex.
+func (s *DeduplicatingSnapStore) sweepChunks(deletions map[string]time.Time) error {
+	var expired []string
+	for hash, markedAt := range deletions {
+		if time.Since(markedAt) >= s.gracePeriod {
+			expired = append(expired, hash)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := s.loadReferences(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, hash := range expired {
+		if s.pending[hash] > 0 {
+			continue
+		}
+		if s.refs[hash] == 0 {
+			if err := s.store.Delete(s.chunkSnapshot(hash)); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete deduplication chunk %s: %v", hash, err))
+				continue
+			}
+		}
+		delete(deletions, hash)
+	}
+	return errors.Join(errs...)
+}
+
+// getManifest returns the manifest of the given snapshot, or nil if the snapshot is stored as a whole.
+func (s *DeduplicatingSnapStore) getManifest(snap brtypes.Snapshot) (*deduplicationManifest, error) {
+	rc, err := s.store.Fetch(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch snapshot %s: %v", snap.SnapName, err)
+	}
+	manifest, rc, err := readDeduplicationManifest(rc)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		rc.Close()
+	}
+	return manifest, nil
+}
+
+// readDeduplicationManifest reads the manifest from the given snapshot reader and closes it.
+// If the snapshot is stored as a whole, it returns no manifest and a reader of the snapshot instead.
+func readDeduplicationManifest(rc io.ReadCloser) (*deduplicationManifest, io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	header, err := br.Peek(len(deduplicationManifestHeader))
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, nil, err
+	}
+	if string(header) != deduplicationManifestHeader {
+		return nil, struct {
+			io.Reader
+			io.Closer
+		}{br, rc}, nil
+	}
+	defer rc.Close()
+	if _, err := br.Discard(len(deduplicationManifestHeader)); err != nil {
+		return nil, nil, err
+	}
+	manifest := &deduplicationManifest{}
+	if err := json.NewDecoder(br).Decode(manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode deduplication manifest: %v", err)
+	}
+	return manifest, nil, nil
+}
+
+// saveChunks splits the snapshot into chunks and uploads those which aren't stored yet. It returns the manifest of the
+// chunks referenced so far, and the hashes of the uploaded chunks, also if it fails. The uploaded chunks which are
+// marked for deletion are returned as well, so that they can be uploaded again once the manifest is stored.
+func (s *DeduplicatingSnapStore) saveChunks(r io.Reader, deletions map[string]time.Time) (*deduplicationManifest, []string, map[string][]byte, error) {
+	var (
+		manifest    = &deduplicationManifest{}
+		marked      = map[string][]byte{}
+		chunker     = newContentDefinedChunker(r, s.chunkSize)
+		slots       = make(chan struct{}, s.maxParallelUploads)
+		wg          sync.WaitGroup
+		resultMutex sync.Mutex
+		uploaded    []string
+		uploadErr   error
+	)
+	failed := func() bool {
+		resultMutex.Lock()
+		defer resultMutex.Unlock()
+		return uploadErr != nil
+	}
+
+	var chunkErr error
+	for !failed() {
+		data, err := chunker.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			chunkErr = fmt.Errorf("failed to read snapshot: %v", err)
+			break
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		manifest.Chunks = append(manifest.Chunks, deduplicationChunkRef{Hash: hash, Size: int64(len(data))})
+		manifest.Size += int64(len(data))
+
+		s.mutex.Lock()
+		stored := s.refs[hash] > 0 || s.pending[hash] > 0
+		s.pending[hash]++
+		s.mutex.Unlock()
+		if stored {
+			continue
+		}
+		if _, ok := deletions[hash]; ok {
+			marked[hash] = data
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(hash string, data []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := s.store.Save(s.chunkSnapshot(hash), io.NopCloser(bytes.NewReader(data)))
+			resultMutex.Lock()
+			defer resultMutex.Unlock()
+			if err != nil {
+				if uploadErr == nil {
+					uploadErr = fmt.Errorf("failed to save deduplication chunk %s: %v", hash, err)
+				}
+				return
+			}
+			uploaded = append(uploaded, hash)
+		}(hash, data)
+	}
+	wg.Wait()
+
+	if chunkErr != nil {
+		return manifest, uploaded, marked, chunkErr
+	}
+	return manifest, uploaded, marked, uploadErr
+}
+
+// saveMarkedChunks uploads the given chunks marked for deletion again, after the manifest referring to them was
+// stored, as a sweep of the chunks which started before may have deleted them meanwhile.
+func (s *DeduplicatingSnapStore) saveMarkedChunks(marked map[string][]byte) error {
+	for hash, data := range marked {
+		if err := s.store.Save(s.chunkSnapshot(hash), io.NopCloser(bytes.NewReader(data))); err != nil {
+			return fmt.Errorf("failed to save deduplication chunk %s again: %v", hash, err)
+		}
+	}
+	return nil
+}
+
+// saveManifest stores the manifest in place of the given snapshot.
+func (s *DeduplicatingSnapStore) saveManifest(snap brtypes.Snapshot, manifest *deduplicationManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deduplication manifest of snapshot %s: %v", snap.SnapName, err)
+	}
+	data = append([]byte(deduplicationManifestHeader), data...)
+	if err := s.store.Save(snap, io.NopCloser(bytes.NewReader(data))); err != nil {
+		return fmt.Errorf("failed to save deduplication manifest of snapshot %s: %v", snap.SnapName, err)
+	}
+	return nil
+}
+
+// markUnreferencedChunks marks the chunks of the given hashes which neither a stored manifest nor a snapshot
+// being saved refers to for deletion. The caller must hold the mutex.
+func (s *DeduplicatingSnapStore) markUnreferencedChunks(hashes []string) error {
+	deletions := s.fetchChunkDeletions()
+	now := time.Now()
+	for _, hash := range hashes {
+		if s.refs[hash] == 0 && s.pending[hash] == 0 {
+			deletions[hash] = now
+		}
+	}
+	return s.saveChunkDeletions(deletions)
+}
+
+// fetchChunks fetches the chunks of the manifest in parallel and writes them to the given writer in their order.
+// At most maxParallelDownloads chunks are fetched or waiting to be written at a time.
+func (s *DeduplicatingSnapStore) fetchChunks(manifest *deduplicationManifest, w io.Writer) error {
+	type result struct {
+		data []byte
+		err  error
+	}
+	var (
+		results = make([]chan result, len(manifest.Chunks))
+		slots   = make(chan struct{}, s.maxParallelDownloads)
+		done    = make(chan struct{})
+	)
+	defer close(done)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	go func() {
+		for i, chunk := range manifest.Chunks {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, chunk deduplicationChunkRef) {
+				data, err := s.fetchChunk(chunk)
+				results[i] <- result{data: data, err: err}
+			}(i, chunk)
+		}
+	}()
+
+	for i := range results {
+		res := <-results[i]
+		if res.err != nil {
+			return res.err
+		}
+		if _, err := w.Write(res.data); err != nil {
+			return err
+		}
+		<-slots
+	}
+	return nil
+}
+
+// fetchChunk fetches the given chunk and verifies its hash.
+func (s *DeduplicatingSnapStore) fetchChunk(chunk deduplicationChunkRef) ([]byte, error) {
+	rc, err := s.store.Fetch(s.chunkSnapshot(chunk.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deduplication chunk %s: %v", chunk.Hash, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deduplication chunk %s: %v", chunk.Hash, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != chunk.Size || hex.EncodeToString(sum[:]) != chunk.Hash {
+		return nil, fmt.Errorf("deduplication chunk %s is corrupted", chunk.Hash)
+	}
+	return data, nil
+}
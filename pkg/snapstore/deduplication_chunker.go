@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// gearTable holds the random values of the gear rolling hash which finds the chunk boundaries.
+// It is generated with splitmix64 from a fixed seed, as the boundaries must not change between processes.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// contentDefinedChunker splits a stream into chunks whose boundaries depend on the content only, so that
+// the chunks of unchanged regions stay the same when data is changed, inserted or removed elsewhere.
+// It follows the normalized chunking of FastCDC: chunks are between a quarter of and four times the
+// average size, and a boundary is harder to match before the average size than after it.
+type contentDefinedChunker struct {
+	reader  *bufio.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	// maskS and maskL select the hash bits which have to be zero at a boundary before and after the average size.
+	maskS uint64
+	maskL uint64
+}
+
+// newContentDefinedChunker returns a chunker of the given reader. The average chunk size must be a power of two.
+func newContentDefinedChunker(r io.Reader, avgSize int) *contentDefinedChunker {
+	avgBits := bits.Len(uint(avgSize)) - 1
+	return &contentDefinedChunker{
+		reader:  bufio.NewReaderSize(r, 4*avgSize),
+		minSize: avgSize / 4,
+		avgSize: avgSize,
+		maxSize: 4 * avgSize,
+		maskS:   highBitsMask(avgBits + 1),
+		maskL:   highBitsMask(avgBits - 1),
+	}
+}
+
+// highBitsMask returns the mask of the n highest bits. The high bits of the gear hash depend on the last 64 bytes,
+// while its low bits only depend on the last few bytes.
+func highBitsMask(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// next returns the next chunk, or io.EOF after the last chunk.
+func (c *contentDefinedChunker) next() ([]byte, error) {
+	data, err := c.reader.Peek(c.maxSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+	chunk := make([]byte, c.cut(data))
+	copy(chunk, data)
+	if _, err := c.reader.Discard(len(chunk)); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// cut returns the size of the chunk at the start of the given data.
+func (c *contentDefinedChunker) cut(data []byte) int {
+	if len(data) <= c.minSize {
+		return len(data)
+	}
+	normalSize := c.avgSize
+	if normalSize > len(data) {
+		normalSize = len(data)
+	}
+	var hash uint64
+	i := c.minSize
+	for ; i < normalSize; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(data); i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	. "github.com/gardener/etcd-backup-restore/pkg/snapstore"
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deduplicating snapstore", func() {
+	const chunkSize = 64 * 1024
+
+	var (
+		prefix     string
+		localStore brtypes.SnapStore
+		store      *DeduplicatingSnapStore
+		data       []byte
+	)
+
+	newStore := func(gracePeriod time.Duration) *DeduplicatingSnapStore {
+		return NewDeduplicatingSnapStore(localStore, prefix, &brtypes.SnapstoreConfig{
+			Deduplication:                 true,
+			DeduplicationChunkSize:        chunkSize,
+			MaxParallelChunkUploads:       4,
+			MaxParallelChunkDownloads:     4,
+			DeduplicationChunkGracePeriod: wrappers.Duration{Duration: gracePeriod},
+		})
+	}
+	// chunkCount returns the number of chunk objects in the snapstore.
+	chunkCount := func() int {
+		entries, err := os.ReadDir(path.Join(prefix, brtypes.DeduplicationChunkDir))
+		if os.IsNotExist(err) {
+			return 0
+		}
+		Expect(err).ShouldNot(HaveOccurred())
+		count := 0
+		for _, entry := range entries {
+			if entry.Name() != "deletions"+brtypes.DeduplicationChunkSuffix {
+				count++
+			}
+		}
+		return count
+	}
+	save := func(snap *brtypes.Snapshot, content []byte) {
+		Expect(store.Save(*snap, io.NopCloser(bytes.NewReader(content)))).Should(Succeed())
+	}
+	fetch := func(snap *brtypes.Snapshot) []byte {
+		rc, err := store.Fetch(*snap)
+		Expect(err).ShouldNot(HaveOccurred())
+		defer rc.Close()
+		content, err := io.ReadAll(rc)
+		Expect(err).ShouldNot(HaveOccurred())
+		return content
+	}
+	list := func() brtypes.SnapList {
+		snapList, err := store.List()
+		Expect(err).ShouldNot(HaveOccurred())
+		return snapList
+	}
+
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "deduplication")
+		Expect(err).ShouldNot(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		prefix = filepath.Join(dir, "v2")
+		localStore, err = NewLocalSnapStore(prefix)
+		Expect(err).ShouldNot(HaveOccurred())
+		store = newStore(time.Nanosecond)
+
+		data = make([]byte, 64*chunkSize)
+		rand.New(rand.NewSource(1)).Read(data)
+	})
+
+	It("should store the chunks shared by full snapshots once and restore each snapshot", func() {
+		// the second snapshot has some data inserted in the middle.
+		modified := append(append(append([]byte{}, data[:len(data)/2]...), []byte("some inserted data")...), data[len(data)/2:]...)
+		snap1 := NewSnapshot(brtypes.SnapshotKindFull, 0, 10, "", false)
+		snap2 := NewSnapshot(brtypes.SnapshotKindFull, 0, 20, "", false)
+		save(snap1, data)
+		chunks := chunkCount()
+		Expect(chunks).Should(BeNumerically(">", 1))
+		save(snap2, modified)
+		Expect(chunkCount()).Should(BeNumerically("<", chunks+3))
+
+		snapList := list()
+		Expect(snapList).Should(HaveLen(2))
+		Expect(snapList[0].Size).Should(Equal(int64(len(data))))
+		Expect(snapList[1].Size).Should(Equal(int64(len(modified))))
+		Expect(fetch(snapList[0])).Should(Equal(data))
+		Expect(fetch(snapList[1])).Should(Equal(modified))
+
+		Expect(store.Delete(*snapList[0])).Should(Succeed())
+		Expect(chunkCount()).Should(Equal(chunks))
+		Expect(fetch(snapList[1])).Should(Equal(modified))
+
+		Expect(store.Delete(*snapList[1])).Should(Succeed())
+		Expect(chunkCount()).Should(BeZero())
+	})
+
+	It("should keep the chunks of a deleted snapshot for the grace period", func() {
+		store = newStore(time.Hour)
+		snap1 := NewSnapshot(brtypes.SnapshotKindFull, 0, 10, "", false)
+		save(snap1, data)
+		chunks := chunkCount()
+
+		Expect(store.Delete(*list()[0])).Should(Succeed())
+		Expect(list()).Should(BeEmpty())
+		Expect(chunkCount()).Should(Equal(chunks))
+
+		// a snapshot containing the chunks marked for deletion can be saved and restored again.
+		snap2 := NewSnapshot(brtypes.SnapshotKindFull, 0, 20, "", false)
+		save(snap2, data)
+		Expect(chunkCount()).Should(Equal(chunks))
+		Expect(fetch(list()[0])).Should(Equal(data))
+	})
+
+	It("should not delete the chunks of a snapshot saved by another snapstore", func() {
+		snap1 := NewSnapshot(brtypes.SnapshotKindFull, 0, 10, "", false)
+		save(snap1, data)
+		chunks := chunkCount()
+
+		// the other snapstore skips uploading the chunks, which are stored already.
+		other := newStore(time.Nanosecond)
+		snap2 := NewSnapshot(brtypes.SnapshotKindFull, 0, 20, "", false)
+		Expect(other.Save(*snap2, io.NopCloser(bytes.NewReader(data)))).Should(Succeed())
+		Expect(chunkCount()).Should(Equal(chunks))
+
+		Expect(store.Delete(*list()[0])).Should(Succeed())
+		Expect(chunkCount()).Should(Equal(chunks))
+		Expect(fetch(list()[0])).Should(Equal(data))
+	})
+
+	It("should reject deduplicated snapshots among snapshot files", func() {
+		full := NewSnapshot(brtypes.SnapshotKindFull, 0, 100, "", false)
+		save(full, data)
+
+		filesStore, err := NewFilesSnapStore([]string{prefix})
+		Expect(err).ShouldNot(HaveOccurred())
+		snapList, err := filesStore.List()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(snapList).To(HaveLen(1))
+		_, err = filesStore.Fetch(*snapList[0])
+		Expect(err).To(MatchError(ContainSubstring("deduplicated full snapshot")))
+	})
+
+	It("should store delta snapshots as they are", func() {
+		snap := NewSnapshot(brtypes.SnapshotKindDelta, 11, 20, "", false)
+		save(snap, data)
+		Expect(chunkCount()).Should(BeZero())
+		content, err := os.ReadFile(path.Join(prefix, snap.SnapName))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(content).Should(Equal(data))
+	})
+
+	It("should read full snapshots stored as a whole", func() {
+		snap := NewSnapshot(brtypes.SnapshotKindFull, 0, 10, "", false)
+		Expect(os.WriteFile(path.Join(prefix, snap.SnapName), data, 0600)).Should(Succeed())
+
+		snapList := list()
+		Expect(snapList).Should(HaveLen(1))
+		Expect(fetch(snapList[0])).Should(Equal(data))
+		Expect(store.Delete(*snapList[0])).Should(Succeed())
+		Expect(list()).Should(BeEmpty())
+	})
+
+	It("should fail to read a snapshot with a corrupted chunk", func() {
+		snap := NewSnapshot(brtypes.SnapshotKindFull, 0, 10, "", false)
+		save(snap, data)
+		entries, err := os.ReadDir(path.Join(prefix, brtypes.DeduplicationChunkDir))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(os.WriteFile(path.Join(prefix, brtypes.DeduplicationChunkDir, entries[0].Name()), []byte("corrupted"), 0600)).Should(Succeed())
+
+		rc, err := store.Fetch(*list()[0])
+		Expect(err).ShouldNot(HaveOccurred())
+		defer rc.Close()
+		_, err = io.ReadAll(rc)
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// FilesSnapStore is a read-only snapstore of snapshot files on local disk, e.g. downloaded from another snapstore,
+// which need not be laid out as in a snapstore.
+type FilesSnapStore struct {
+	paths []string
+}
+
+// NewFilesSnapStore returns the snapstore of the snapshot files at the given paths, and of the files in the directories
+// at the given paths.
+func NewFilesSnapStore(paths []string) (*FilesSnapStore, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no snapshot files given")
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return nil, fmt.Errorf("failed to get file info of snapshot file or directory %s: %v", p, err)
+		}
+	}
+	return &FilesSnapStore{
+		paths: paths,
+	}, nil
+}
+
+// Fetch should open reader for the snapshot file from store.
+// Deduplicated full snapshots are rejected, since their chunks are not laid out as in a snapstore.
+func (s *FilesSnapStore) Fetch(snap brtypes.Snapshot) (io.ReadCloser, error) {
+	f, err := os.Open(path.Join(snap.Prefix, snap.SnapDir, snap.SnapName))
+	if err != nil {
+		return nil, err
+	}
+	if !isDeduplicated(snap) {
+		return f, nil
+	}
+	manifest, rc, err := readDeduplicationManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file %s: %v", snap.SnapName, err)
+	}
+	if manifest != nil {
+		return nil, fmt.Errorf("snapshot file %s is a deduplicated full snapshot, which is only supported in its snapstore", snap.SnapName)
+	}
+	return rc, nil
+}
+
+// Save will write the snapshot to store
+func (s *FilesSnapStore) Save(snap brtypes.Snapshot, rc io.ReadCloser) error {
+	rc.Close()
+	return fmt.Errorf("failed to save snapshot %s: snapstore of snapshot files is read-only", snap.SnapName)
+}
+
+// List will return sorted list with all snapshot files on store.
+func (s *FilesSnapStore) List() (brtypes.SnapList, error) {
+	snapList := brtypes.SnapList{}
+	metadata := snapshotMetadataIndex{}
+	listed := map[string]bool{}
+	for _, p := range s.paths {
+		err := filepath.Walk(p, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			filePath = filepath.Clean(filePath)
+			if info.IsDir() || listed[filePath] {
+				return nil
+			}
+			listed[filePath] = true
+			if IsSnapshotMetadata(filePath) {
+				metadata.add(filepath.ToSlash(filePath))
+				return nil
+			}
+			if IsDeduplicationChunk(filePath) {
+				return nil
+			}
+			snap, err := ParseSnapshotFile(filepath.ToSlash(filePath))
+			if err != nil {
+				logrus.Warnf("Invalid snapshot file found. Ignoring it: %s: %v", filePath, err)
+				return nil
+			}
+			snap.Size = info.Size()
+			snapList = append(snapList, snap)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error walking the path %q: %v", p, err)
+		}
+	}
+	metadata.mark(snapList)
+
+	sort.Sort(snapList)
+	return snapList, nil
+}
+
+// Delete should delete the snapshot file from store
+func (s *FilesSnapStore) Delete(snap brtypes.Snapshot) error {
+	return fmt.Errorf("failed to delete snapshot %s: snapstore of snapshot files is read-only", snap.SnapName)
+}
@@ -282,17 +282,27 @@ func (s *GCSSnapStore) List() (brtypes.SnapList, error) {
 	}
 
 	var snapList brtypes.SnapList
+	metadata := snapshotMetadataIndex{}
 	for _, v := range attrs {
 		if strings.Contains(v.Name, backupVersionV1) || strings.Contains(v.Name, backupVersionV2) {
+			if IsSnapshotMetadata(v.Name) {
+				metadata.add(v.Name)
+				continue
+			}
+			if IsDeduplicationChunk(v.Name) {
+				continue
+			}
 			snap, err := ParseSnapshot(v.Name)
 			if err != nil {
 				// Warning
 				logrus.Warnf("Invalid snapshot %s found, ignoring it: %v", v.Name, err)
 				continue
 			}
+			snap.Size = v.Size
 			snapList = append(snapList, snap)
 		}
 	}
+	metadata.mark(snapList)
 
 	sort.Sort(snapList)
 	return snapList, nil
@@ -301,7 +311,35 @@ func (s *GCSSnapStore) List() (brtypes.SnapList, error) {
 // Delete should delete the snapshot file from store.
 func (s *GCSSnapStore) Delete(snap brtypes.Snapshot) error {
 	objectName := path.Join(snap.Prefix, snap.SnapDir, snap.SnapName)
-	return s.client.Bucket(s.bucket).Object(objectName).Delete(context.TODO())
+	if err := s.client.Bucket(s.bucket).Object(objectName).Delete(context.TODO()); err != nil {
+		return err
+	}
+	if IsSnapshotMetadata(snap.SnapName) || IsDeduplicationChunk(snap.SnapName) {
+		// The chunks of snapshot metadata objects and deduplication chunks are not garbage collected along with the snapshot chunks.
+		return s.deleteChunks(objectName + s.chunkDirSuffix + "/")
+	}
+	return nil
+}
+
+// deleteChunks deletes the chunk objects with the given prefix.
+func (s *GCSSnapStore) deleteChunks(prefix string) error {
+	bh := s.client.Bucket(s.bucket)
+	it := bh.Objects(context.TODO(), &storage.Query{Prefix: prefix})
+	for {
+		attr, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(attr.Name, prefix) {
+			continue
+		}
+		if err := bh.Object(attr.Name).Delete(context.TODO()); err != nil {
+			return err
+		}
+	}
 }
 
 // GetGCSCredentialsLastModifiedTime returns the latest modification timestamp of the GCS credential file
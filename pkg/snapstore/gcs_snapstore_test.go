@@ -47,7 +47,11 @@ func (m *mockBucketHandle) Objects(context.Context, *storage.Query) stiface.Obje
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
-	return &mockObjectIterator{keys: keys}
+	sizes := make([]int64, len(keys))
+	for i, key := range keys {
+		sizes[i] = int64(len(*m.client.objects[key]))
+	}
+	return &mockObjectIterator{keys: keys, sizes: sizes}
 }
 
 type mockObjectHandle struct {
@@ -91,12 +95,14 @@ type mockObjectIterator struct {
 	stiface.ObjectIterator
 	currentIndex int
 	keys         []string
+	sizes        []int64
 }
 
 func (m *mockObjectIterator) Next() (*storage.ObjectAttrs, error) {
 	if m.currentIndex < len(m.keys) {
 		obj := &storage.ObjectAttrs{
 			Name: m.keys[m.currentIndex],
+			Size: m.sizes[m.currentIndex],
 		}
 		m.currentIndex++
 		return obj, nil
@@ -6,13 +6,17 @@ package snapstore
 
 import (
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
 )
 
 // NewSnapstoreConfig returns the snapstore config.
 func NewSnapstoreConfig() *brtypes.SnapstoreConfig {
 	return &brtypes.SnapstoreConfig{
-		MaxParallelChunkUploads: 5,
-		MinChunkSize:            brtypes.MinChunkSize,
-		TempDir:                 "/tmp",
+		MaxParallelChunkUploads:       5,
+		MinChunkSize:                  brtypes.MinChunkSize,
+		TempDir:                       "/tmp",
+		DeduplicationChunkSize:        brtypes.DefaultDeduplicationChunkSize,
+		MaxParallelChunkDownloads:     brtypes.DefaultMaxParallelChunkDownloads,
+		DeduplicationChunkGracePeriod: wrappers.Duration{Duration: brtypes.DefaultDeduplicationChunkGracePeriod},
 	}
 }
@@ -75,6 +75,7 @@ func (s *LocalSnapStore) List() (brtypes.SnapList, error) {
 	prefix := path.Join(strings.Join(prefixTokens[:len(prefixTokens)-1], "/"))
 
 	snapList := brtypes.SnapList{}
+	metadata := snapshotMetadataIndex{}
 	err := filepath.Walk(prefix, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			fmt.Printf("prevent panic by handling failure accessing a path %q: %v\n", path, err)
@@ -84,11 +85,19 @@ func (s *LocalSnapStore) List() (brtypes.SnapList, error) {
 			return nil
 		}
 		if strings.Contains(path, backupVersionV1) || strings.Contains(path, backupVersionV2) {
+			if IsSnapshotMetadata(path) {
+				metadata.add(path)
+				return nil
+			}
+			if IsDeduplicationChunk(path) {
+				return nil
+			}
 			snap, err := ParseSnapshot(path)
 			if err != nil {
 				// Warning
 				logrus.Warnf("Invalid snapshot found. Ignoring it:%s\n", path)
 			} else {
+				snap.Size = info.Size()
 				snapList = append(snapList, snap)
 			}
 		}
@@ -97,6 +106,7 @@ func (s *LocalSnapStore) List() (brtypes.SnapList, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error walking the path %q: %v", prefix, err)
 	}
+	metadata.mark(snapList)
 
 	sort.Sort(snapList)
 	return snapList, nil
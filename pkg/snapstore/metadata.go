@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+)
+
+// IsSnapshotMetadata returns true if the object at the given path in the snapstore is the
+// metadata or the pin of a snapshot, or a chunk of it, rather than a snapshot.
+// Only the name of the object is checked, so that a prefix or container ending with the suffix doesn't matter.
+func IsSnapshotMetadata(objectPath string) bool {
+	name := objectName(objectPath)
+	return strings.HasSuffix(name, brtypes.SnapshotMetadataSuffix) || strings.HasSuffix(name, brtypes.SnapshotPinSuffix)
+}
+
+// objectName returns the name of the object at the given path in the snapstore. For a chunk of an object,
+// which is stored in a directory named after the object, it returns the name of that object.
+func objectName(objectPath string) string {
+	dir, name := path.Split(objectPath)
+	if isChunkName(name) && dir != "" {
+		return strings.TrimSuffix(path.Base(dir), brtypes.ChunkDirSuffix)
+	}
+	return name
+}
+
+// isChunkName returns true if the given name is the name of a chunk of an object, which is its zero padded part number.
+func isChunkName(name string) bool {
+	if len(name) != 10 {
+		return false
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveSnapshotMetadata stores the metadata of the given snapshot in the snapstore.
+func SaveSnapshotMetadata(store brtypes.SnapStore, snap brtypes.Snapshot, metadata *brtypes.SnapshotMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata of snapshot %s: %v", snap.SnapName, err)
+	}
+	if err := store.Save(metadataSnapshot(snap), io.NopCloser(bytes.NewReader(data))); err != nil {
+		return fmt.Errorf("failed to save metadata of snapshot %s: %v", snap.SnapName, err)
+	}
+	return nil
+}
+
+// GetSnapshotMetadata fetches the metadata of the given snapshot from the snapstore.
+// It returns nil if no metadata is stored for the snapshot.
+func GetSnapshotMetadata(store brtypes.SnapStore, snap brtypes.Snapshot) (*brtypes.SnapshotMetadata, error) {
+	if !snap.HasMetadata {
+		return nil, nil
+	}
+	rc, err := store.Fetch(metadataSnapshot(snap))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metadata of snapshot %s: %v", snap.SnapName, err)
+	}
+	defer rc.Close()
+	metadata := &brtypes.SnapshotMetadata{}
+	if err := json.NewDecoder(rc).Decode(metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata of snapshot %s: %v", snap.SnapName, err)
+	}
+	return metadata, nil
+}
+
+// DeleteSnapshotMetadata deletes the metadata of the given snapshot from the snapstore, if there is any.
+func DeleteSnapshotMetadata(store brtypes.SnapStore, snap brtypes.Snapshot) error {
+	if !snap.HasMetadata {
+		return nil
+	}
+	if err := store.Delete(metadataSnapshot(snap)); err != nil {
+		return fmt.Errorf("failed to delete metadata of snapshot %s: %v", snap.SnapName, err)
+	}
+	return nil
+}
+
+// GetKeyFilter returns the key filter of the latest snapshot in the given list which was recorded with one,
+// or nil if all the snapshots contain all the keys.
+func GetKeyFilter(store brtypes.SnapStore, snapList brtypes.SnapList) (*brtypes.KeyPrefixFilter, error) {
+	for i := len(snapList) - 1; i >= 0; i-- {
+		metadata, err := GetSnapshotMetadata(store, *snapList[i])
+		if err != nil {
+			return nil, err
+		}
+		if metadata.IsPartial() {
+			return metadata.KeyFilter, nil
+		}
+	}
+	return nil, nil
+}
+
+// metadataSnapshot returns the snapstore object holding the metadata of the given snapshot.
+func metadataSnapshot(snap brtypes.Snapshot) brtypes.Snapshot {
+	snap.SnapName += brtypes.SnapshotMetadataSuffix
+	snap.IsChunk = false
+	snap.HasMetadata = false
+	return snap
+}
+
+// snapshotMetadataIndex collects the metadata and pin objects found while listing a snapstore,
+// keyed by the path of the snapshot they belong to.
+type snapshotMetadataIndex map[string]*snapshotMetadataEntry
+
+// snapshotMetadataEntry records which objects are stored alongside a snapshot.
+type snapshotMetadataEntry struct {
+	hasMetadata bool
+	isPinned    bool
+}
+
+// add records the metadata or pin object at the given path. Chunks of these objects are ignored.
+func (m snapshotMetadataIndex) add(objectPath string) {
+	switch {
+	case strings.HasSuffix(objectPath, brtypes.SnapshotMetadataSuffix):
+		m.entry(strings.TrimSuffix(objectPath, brtypes.SnapshotMetadataSuffix)).hasMetadata = true
+	case strings.HasSuffix(objectPath, brtypes.SnapshotPinSuffix):
+		m.entry(strings.TrimSuffix(objectPath, brtypes.SnapshotPinSuffix)).isPinned = true
+	}
+}
+
+// entry returns the entry of the snapshot at the given path, adding it if it is not recorded yet.
+func (m snapshotMetadataIndex) entry(snapPath string) *snapshotMetadataEntry {
+	snapPath = path.Clean(snapPath)
+	if _, ok := m[snapPath]; !ok {
+		m[snapPath] = &snapshotMetadataEntry{}
+	}
+	return m[snapPath]
+}
+
+// mark sets HasMetadata and IsPinned on the snapshots for which a metadata or pin object was recorded.
+func (m snapshotMetadataIndex) mark(snapList brtypes.SnapList) {
+	if len(m) == 0 {
+		return
+	}
+	for _, snap := range snapList {
+		if entry, ok := m[path.Join(snap.Prefix, snap.SnapDir, snap.SnapName)]; ok {
+			snap.HasMetadata = entry.hasMetadata
+			snap.IsPinned = entry.isPinned
+		}
+	}
+}
@@ -223,6 +223,7 @@ func (s *OSSSnapStore) List() (brtypes.SnapList, error) {
 	prefix := path.Join(strings.Join(prefixTokens[:len(prefixTokens)-1], "/"))
 
 	var snapList brtypes.SnapList
+	metadata := snapshotMetadataIndex{}
 
 	marker := ""
 	for {
@@ -232,11 +233,19 @@ func (s *OSSSnapStore) List() (brtypes.SnapList, error) {
 		}
 		for _, object := range lsRes.Objects {
 			if strings.Contains(object.Key, backupVersionV1) || strings.Contains(object.Key, backupVersionV2) {
+				if IsSnapshotMetadata(object.Key) {
+					metadata.add(object.Key)
+					continue
+				}
+				if IsDeduplicationChunk(object.Key) {
+					continue
+				}
 				snap, err := ParseSnapshot(object.Key)
 				if err != nil {
 					// Warning
 					logrus.Warnf("Invalid snapshot found. Ignoring it: %s", object.Key)
 				} else {
+					snap.Size = object.Size
 					snapList = append(snapList, snap)
 				}
 			}
@@ -247,6 +256,7 @@ func (s *OSSSnapStore) List() (brtypes.SnapList, error) {
 			break
 		}
 	}
+	metadata.mark(snapList)
 	sort.Sort(snapList)
 
 	return snapList, nil
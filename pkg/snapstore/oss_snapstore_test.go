@@ -134,7 +134,8 @@ func (m *mockOSSBucket) ListObjects(options ...oss.Option) (oss.ListObjectsResul
 	var contents []oss.ObjectProperties
 	for key := range m.objects {
 		tempObj := oss.ObjectProperties{
-			Key: key,
+			Key:  key,
+			Size: int64(len(*m.objects[key])),
 		}
 		contents = append(contents, tempObj)
 	}
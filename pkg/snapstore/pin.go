@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package snapstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+)
+
+// PinSnapshot stores the given pin alongside the given snapshot in the snapstore, replacing any previous pin of it.
+func PinSnapshot(store brtypes.SnapStore, snap brtypes.Snapshot, pin *brtypes.SnapshotPin) error {
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pin of snapshot %s: %v", snap.SnapName, err)
+	}
+	if err := store.Save(pinSnapshot(snap), io.NopCloser(bytes.NewReader(data))); err != nil {
+		return fmt.Errorf("failed to save pin of snapshot %s: %v", snap.SnapName, err)
+	}
+	return nil
+}
+
+// GetSnapshotPin fetches the pin of the given snapshot from the snapstore.
+// It returns nil if the snapshot is not pinned.
+func GetSnapshotPin(store brtypes.SnapStore, snap brtypes.Snapshot) (*brtypes.SnapshotPin, error) {
+	if !snap.IsPinned {
+		return nil, nil
+	}
+	rc, err := store.Fetch(pinSnapshot(snap))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pin of snapshot %s: %v", snap.SnapName, err)
+	}
+	defer rc.Close()
+	pin := &brtypes.SnapshotPin{}
+	if err := json.NewDecoder(rc).Decode(pin); err != nil {
+		return nil, fmt.Errorf("failed to decode pin of snapshot %s: %v", snap.SnapName, err)
+	}
+	return pin, nil
+}
+
+// UnpinSnapshot deletes the pin of the given snapshot from the snapstore, if there is any.
+func UnpinSnapshot(store brtypes.SnapStore, snap brtypes.Snapshot) error {
+	if !snap.IsPinned {
+		return nil
+	}
+	if err := store.Delete(pinSnapshot(snap)); err != nil {
+		return fmt.Errorf("failed to delete pin of snapshot %s: %v", snap.SnapName, err)
+	}
+	return nil
+}
+
+// GetActiveSnapshotPins fetches the pins of the pinned snapshots in the given list, and returns those which
+// are active at the given time. Snapshots whose pin cannot be fetched are treated as pinned, so that they
+// are not garbage collected by mistake.
+func GetActiveSnapshotPins(store brtypes.SnapStore, snapList brtypes.SnapList, now time.Time) (map[*brtypes.Snapshot]*brtypes.SnapshotPin, error) {
+	var (
+		pins = make(map[*brtypes.Snapshot]*brtypes.SnapshotPin)
+		errs []error
+	)
+	for _, snap := range snapList {
+		if !snap.IsPinned {
+			continue
+		}
+		pin, err := GetSnapshotPin(store, *snap)
+		if err != nil {
+			errs = append(errs, err)
+			pins[snap] = &brtypes.SnapshotPin{Reason: "pin could not be read"}
+			continue
+		}
+		if pin.IsActive(now) {
+			pins[snap] = pin
+		}
+	}
+	return pins, errors.Join(errs...)
+}
+
+// ListSnapshotPins returns the pinned snapshots of the snapstore along with their pins, including the expired ones.
+func ListSnapshotPins(store brtypes.SnapStore) ([]brtypes.PinnedSnapshot, error) {
+	snapList, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var pinned []brtypes.PinnedSnapshot
+	for _, snap := range snapList {
+		if !snap.IsPinned {
+			continue
+		}
+		pin, err := GetSnapshotPin(store, *snap)
+		if err != nil {
+			return nil, err
+		}
+		pinned = append(pinned, brtypes.PinnedSnapshot{Snapshot: snap, Pin: pin})
+	}
+	return pinned, nil
+}
+
+// FindSnapshot returns the snapshot with the given name in the given list, or nil if there is none.
+// Chunks of snapshots are not considered.
+func FindSnapshot(snapList brtypes.SnapList, snapName string) *brtypes.Snapshot {
+	for _, snap := range snapList {
+		if !snap.IsChunk && snap.SnapName == snapName {
+			return snap
+		}
+	}
+	return nil
+}
+
+// pinSnapshot returns the snapstore object holding the pin of the given snapshot.
+func pinSnapshot(snap brtypes.Snapshot) brtypes.Snapshot {
+	snap.SnapName += brtypes.SnapshotPinSuffix
+	snap.IsChunk = false
+	snap.HasMetadata = false
+	snap.IsPinned = false
+	return snap
+}
@@ -518,6 +518,7 @@ func (s *S3SnapStore) List() (brtypes.SnapList, error) {
 	prefix := path.Join(strings.Join(prefixTokens[:len(prefixTokens)-1], "/"))
 
 	var snapList brtypes.SnapList
+	metadata := snapshotMetadataIndex{}
 	in := &s3.ListObjectsInput{
 		Bucket: aws.String(s.bucket),
 		Prefix: aws.String(prefix),
@@ -526,11 +527,19 @@ func (s *S3SnapStore) List() (brtypes.SnapList, error) {
 		for _, key := range page.Contents {
 			k := (*key.Key)[len(*page.Prefix):]
 			if strings.Contains(k, backupVersionV1) || strings.Contains(k, backupVersionV2) {
+				if IsSnapshotMetadata(k) {
+					metadata.add(path.Join(prefix, k))
+					continue
+				}
+				if IsDeduplicationChunk(k) {
+					continue
+				}
 				snap, err := ParseSnapshot(path.Join(prefix, k))
 				if err != nil {
 					// Warning
 					logrus.Warnf("Invalid snapshot found. Ignoring it: %s", k)
 				} else {
+					snap.Size = aws.Int64Value(key.Size)
 					snapList = append(snapList, snap)
 				}
 			}
@@ -540,6 +549,7 @@ func (s *S3SnapStore) List() (brtypes.SnapList, error) {
 	if err != nil {
 		return nil, err
 	}
+	metadata.mark(snapList)
 
 	sort.Sort(snapList)
 	return snapList, nil
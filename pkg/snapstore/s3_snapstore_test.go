@@ -184,7 +184,8 @@ func (m *mockS3Client) ListObjectsPages(in *s3.ListObjectsInput, callback func(*
 			keyPtr := new(string)
 			*keyPtr = key
 			tempObj := &s3.Object{
-				Key: keyPtr,
+				Key:  keyPtr,
+				Size: aws.Int64(int64(len(*m.objects[key]))),
 			}
 			out.Contents = append(out.Contents, tempObj)
 			count++
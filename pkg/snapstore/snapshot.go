@@ -138,3 +138,19 @@ func ParseSnapshot(snapPath string) (*brtypes.Snapshot, error) {
 	s.Prefix = prefix
 	return s, nil
 }
+
+// ParseSnapshotFile parses the snapshot file at the given path like ParseSnapshot. Files which are not laid out as in
+// a snapstore, without a backup version in their path, are parsed by their name alone, as a snapshot in their directory.
+func ParseSnapshotFile(filePath string) (*brtypes.Snapshot, error) {
+	s, err := ParseSnapshot(filePath)
+	if err == nil {
+		return s, nil
+	}
+	dir, name := path.Split(filePath)
+	s, fallbackErr := ParseSnapshot(path.Join(backupVersionV2, name))
+	if fallbackErr != nil {
+		return nil, err
+	}
+	s.Prefix = path.Clean(dir)
+	return s, nil
+}
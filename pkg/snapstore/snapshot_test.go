@@ -195,6 +195,42 @@ var _ = Describe("Snapshot", func() {
 		})
 	})
 
+	Describe("Parse Snapshot file", func() {
+		Context("when path with backup version specified", func() {
+			It("parses the path like a snapshot path", func() {
+				snap, err := ParseSnapshotFile("/abc/v2/Full-00000000-00002088-2387428")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snap.Prefix).To(Equal("/abc/v2/"))
+				Expect(snap.SnapDir).To(Equal(""))
+				Expect(snap.SnapName).To(Equal("Full-00000000-00002088-2387428"))
+			})
+		})
+		Context("when path without any backup version specified", func() {
+			It("parses the snapshot name, with the directory of the file as prefix", func() {
+				snap, err := ParseSnapshotFile("/abc/Incr-00002089-00002100-2387500.gz")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snap.Kind).To(Equal(brtypes.SnapshotKindDelta))
+				Expect(snap.StartRevision).To(Equal(int64(2089)))
+				Expect(snap.LastRevision).To(Equal(int64(2100)))
+				Expect(snap.CompressionSuffix).To(Equal(".gz"))
+				Expect(snap.Prefix).To(Equal("/abc"))
+				Expect(snap.SnapDir).To(Equal(""))
+				Expect(snap.SnapName).To(Equal("Incr-00002089-00002100-2387500.gz"))
+
+				snap, err = ParseSnapshotFile("/home/dev1/Full-00000000-00002088-2387428")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snap.Prefix).To(Equal("/home/dev1"))
+				Expect(snap.SnapName).To(Equal("Full-00000000-00002088-2387428"))
+			})
+		})
+		Context("when invalid snapshot name specified", func() {
+			It("returns error", func() {
+				_, err := ParseSnapshotFile("/abc/Backup--00000000-00002088-2387428")
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("Parse Snapshot name", func() {
 		Context("when valid snapshot name provided under valid path", func() {
 			It("correctly parses a snapshot name with neither a compression nor a final suffix", func() {
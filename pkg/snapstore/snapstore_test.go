@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/url"
 	"os"
 	"path"
@@ -18,6 +19,7 @@ import (
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	. "github.com/gardener/etcd-backup-restore/pkg/snapstore"
 	brtypes "github.com/gardener/etcd-backup-restore/pkg/types"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
 	fake "github.com/gophercloud/gophercloud/testhelper/client"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -308,6 +310,7 @@ var _ = Describe("Save, List, Fetch, Delete from mock snapstore", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 				expectedBytes := []byte(generateContentsForSnapshot(&snap5))
 				Expect(buf.Bytes()).To(Equal(expectedBytes))
+				Expect(snapList[secondSnapshotIndex].Size).To(Equal(int64(len(expectedBytes))))
 
 				// Delete snap5
 				prevLen := len(objectMap)
@@ -327,6 +330,162 @@ var _ = Describe("Save, List, Fetch, Delete from mock snapstore", func() {
 			}
 		})
 	})
+
+	Describe("When a snapshot has metadata", func() {
+		It("should list the snapshot with its metadata", func() {
+			for provider, snapStore := range snapstores {
+				// Create store for mock tests
+				resetObjectMap()
+
+				var objectMapSnapshots brtypes.SnapList
+				objectMapSnapshots = append(objectMapSnapshots, &snap4, &snap5)
+				numberSnapshotsInObjectMap := setObjectMap(provider, objectMapSnapshots)
+
+				logrus.Infof("Running mock tests for %s when a snapshot has metadata", provider)
+
+				metadata := &brtypes.SnapshotMetadata{
+					KeyFilter: &brtypes.KeyPrefixFilter{Exclude: []string{"/registry/events/"}},
+				}
+				Expect(SaveSnapshotMetadata(snapStore, snap5, metadata)).To(Succeed())
+
+				// the metadata object is not listed as a snapshot
+				snapList, err := snapStore.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snapList.Len()).To(Equal(numberSnapshotsInObjectMap * snapStore.objectCountPerSnapshot))
+				var snapWithMetadata *brtypes.Snapshot
+				for _, snap := range snapList {
+					if snap.SnapName == snap5.SnapName && !snap.IsChunk {
+						snapWithMetadata = snap
+					} else {
+						Expect(snap.HasMetadata).To(BeFalse())
+					}
+				}
+				Expect(snapWithMetadata).NotTo(BeNil())
+				Expect(snapWithMetadata.HasMetadata).To(BeTrue())
+
+				fetchedMetadata, err := GetSnapshotMetadata(snapStore, *snapWithMetadata)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fetchedMetadata).To(Equal(metadata))
+				Expect(fetchedMetadata.IsPartial()).To(BeTrue())
+
+				Expect(DeleteSnapshotMetadata(snapStore, *snapWithMetadata)).To(Succeed())
+				snapList, err = snapStore.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snapList.Len()).To(Equal(numberSnapshotsInObjectMap * snapStore.objectCountPerSnapshot))
+				for _, snap := range snapList {
+					Expect(snap.HasMetadata).To(BeFalse())
+				}
+			}
+		})
+	})
+
+	Describe("When objects are classified as snapshot metadata", func() {
+		It("should only consider the name of the object", func() {
+			Expect(IsSnapshotMetadata("prefix/v2/Full-00000000-00000001-1234.meta")).To(BeTrue())
+			Expect(IsSnapshotMetadata("prefix/v2/Full-00000000-00000001-1234.pin")).To(BeTrue())
+			Expect(IsSnapshotMetadata("prefix/v2/Full-00000000-00000001-1234.meta/0000000001")).To(BeTrue())
+			Expect(IsSnapshotMetadata("prefix/v2/Full-00000000-00000001-1234.meta.chunk/0000000001")).To(BeTrue())
+			Expect(IsSnapshotMetadata("prefix.meta/v2/Full-00000000-00000001-1234")).To(BeFalse())
+			Expect(IsSnapshotMetadata("backup.pin/v2/Incr-00000002-00000003-1234.gz/0000000001")).To(BeFalse())
+		})
+	})
+
+	Describe("When a snapshot is pinned", func() {
+		It("should list the snapshot as pinned until its pin expires", func() {
+			for provider, snapStore := range snapstores {
+				// Create store for mock tests
+				resetObjectMap()
+
+				var objectMapSnapshots brtypes.SnapList
+				objectMapSnapshots = append(objectMapSnapshots, &snap4, &snap5)
+				numberSnapshotsInObjectMap := setObjectMap(provider, objectMapSnapshots)
+
+				logrus.Infof("Running mock tests for %s when a snapshot is pinned", provider)
+
+				now := time.Now().UTC().Truncate(time.Second)
+				expiresOn := now.Add(time.Hour)
+				pin := &brtypes.SnapshotPin{Reason: "cluster upgrade", CreatedOn: now, ExpiresOn: &expiresOn}
+				Expect(PinSnapshot(snapStore, snap5, pin)).To(Succeed())
+
+				// the pin object is not listed as a snapshot
+				snapList, err := snapStore.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snapList.Len()).To(Equal(numberSnapshotsInObjectMap * snapStore.objectCountPerSnapshot))
+				pinnedSnap := FindSnapshot(snapList, snap5.SnapName)
+				Expect(pinnedSnap).NotTo(BeNil())
+				for _, snap := range snapList {
+					Expect(snap.IsPinned).To(Equal(snap == pinnedSnap))
+					Expect(snap.HasMetadata).To(BeFalse())
+				}
+
+				fetchedPin, err := GetSnapshotPin(snapStore, *pinnedSnap)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fetchedPin).To(Equal(pin))
+
+				pins, err := GetActiveSnapshotPins(snapStore, snapList, now)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(pins).To(Equal(map[*brtypes.Snapshot]*brtypes.SnapshotPin{pinnedSnap: pin}))
+				pins, err = GetActiveSnapshotPins(snapStore, snapList, expiresOn)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(pins).To(BeEmpty())
+
+				Expect(UnpinSnapshot(snapStore, *pinnedSnap)).To(Succeed())
+				snapList, err = snapStore.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(snapList.Len()).To(Equal(numberSnapshotsInObjectMap * snapStore.objectCountPerSnapshot))
+				for _, snap := range snapList {
+					Expect(snap.IsPinned).To(BeFalse())
+				}
+			}
+		})
+	})
+
+	Describe("When a full snapshot is deduplicated", func() {
+		It("should list, fetch and delete the snapshot without its chunks", func() {
+			for provider, snapStore := range snapstores {
+				// Create store for mock tests
+				resetObjectMap()
+
+				logrus.Infof("Running mock tests for %s when a full snapshot is deduplicated", provider)
+
+				store := NewDeduplicatingSnapStore(snapStore.SnapStore, prefixV2, &brtypes.SnapstoreConfig{
+					Deduplication:                 true,
+					DeduplicationChunkSize:        brtypes.MinDeduplicationChunkSize,
+					MaxParallelChunkUploads:       2,
+					MaxParallelChunkDownloads:     2,
+					DeduplicationChunkGracePeriod: wrappers.Duration{Duration: time.Nanosecond},
+				})
+				dummyData := make([]byte, 1024*1024)
+				rand.New(rand.NewSource(1)).Read(dummyData)
+				Expect(store.Save(snap4, io.NopCloser(bytes.NewReader(dummyData)))).To(Succeed())
+
+				// the chunks are not listed as snapshots
+				snapList, err := store.List()
+				Expect(err).ShouldNot(HaveOccurred())
+				var deduplicatedSnap *brtypes.Snapshot
+				for _, snap := range snapList {
+					Expect(IsDeduplicationChunk(path.Join(snap.SnapDir, snap.SnapName))).To(BeFalse())
+					if !snap.IsChunk {
+						Expect(deduplicatedSnap).To(BeNil())
+						deduplicatedSnap = snap
+					}
+				}
+				Expect(deduplicatedSnap).NotTo(BeNil())
+				rc, err := store.Fetch(*deduplicatedSnap)
+				Expect(err).ShouldNot(HaveOccurred())
+				fetchedData, err := io.ReadAll(rc)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(rc.Close()).To(Succeed())
+				Expect(fetchedData).To(Equal(dummyData))
+
+				// only the chunks marked for deletion are left behind.
+				Expect(store.Delete(*deduplicatedSnap)).To(Succeed())
+				for key := range objectMap {
+					Expect(IsDeduplicationChunk(key) && !strings.Contains(key, "deletions"+brtypes.DeduplicationChunkSuffix)).To(BeFalse())
+				}
+			}
+		})
+	})
 })
 
 type CredentialTestConfig struct {
@@ -432,6 +591,57 @@ var credentialTestConfigs = []CredentialTestConfig{
 	},
 }
 
+var _ = Describe("Snapstore of snapshot files", func() {
+	var (
+		dir      string
+		otherDir string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		otherDir = GinkgoT().TempDir()
+		for _, file := range []string{
+			path.Join(dir, "Incr-00000101-00000200-1565021794.gz"),
+			path.Join(dir, "Full-00000000-00000100-1565021494.gz"),
+			path.Join(dir, "Full-00000000-00000100-1565021494.gz"+brtypes.SnapshotMetadataSuffix),
+			path.Join(dir, "notes.txt"),
+			path.Join(otherDir, "Incr-00000201-00000300-1565022094.gz"),
+		} {
+			Expect(os.WriteFile(file, []byte(path.Base(file)), 0600)).To(Succeed())
+		}
+	})
+
+	It("should list the snapshot files of the given files and directories in order", func() {
+		store, err := NewFilesSnapStore([]string{dir, path.Join(otherDir, "Incr-00000201-00000300-1565022094.gz"), path.Join(dir, "Full-00000000-00000100-1565021494.gz")})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		snapList, err := store.List()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(snapList).To(HaveLen(3))
+		Expect(snapList[0].SnapName).To(Equal("Full-00000000-00000100-1565021494.gz"))
+		Expect(snapList[0].Prefix).To(Equal(dir))
+		Expect(snapList[1].SnapName).To(Equal("Incr-00000101-00000200-1565021794.gz"))
+		Expect(snapList[2].SnapName).To(Equal("Incr-00000201-00000300-1565022094.gz"))
+		Expect(snapList[2].Prefix).To(Equal(otherDir))
+
+		rc, err := store.Fetch(*snapList[2])
+		Expect(err).ShouldNot(HaveOccurred())
+		data, err := io.ReadAll(rc)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(rc.Close()).To(Succeed())
+		Expect(string(data)).To(Equal("Incr-00000201-00000300-1565022094.gz"))
+
+		Expect(store.Save(*snapList[0], io.NopCloser(bytes.NewReader(nil)))).NotTo(Succeed())
+		Expect(store.Delete(*snapList[0])).NotTo(Succeed())
+		Expect(path.Join(snapList[0].Prefix, snapList[0].SnapName)).To(BeAnExistingFile())
+	})
+
+	It("should fail if a given file does not exist", func() {
+		_, err := NewFilesSnapStore([]string{path.Join(dir, "missing")})
+		Expect(err).Should(HaveOccurred())
+	})
+})
+
 var _ = Describe("Dynamic access credential rotation test for each provider", func() {
 	for _, config := range credentialTestConfigs {
 		config := config
@@ -458,26 +458,36 @@ func (s *SwiftSnapStore) List() (brtypes.SnapList, error) {
 	prefix := path.Join(strings.Join(prefixTokens[:len(prefixTokens)-1], "/"))
 
 	opts := &objects.ListOpts{
-		Full:   false,
+		Full:   true,
 		Prefix: prefix,
 	}
 	// Retrieve a pager (i.e. a paginated collection)
 	pager := objects.List(s.client, s.bucket, opts)
 	var snapList brtypes.SnapList
+	metadata := snapshotMetadataIndex{}
 	// Define an anonymous function to be executed on each page's iteration
 	err := pager.EachPage(func(page pagination.Page) (bool, error) {
 
-		objectList, err := objects.ExtractNames(page)
+		objectList, err := objects.ExtractInfo(page)
 		if err != nil {
 			return false, err
 		}
-		for _, object := range objectList {
+		for _, info := range objectList {
+			object := info.Name
 			if strings.Contains(object, backupVersionV1) || strings.Contains(object, backupVersionV2) {
+				if IsSnapshotMetadata(object) {
+					metadata.add(object)
+					continue
+				}
+				if IsDeduplicationChunk(object) {
+					continue
+				}
 				snap, err := ParseSnapshot(object)
 				if err != nil {
 					// Warning: the file can be a non snapshot file. Do not return error.
 					logrus.Warnf("Invalid snapshot found. Ignoring it:%s, %v", object, err)
 				} else {
+					snap.Size = info.Bytes
 					snapList = append(snapList, snap)
 				}
 			}
@@ -488,11 +498,33 @@ func (s *SwiftSnapStore) List() (brtypes.SnapList, error) {
 	if err != nil {
 		return nil, err
 	}
+	metadata.mark(snapList)
+	addChunkSizes(snapList)
 
 	sort.Sort(snapList)
 	return snapList, nil
 }
 
+// addChunkSizes adds the sizes of the chunks to the size of their snapshot, as the snapshot object
+// is a manifest of its chunks, which hold the data.
+func addChunkSizes(snapList brtypes.SnapList) {
+	snapshots := make(map[string]*brtypes.Snapshot)
+	for _, snap := range snapList {
+		if !snap.IsChunk {
+			snapshots[path.Join(snap.Prefix, snap.SnapDir, snap.SnapName)] = snap
+		}
+	}
+	for _, snap := range snapList {
+		if !snap.IsChunk {
+			continue
+		}
+		chunkParentSnapPath, _ := path.Split(path.Join(snap.Prefix, snap.SnapDir, snap.SnapName))
+		if parent, ok := snapshots[strings.TrimSuffix(chunkParentSnapPath, "/")]; ok {
+			parent.Size += snap.Size
+		}
+	}
+}
+
 func (s *SwiftSnapStore) getSnapshotChunks(snapshot brtypes.Snapshot) (brtypes.SnapList, error) {
 	snaps, err := s.List()
 	if err != nil {
@@ -511,21 +543,52 @@ func (s *SwiftSnapStore) getSnapshotChunks(snapshot brtypes.Snapshot) (brtypes.S
 	return chunkList, nil
 }
 
+// getSegmentNames returns the names of the segment objects of the object of the given name.
+func (s *SwiftSnapStore) getSegmentNames(objectName string) ([]string, error) {
+	prefix := objectName + "/"
+	opts := &objects.ListOpts{
+		Full:   false,
+		Prefix: prefix,
+	}
+	var segmentNames []string
+	err := objects.List(s.client, s.bucket, opts).EachPage(func(page pagination.Page) (bool, error) {
+		objectList, err := objects.ExtractNames(page)
+		if err != nil {
+			return false, err
+		}
+		for _, object := range objectList {
+			if strings.HasPrefix(object, prefix) {
+				segmentNames = append(segmentNames, object)
+			}
+		}
+		return true, nil
+	})
+	return segmentNames, err
+}
+
 // Delete deletes the objects related to the DLO (dynamic large object) from the store.
 // This includes the manifest object as well as the segment objects, as
 // described in https://docs.openstack.org/swift/latest/overview_large_objects.html
 func (s *SwiftSnapStore) Delete(snap brtypes.Snapshot) error {
-	chunks, err := s.getSnapshotChunks(snap)
-	if err != nil {
-		return err
-	}
-
-	if len(chunks) > 0 {
-		var chunkObjectNames []string
+	var chunkObjectNames []string
+	if IsSnapshotMetadata(snap.SnapName) || IsDeduplicationChunk(snap.SnapName) {
+		// The segments of snapshot metadata objects and deduplication chunks are not listed as snapshot chunks.
+		segmentNames, err := s.getSegmentNames(path.Join(snap.Prefix, snap.SnapDir, snap.SnapName))
+		if err != nil {
+			return err
+		}
+		chunkObjectNames = segmentNames
+	} else {
+		chunks, err := s.getSnapshotChunks(snap)
+		if err != nil {
+			return err
+		}
 		for _, chunk := range chunks {
 			chunkObjectNames = append(chunkObjectNames, path.Join(chunk.Prefix, chunk.SnapDir, chunk.SnapName))
 		}
+	}
 
+	if len(chunkObjectNames) > 0 {
 		chunkObjectsDeleteResult := objects.BulkDelete(s.client, s.bucket, chunkObjectNames)
 		if chunkObjectsDeleteResult.Err != nil {
 			// chunkObjectsDeleteResult.Err is the error that occurs while creating the POST request
@@ -126,7 +126,7 @@ func handleDownloadObject(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleListObjectNames creates an HTTP handler at `/testContainer` on the test handler mux that
-// responds with a `List` response when only object names are requested.
+// responds with a `List` response, with the object names or, if requested as json, the object infos.
 func handleListObjectNames(w http.ResponseWriter, r *http.Request) {
 	objectMapMutex.Lock()
 	defer objectMapMutex.Unlock()
@@ -145,6 +145,15 @@ func handleListObjectNames(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	w.Header().Set("X-Container-Object-Count", fmt.Sprint(len(contents)))
+	if strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+		infos := make([]map[string]interface{}, 0, len(contents))
+		for _, key := range contents {
+			infos = append(infos, map[string]interface{}{"name": key, "bytes": len(*objectMap[key])})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain")
 	list := strings.Join(contents, "\n")
 	w.Write([]byte(list))
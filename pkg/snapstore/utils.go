@@ -61,6 +61,19 @@ func GetSnapstore(config *brtypes.SnapstoreConfig) (brtypes.SnapStore, error) {
 		config.MaxParallelChunkUploads = 5
 	}
 
+	if config.DeduplicationChunkSize <= 0 {
+		config.DeduplicationChunkSize = brtypes.DefaultDeduplicationChunkSize
+	}
+
+	if config.MaxParallelChunkDownloads <= 0 {
+		config.MaxParallelChunkDownloads = brtypes.DefaultMaxParallelChunkDownloads
+	}
+
+	var (
+		store  brtypes.SnapStore
+		prefix = config.Prefix
+		err    error
+	)
 	switch config.Provider {
 	case brtypes.SnapstoreProviderLocal, "":
 		if config.Container == "" {
@@ -68,32 +81,39 @@ func GetSnapstore(config *brtypes.SnapstoreConfig) (brtypes.SnapStore, error) {
 		}
 		if strings.HasPrefix(config.Container, "../../../test/output") {
 			// To be used only by unit tests
-			return NewLocalSnapStore(path.Join(config.Container, config.Prefix))
-		}
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, err
+			prefix = path.Join(config.Container, config.Prefix)
+		} else {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			prefix = path.Join(homeDir, config.Container, config.Prefix)
 		}
-		return NewLocalSnapStore(path.Join(homeDir, config.Container, config.Prefix))
+		store, err = NewLocalSnapStore(prefix)
 	case brtypes.SnapstoreProviderS3:
-		return NewS3SnapStore(config)
+		store, err = NewS3SnapStore(config)
 	case brtypes.SnapstoreProviderABS:
-		return NewABSSnapStore(config)
+		store, err = NewABSSnapStore(config)
 	case brtypes.SnapstoreProviderGCS:
-		return NewGCSSnapStore(config)
+		store, err = NewGCSSnapStore(config)
 	case brtypes.SnapstoreProviderSwift:
-		return NewSwiftSnapStore(config)
+		store, err = NewSwiftSnapStore(config)
 	case brtypes.SnapstoreProviderOSS:
-		return NewOSSSnapStore(config)
+		store, err = NewOSSSnapStore(config)
 	case brtypes.SnapstoreProviderECS:
-		return NewECSSnapStore(config)
+		store, err = NewECSSnapStore(config)
 	case brtypes.SnapstoreProviderOCS:
-		return NewOCSSnapStore(config)
+		store, err = NewOCSSnapStore(config)
 	case brtypes.SnapstoreProviderFakeFailed:
 		return NewFailedSnapStore(), nil
 	default:
 		return nil, fmt.Errorf("unsupported storage provider : %s", config.Provider)
 	}
+	if err != nil {
+		return nil, err
+	}
+	// Deduplicated snapshots are read and garbage collected also if deduplication is disabled.
+	return NewDeduplicatingSnapStore(store, prefix, config), nil
 }
 
 // GetEnvVarOrError returns the value of specified environment variable or terminates if it's not defined.
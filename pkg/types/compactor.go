@@ -37,6 +37,9 @@ type CompactorConfig struct {
 	EnabledLeaseRenewal    bool              `json:"enabledLeaseRenewal"`
 	// see https://github.com/gardener/etcd-druid/issues/648
 	MetricsScrapeWaitDuration wrappers.Duration `json:"metricsScrapeWaitDuration,omitempty"`
+	// StripFilteredKeys removes the keys which are not selected by the key filter of a partial backup
+	// from the compacted snapshot, since they are only as recent as the base full snapshot.
+	StripFilteredKeys bool `json:"stripFilteredKeys,omitempty"`
 }
 
 // NewCompactorConfig returns the CompactorConfig.
@@ -61,6 +64,7 @@ func (c *CompactorConfig) AddFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.DeltaSnapshotLeaseName, "delta-snapshot-lease-name", c.DeltaSnapshotLeaseName, "delta snapshot lease name")
 	fs.BoolVar(&c.EnabledLeaseRenewal, "enable-snapshot-lease-renewal", c.EnabledLeaseRenewal, "Allows compactor to renew the full snapshot lease when successfully compacted snapshot is uploaded")
 	fs.DurationVar(&c.MetricsScrapeWaitDuration.Duration, "metrics-scrape-wait-duration", c.MetricsScrapeWaitDuration.Duration, "The duration to wait for after compaction is completed, to allow Prometheus metrics to be scraped")
+	fs.BoolVar(&c.StripFilteredKeys, "strip-filtered-keys", c.StripFilteredKeys, "remove the keys not selected by the key filter of a partial backup from the compacted snapshot")
 }
 
 // Validate validates the config.
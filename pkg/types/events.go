@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// defaultEventSource is the default source of the events.
+	defaultEventSource = "etcd-backup-restore"
+	// defaultEventBufferSize is the default number of events buffered for delivery.
+	defaultEventBufferSize = 100
+	// defaultEventMaxRetries is the default number of retries of a failed delivery of an event.
+	defaultEventMaxRetries = 5
+	// defaultEventRetryPeriod is the default period after which a failed delivery of an event is first retried.
+	defaultEventRetryPeriod = 1 * time.Second
+	// defaultEventTimeout is the default timeout of the delivery of an event.
+	defaultEventTimeout = 10 * time.Second
+)
+
+// EventsConfig holds the configuration of the notifications of backup lifecycle events.
+type EventsConfig struct {
+	// Source is the source of the events, e.g. the name of the etcd cluster.
+	Source string `json:"source,omitempty"`
+	// HTTPSinkURL is the URL to which the events are posted. Events are not posted if it is empty.
+	HTTPSinkURL string `json:"httpSinkURL,omitempty"`
+	// HTTPSinkHeaders are additional HTTP headers of the requests posting the events.
+	HTTPSinkHeaders map[string]string `json:"httpSinkHeaders,omitempty"`
+	// FileSinkPath is the path of a local file to which the events are appended. Events are not written if it is empty.
+	FileSinkPath string `json:"fileSinkPath,omitempty"`
+	// BufferSize is the number of events buffered for delivery, beyond which events are dropped.
+	BufferSize int `json:"bufferSize,omitempty"`
+	// MaxRetries is the number of retries of a failed delivery of an event.
+	MaxRetries uint `json:"maxRetries,omitempty"`
+	// RetryPeriod is the period after which a failed delivery is first retried. It is doubled after each retry.
+	RetryPeriod wrappers.Duration `json:"retryPeriod,omitempty"`
+	// Timeout is the timeout of the delivery of an event.
+	Timeout wrappers.Duration `json:"timeout,omitempty"`
+}
+
+// NewEventsConfig returns the events config.
+func NewEventsConfig() *EventsConfig {
+	return &EventsConfig{
+		Source:      defaultEventSource,
+		BufferSize:  defaultEventBufferSize,
+		MaxRetries:  defaultEventMaxRetries,
+		RetryPeriod: wrappers.Duration{Duration: defaultEventRetryPeriod},
+		Timeout:     wrappers.Duration{Duration: defaultEventTimeout},
+	}
+}
+
+// AddFlags adds the flags to flagset.
+func (c *EventsConfig) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Source, "events-source", c.Source, "source of the backup lifecycle events, e.g. the name of the etcd cluster")
+	fs.StringVar(&c.HTTPSinkURL, "events-http-url", c.HTTPSinkURL, "URL to which backup lifecycle events are posted as CloudEvents")
+	fs.StringVar(&c.FileSinkPath, "events-file", c.FileSinkPath, "path of a local file to which backup lifecycle events are appended as CloudEvents, one per line")
+	fs.IntVar(&c.BufferSize, "events-buffer-size", c.BufferSize, "number of events buffered for delivery, beyond which events are dropped")
+	fs.UintVar(&c.MaxRetries, "events-max-retries", c.MaxRetries, "number of retries of a failed delivery of an event")
+	fs.DurationVar(&c.RetryPeriod.Duration, "events-retry-period", c.RetryPeriod.Duration, "period after which a failed delivery of an event is first retried, doubled after each retry")
+	fs.DurationVar(&c.Timeout.Duration, "events-timeout", c.Timeout.Duration, "timeout of the delivery of an event")
+}
+
+// IsEnabled returns true if a sink of the events is configured.
+func (c *EventsConfig) IsEnabled() bool {
+	return len(c.HTTPSinkURL) != 0 || len(c.FileSinkPath) != 0
+}
+
+// Validate validates the config.
+func (c *EventsConfig) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+	if len(c.Source) == 0 {
+		return fmt.Errorf("source of the events should not be empty")
+	}
+	if len(c.HTTPSinkURL) != 0 {
+		if u, err := url.Parse(c.HTTPSinkURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid events http url %s", c.HTTPSinkURL)
+		}
+	}
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("events buffer size should be greater than zero")
+	}
+	if c.RetryPeriod.Duration <= 0 {
+		return fmt.Errorf("events retry period should be greater than zero")
+	}
+	if c.Timeout.Duration <= 0 {
+		return fmt.Errorf("events timeout should be greater than zero")
+	}
+	return nil
+}
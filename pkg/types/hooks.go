@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+)
+
+// HookStage is the stage of an operation at which a hook is run.
+type HookStage string
+
+const (
+	// HookStagePreFullSnapshot is the stage before a full snapshot is taken.
+	HookStagePreFullSnapshot HookStage = "PreFullSnapshot"
+	// HookStagePostFullSnapshot is the stage after a full snapshot is uploaded.
+	HookStagePostFullSnapshot HookStage = "PostFullSnapshot"
+	// HookStagePreDeltaSnapshot is the stage before a delta snapshot is taken.
+	HookStagePreDeltaSnapshot HookStage = "PreDeltaSnapshot"
+	// HookStagePostDeltaSnapshot is the stage after a delta snapshot is uploaded.
+	HookStagePostDeltaSnapshot HookStage = "PostDeltaSnapshot"
+	// HookStagePreSnapshotDelete is the stage before a snapshot is deleted by the garbage collector.
+	HookStagePreSnapshotDelete HookStage = "PreSnapshotDelete"
+	// HookStagePostSnapshotDelete is the stage after a snapshot is deleted by the garbage collector.
+	HookStagePostSnapshotDelete HookStage = "PostSnapshotDelete"
+	// HookStagePreRestore is the stage before a restore.
+	HookStagePreRestore HookStage = "PreRestore"
+	// HookStagePostRestore is the stage after a successful restore.
+	HookStagePostRestore HookStage = "PostRestore"
+
+	// HookFailurePolicyIgnore logs the failure of a hook and carries on with the operation.
+	HookFailurePolicyIgnore = "Ignore"
+	// HookFailurePolicyAbort fails the operation if a hook fails. A failed pre hook prevents the operation,
+	// and a failed post hook makes the completed operation report a failure, except for the post snapshot
+	// hooks, whose failure is only logged as the uploaded snapshot can't be undone.
+	HookFailurePolicyAbort = "Abort"
+
+	// DefaultHookTimeout is the default timeout of a hook.
+	DefaultHookTimeout = 30 * time.Second
+)
+
+var (
+	// SnapshotterHookStages are the stages at which the hooks of the snapshotter are run.
+	SnapshotterHookStages = []HookStage{
+		HookStagePreFullSnapshot,
+		HookStagePostFullSnapshot,
+		HookStagePreDeltaSnapshot,
+		HookStagePostDeltaSnapshot,
+		HookStagePreSnapshotDelete,
+		HookStagePostSnapshotDelete,
+	}
+	// RestorationHookStages are the stages at which the hooks of the restorer are run.
+	RestorationHookStages = []HookStage{
+		HookStagePreRestore,
+		HookStagePostRestore,
+	}
+)
+
+// HookConfig holds the configuration of a hook, which is run at the given stages of an operation.
+// Exactly one of Exec and Webhook has to be set.
+type HookConfig struct {
+	// Name is the name of the hook.
+	Name string `json:"name"`
+	// Stages are the stages at which the hook is run.
+	Stages []HookStage `json:"stages"`
+	// Exec runs a command, which gets the metadata of the snapshot as JSON on its standard input.
+	Exec *ExecHookConfig `json:"exec,omitempty"`
+	// Webhook posts the metadata of the snapshot as JSON to a URL.
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+	// Timeout is the timeout of the hook. Defaults to DefaultHookTimeout.
+	Timeout *wrappers.Duration `json:"timeout,omitempty"`
+	// FailurePolicy defines what happens if the hook fails, either Ignore or Abort. Defaults to Ignore.
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+}
+
+// ExecHookConfig holds the configuration of a hook which runs a command.
+type ExecHookConfig struct {
+	// Command is the command to run, followed by its arguments.
+	Command []string `json:"command"`
+}
+
+// WebhookConfig holds the configuration of a hook which posts to a URL.
+type WebhookConfig struct {
+	// URL is the URL to post to.
+	URL string `json:"url"`
+	// Headers are additional HTTP headers of the request.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// GetTimeout returns the timeout of the hook.
+func (h *HookConfig) GetTimeout() time.Duration {
+	if h.Timeout == nil {
+		return DefaultHookTimeout
+	}
+	return h.Timeout.Duration
+}
+
+// IsAbortOnFailure returns true if the operation fails if the hook fails.
+func (h *HookConfig) IsAbortOnFailure() bool {
+	return h.FailurePolicy == HookFailurePolicyAbort
+}
+
+// HasStage returns true if the hook is run at the given stage.
+func (h *HookConfig) HasStage(stage HookStage) bool {
+	for _, s := range h.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the hook, which may only be run at the given stages.
+func (h *HookConfig) Validate(allowedStages []HookStage) error {
+	if len(h.Name) == 0 {
+		return fmt.Errorf("hook name should not be empty")
+	}
+	if len(h.Stages) == 0 {
+		return fmt.Errorf("stages of hook %s should not be empty", h.Name)
+	}
+	for _, stage := range h.Stages {
+		allowed := false
+		for _, s := range allowedStages {
+			allowed = allowed || s == stage
+		}
+		if !allowed {
+			return fmt.Errorf("invalid stage %s of hook %s, should be one of %v", stage, h.Name, allowedStages)
+		}
+	}
+	if (h.Exec == nil) == (h.Webhook == nil) {
+		return fmt.Errorf("exactly one of exec and webhook should be set for hook %s", h.Name)
+	}
+	if h.Exec != nil && len(h.Exec.Command) == 0 {
+		return fmt.Errorf("command of hook %s should not be empty", h.Name)
+	}
+	if h.Webhook != nil {
+		if u, err := url.Parse(h.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid webhook url %s of hook %s", h.Webhook.URL, h.Name)
+		}
+	}
+	if h.Timeout != nil && h.Timeout.Duration <= 0 {
+		return fmt.Errorf("timeout of hook %s should be greater than zero", h.Name)
+	}
+	if len(h.FailurePolicy) != 0 && h.FailurePolicy != HookFailurePolicyIgnore && h.FailurePolicy != HookFailurePolicyAbort {
+		return fmt.Errorf("invalid failure policy %s of hook %s, should be either %s or %s", h.FailurePolicy, h.Name, HookFailurePolicyIgnore, HookFailurePolicyAbort)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyPrefixFilter selects the etcd keys which are backed up.
+// A key is selected if it matches one of the include prefixes, or if no include prefixes
+// are configured, and if it does not match any of the exclude prefixes.
+type KeyPrefixFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// IsEmpty returns true if the filter selects all keys.
+func (f *KeyPrefixFilter) IsEmpty() bool {
+	return f == nil || (len(f.Include) == 0 && len(f.Exclude) == 0)
+}
+
+// Matches returns true if the given key is selected by the filter.
+func (f *KeyPrefixFilter) Matches(key []byte) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	k := string(key)
+	for _, prefix := range f.Exclude {
+		if strings.HasPrefix(k, prefix) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, prefix := range f.Include {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the filter.
+func (f *KeyPrefixFilter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, prefix := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if len(prefix) == 0 {
+			return fmt.Errorf("key prefix should not be empty")
+		}
+	}
+	return nil
+}
+
+// String returns a human readable representation of the filter.
+func (f *KeyPrefixFilter) String() string {
+	if f.IsEmpty() {
+		return "all keys"
+	}
+	return fmt.Sprintf("include: %v, exclude: %v", f.Include, f.Exclude)
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// KeyConflictPolicyAbort restores no key at all, and fails, if any key to restore exists in the etcd cluster with a different value.
+	KeyConflictPolicyAbort = "abort"
+	// KeyConflictPolicySkip is an alias of KeyConflictPolicyAbort, which skips all the keys if any key conflicts.
+	KeyConflictPolicySkip = "skip"
+	// KeyConflictPolicyOverwrite overwrites the keys which exist in the etcd cluster with a different value.
+	KeyConflictPolicyOverwrite = "overwrite"
+	// KeyConflictPolicyOnlyMissing restores the keys which are missing in the etcd cluster, and keeps the others as they are.
+	KeyConflictPolicyOnlyMissing = "only-missing"
+
+	// KeyRestoreActionCreate is the action on a key which is missing in the etcd cluster.
+	KeyRestoreActionCreate = "create"
+	// KeyRestoreActionUpdate is the action on a key which exists in the etcd cluster with a different value, and is overwritten.
+	KeyRestoreActionUpdate = "update"
+	// KeyRestoreActionSkip is the action on a key which is not restored because of the conflict policy.
+	KeyRestoreActionSkip = "skip"
+)
+
+// KeyRestoreOptions holds all configurable options of the restoration of keys.
+type KeyRestoreOptions struct {
+	*RestoreOptions
+	*KeyRestorerConfig
+}
+
+// KeyRestorerConfig holds all configuration options related to the `restore-keys` subcommand.
+type KeyRestorerConfig struct {
+	// Prefixes are the prefixes of the keys which are restored.
+	Prefixes []string `json:"prefixes"`
+	// ConflictPolicy decides about the keys which exist in the etcd cluster with a different value.
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+	// DryRun only computes the changes to the etcd cluster, without applying them.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// NewKeyRestorerConfig returns the KeyRestorerConfig.
+func NewKeyRestorerConfig() *KeyRestorerConfig {
+	return &KeyRestorerConfig{
+		ConflictPolicy: KeyConflictPolicyAbort,
+	}
+}
+
+// AddFlags adds the flags to flagset.
+func (c *KeyRestorerConfig) AddFlags(fs *flag.FlagSet) {
+	fs.StringArrayVar(&c.Prefixes, "prefix", c.Prefixes, "prefix of the keys to restore into the etcd cluster, can be repeated")
+	fs.StringVar(&c.ConflictPolicy, "conflict-policy", c.ConflictPolicy, "policy for the keys which exist in the etcd cluster with a different value: 'abort' (or its alias 'skip') restores no key at all and fails, 'overwrite' overwrites them, 'only-missing' restores the missing keys only")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "only print the changes to the etcd cluster, without applying them")
+}
+
+// Validate validates the config.
+func (c *KeyRestorerConfig) Validate() error {
+	if len(c.Prefixes) == 0 {
+		return fmt.Errorf("at least one prefix of the keys to restore is required")
+	}
+	for _, prefix := range c.Prefixes {
+		if len(prefix) == 0 {
+			return fmt.Errorf("prefixes of the keys to restore must not be empty")
+		}
+	}
+	switch c.ConflictPolicy {
+	case KeyConflictPolicyAbort, KeyConflictPolicySkip, KeyConflictPolicyOverwrite, KeyConflictPolicyOnlyMissing:
+	default:
+		return fmt.Errorf("unsupported conflict policy %s", c.ConflictPolicy)
+	}
+	return nil
+}
+
+// AbortsOnConflict returns true if no key is restored if any key exists in the etcd cluster with a different value.
+func (c *KeyRestorerConfig) AbortsOnConflict() bool {
+	return c.ConflictPolicy == KeyConflictPolicyAbort || c.ConflictPolicy == KeyConflictPolicySkip
+}
+
+// KeyDiff is the difference of a key between the backup and the etcd cluster.
+type KeyDiff struct {
+	// Key is the key.
+	Key string `json:"key"`
+	// Action is the action on the key: create, update or skip.
+	Action string `json:"action"`
+	// BackupModRevision is the revision of the last modification of the key in the backup.
+	BackupModRevision int64 `json:"backupModRevision"`
+	// ModRevision is the revision of the last modification of the key in the etcd cluster, if the key exists there.
+	ModRevision int64 `json:"modRevision,omitempty"`
+	// Applied is set if the key was put into the etcd cluster.
+	Applied bool `json:"applied,omitempty"`
+}
+
+// KeyRestoreResult is the result of the restoration of keys into an etcd cluster.
+type KeyRestoreResult struct {
+	// Revision is the revision of the restored backup.
+	Revision int64 `json:"revision"`
+	// Prefixes are the prefixes of the restored keys.
+	Prefixes []string `json:"prefixes"`
+	// ConflictPolicy is the policy applied to the keys which exist in the etcd cluster with a different value.
+	ConflictPolicy string `json:"conflictPolicy"`
+	// DryRun is set if the changes were not applied.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Diffs are the keys which differ between the backup and the etcd cluster.
+	Diffs []KeyDiff `json:"diffs"`
+	// Unchanged is the number of keys which are equal in the backup and the etcd cluster.
+	Unchanged int `json:"unchanged"`
+}
+
+// Count returns the number of differing keys with the given action.
+func (r *KeyRestoreResult) Count(action string) int {
+	count := 0
+	for _, diff := range r.Diffs {
+		if diff.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// CountApplied returns the number of differing keys which were put into the etcd cluster.
+func (r *KeyRestoreResult) CountApplied() int {
+	count := 0
+	for _, diff := range r.Diffs {
+		if diff.Applied {
+			count++
+		}
+	}
+	return count
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/etcdutil/client"
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
 	flag "github.com/spf13/pflag"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/pkg/types"
@@ -27,6 +28,19 @@ const (
 	defaultEmbeddedEtcdQuotaBytes   = 8 * 1024 * 1024 * 1024 //8Gib
 	defaultAutoCompactionMode       = "periodic"             // only 2 mode is supported: 'periodic' or 'revision'
 	defaultAutoCompactionRetention  = "30m"
+	defaultLeaseTTL                 = time.Hour
+
+	// DeltaSnapshotApplyModeEmbeddedEtcd applies the delta snapshots by replaying their events through an embedded etcd.
+	DeltaSnapshotApplyModeEmbeddedEtcd = "embedded-etcd"
+	// DeltaSnapshotApplyModeOffline applies the delta snapshots by writing their events directly into the restored database.
+	DeltaSnapshotApplyModeOffline = "offline"
+
+	// DeltaSnapshotVerificationNone verifies each delta snapshot only when it is applied.
+	DeltaSnapshotVerificationNone = "none"
+	// DeltaSnapshotVerificationFail verifies all delta snapshots before applying any, and fails if one of them is not consistent.
+	DeltaSnapshotVerificationFail = "fail"
+	// DeltaSnapshotVerificationTruncate verifies all delta snapshots before applying any, and applies them only up to the first one which is not consistent.
+	DeltaSnapshotVerificationTruncate = "truncate"
 )
 
 // NewClientFactoryFunc allows to define how to create a client.Factory
@@ -63,25 +77,48 @@ type RestorationConfig struct {
 	EmbeddedEtcdQuotaBytes   int64    `json:"embeddedEtcdQuotaBytes,omitempty"`
 	AutoCompactionMode       string   `json:"autoCompactionMode,omitempty"`
 	AutoCompactionRetention  string   `json:"autoCompactionRetention,omitempty"`
+	// TargetRevision is the revision up to which the backup is restored. If 0, the backup is restored up to its latest revision.
+	TargetRevision int64 `json:"targetRevision,omitempty"`
+	// TargetTime is the time in RFC 3339 format up to which the backup is restored. If empty, the backup is restored up to its latest revision.
+	TargetTime string `json:"targetTime,omitempty"`
+	// SnapshotSelector selects the base full snapshot and the delta snapshots the backup is restored from.
+	SnapshotSelector SnapshotSelector `json:"snapshotSelector,omitempty"`
+	// Hooks are run around restores.
+	Hooks []HookConfig `json:"hooks,omitempty"`
+	// DeltaSnapshotApplyMode is the way the delta snapshots are applied over the base snapshot: embedded-etcd or offline.
+	DeltaSnapshotApplyMode string `json:"deltaSnapshotApplyMode,omitempty"`
+	// DeltaSnapshotVerification is the verification of all delta snapshots before applying any: none, fail or truncate.
+	DeltaSnapshotVerification string `json:"deltaSnapshotVerification,omitempty"`
+	// PreserveLeases re-creates the leases of the restored keys with their remaining TTLs. It requires the offline delta snapshot apply mode.
+	PreserveLeases bool `json:"preserveLeases,omitempty"`
+	// DefaultLeaseTTL is the TTL of the re-created leases which are missing in the base snapshot, since the delta snapshots do not record the grants of leases.
+	DefaultLeaseTTL wrappers.Duration `json:"defaultLeaseTTL,omitempty"`
+	// BumpRevision is the amount by which the revision of the restored database is bumped after the restoration.
+	BumpRevision int64 `json:"bumpRevision,omitempty"`
+	// MarkCompacted marks the restored database as compacted at its revision, after bumping it if BumpRevision is set.
+	MarkCompacted bool `json:"markCompacted,omitempty"`
 }
 
 // NewRestorationConfig returns the restoration config.
 func NewRestorationConfig() *RestorationConfig {
 	return &RestorationConfig{
-		InitialCluster:           initialClusterFromName(defaultName),
-		InitialClusterToken:      defaultInitialClusterToken,
-		DataDir:                  fmt.Sprintf("%s.etcd", defaultName),
-		TempSnapshotsDir:         fmt.Sprintf("%s.restoration.tmp", defaultName),
-		InitialAdvertisePeerURLs: []string{defaultInitialAdvertisePeerURLs},
-		Name:                     defaultName,
-		SkipHashCheck:            false,
-		MaxFetchers:              defaultMaxFetchers,
-		MaxCallSendMsgSize:       defaultMaxCallSendMsgSize,
-		MaxRequestBytes:          defaultMaxRequestBytes,
-		MaxTxnOps:                defaultMaxTxnOps,
-		EmbeddedEtcdQuotaBytes:   int64(defaultEmbeddedEtcdQuotaBytes),
-		AutoCompactionMode:       defaultAutoCompactionMode,
-		AutoCompactionRetention:  defaultAutoCompactionRetention,
+		InitialCluster:            initialClusterFromName(defaultName),
+		InitialClusterToken:       defaultInitialClusterToken,
+		DataDir:                   fmt.Sprintf("%s.etcd", defaultName),
+		TempSnapshotsDir:          fmt.Sprintf("%s.restoration.tmp", defaultName),
+		InitialAdvertisePeerURLs:  []string{defaultInitialAdvertisePeerURLs},
+		Name:                      defaultName,
+		SkipHashCheck:             false,
+		MaxFetchers:               defaultMaxFetchers,
+		MaxCallSendMsgSize:        defaultMaxCallSendMsgSize,
+		MaxRequestBytes:           defaultMaxRequestBytes,
+		MaxTxnOps:                 defaultMaxTxnOps,
+		EmbeddedEtcdQuotaBytes:    int64(defaultEmbeddedEtcdQuotaBytes),
+		AutoCompactionMode:        defaultAutoCompactionMode,
+		AutoCompactionRetention:   defaultAutoCompactionRetention,
+		DeltaSnapshotApplyMode:    DeltaSnapshotApplyModeEmbeddedEtcd,
+		DeltaSnapshotVerification: DeltaSnapshotVerificationNone,
+		DefaultLeaseTTL:           wrappers.Duration{Duration: defaultLeaseTTL},
 	}
 }
 
@@ -101,6 +138,18 @@ func (c *RestorationConfig) AddFlags(fs *flag.FlagSet) {
 	fs.Int64Var(&c.EmbeddedEtcdQuotaBytes, "embedded-etcd-quota-bytes", c.EmbeddedEtcdQuotaBytes, "maximum backend quota for the embedded etcd used for applying delta snapshots")
 	fs.StringVar(&c.AutoCompactionMode, "auto-compaction-mode", c.AutoCompactionMode, "mode for auto-compaction: 'periodic' for duration based retention. 'revision' for revision number based retention.")
 	fs.StringVar(&c.AutoCompactionRetention, "auto-compaction-retention", c.AutoCompactionRetention, "Auto-compaction retention length.")
+	fs.Int64Var(&c.TargetRevision, "target-revision", c.TargetRevision, "revision up to which the backup is restored, including the events of this revision. If set to 0, the backup is restored up to its latest revision.")
+	fs.StringVar(&c.TargetTime, "target-time", c.TargetTime, "time in RFC 3339 format up to which the backup is restored, including the events recorded at this time. If empty, the backup is restored up to its latest revision.")
+	fs.StringVar(&c.SnapshotSelector.BaseSnapshotName, "base-snapshot", c.SnapshotSelector.BaseSnapshotName, "name of the full snapshot to restore from. If empty, the latest full snapshot up to the restore target is used.")
+	fs.Int64Var(&c.SnapshotSelector.BaseSnapshotRevision, "base-snapshot-revision", c.SnapshotSelector.BaseSnapshotRevision, "revision of the full snapshot to restore from. If set to 0, the latest full snapshot up to the restore target is used.")
+	fs.IntVar(&c.SnapshotSelector.MaxDeltaSnapshots, "max-delta-snapshots", c.SnapshotSelector.MaxDeltaSnapshots, "maximum number of delta snapshots applied over the base snapshot. If set to 0, all of them are applied.")
+	fs.BoolVar(&c.SnapshotSelector.FallbackToPreviousSnapshot, "fallback-to-previous-snapshot", c.SnapshotSelector.FallbackToPreviousSnapshot, "restore from the previous full snapshot and its delta snapshots if the hash verification of the base snapshot fails")
+	fs.StringVar(&c.DeltaSnapshotApplyMode, "delta-snapshot-apply-mode", c.DeltaSnapshotApplyMode, "way the delta snapshots are applied: 'embedded-etcd' replays their events through an embedded etcd, 'offline' writes them directly into the restored database, which is faster and preserves their revisions")
+	fs.StringVar(&c.DeltaSnapshotVerification, "delta-snapshot-verification", c.DeltaSnapshotVerification, "verification of all delta snapshots, fetched in parallel, before applying any: 'none' verifies each of them only when it is applied, 'fail' fails if one of them is not consistent, 'truncate' applies them only up to the first one which is not consistent")
+	fs.BoolVar(&c.PreserveLeases, "preserve-leases", c.PreserveLeases, "re-create the leases of the restored keys with their remaining TTLs, so that they expire as in the backed up cluster. Requires the offline delta snapshot apply mode.")
+	fs.DurationVar(&c.DefaultLeaseTTL.Duration, "default-lease-ttl", c.DefaultLeaseTTL.Duration, "TTL of the re-created leases which are missing in the base snapshot, if leases are preserved")
+	fs.Int64Var(&c.BumpRevision, "bump-revision", c.BumpRevision, "amount by which the revision of the restored database is bumped, so that it is higher than any revision seen by the clients of the backed up cluster")
+	fs.BoolVar(&c.MarkCompacted, "mark-compacted", c.MarkCompacted, "mark the restored database as compacted at its revision, after bumping it if bump-revision is set, so that watchers are forced to relist")
 }
 
 // Validate validates the config.
@@ -123,11 +172,159 @@ func (c *RestorationConfig) Validate() error {
 	if c.AutoCompactionMode != "periodic" && c.AutoCompactionMode != "revision" {
 		return fmt.Errorf("UnSupported auto-compaction-mode")
 	}
+	if c.TargetRevision < 0 {
+		return fmt.Errorf("target revision should not be less than zero")
+	}
+	if len(c.TargetTime) != 0 {
+		if c.TargetRevision != 0 {
+			return fmt.Errorf("only one of target revision and target time can be set")
+		}
+		if _, err := time.Parse(time.RFC3339, c.TargetTime); err != nil {
+			return fmt.Errorf("invalid target time %s: %v", c.TargetTime, err)
+		}
+	}
+	if err := c.SnapshotSelector.Validate(); err != nil {
+		return err
+	}
+	switch c.DeltaSnapshotApplyMode {
+	case "", DeltaSnapshotApplyModeEmbeddedEtcd, DeltaSnapshotApplyModeOffline:
+	default:
+		return fmt.Errorf("unsupported delta snapshot apply mode %s", c.DeltaSnapshotApplyMode)
+	}
+	switch c.DeltaSnapshotVerification {
+	case "", DeltaSnapshotVerificationNone, DeltaSnapshotVerificationFail, DeltaSnapshotVerificationTruncate:
+	default:
+		return fmt.Errorf("unsupported delta snapshot verification %s", c.DeltaSnapshotVerification)
+	}
+	if c.PreserveLeases {
+		if c.DeltaSnapshotApplyMode != DeltaSnapshotApplyModeOffline {
+			return fmt.Errorf("preserving leases requires the %s delta snapshot apply mode", DeltaSnapshotApplyModeOffline)
+		}
+		if c.DefaultLeaseTTL.Duration < time.Second {
+			return fmt.Errorf("default lease TTL should be at least one second")
+		}
+	}
+	if c.BumpRevision < 0 {
+		return fmt.Errorf("bump revision should not be less than zero")
+	}
+	for i := range c.Hooks {
+		if err := c.Hooks[i].Validate(RestorationHookStages); err != nil {
+			return err
+		}
+	}
 	c.DataDir = path.Clean(c.DataDir)
 	c.TempSnapshotsDir = path.Clean(c.TempSnapshotsDir)
 	return nil
 }
 
+// RestoreTarget returns the point up to which the backup is restored. The config must be validated.
+func (c *RestorationConfig) RestoreTarget() RestoreTarget {
+	target := RestoreTarget{Revision: c.TargetRevision}
+	if len(c.TargetTime) != 0 {
+		target.Time, _ = time.Parse(time.RFC3339, c.TargetTime)
+	}
+	return target
+}
+
+// RestoreTarget is the point up to which a backup is restored, given either by a revision or by a time.
+// The zero value restores the backup up to its latest revision.
+type RestoreTarget struct {
+	// Revision is the last revision which is restored.
+	Revision int64 `json:"revision,omitempty"`
+	// Time is the time of the last events which are restored.
+	Time time.Time `json:"time,omitempty"`
+}
+
+// IsLatest returns true if the backup is restored up to its latest revision.
+func (t RestoreTarget) IsLatest() bool {
+	return t.Revision == 0 && t.Time.IsZero()
+}
+
+// Includes returns true if the given event is restored.
+func (t RestoreTarget) Includes(event *Event) bool {
+	if t.Revision != 0 && event.EtcdEvent.Kv.ModRevision > t.Revision {
+		return false
+	}
+	return t.Time.IsZero() || !event.Time.After(t.Time)
+}
+
+// IncludesSnapshot returns true if all the events of the given snapshot are restored.
+func (t RestoreTarget) IncludesSnapshot(snap *Snapshot) bool {
+	if t.Revision != 0 && snap.LastRevision > t.Revision {
+		return false
+	}
+	return t.Time.IsZero() || !snap.CreatedOn.After(t.Time)
+}
+
+// String returns a description of the target.
+func (t RestoreTarget) String() string {
+	switch {
+	case t.Revision != 0:
+		return fmt.Sprintf("revision %d", t.Revision)
+	case !t.Time.IsZero():
+		return fmt.Sprintf("time %s", t.Time.Format(time.RFC3339))
+	default:
+		return "latest revision"
+	}
+}
+
+// SnapshotSelector selects the base full snapshot of a restore, and limits the delta snapshots applied over it.
+// The zero value selects the latest full snapshot up to the restore target, and all the delta snapshots after it.
+type SnapshotSelector struct {
+	// BaseSnapshotName is the name of the base full snapshot.
+	BaseSnapshotName string `json:"baseSnapshotName,omitempty"`
+	// BaseSnapshotRevision is the revision of the base full snapshot.
+	BaseSnapshotRevision int64 `json:"baseSnapshotRevision,omitempty"`
+	// MaxDeltaSnapshots is the maximum number of delta snapshots applied over the base snapshot. If 0, all of them are applied.
+	MaxDeltaSnapshots int `json:"maxDeltaSnapshots,omitempty"`
+	// FallbackToPreviousSnapshot restores from the previous full snapshot and its delta snapshots, if the hash verification
+	// of the base snapshot fails.
+	FallbackToPreviousSnapshot bool `json:"fallbackToPreviousSnapshot,omitempty"`
+}
+
+// Validate validates the snapshot selector.
+func (s *SnapshotSelector) Validate() error {
+	if s.BaseSnapshotRevision < 0 {
+		return fmt.Errorf("base snapshot revision should not be less than zero")
+	}
+	if len(s.BaseSnapshotName) != 0 && s.BaseSnapshotRevision != 0 {
+		return fmt.Errorf("only one of base snapshot name and base snapshot revision can be set")
+	}
+	if s.MaxDeltaSnapshots < 0 {
+		return fmt.Errorf("max delta snapshots should not be less than zero")
+	}
+	return nil
+}
+
+// IsLatest returns true if the latest full snapshot and all the delta snapshots after it are selected.
+func (s SnapshotSelector) IsLatest() bool {
+	return len(s.BaseSnapshotName) == 0 && s.BaseSnapshotRevision == 0 && s.MaxDeltaSnapshots == 0
+}
+
+// Selects returns true if the given full snapshot is the selected base snapshot.
+func (s SnapshotSelector) Selects(snap *Snapshot) bool {
+	switch {
+	case len(s.BaseSnapshotName) != 0:
+		return snap.SnapName == s.BaseSnapshotName
+	case s.BaseSnapshotRevision != 0:
+		return snap.LastRevision == s.BaseSnapshotRevision
+	default:
+		return true
+	}
+}
+
+// String returns a description of the selected base snapshot.
+func (s SnapshotSelector) String() string {
+	switch {
+	case len(s.BaseSnapshotName) != 0:
+		return fmt.Sprintf("full snapshot %s", s.BaseSnapshotName)
+	case s.BaseSnapshotRevision != 0:
+		return fmt.Sprintf("full snapshot of revision %d", s.BaseSnapshotRevision)
+	default:
+		return "latest full snapshot"
+	}
+}
+
 // DeepCopyInto copies the structure deeply from in to out.
 func (c *RestorationConfig) DeepCopyInto(out *RestorationConfig) {
 	*out = *c
@@ -138,6 +335,10 @@ func (c *RestorationConfig) DeepCopyInto(out *RestorationConfig) {
 			(*out)[i] = v
 		}
 	}
+	if c.Hooks != nil {
+		out.Hooks = make([]HookConfig, len(c.Hooks))
+		copy(out.Hooks, c.Hooks)
+	}
 }
 
 // DeepCopy returns a deeply copied structure.
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// DefaultGFSKeepLast is the default number of most recent full snapshots kept by the GFS garbage collection policy.
+	DefaultGFSKeepLast = 1
+	// DefaultGFSHourly is the default number of hourly full snapshots kept by the GFS garbage collection policy.
+	DefaultGFSHourly = 24
+	// DefaultGFSDaily is the default number of daily full snapshots kept by the GFS garbage collection policy.
+	DefaultGFSDaily = 7
+	// DefaultGFSWeekly is the default number of weekly full snapshots kept by the GFS garbage collection policy.
+	DefaultGFSWeekly = 4
+)
+
+// GFSRetentionConfig holds the config of the grandfather-father-son (GFS) garbage collection policy.
+// For each of the last Hourly hours, Daily days, Weekly weeks, Monthly months and Yearly years,
+// including the current one, the latest full snapshot taken in it is kept.
+// Weeks start on Monday.
+type GFSRetentionConfig struct {
+	// KeepLast is the number of most recent full snapshots which are kept regardless of their age.
+	KeepLast uint `json:"keepLast,omitempty"`
+	// Hourly is the number of hours for which the latest full snapshot of each hour is kept.
+	Hourly uint `json:"hourly,omitempty"`
+	// Daily is the number of days for which the latest full snapshot of each day is kept.
+	Daily uint `json:"daily,omitempty"`
+	// Weekly is the number of weeks for which the latest full snapshot of each week is kept.
+	Weekly uint `json:"weekly,omitempty"`
+	// Monthly is the number of months for which the latest full snapshot of each month is kept.
+	Monthly uint `json:"monthly,omitempty"`
+	// Yearly is the number of years for which the latest full snapshot of each year is kept.
+	Yearly uint `json:"yearly,omitempty"`
+	// TimeZone is the IANA time zone in which the hours, days, weeks, months and years start,
+	// e.g. "Europe/Berlin". If empty, UTC is used.
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// AddFlags adds the flags to flagset.
+func (c *GFSRetentionConfig) AddFlags(fs *flag.FlagSet) {
+	fs.UintVar(&c.KeepLast, "gfs-keep-last", c.KeepLast, "number of most recent full snapshots kept regardless of their age by the GFS garbage collection policy")
+	fs.UintVar(&c.Hourly, "gfs-hourly", c.Hourly, "number of hours for which the GFS garbage collection policy keeps the latest full snapshot of each hour")
+	fs.UintVar(&c.Daily, "gfs-daily", c.Daily, "number of days for which the GFS garbage collection policy keeps the latest full snapshot of each day")
+	fs.UintVar(&c.Weekly, "gfs-weekly", c.Weekly, "number of weeks for which the GFS garbage collection policy keeps the latest full snapshot of each week")
+	fs.UintVar(&c.Monthly, "gfs-monthly", c.Monthly, "number of months for which the GFS garbage collection policy keeps the latest full snapshot of each month")
+	fs.UintVar(&c.Yearly, "gfs-yearly", c.Yearly, "number of years for which the GFS garbage collection policy keeps the latest full snapshot of each year")
+	fs.StringVar(&c.TimeZone, "gfs-time-zone", c.TimeZone, "IANA time zone in which the hours, days, weeks, months and years of the GFS garbage collection policy start. If not set, UTC is used.")
+}
+
+// Validate validates the config.
+func (c *GFSRetentionConfig) Validate() error {
+	if c.KeepLast == 0 && c.Hourly == 0 && c.Daily == 0 && c.Weekly == 0 && c.Monthly == 0 && c.Yearly == 0 {
+		return fmt.Errorf("at least one of the GFS retention counts should be greater than zero")
+	}
+	if _, err := c.Location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Location returns the location of the configured time zone.
+func (c *GFSRetentionConfig) Location() (*time.Location, error) {
+	if len(c.TimeZone) == 0 {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GFS retention time zone %s: %v", c.TimeZone, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+	"github.com/robfig/cron/v3"
+)
+
+// FullSnapshotScheduleConfig holds the config of a full snapshot schedule.
+type FullSnapshotScheduleConfig struct {
+	// Schedule is the cron schedule at which full snapshots are taken.
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA time zone in which the schedule and its blackout windows are evaluated,
+	// e.g. "Europe/Berlin". If empty, the local time zone is used.
+	TimeZone string `json:"timeZone,omitempty"`
+	// BlackoutWindows are the windows during which the schedule does not take full snapshots.
+	BlackoutWindows []BlackoutWindow `json:"blackoutWindows,omitempty"`
+}
+
+// BlackoutWindow is a recurring window of time.
+type BlackoutWindow struct {
+	// Start is the cron schedule at which the window starts.
+	Start string `json:"start"`
+	// Duration is the duration of the window.
+	Duration wrappers.Duration `json:"duration"`
+}
+
+// ParseCron parses the given cron spec to be evaluated in the time zone of the schedule.
+func (s *FullSnapshotScheduleConfig) ParseCron(spec string) (cron.Schedule, error) {
+	if len(s.TimeZone) == 0 {
+		return cron.ParseStandard(spec)
+	}
+	if strings.HasPrefix(spec, "TZ=") || strings.HasPrefix(spec, "CRON_TZ=") {
+		return nil, fmt.Errorf("cron spec %q should not set a time zone if the time zone %s is configured", spec, s.TimeZone)
+	}
+	return cron.ParseStandard(fmt.Sprintf("CRON_TZ=%s %s", s.TimeZone, spec))
+}
+
+// Validate validates the schedule.
+func (s *FullSnapshotScheduleConfig) Validate() error {
+	if len(s.TimeZone) != 0 {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("invalid time zone %s: %v", s.TimeZone, err)
+		}
+	}
+	if _, err := s.ParseCron(s.Schedule); err != nil {
+		return fmt.Errorf("invalid full snapshot schedule %s: %v", s.Schedule, err)
+	}
+	for _, w := range s.BlackoutWindows {
+		if _, err := s.ParseCron(w.Start); err != nil {
+			return fmt.Errorf("invalid start %s of blackout window: %v", w.Start, err)
+		}
+		if w.Duration.Duration <= 0 {
+			return fmt.Errorf("duration of blackout window starting at %s should be greater than zero", w.Start)
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package types
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
@@ -19,6 +20,12 @@ const (
 	GarbageCollectionPolicyExponential = "Exponential"
 	// GarbageCollectionPolicyLimitBased defines the limit based policy for garbage collecting old backups
 	GarbageCollectionPolicyLimitBased = "LimitBased"
+	// GarbageCollectionPolicyGFS defines the configurable grandfather-father-son policy for garbage collecting old backups
+	GarbageCollectionPolicyGFS = "GFS"
+	// GarbageCollectionPolicyAgeBased defines the policy for garbage collecting full snapshots older than the full snapshot retention period
+	GarbageCollectionPolicyAgeBased = "AgeBased"
+	// GarbageCollectionPolicySizeBased defines the policy for garbage collecting the oldest backups beyond the max backup size
+	GarbageCollectionPolicySizeBased = "SizeBased"
 	// DefaultMaxBackups is default number of maximum backups for limit based garbage collection policy.
 	DefaultMaxBackups = 7
 
@@ -39,6 +46,35 @@ const (
 
 	// DeltaSnapshotIntervalThreshold is interval between delta snapshot
 	DeltaSnapshotIntervalThreshold = time.Second
+
+	// DefaultDeltaSnapshotUploadQueueSize is the default number of sealed delta snapshots that can wait for upload.
+	// Delta snapshots are uploaded synchronously by default.
+	DefaultDeltaSnapshotUploadQueueSize = 0
+	// DefaultMaxParallelDeltaSnapshotUploads is the default number of delta snapshots uploaded in parallel.
+	DefaultMaxParallelDeltaSnapshotUploads = 1
+	// DefaultWatchStallTimeout is the default duration without any response on the etcd watch after which the watch is considered stalled.
+	DefaultWatchStallTimeout = 5 * time.Minute
+
+	// DefaultMinDeltaSnapshotPeriod is the default lower bound of the adaptive delta snapshot period.
+	DefaultMinDeltaSnapshotPeriod = 5 * time.Second
+	// DefaultMaxDeltaSnapshotPeriod is the default upper bound of the adaptive delta snapshot period.
+	DefaultMaxDeltaSnapshotPeriod = 5 * time.Minute
+	// DefaultMinDeltaSnapMemoryLimit is the default lower bound of the adaptive delta snapshot memory limit.
+	DefaultMinDeltaSnapMemoryLimit = 1024 * 1024 //1Mib
+	// DefaultMaxDeltaSnapMemoryLimit is the default upper bound of the adaptive delta snapshot memory limit.
+	DefaultMaxDeltaSnapMemoryLimit = 4 * DefaultDeltaSnapMemoryLimit
+	// DefaultDeltaSnapshotRecoveryPointObjective is the default recovery point objective targeted by the adaptive delta snapshot period.
+	DefaultDeltaSnapshotRecoveryPointObjective = time.Minute
+
+	// FullSnapshotSourceLocal defines the policy to take full snapshots from the configured etcd endpoints.
+	FullSnapshotSourceLocal = "Local"
+	// FullSnapshotSourceFollower defines the policy to take full snapshots from the least loaded, caught up follower.
+	FullSnapshotSourceFollower = "Follower"
+	// FullSnapshotSourceMember defines the policy to take full snapshots from the configured member, if it is caught up.
+	FullSnapshotSourceMember = "Member"
+	// DefaultFullSnapshotSourceMaxRaftLag is the default number of raft entries a member may be behind the leader
+	// to qualify as the source of full snapshots.
+	DefaultFullSnapshotSourceMaxRaftLag = 1000
 )
 
 // SnapshotterState denotes the state the snapshotter would be in.
@@ -53,6 +89,54 @@ type SnapshotterConfig struct {
 	GarbageCollectionPolicy      string            `json:"garbageCollectionPolicy,omitempty"`
 	MaxBackups                   uint              `json:"maxBackups,omitempty"`
 	DeltaSnapshotRetentionPeriod wrappers.Duration `json:"deltaSnapshotRetentionPeriod,omitempty"`
+	// DeltaSnapshotUploadQueueSize is the number of sealed delta snapshots which can wait for upload
+	// without blocking the etcd watch. Setting it to 0 uploads delta snapshots synchronously.
+	DeltaSnapshotUploadQueueSize uint `json:"deltaSnapshotUploadQueueSize,omitempty"`
+	// MaxParallelDeltaSnapshotUploads is the maximum number of delta snapshots uploaded in parallel.
+	MaxParallelDeltaSnapshotUploads uint `json:"maxParallelDeltaSnapshotUploads,omitempty"`
+	// WatchStallTimeout is the duration without any response on the etcd watch, despite requested
+	// progress notifications, after which the watch is considered stalled and re-established.
+	// Setting it to 0 disables the stall detection.
+	WatchStallTimeout wrappers.Duration `json:"watchStallTimeout,omitempty"`
+	// IncludeKeyPrefixes are the key prefixes recorded in the delta snapshots. If empty, all keys are recorded.
+	IncludeKeyPrefixes []string `json:"includeKeyPrefixes,omitempty"`
+	// ExcludeKeyPrefixes are the key prefixes which are not recorded in the delta snapshots.
+	ExcludeKeyPrefixes []string `json:"excludeKeyPrefixes,omitempty"`
+	// FullSnapshotSchedules are the schedules at which full snapshots are taken. If set, they replace
+	// the FullSnapshotSchedule and a full snapshot is taken whenever any of them is due.
+	FullSnapshotSchedules []FullSnapshotScheduleConfig `json:"fullSnapshotSchedules,omitempty"`
+	// AdaptiveDeltaSnapshotPeriod enables adjusting the delta snapshot period and memory limit within their bounds,
+	// based on the observed event rate and upload latency, to meet the DeltaSnapshotRecoveryPointObjective.
+	// The DeltaSnapshotPeriod and DeltaSnapshotMemoryLimit are used as the initial values.
+	AdaptiveDeltaSnapshotPeriod bool `json:"adaptiveDeltaSnapshotPeriod,omitempty"`
+	// MinDeltaSnapshotPeriod is the lower bound of the adaptive delta snapshot period.
+	MinDeltaSnapshotPeriod wrappers.Duration `json:"minDeltaSnapshotPeriod,omitempty"`
+	// MaxDeltaSnapshotPeriod is the upper bound of the adaptive delta snapshot period.
+	MaxDeltaSnapshotPeriod wrappers.Duration `json:"maxDeltaSnapshotPeriod,omitempty"`
+	// MinDeltaSnapshotMemoryLimit is the lower bound of the adaptive delta snapshot memory limit.
+	MinDeltaSnapshotMemoryLimit uint `json:"minDeltaSnapshotMemoryLimit,omitempty"`
+	// MaxDeltaSnapshotMemoryLimit is the upper bound of the adaptive delta snapshot memory limit.
+	MaxDeltaSnapshotMemoryLimit uint `json:"maxDeltaSnapshotMemoryLimit,omitempty"`
+	// DeltaSnapshotRecoveryPointObjective is the maximum age of the etcd writes which are not yet persisted in
+	// an uploaded snapshot, which is targeted by the adaptive delta snapshot period.
+	DeltaSnapshotRecoveryPointObjective wrappers.Duration `json:"deltaSnapshotRecoveryPointObjective,omitempty"`
+	// Hooks are run around full snapshots, delta snapshots and the deletion of snapshots by the garbage collector.
+	Hooks []HookConfig `json:"hooks,omitempty"`
+	// FullSnapshotSourcePolicy is the policy for choosing the etcd member from which full snapshots are taken.
+	// The leader is used if no member qualifies for the Follower or Member policy.
+	FullSnapshotSourcePolicy string `json:"fullSnapshotSourcePolicy,omitempty"`
+	// FullSnapshotSourceMember is the name of the etcd member from which full snapshots are taken with the Member policy.
+	FullSnapshotSourceMember string `json:"fullSnapshotSourceMember,omitempty"`
+	// FullSnapshotSourceMaxRaftLag is the number of raft entries a member may be behind the leader
+	// to qualify as the source of full snapshots.
+	FullSnapshotSourceMaxRaftLag uint64 `json:"fullSnapshotSourceMaxRaftLag,omitempty"`
+	// GFSRetention is the config of the GFS garbage collection policy.
+	GFSRetention GFSRetentionConfig `json:"gfsRetention,omitempty"`
+	// FullSnapshotRetentionPeriod is the age beyond which full snapshots are garbage collected by the AgeBased policy.
+	FullSnapshotRetentionPeriod wrappers.Duration `json:"fullSnapshotRetentionPeriod,omitempty"`
+	// MaxBackupSize is the total size of the backups in bytes beyond which the oldest full snapshots
+	// are garbage collected by the SizeBased policy.
+	MaxBackupSize uint64 `json:"maxBackupSize,omitempty"`
 }
 
 // AddFlags adds the flags to flagset.
@@ -61,21 +145,47 @@ func (c *SnapshotterConfig) AddFlags(fs *flag.FlagSet) {
 	fs.DurationVar(&c.DeltaSnapshotPeriod.Duration, "delta-snapshot-period", c.DeltaSnapshotPeriod.Duration, "Period after which delta snapshot will be persisted. If this value is set to be lesser than 1, delta snapshotting will be disabled.")
 	fs.UintVar(&c.DeltaSnapshotMemoryLimit, "delta-snapshot-memory-limit", c.DeltaSnapshotMemoryLimit, "memory limit after which delta snapshots will be taken")
 	fs.DurationVar(&c.GarbageCollectionPeriod.Duration, "garbage-collection-period", c.GarbageCollectionPeriod.Duration, "Period for garbage collecting old backups")
-	fs.StringVar(&c.GarbageCollectionPolicy, "garbage-collection-policy", c.GarbageCollectionPolicy, "Policy for garbage collecting old backups")
+	fs.UintVar(&c.DeltaSnapshotUploadQueueSize, "delta-snapshot-upload-queue-size", c.DeltaSnapshotUploadQueueSize, "number of sealed delta snapshots which can wait for upload without blocking the etcd watch. If set to 0, delta snapshots are uploaded synchronously.")
+	fs.UintVar(&c.MaxParallelDeltaSnapshotUploads, "max-parallel-delta-snapshot-uploads", c.MaxParallelDeltaSnapshotUploads, "maximum number of delta snapshots uploaded in parallel")
+	fs.DurationVar(&c.WatchStallTimeout.Duration, "watch-stall-timeout", c.WatchStallTimeout.Duration, "duration without any response on the etcd watch after which the watch is considered stalled and re-established. If set to 0, stall detection is disabled.")
+	fs.StringSliceVar(&c.IncludeKeyPrefixes, "include-key-prefixes", c.IncludeKeyPrefixes, "key prefixes recorded in the delta snapshots. If not set, all keys are recorded.")
+	fs.StringSliceVar(&c.ExcludeKeyPrefixes, "exclude-key-prefixes", c.ExcludeKeyPrefixes, "key prefixes not recorded in the delta snapshots")
+	fs.BoolVar(&c.AdaptiveDeltaSnapshotPeriod, "adaptive-delta-snapshot-period", c.AdaptiveDeltaSnapshotPeriod, "adjust the delta snapshot period and memory limit within their bounds, based on the observed event rate and upload latency, to meet the delta snapshot recovery point objective")
+	fs.DurationVar(&c.MinDeltaSnapshotPeriod.Duration, "min-delta-snapshot-period", c.MinDeltaSnapshotPeriod.Duration, "lower bound of the adaptive delta snapshot period")
+	fs.DurationVar(&c.MaxDeltaSnapshotPeriod.Duration, "max-delta-snapshot-period", c.MaxDeltaSnapshotPeriod.Duration, "upper bound of the adaptive delta snapshot period")
+	fs.UintVar(&c.MinDeltaSnapshotMemoryLimit, "min-delta-snapshot-memory-limit", c.MinDeltaSnapshotMemoryLimit, "lower bound of the adaptive delta snapshot memory limit")
+	fs.UintVar(&c.MaxDeltaSnapshotMemoryLimit, "max-delta-snapshot-memory-limit", c.MaxDeltaSnapshotMemoryLimit, "upper bound of the adaptive delta snapshot memory limit")
+	fs.DurationVar(&c.DeltaSnapshotRecoveryPointObjective.Duration, "delta-snapshot-recovery-point-objective", c.DeltaSnapshotRecoveryPointObjective.Duration, "maximum age of the etcd writes not yet persisted in an uploaded snapshot, targeted by the adaptive delta snapshot period")
+	fs.StringVar(&c.FullSnapshotSourcePolicy, "full-snapshot-source-policy", c.FullSnapshotSourcePolicy, "policy for choosing the etcd member from which full snapshots are taken: Local, Follower or Member")
+	fs.StringVar(&c.FullSnapshotSourceMember, "full-snapshot-source-member", c.FullSnapshotSourceMember, "name of the etcd member from which full snapshots are taken with the Member full snapshot source policy")
+	fs.Uint64Var(&c.FullSnapshotSourceMaxRaftLag, "full-snapshot-source-max-raft-lag", c.FullSnapshotSourceMaxRaftLag, "number of raft entries an etcd member may be behind the leader to qualify as the source of full snapshots")
+	c.AddGarbageCollectionFlags(fs)
+}
+
+// AddGarbageCollectionFlags adds the flags of the garbage collection policies to flagset.
+func (c *SnapshotterConfig) AddGarbageCollectionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.GarbageCollectionPolicy, "garbage-collection-policy", c.GarbageCollectionPolicy, "Policy for garbage collecting old backups: Exponential, LimitBased, GFS, AgeBased or SizeBased. Several policies can be combined separated by commas.")
 	fs.UintVarP(&c.MaxBackups, "max-backups", "m", c.MaxBackups, "maximum number of previous backups to keep")
 	fs.DurationVar(&c.DeltaSnapshotRetentionPeriod.Duration, "delta-snapshot-retention-period", c.DeltaSnapshotRetentionPeriod.Duration, "Defines the retention period for older delta snapshots, excluding the latest snapshot set which is always retained for data safety.")
+	c.GFSRetention.AddFlags(fs)
+	fs.DurationVar(&c.FullSnapshotRetentionPeriod.Duration, "full-snapshot-retention-period", c.FullSnapshotRetentionPeriod.Duration, "age beyond which full snapshots are garbage collected by the AgeBased garbage collection policy, except the latest full snapshot")
+	fs.Uint64Var(&c.MaxBackupSize, "max-backup-size", c.MaxBackupSize, "total size of the backups in bytes beyond which the oldest full snapshots, except the latest one, are garbage collected by the SizeBased garbage collection policy")
 }
 
 // Validate validates the config.
 func (c *SnapshotterConfig) Validate() error {
-	if _, err := cron.ParseStandard(c.FullSnapshotSchedule); err != nil {
-		return err
+	if len(c.FullSnapshotSchedules) == 0 {
+		if _, err := cron.ParseStandard(c.FullSnapshotSchedule); err != nil {
+			return err
+		}
 	}
-	if c.GarbageCollectionPolicy != GarbageCollectionPolicyLimitBased && c.GarbageCollectionPolicy != GarbageCollectionPolicyExponential {
-		return fmt.Errorf("invalid garbage collection policy: %s", c.GarbageCollectionPolicy)
+	for i := range c.FullSnapshotSchedules {
+		if err := c.FullSnapshotSchedules[i].Validate(); err != nil {
+			return err
+		}
 	}
-	if c.GarbageCollectionPolicy == GarbageCollectionPolicyLimitBased && c.MaxBackups <= 0 {
-		return fmt.Errorf("max backups should be greather than zero for garbage collection policy set to limit based")
+	if err := c.validateGarbageCollectionPolicies(); err != nil {
+		return err
 	}
 
 	if c.DeltaSnapshotPeriod.Duration < DeltaSnapshotIntervalThreshold {
@@ -86,5 +196,120 @@ func (c *SnapshotterConfig) Validate() error {
 		logrus.Infof("Found delta snapshot memory limit %d bytes less than 1 byte. Setting it to default: %d ", c.DeltaSnapshotMemoryLimit, DefaultDeltaSnapMemoryLimit)
 		c.DeltaSnapshotMemoryLimit = DefaultDeltaSnapMemoryLimit
 	}
+
+	if c.DeltaSnapshotUploadQueueSize > 0 && c.MaxParallelDeltaSnapshotUploads < 1 {
+		logrus.Infof("Found max parallel delta snapshot uploads %d less than 1. Setting it to default: %d ", c.MaxParallelDeltaSnapshotUploads, DefaultMaxParallelDeltaSnapshotUploads)
+		c.MaxParallelDeltaSnapshotUploads = DefaultMaxParallelDeltaSnapshotUploads
+	}
+
+	if c.WatchStallTimeout.Duration < 0 {
+		return fmt.Errorf("watch stall timeout should not be negative")
+	}
+
+	if c.AdaptiveDeltaSnapshotPeriod {
+		if c.MinDeltaSnapshotPeriod.Duration < DeltaSnapshotIntervalThreshold {
+			return fmt.Errorf("min delta snapshot period should not be less than %v", DeltaSnapshotIntervalThreshold)
+		}
+		if c.MaxDeltaSnapshotPeriod.Duration < c.MinDeltaSnapshotPeriod.Duration {
+			return fmt.Errorf("max delta snapshot period should not be less than min delta snapshot period")
+		}
+		if c.MinDeltaSnapshotMemoryLimit < 1 {
+			return fmt.Errorf("min delta snapshot memory limit should be greater than zero")
+		}
+		if c.MaxDeltaSnapshotMemoryLimit < c.MinDeltaSnapshotMemoryLimit {
+			return fmt.Errorf("max delta snapshot memory limit should not be less than min delta snapshot memory limit")
+		}
+		if c.DeltaSnapshotRecoveryPointObjective.Duration < DeltaSnapshotIntervalThreshold {
+			return fmt.Errorf("delta snapshot recovery point objective should not be less than %v", DeltaSnapshotIntervalThreshold)
+		}
+	}
+	switch c.FullSnapshotSourcePolicy {
+	case "", FullSnapshotSourceLocal, FullSnapshotSourceFollower:
+	case FullSnapshotSourceMember:
+		if len(c.FullSnapshotSourceMember) == 0 {
+			return fmt.Errorf("full snapshot source member should be set for full snapshot source policy %s", FullSnapshotSourceMember)
+		}
+	default:
+		return fmt.Errorf("invalid full snapshot source policy: %s", c.FullSnapshotSourcePolicy)
+	}
+	for i := range c.Hooks {
+		if err := c.Hooks[i].Validate(SnapshotterHookStages); err != nil {
+			return err
+		}
+	}
+	return c.KeyFilter().Validate()
+}
+
+func (c *SnapshotterConfig) validateGarbageCollectionPolicies() error {
+	policies := c.GarbageCollectionPolicies()
+	if len(policies) == 0 {
+		return fmt.Errorf("invalid garbage collection policy: %s", c.GarbageCollectionPolicy)
+	}
+	seen := make(map[string]bool)
+	for _, policy := range policies {
+		if seen[policy] {
+			return fmt.Errorf("duplicate garbage collection policy: %s", policy)
+		}
+		seen[policy] = true
+		switch policy {
+		case GarbageCollectionPolicyExponential:
+		case GarbageCollectionPolicyLimitBased:
+			if c.MaxBackups <= 0 {
+				return fmt.Errorf("max backups should be greather than zero for garbage collection policy set to limit based")
+			}
+		case GarbageCollectionPolicyGFS:
+			if err := c.GFSRetention.Validate(); err != nil {
+				return err
+			}
+		case GarbageCollectionPolicyAgeBased:
+			if c.FullSnapshotRetentionPeriod.Duration <= 0 {
+				return fmt.Errorf("full snapshot retention period should be greater than zero for garbage collection policy set to age based")
+			}
+		case GarbageCollectionPolicySizeBased:
+			if c.MaxBackupSize == 0 {
+				return fmt.Errorf("max backup size should be greater than zero for garbage collection policy set to size based")
+			}
+		default:
+			return fmt.Errorf("invalid garbage collection policy: %s", policy)
+		}
+	}
 	return nil
 }
+
+// GarbageCollectionPolicies returns the configured garbage collection policies.
+func (c *SnapshotterConfig) GarbageCollectionPolicies() []string {
+	var policies []string
+	for _, policy := range strings.Split(c.GarbageCollectionPolicy, ",") {
+		if policy = strings.TrimSpace(policy); len(policy) != 0 {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+// HasGarbageCollectionPolicy returns whether the given garbage collection policy is configured.
+func (c *SnapshotterConfig) HasGarbageCollectionPolicy(policy string) bool {
+	for _, p := range c.GarbageCollectionPolicies() {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyFilter returns the filter for the keys recorded in the delta snapshots, or nil if all keys are recorded.
+func (c *SnapshotterConfig) KeyFilter() *KeyPrefixFilter {
+	filter := &KeyPrefixFilter{Include: c.IncludeKeyPrefixes, Exclude: c.ExcludeKeyPrefixes}
+	if filter.IsEmpty() {
+		return nil
+	}
+	return filter
+}
+
+// GetFullSnapshotSchedules returns the schedules at which full snapshots are taken.
+func (c *SnapshotterConfig) GetFullSnapshotSchedules() []FullSnapshotScheduleConfig {
+	if len(c.FullSnapshotSchedules) != 0 {
+		return c.FullSnapshotSchedules
+	}
+	return []FullSnapshotScheduleConfig{{Schedule: c.FullSnapshotSchedule}}
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gardener/etcd-backup-restore/pkg/wrappers"
+
 	flag "github.com/spf13/pflag"
 )
 
@@ -52,6 +54,27 @@ const (
 	// Refer to this github issue for more details: https://github.com/fsouza/fake-gcs-server/issues/1434
 	ChunkDirSuffix = ".chunk"
 
+	// SnapshotMetadataSuffix is the suffix appended to the name of a snapshot to name its metadata object.
+	SnapshotMetadataSuffix = ".meta"
+	// SnapshotPinSuffix is the suffix appended to the name of a snapshot to name its pin object.
+	SnapshotPinSuffix = ".pin"
+
+	// DeduplicationChunkDir is the directory under the snapstore prefix holding the chunks of deduplicated snapshots.
+	DeduplicationChunkDir = "chunks"
+	// DeduplicationChunkSuffix is the suffix appended to the hash of a chunk of deduplicated snapshots to name its object.
+	DeduplicationChunkSuffix = ".dedup"
+	// DefaultDeduplicationChunkSize is the default average size of the chunks of deduplicated snapshots.
+	DefaultDeduplicationChunkSize int64 = 1 << 20 //1 MiB
+	// MinDeduplicationChunkSize is the minimum average size of the chunks of deduplicated snapshots.
+	MinDeduplicationChunkSize int64 = 64 * (1 << 10) //64 KiB
+	// MaxDeduplicationChunkSize is the maximum average size of the chunks of deduplicated snapshots.
+	MaxDeduplicationChunkSize int64 = 64 * (1 << 20) //64 MiB
+	// DefaultDeduplicationChunkGracePeriod is the default period for which chunks of deduplicated snapshots are kept
+	// after the last snapshot referring to them was deleted.
+	DefaultDeduplicationChunkGracePeriod = 24 * time.Hour
+	// DefaultMaxParallelChunkDownloads is the default number of chunks of a deduplicated snapshot fetched in parallel.
+	DefaultMaxParallelChunkDownloads = 5
+
 	backupFormatVersion = "v2"
 
 	// MinChunkSize is set to 5Mib since it is lower chunk size limit for AWS.
@@ -85,6 +108,86 @@ type Snapshot struct {
 	Prefix            string    `json:"prefix"`            // Points to correct prefix of a snapshot in snapstore (Required for Backward Compatibility)
 	CompressionSuffix string    `json:"compressionSuffix"` // CompressionSuffix depends on compessionPolicy
 	IsFinal           bool      `json:"isFinal"`
+	HasMetadata       bool      `json:"hasMetadata,omitempty"` // HasMetadata is set if a metadata object is stored alongside the snapshot
+	Size              int64     `json:"size,omitempty"`        // Size is the size of the snapshot in the snapstore in bytes, as found when listing the snapstore
+	IsPinned          bool      `json:"isPinned,omitempty"`    // IsPinned is set if a pin object is stored alongside the snapshot
+}
+
+// SnapshotPin protects a snapshot from garbage collection. It is stored in the snapstore alongside the snapshot.
+type SnapshotPin struct {
+	// Reason describes why the snapshot is pinned.
+	Reason string `json:"reason,omitempty"`
+	// CreatedOn is the time at which the snapshot was pinned.
+	CreatedOn time.Time `json:"createdOn"`
+	// ExpiresOn is the time after which the snapshot is no longer protected. If not set, the pin never expires.
+	ExpiresOn *time.Time `json:"expiresOn,omitempty"`
+}
+
+// PinnedSnapshot is a snapshot along with its pin.
+type PinnedSnapshot struct {
+	// Snapshot is the pinned snapshot.
+	Snapshot *Snapshot `json:"snapshot"`
+	// Pin is the pin of the snapshot.
+	Pin *SnapshotPin `json:"pin"`
+}
+
+// NewSnapshotPin returns a pin created at the given time with the given reason, which expires after the given ttl.
+// If the ttl is 0, the pin never expires.
+func NewSnapshotPin(reason string, ttl time.Duration, now time.Time) *SnapshotPin {
+	pin := &SnapshotPin{
+		Reason:    reason,
+		CreatedOn: now.UTC(),
+	}
+	if ttl > 0 {
+		expiresOn := pin.CreatedOn.Add(ttl)
+		pin.ExpiresOn = &expiresOn
+	}
+	return pin
+}
+
+// IsActive returns true if the pin protects the snapshot at the given time.
+func (p *SnapshotPin) IsActive(now time.Time) bool {
+	return p != nil && (p.ExpiresOn == nil || now.Before(*p.ExpiresOn))
+}
+
+// String returns a description of the pin.
+func (p *SnapshotPin) String() string {
+	description := "pinned"
+	if len(p.Reason) != 0 {
+		description += fmt.Sprintf(" (%s)", p.Reason)
+	}
+	if p.ExpiresOn != nil {
+		return fmt.Sprintf("%s until %s", description, p.ExpiresOn.UTC().Format(time.RFC3339))
+	}
+	return description + " indefinitely"
+}
+
+// SnapshotMetadata holds the additional information about a snapshot, which is stored
+// in the snapstore alongside the snapshot.
+type SnapshotMetadata struct {
+	// KeyFilter is the filter for the keys recorded in the snapshot. If set, the snapshot is partial.
+	KeyFilter *KeyPrefixFilter `json:"keyFilter,omitempty"`
+	// SourceMember is the etcd member from which a full snapshot was taken, if it was chosen by a full snapshot source policy.
+	SourceMember *SnapshotSourceMember `json:"sourceMember,omitempty"`
+}
+
+// SnapshotSourceMember is the etcd member from which a full snapshot is taken.
+type SnapshotSourceMember struct {
+	// Name is the name of the etcd member.
+	Name string `json:"name"`
+	// ID is the hexadecimal ID of the etcd member.
+	ID string `json:"id"`
+	// Endpoint is the client URL of the etcd member the snapshot is taken from.
+	Endpoint string `json:"endpoint"`
+	// IsLeader is set if the etcd member was the leader when it was chosen.
+	IsLeader bool `json:"isLeader"`
+	// RaftIndex is the applied raft index of the etcd member when it was chosen.
+	RaftIndex uint64 `json:"raftIndex"`
+}
+
+// IsPartial returns true if the snapshot does not contain all the keys.
+func (m *SnapshotMetadata) IsPartial() bool {
+	return m != nil && !m.KeyFilter.IsEmpty()
 }
 
 // GenerateSnapshotName prepares the snapshot name from metadata
@@ -171,6 +274,16 @@ type SnapstoreConfig struct {
 	TempDir string `json:"tempDir,omitempty"`
 	// IsSource determines if this SnapStore is the source for a copy operation
 	IsSource bool `json:"isSource,omitempty"`
+	// Deduplication enables storing the full snapshots as content-defined chunks, which are stored once and shared
+	// between the snapshots, along with a manifest per snapshot listing its chunks.
+	Deduplication bool `json:"deduplication,omitempty"`
+	// DeduplicationChunkSize is the average size of the chunks of deduplicated snapshots. It must be a power of two.
+	DeduplicationChunkSize int64 `json:"deduplicationChunkSize,omitempty"`
+	// MaxParallelChunkDownloads is the maximum number of chunks of a deduplicated snapshot fetched in parallel.
+	MaxParallelChunkDownloads uint `json:"maxParallelChunkDownloads,omitempty"`
+	// DeduplicationChunkGracePeriod is the period for which the chunks of deduplicated snapshots are kept after the
+	// last snapshot referring to them was deleted. It must be longer than it takes to save any full snapshot.
+	DeduplicationChunkGracePeriod wrappers.Duration `json:"deduplicationChunkGracePeriod,omitempty"`
 }
 
 // AddFlags adds the flags to flagset.
@@ -189,7 +302,11 @@ func (c *SnapstoreConfig) addFlags(fs *flag.FlagSet, parameterPrefix string) {
 	fs.StringVar(&c.Prefix, parameterPrefix+"store-prefix", c.Prefix, "prefix or directory inside container under which snapstore is created")
 	fs.UintVar(&c.MaxParallelChunkUploads, parameterPrefix+"max-parallel-chunk-uploads", c.MaxParallelChunkUploads, "maximum number of parallel chunk uploads allowed")
 	fs.Int64Var(&c.MinChunkSize, parameterPrefix+"min-chunk-size", c.MinChunkSize, "Minimum size for multipart chunk upload")
-	fs.StringVar(&c.TempDir, parameterPrefix+"snapstore-temp-directory", c.TempDir, "temporary directory for processing")
+	fs.StringVar(&c.TempDir, parameterPrefix+"snapstore-temp-directory", c.TempDir, "temporary directory for processing, which needs as much free space as the etcd database takes, since full snapshots are spooled to it before they are uploaded")
+	fs.BoolVar(&c.Deduplication, parameterPrefix+"deduplicate-full-snapshots", c.Deduplication, "store full snapshots as content-defined chunks, which are stored once and shared between the snapshots")
+	fs.Int64Var(&c.DeduplicationChunkSize, parameterPrefix+"deduplication-chunk-size", c.DeduplicationChunkSize, "average size of the chunks of deduplicated full snapshots, which must be a power of two")
+	fs.UintVar(&c.MaxParallelChunkDownloads, parameterPrefix+"max-parallel-chunk-downloads", c.MaxParallelChunkDownloads, "maximum number of chunks of a deduplicated full snapshot fetched in parallel")
+	fs.DurationVar(&c.DeduplicationChunkGracePeriod.Duration, parameterPrefix+"deduplication-chunk-grace-period", c.DeduplicationChunkGracePeriod.Duration, "period for which the chunks of deduplicated full snapshots are kept after the last snapshot referring to them was deleted, which must be longer than it takes to save any full snapshot")
 }
 
 // Validate validates the config.
@@ -200,6 +317,20 @@ func (c *SnapstoreConfig) Validate() error {
 	if c.MinChunkSize < MinChunkSize {
 		return fmt.Errorf("min chunk size for multi-part chunk upload should be greater than or equal to 5 MiB")
 	}
+	if c.Deduplication {
+		if c.DeduplicationChunkSize < MinDeduplicationChunkSize || c.DeduplicationChunkSize > MaxDeduplicationChunkSize {
+			return fmt.Errorf("deduplication chunk size should be between 64 KiB and 64 MiB")
+		}
+		if c.DeduplicationChunkSize&(c.DeduplicationChunkSize-1) != 0 {
+			return fmt.Errorf("deduplication chunk size should be a power of two")
+		}
+		if c.MaxParallelChunkDownloads <= 0 {
+			return fmt.Errorf("max parallel chunk downloads should be greater than zero")
+		}
+		if c.DeduplicationChunkGracePeriod.Duration <= 0 {
+			return fmt.Errorf("deduplication chunk grace period should be greater than zero")
+		}
+	}
 	return nil
 }
 